@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Catzkorn/subscrypt/internal/fakebank"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	historyPath := flag.String("history", "", "JSON file of the transaction history to serve, defaults to a year of subscriptions")
+	flag.Parse()
+
+	history := fakebank.DefaultHistory
+	if *historyPath != "" {
+		var err error
+		history, err = fakebank.LoadHistory(*historyPath)
+		if err != nil {
+			log.Fatalf("failed to load history: %v", err)
+		}
+	}
+
+	log.Printf("fake bank listening on %s, run subscrypt with PLAID_BASE_URL set to it, CLIENT_ID=%s and SECRET=%s", *addr, fakebank.ClientID, fakebank.Secret)
+	err := http.ListenAndServe(*addr, fakebank.New(history, time.Now()))
+	if err != nil {
+		log.Fatalf("could not listen on %s %v", *addr, err)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/Catzkorn/subscrypt/internal/fakeidp"
+)
+
+func main() {
+	addr := flag.String("addr", ":8081", "address to listen on")
+	issuer := flag.String("issuer", "http://localhost:8081", "issuer URL the identity provider is reached at")
+	subject := flag.String("subject", fakeidp.DefaultUser.Subject, "subject of the user who signs in")
+	email := flag.String("email", fakeidp.DefaultUser.Email, "email of the user who signs in")
+	name := flag.String("name", fakeidp.DefaultUser.Name, "name of the user who signs in")
+	flag.Parse()
+
+	idp, err := fakeidp.New(*issuer, fakeidp.User{Subject: *subject, Email: *email, Name: *name})
+	if err != nil {
+		log.Fatalf("failed to create identity provider: %v", err)
+	}
+
+	log.Printf("fake identity provider listening on %s, run subscrypt with OIDC_ISSUER_URL=%s, OIDC_CLIENT_ID=%s and OIDC_CLIENT_SECRET=%s", *addr, *issuer, fakeidp.ClientID, fakeidp.ClientSecret)
+	err = http.ListenAndServe(*addr, idp)
+	if err != nil {
+		log.Fatalf("could not listen on %s %v", *addr, err)
+	}
+}
@@ -1,13 +1,20 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/Catzkorn/subscrypt/internal/plaid"
 
+	"github.com/Catzkorn/subscrypt/internal/catalogue"
 	"github.com/Catzkorn/subscrypt/internal/database"
+	"github.com/Catzkorn/subscrypt/internal/oidc"
+	"github.com/Catzkorn/subscrypt/internal/renewal"
+	"github.com/Catzkorn/subscrypt/internal/secret"
 	"github.com/Catzkorn/subscrypt/internal/server"
 	"github.com/sendgrid/sendgrid-go"
 )
@@ -19,15 +26,97 @@ func main() {
 		log.Fatalf("failed to create database connection: %v", err)
 	}
 
+	go renewal.Schedule(context.Background(), database, time.Hour)
+
+	cataloguePath := os.Getenv("MERCHANT_CATALOGUE")
+	if cataloguePath == "" {
+		cataloguePath = "data/merchants.json"
+	}
+	merchants, err := catalogue.Load(cataloguePath, os.Getenv("MERCHANT_CATALOGUE_OVERRIDES"))
+	if err != nil {
+		log.Fatalf("failed to load merchant catalogue: %v", err)
+	}
+
 	client := sendgrid.NewSendClient(os.Getenv("SENDGRID_API_KEY"))
-	transactionsAPI := &plaid.PlaidAPI{}
+	plaidURL := os.Getenv("PLAID_BASE_URL")
+	if plaidURL == "" {
+		plaidURL, err = plaid.EnvironmentURL(os.Getenv("PLAID_ENV"))
+		if err != nil {
+			log.Fatalf("failed to configure plaid: %v", err)
+		}
+	}
+	lookbackDays := plaid.DefaultLookbackDays
+	if days := os.Getenv("PLAID_LOOKBACK_DAYS"); days != "" {
+		lookbackDays, err = strconv.Atoi(days)
+		if err != nil {
+			log.Fatalf("failed to configure plaid: PLAID_LOOKBACK_DAYS must be a number of days: %v", err)
+		}
+	}
+	plaidConfig := plaid.Config{
+		BaseURL:       plaidURL,
+		ClientID:      os.Getenv("CLIENT_ID"),
+		Secret:        os.Getenv("SECRET"),
+		InstitutionID: os.Getenv("PLAID_INSTITUTION_ID"),
+		LookbackDays:  lookbackDays,
+		HTTPClient:    &http.Client{Timeout: plaid.DefaultTimeout},
+		Webhook:       os.Getenv("PLAID_WEBHOOK_URL"),
+	}
+	if key := os.Getenv("ACCESS_TOKEN_KEY"); key != "" {
+		tokenKey, err := secret.ParseKey(key)
+		if err != nil {
+			log.Fatalf("failed to configure plaid: ACCESS_TOKEN_KEY %v", err)
+		}
+		plaidConfig.TokenCipher, err = secret.NewCipher(tokenKey)
+		if err != nil {
+			log.Fatalf("failed to configure plaid: %v", err)
+		}
+		plaidConfig.Items = database
+	} else {
+		log.Printf("ACCESS_TOKEN_KEY is not set, linked banks will not be stored")
+	}
+	transactionsAPI := plaid.NewPlaidAPI(plaidConfig)
+
+	sources := server.NewSources()
+	err = sources.Register(plaid.DefaultSource, transactionsAPI)
+	if err != nil {
+		log.Fatalf("failed to register transaction sources: %v", err)
+	}
+	err = registerSources(sources, os.Getenv("TRANSACTION_SOURCES"), plaidConfig)
+	if err != nil {
+		log.Fatalf("failed to register transaction sources: %v", err)
+	}
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "5000"
 	}
 
-	server := server.NewServer(database, client, transactionsAPI)
+	options := []server.Option{
+		server.WithCatalogue(merchants),
+		server.WithAdminToken(os.Getenv("ADMIN_TOKEN")),
+		server.WithPlaidWebhooks(transactionsAPI),
+	}
+	if issuer := os.Getenv("OIDC_ISSUER_URL"); issuer != "" {
+		redirectURL := os.Getenv("OIDC_REDIRECT_URL")
+		if redirectURL == "" {
+			redirectURL = "http://localhost:" + port + "/api/sso/callback"
+		}
+		provider, err := oidc.NewProvider(context.Background(), oidc.Config{
+			IssuerURL:    issuer,
+			ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  redirectURL,
+		})
+		if err != nil {
+			log.Fatalf("failed to configure single sign on: %v", err)
+		}
+		options = append(options, server.WithSingleSignOn(provider))
+		if os.Getenv("PASSWORD_LOGIN") == "false" {
+			options = append(options, server.WithoutPasswordLogin())
+		}
+	}
+
+	server := server.NewServer(database, client, sources, options...)
 	err = http.ListenAndServe(":"+port, server)
 	if err != nil {
 		log.Fatalf("could not listen on port 5000 %v", err)
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Catzkorn/subscrypt/internal/fakebank"
+	"github.com/Catzkorn/subscrypt/internal/plaid"
+	"github.com/Catzkorn/subscrypt/internal/server"
+	"github.com/Catzkorn/subscrypt/internal/statement"
+)
+
+// sourceConfig is the configuration of a transaction source in TRANSACTION_SOURCES.
+// Plaid sources share the Plaid credentials and linked bank storage, and each links its own institution.
+// Statement sources read a statement file on disk, in the given format, every time they are imported.
+// Fake sources link banks at an in-process fake bank, serving the history in the JSON file at Path or a default one.
+type sourceConfig struct {
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	InstitutionID string `json:"institutionId"`
+	LookbackDays  int    `json:"lookbackDays"`
+	Path          string `json:"path"`
+	Format        string `json:"format"`
+	Bank          string `json:"bank"`
+}
+
+// registerSources registers the transaction sources configured by a JSON list of source configurations
+func registerSources(sources *server.Sources, config string, plaidConfig plaid.Config) error {
+	if config == "" {
+		return nil
+	}
+
+	var configs []sourceConfig
+	err := json.Unmarshal([]byte(config), &configs)
+	if err != nil {
+		return fmt.Errorf("unable to read TRANSACTION_SOURCES: %w", err)
+	}
+
+	for _, source := range configs {
+		api, err := newSource(source, plaidConfig)
+		if err != nil {
+			return fmt.Errorf("source %q: %w", source.Name, err)
+		}
+		err = sources.Register(source.Name, api)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newSource returns the transaction API of a configured source
+func newSource(source sourceConfig, plaidConfig plaid.Config) (server.TransactionAPI, error) {
+	switch source.Type {
+	case "plaid":
+		plaidConfig.Source = source.Name
+		if source.InstitutionID != "" {
+			plaidConfig.InstitutionID = source.InstitutionID
+		}
+		if source.LookbackDays != 0 {
+			plaidConfig.LookbackDays = source.LookbackDays
+		}
+		return plaid.NewPlaidAPI(plaidConfig), nil
+	case "fake":
+		history := fakebank.DefaultHistory
+		if source.Path != "" {
+			var err error
+			history, err = fakebank.LoadHistory(source.Path)
+			if err != nil {
+				return nil, err
+			}
+		}
+		fakeConfig := fakebank.New(history, time.Now()).Config()
+		fakeConfig.Source = source.Name
+		fakeConfig.LookbackDays = source.LookbackDays
+		fakeConfig.Items = plaidConfig.Items
+		fakeConfig.TokenCipher = plaidConfig.TokenCipher
+		return plaid.NewPlaidAPI(fakeConfig), nil
+	case "statement":
+		parse, err := statementParser(source.Format, source.Bank)
+		if err != nil {
+			return nil, err
+		}
+		return statement.File{Path: source.Path, Parse: parse}, nil
+	default:
+		return nil, fmt.Errorf("unknown source type %q, expected plaid, statement or fake", source.Type)
+	}
+}
+
+// statementParser returns the parser of a statement format, using the bank's preset mapping for CSV statements
+func statementParser(format string, bank string) (statement.Parser, error) {
+	switch format {
+	case "csv":
+		mapping, ok := statement.Presets[bank]
+		if !ok {
+			return nil, fmt.Errorf("unknown bank %q for a CSV statement, expected one of %v", bank, statement.PresetNames())
+		}
+		return func(r io.Reader) (plaid.TransactionList, error) {
+			return statement.ParseCSV(r, mapping)
+		}, nil
+	case "ofx", "qfx":
+		return statement.ParseOFX, nil
+	case "camt053":
+		return statement.ParseCAMT053, nil
+	case "mt940":
+		return statement.ParseMT940, nil
+	default:
+		return nil, fmt.Errorf("unknown statement format %q, expected csv, ofx, camt053 or mt940", format)
+	}
+}
@@ -1,15 +1,115 @@
 CREATE EXTENSION pgcrypto;
 
+CREATE TABLE users (
+  id SERIAL PRIMARY KEY,
+  name TEXT NOT NULL,
+  email TEXT NOT NULL UNIQUE,
+  password_hash TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE sessions (
+  token_hash TEXT PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  expires_at TIMESTAMP NOT NULL,
+  created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE identities (
+  issuer TEXT NOT NULL,
+  subject TEXT NOT NULL,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  created_at TIMESTAMP NOT NULL,
+  PRIMARY KEY (issuer, subject)
+);
+
+CREATE TABLE api_tokens (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  scope TEXT NOT NULL,
+  token_hash TEXT NOT NULL UNIQUE,
+  created_at TIMESTAMP NOT NULL,
+  last_used_at TIMESTAMP
+);
+
 CREATE TABLE subscriptions (
   id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name VARCHAR(100) NOT NULL,
+  merchant TEXT NOT NULL DEFAULT '',
+  category TEXT NOT NULL DEFAULT '',
+  amount NUMERIC NOT NULL,
+  date_due DATE NOT NULL,
+  anchor_date DATE NOT NULL,
+  frequency TEXT NOT NULL DEFAULT 'monthly',
+  frequency_interval INTEGER NOT NULL DEFAULT 1,
+  created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE renewals (
+  id SERIAL PRIMARY KEY,
+  subscription_id INTEGER NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+  date_due DATE NOT NULL,
+  amount NUMERIC NOT NULL,
+  created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE merchant_aliases (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  pattern TEXT NOT NULL,
+  merchant TEXT NOT NULL,
+  UNIQUE (user_id, pattern)
+);
+
+CREATE TABLE candidates (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  merchant TEXT NOT NULL,
   name VARCHAR(100) NOT NULL,
+  category TEXT NOT NULL DEFAULT '',
   amount NUMERIC NOT NULL,
   date_due DATE NOT NULL,
+  frequency TEXT NOT NULL DEFAULT 'monthly',
+  frequency_interval INTEGER NOT NULL DEFAULT 1,
+  confidence DOUBLE PRECISION NOT NULL,
+  transactions JSONB NOT NULL,
+  created_at TIMESTAMP NOT NULL,
+  UNIQUE (user_id, merchant)
+);
+
+CREATE TABLE rejected_merchants (
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  merchant TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL,
+  PRIMARY KEY (user_id, merchant)
+);
+
+CREATE TABLE plaid_items (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  source TEXT NOT NULL DEFAULT 'plaid',
+  item_id TEXT NOT NULL UNIQUE,
+  institution_id TEXT NOT NULL,
+  access_token TEXT NOT NULL,
+  cursor TEXT NOT NULL DEFAULT '',
+  status TEXT NOT NULL DEFAULT '',
   created_at TIMESTAMP NOT NULL
 );
 
-CREATE TABLE users(
-id TEXT PRIMARY KEY DEFAULT 'present',
-name TEXT NOT NULL,
-email TEXT NOT NULL
-);
\ No newline at end of file
+CREATE TABLE transactions (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  external_id TEXT NOT NULL,
+  account_id TEXT NOT NULL DEFAULT '',
+  name TEXT NOT NULL,
+  merchant TEXT NOT NULL,
+  amount NUMERIC NOT NULL,
+  currency TEXT NOT NULL DEFAULT '',
+  date DATE NOT NULL,
+  pending BOOLEAN NOT NULL DEFAULT FALSE,
+  subscription_id INTEGER REFERENCES subscriptions(id) ON DELETE SET NULL,
+  created_at TIMESTAMP NOT NULL,
+  UNIQUE (user_id, external_id)
+);
@@ -0,0 +1,100 @@
+package account
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLength is the shortest password an account can be created with
+const MinPasswordLength = 8
+
+// SessionDuration is how long a user stays logged in after logging in
+const SessionDuration = 30 * 24 * time.Hour
+
+// ErrPasswordTooShort is returned when hashing a password shorter than MinPasswordLength
+var ErrPasswordTooShort = fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+
+// ErrEmailTaken is returned when storing a user with an email that another user already has
+var ErrEmailTaken = errors.New("an account already exists with that email")
+
+// HashPassword returns the bcrypt hash of a password, which is what is stored for a user instead of the password
+func HashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", ErrPasswordTooShort
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("unexpected hashing error: %w", err)
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether the password matches a hash returned by HashPassword
+func CheckPassword(hash string, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// Session is a logged in user. Only the hash of the session's token is stored,
+// the token itself is only ever sent to the user's browser.
+type Session struct {
+	TokenHash string
+	UserID    int
+	ExpiresAt time.Time
+}
+
+// Expired reports whether the session has ended by the given time
+func (s Session) Expired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt)
+}
+
+// NewSession returns a new random session token for the user and the session to store for it,
+// which lasts for SessionDuration from now
+func NewSession(userID int, now time.Time) (string, Session, error) {
+	random := make([]byte, 32)
+	_, err := rand.Read(random)
+	if err != nil {
+		return "", Session{}, fmt.Errorf("unable to create session token: %w", err)
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(random)
+	session := Session{TokenHash: HashToken(token), UserID: userID, ExpiresAt: now.Add(SessionDuration)}
+	return token, session, nil
+}
+
+// HashToken returns the hash a session token is stored and looked up by
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CSRFToken returns the token the web UI has to send back with every request that changes something,
+// which is derived from the session token so only a page that was given it by the server can know it
+func CSRFToken(sessionToken string) string {
+	mac := hmac.New(sha256.New, []byte(sessionToken))
+	mac.Write([]byte("csrf"))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// userKey is the context key of the logged in user's ID
+type userKey struct{}
+
+// WithUser returns a copy of the context that carries the ID of the logged in user
+func WithUser(ctx context.Context, userID int) context.Context {
+	return context.WithValue(ctx, userKey{}, userID)
+}
+
+// UserID returns the ID of the logged in user carried by the context, if there is one
+func UserID(ctx context.Context) (int, bool) {
+	userID, ok := ctx.Value(userKey{}).(int)
+	return userID, ok
+}
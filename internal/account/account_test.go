@@ -0,0 +1,102 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPasswords(t *testing.T) {
+	t.Run("checks a password against its hash", func(t *testing.T) {
+		hash, err := HashPassword("correct horse")
+		if err != nil {
+			t.Fatalf("unexpected error hashing password: %v", err)
+		}
+		if strings.Contains(hash, "correct horse") {
+			t.Errorf("got hash %q containing the password", hash)
+		}
+
+		if !CheckPassword(hash, "correct horse") {
+			t.Errorf("the password did not match its hash")
+		}
+		if CheckPassword(hash, "battery staple") {
+			t.Errorf("a different password matched the hash")
+		}
+	})
+
+	t.Run("salts each hash", func(t *testing.T) {
+		first, _ := HashPassword("correct horse")
+		second, _ := HashPassword("correct horse")
+		if first == second {
+			t.Errorf("got the same hash twice %q", first)
+		}
+	})
+
+	t.Run("rejects short passwords", func(t *testing.T) {
+		_, err := HashPassword("short")
+		if !errors.Is(err, ErrPasswordTooShort) {
+			t.Errorf("got %v want %v", err, ErrPasswordTooShort)
+		}
+	})
+
+	t.Run("does not match an invalid hash", func(t *testing.T) {
+		if CheckPassword("", "correct horse") {
+			t.Errorf("the password matched an empty hash")
+		}
+	})
+}
+
+func TestNewSession(t *testing.T) {
+	now := time.Date(2020, time.November, 1, 12, 0, 0, 0, time.UTC)
+
+	token, session, err := NewSession(7, now)
+	if err != nil {
+		t.Fatalf("unexpected error creating session: %v", err)
+	}
+
+	if session.UserID != 7 {
+		t.Errorf("got user %d want 7", session.UserID)
+	}
+	if session.TokenHash != HashToken(token) || session.TokenHash == token {
+		t.Errorf("got token hash %q want the hash of the token %q", session.TokenHash, token)
+	}
+	if !session.ExpiresAt.Equal(now.Add(SessionDuration)) {
+		t.Errorf("got expiry %v want %v", session.ExpiresAt, now.Add(SessionDuration))
+	}
+	if session.Expired(now) || !session.Expired(now.Add(SessionDuration)) {
+		t.Errorf("want the session to last for %v", SessionDuration)
+	}
+
+	other, _, _ := NewSession(7, now)
+	if other == token {
+		t.Errorf("got the same token twice %q", token)
+	}
+}
+
+func TestCSRFToken(t *testing.T) {
+	token := CSRFToken("session-token")
+
+	if token != CSRFToken("session-token") {
+		t.Errorf("got a different CSRF token for the same session")
+	}
+	if token == CSRFToken("another-session-token") {
+		t.Errorf("got the same CSRF token %q for different sessions", token)
+	}
+	if token == HashToken("session-token") || token == "session-token" {
+		t.Errorf("got CSRF token %q that gives away the session", token)
+	}
+}
+
+func TestUserContext(t *testing.T) {
+	_, ok := UserID(context.Background())
+	if ok {
+		t.Errorf("got a user from an empty context")
+	}
+
+	userID, ok := UserID(WithUser(context.Background(), 3))
+	if !ok || userID != 3 {
+		t.Errorf("got user %d, %v want 3", userID, ok)
+	}
+}
@@ -0,0 +1,76 @@
+package account
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Scope is what an API token lets a script do with the account it belongs to
+type Scope string
+
+const (
+	// ReadOnly tokens can only make GET and HEAD requests
+	ReadOnly Scope = "read"
+	// ReadWrite tokens can make any request a logged in user can
+	ReadWrite Scope = "read-write"
+)
+
+// TokenPrefix starts every API token, so they can be told apart from session tokens and found if leaked
+const TokenPrefix = "sct_"
+
+// ErrInvalidScope is returned when creating an API token with a scope other than ReadOnly or ReadWrite
+var ErrInvalidScope = fmt.Errorf("scope must be %q or %q", ReadOnly, ReadWrite)
+
+// ErrTokenNameMissing is returned when creating an API token without a name
+var ErrTokenNameMissing = errors.New("an API token needs a name")
+
+// APIToken is a personal access token a user created for a script or integration.
+// Only the hash of the token is stored, the token itself is only shown to the user when it is created.
+// LastUsedAt is nil until the token is first used.
+type APIToken struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"-"`
+	Name       string     `json:"name"`
+	Scope      Scope      `json:"scope"`
+	TokenHash  string     `json:"-"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+// Allows reports whether the token's scope lets it make a request with the given method
+func (t APIToken) Allows(method string) bool {
+	switch t.Scope {
+	case ReadWrite:
+		return true
+	case ReadOnly:
+		return method == http.MethodGet || method == http.MethodHead
+	default:
+		return false
+	}
+}
+
+// NewAPIToken returns a new random API token for the user and the APIToken to store for it
+func NewAPIToken(userID int, name string, scope Scope, now time.Time) (string, APIToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", APIToken{}, ErrTokenNameMissing
+	}
+	if scope != ReadOnly && scope != ReadWrite {
+		return "", APIToken{}, ErrInvalidScope
+	}
+
+	random := make([]byte, 32)
+	_, err := rand.Read(random)
+	if err != nil {
+		return "", APIToken{}, fmt.Errorf("unable to create API token: %w", err)
+	}
+
+	token := TokenPrefix + base64.RawURLEncoding.EncodeToString(random)
+	apiToken := APIToken{UserID: userID, Name: name, Scope: scope, TokenHash: HashToken(token), CreatedAt: now}
+	return token, apiToken, nil
+}
@@ -0,0 +1,68 @@
+package account
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewAPIToken(t *testing.T) {
+	now := time.Date(2020, time.November, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("creates a named token storing only its hash", func(t *testing.T) {
+		token, apiToken, err := NewAPIToken(7, " deploy script ", ReadOnly, now)
+		if err != nil {
+			t.Fatalf("unexpected error creating token: %v", err)
+		}
+
+		if !strings.HasPrefix(token, TokenPrefix) {
+			t.Errorf("got token %q want it to start with %q", token, TokenPrefix)
+		}
+		if apiToken.TokenHash != HashToken(token) {
+			t.Errorf("got token hash %q want the hash of the token %q", apiToken.TokenHash, token)
+		}
+		if apiToken.UserID != 7 || apiToken.Name != "deploy script" || apiToken.Scope != ReadOnly || !apiToken.CreatedAt.Equal(now) {
+			t.Errorf("got token %+v", apiToken)
+		}
+		if apiToken.LastUsedAt != nil {
+			t.Errorf("got a new token last used at %v", apiToken.LastUsedAt)
+		}
+	})
+
+	t.Run("rejects tokens without a name or with an unknown scope", func(t *testing.T) {
+		_, _, err := NewAPIToken(7, " ", ReadWrite, now)
+		if !errors.Is(err, ErrTokenNameMissing) {
+			t.Errorf("got %v want %v", err, ErrTokenNameMissing)
+		}
+
+		_, _, err = NewAPIToken(7, "deploy script", "admin", now)
+		if !errors.Is(err, ErrInvalidScope) {
+			t.Errorf("got %v want %v", err, ErrInvalidScope)
+		}
+	})
+}
+
+func TestAPITokenAllows(t *testing.T) {
+	cases := []struct {
+		scope  Scope
+		method string
+		want   bool
+	}{
+		{ReadOnly, "GET", true},
+		{ReadOnly, "HEAD", true},
+		{ReadOnly, "POST", false},
+		{ReadOnly, "DELETE", false},
+		{ReadWrite, "GET", true},
+		{ReadWrite, "POST", true},
+		{ReadWrite, "DELETE", true},
+		{"", "GET", false},
+	}
+
+	for _, c := range cases {
+		got := APIToken{Scope: c.scope}.Allows(c.method)
+		if got != c.want {
+			t.Errorf("%q token allows %s got %v want %v", c.scope, c.method, got, c.want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package calendar
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/Catzkorn/subscrypt/internal/reminder"
@@ -20,10 +21,12 @@ func CreateReminderInvite(subscription subscription.Subscription, reminder remin
 	event.SetDtStampTime(time.Now())
 	event.SetModifiedAt(time.Now())
 	event.SetAllDayStartAt(reminder.ReminderDate)
-	event.SetSummary(fmt.Sprintf("Your %s subscription is due to renew on %v", subscription.Name, subscription.DateDue.Format(timeLayout)))
+	event.AddProperty(ics.ComponentProperty(ics.PropertyRrule), subscription.RecurrenceRule())
+	dateDue := subscription.NextDue(reminder.ReminderDate)
+	event.SetSummary(fmt.Sprintf("Your %s subscription is due to renew on %v", subscription.Name, dateDue.Format(timeLayout)))
 	event.SetLocation("")
-	event.SetDescription(fmt.Sprintf("Hey! Your %s subscription is due to renew on %v and you asked us to remind you about that!",
-		subscription.Name, subscription.DateDue))
+	event.SetDescription(fmt.Sprintf("Hey! Your %s subscription is due to renew on %v and you asked us to remind you about that! It renews %s.",
+		subscription.Name, dateDue.Format(timeLayout), strings.ToLower(subscription.Cadence())))
 	event.SetOrganizer("team@subscrypt.com", ics.WithCN("Subscrypt Team"))
 	event.AddAttendee(reminder.Email, ics.CalendarUserTypeIndividual, ics.ParticipationStatusNeedsAction, ics.ParticipationRoleReqParticipant, ics.WithRSVP(true))
 
@@ -43,6 +43,7 @@ func TestCalendarInviteCreation(t *testing.T) {
 
 		var uid string
 		var attendee string
+		var rrule string
 
 		for _, property := range event.Properties {
 
@@ -52,6 +53,8 @@ func TestCalendarInviteCreation(t *testing.T) {
 			case string(ics.PropertyAttendee):
 				attendee = property.Value
 				t.Logf(attendee)
+			case string(ics.PropertyRrule):
+				rrule = property.Value
 			}
 		}
 
@@ -62,6 +65,23 @@ func TestCalendarInviteCreation(t *testing.T) {
 		if attendee != fmt.Sprintf("mailto:%v", reminder.Email) {
 			t.Errorf("incorrect attendee got %v want mailto:%v", attendee, reminder.Email)
 		}
+
+		if rrule != "FREQ=MONTHLY;INTERVAL=1" {
+			t.Errorf("incorrect recurrence rule got %v want %v", rrule, "FREQ=MONTHLY;INTERVAL=1")
+		}
+	})
+
+	t.Run("repeats the reminder with the subscription's frequency", func(t *testing.T) {
+		weekly := subscription
+		weekly.Frequency = "weekly"
+
+		cal := CreateReminderInvite(weekly, reminder)
+		event := cal.Events()[0]
+
+		rrule := event.GetProperty(ics.ComponentProperty(ics.PropertyRrule))
+		if rrule == nil || rrule.Value != "FREQ=WEEKLY;INTERVAL=1" {
+			t.Errorf("incorrect recurrence rule got %v want %v", rrule, "FREQ=WEEKLY;INTERVAL=1")
+		}
 	})
 
 }
@@ -0,0 +1,244 @@
+package catalogue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/Catzkorn/subscrypt/internal/merchant"
+)
+
+// ErrNotFound is returned when no catalogue entry exists for a merchant
+var ErrNotFound = errors.New("merchant not found in catalogue")
+
+// Entry describes a merchant known to sell subscriptions.
+// Merchant is the canonical merchant name and Patterns are the other names its payments appear under.
+// Category, Frequency and Interval are the defaults given to subscriptions with the merchant,
+// and CancellationURL is where the user can go to cancel one.
+type Entry struct {
+	Merchant        string   `json:"merchant"`
+	Name            string   `json:"name"`
+	Patterns        []string `json:"patterns,omitempty"`
+	Category        string   `json:"category,omitempty"`
+	Frequency       string   `json:"frequency,omitempty"`
+	Interval        int      `json:"interval,omitempty"`
+	CancellationURL string   `json:"cancellationUrl,omitempty"`
+	Removed         bool     `json:"removed,omitempty"`
+}
+
+// Catalogue is the set of known merchants, made from a bundled list and the overrides of a deployment.
+// It is safe for concurrent use.
+type Catalogue struct {
+	mu           sync.RWMutex
+	bundled      []Entry
+	overrides    []Entry
+	overridePath string
+	entries      []Entry
+}
+
+// New returns a Catalogue of the given entries that keeps changes in memory
+func New(entries []Entry) *Catalogue {
+	c := &Catalogue{bundled: normalizeEntries(entries)}
+	c.merge()
+	return c
+}
+
+// Load reads the bundled catalogue from bundledPath and applies the overrides in overridePath.
+// Changes made to the catalogue are saved to overridePath, which doesn't need to exist yet.
+// If overridePath is empty changes are only kept in memory.
+func Load(bundledPath string, overridePath string) (*Catalogue, error) {
+	bundled, err := readEntries(bundledPath)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Catalogue{bundled: bundled, overridePath: overridePath}
+
+	if overridePath != "" {
+		c.overrides, err = readEntries(overridePath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	c.merge()
+	return c, nil
+}
+
+// Entries returns every merchant in the catalogue
+func (c *Catalogue) Entries() []Entry {
+	if c == nil {
+		return []Entry{}
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]Entry{}, c.entries...)
+}
+
+// Match finds the catalogue entry for a canonical merchant name, as returned by merchant.Resolver.
+// An entry matches if the name contains its merchant or one of its patterns as whole words,
+// preferring the longest pattern when more than one matches. A nil Catalogue matches nothing.
+func (c *Catalogue) Match(name string) (Entry, bool) {
+	if c == nil {
+		return Entry{}, false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	padded := " " + merchant.Normalize(name) + " "
+	var match Entry
+	longest := 0
+	for _, entry := range c.entries {
+		for _, pattern := range append([]string{entry.Merchant}, entry.Patterns...) {
+			if len(pattern) > longest && strings.Contains(padded, " "+pattern+" ") {
+				match, longest = entry, len(pattern)
+			}
+		}
+	}
+	return match, longest > 0
+}
+
+// Put adds an entry to the catalogue, replacing any entry for the same merchant, and saves the overrides
+func (c *Catalogue) Put(entry Entry) (Entry, error) {
+	entry = normalizeEntry(entry)
+	entry.Removed = false
+	if entry.Merchant == "" {
+		return Entry{}, fmt.Errorf("a catalogue entry needs a merchant")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.overrides = replaceEntry(c.overrides, entry)
+	c.merge()
+	return entry, c.save()
+}
+
+// Remove takes a merchant out of the catalogue and saves the overrides.
+// It returns ErrNotFound if the merchant is not in the catalogue.
+func (c *Catalogue) Remove(name string) error {
+	key := merchant.Normalize(name)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := findEntry(c.entries, key); !ok {
+		return ErrNotFound
+	}
+
+	if _, ok := findEntry(c.bundled, key); ok {
+		c.overrides = replaceEntry(c.overrides, Entry{Merchant: key, Removed: true})
+	} else {
+		c.overrides = deleteEntry(c.overrides, key)
+	}
+	c.merge()
+	return c.save()
+}
+
+// merge applies the overrides to the bundled entries
+func (c *Catalogue) merge() {
+	entries := append([]Entry{}, c.bundled...)
+	for _, override := range c.overrides {
+		if override.Removed {
+			entries = deleteEntry(entries, override.Merchant)
+		} else {
+			entries = replaceEntry(entries, override)
+		}
+	}
+	c.entries = entries
+}
+
+// save writes the overrides to the override file, if there is one
+func (c *Catalogue) save() error {
+	if c.overridePath == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(c.overrides, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unexpected encoding error: %w", err)
+	}
+
+	err = ioutil.WriteFile(c.overridePath, data, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to save catalogue overrides: %w", err)
+	}
+	return nil
+}
+
+// readEntries reads a JSON list of entries from a file
+func readEntries(path string) ([]Entry, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read merchant catalogue: %w", err)
+	}
+
+	var entries []Entry
+	err = json.Unmarshal(data, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse merchant catalogue %s: %w", path, err)
+	}
+	return normalizeEntries(entries), nil
+}
+
+func normalizeEntries(entries []Entry) []Entry {
+	var normalized []Entry
+	for _, entry := range entries {
+		entry = normalizeEntry(entry)
+		if entry.Merchant != "" {
+			normalized = append(normalized, entry)
+		}
+	}
+	return normalized
+}
+
+// normalizeEntry puts the merchant and patterns of an entry into the form merchant.Normalize returns
+func normalizeEntry(entry Entry) Entry {
+	if entry.Name == "" {
+		entry.Name = strings.TrimSpace(entry.Merchant)
+	}
+	entry.Merchant = merchant.Normalize(entry.Merchant)
+
+	var patterns []string
+	for _, pattern := range entry.Patterns {
+		if normalized := merchant.Normalize(pattern); normalized != "" {
+			patterns = append(patterns, normalized)
+		}
+	}
+	entry.Patterns = patterns
+	return entry
+}
+
+func findEntry(entries []Entry, key string) (Entry, bool) {
+	for _, entry := range entries {
+		if entry.Merchant == key {
+			return entry, true
+		}
+	}
+	return Entry{}, false
+}
+
+func replaceEntry(entries []Entry, entry Entry) []Entry {
+	for i := range entries {
+		if entries[i].Merchant == entry.Merchant {
+			replaced := append([]Entry{}, entries...)
+			replaced[i] = entry
+			return replaced
+		}
+	}
+	return append(append([]Entry{}, entries...), entry)
+}
+
+func deleteEntry(entries []Entry, key string) []Entry {
+	var remaining []Entry
+	for _, entry := range entries {
+		if entry.Merchant != key {
+			remaining = append(remaining, entry)
+		}
+	}
+	return remaining
+}
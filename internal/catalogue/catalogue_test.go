@@ -0,0 +1,133 @@
+package catalogue
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+const bundledPath = "../../data/merchants.json"
+
+func TestLoad(t *testing.T) {
+	t.Run("reads the bundled catalogue", func(t *testing.T) {
+		c, err := Load(bundledPath, "")
+		if err != nil {
+			t.Fatalf("unexpected error loading catalogue: %v", err)
+		}
+
+		entry, ok := c.Match("netflix")
+		if !ok {
+			t.Fatalf("did not find netflix in the bundled catalogue")
+		}
+		if entry.Name != "Netflix" || entry.Category == "" || entry.CancellationURL == "" {
+			t.Errorf("got incomplete entry %v", entry)
+		}
+	})
+
+	t.Run("returns an error for a missing catalogue", func(t *testing.T) {
+		_, err := Load(filepath.Join(t.TempDir(), "missing.json"), "")
+		if err == nil {
+			t.Errorf("expected an error loading a missing catalogue")
+		}
+	})
+}
+
+func TestMatch(t *testing.T) {
+	c := New([]Entry{
+		{Merchant: "Amazon", Category: "Shopping"},
+		{Merchant: "Amazon Prime", Patterns: []string{"AMZN Prime"}, Category: "Entertainment"},
+	})
+
+	cases := []struct {
+		name     string
+		merchant string
+		found    bool
+	}{
+		{"amazon", "amazon", true},
+		{"amzn prime", "amazon prime", true},
+		{"amazon prime video", "amazon prime", true},
+		{"amazonia", "", false},
+		{"tesco", "", false},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			entry, ok := c.Match(test.name)
+			if ok != test.found || entry.Merchant != test.merchant {
+				t.Errorf("got %q %v want %q %v", entry.Merchant, ok, test.merchant, test.found)
+			}
+		})
+	}
+
+	t.Run("a nil catalogue matches nothing", func(t *testing.T) {
+		var empty *Catalogue
+		if _, ok := empty.Match("amazon"); ok {
+			t.Errorf("expected no match from a nil catalogue")
+		}
+	})
+}
+
+func TestOverrides(t *testing.T) {
+	t.Run("saves changes to the override file", func(t *testing.T) {
+		overridePath := filepath.Join(t.TempDir(), "overrides.json")
+
+		c, err := Load(bundledPath, overridePath)
+		if err != nil {
+			t.Fatalf("unexpected error loading catalogue: %v", err)
+		}
+
+		_, err = c.Put(Entry{Merchant: "Local Gym", Category: "Fitness", Frequency: "monthly"})
+		if err != nil {
+			t.Fatalf("unexpected error adding entry: %v", err)
+		}
+		err = c.Remove("Netflix")
+		if err != nil {
+			t.Fatalf("unexpected error removing entry: %v", err)
+		}
+
+		reloaded, err := Load(bundledPath, overridePath)
+		if err != nil {
+			t.Fatalf("unexpected error reloading catalogue: %v", err)
+		}
+
+		if _, ok := reloaded.Match("local gym"); !ok {
+			t.Errorf("added entry was not saved")
+		}
+		if _, ok := reloaded.Match("netflix"); ok {
+			t.Errorf("removed bundled entry was not saved")
+		}
+		if len(reloaded.Entries()) != len(c.Entries()) {
+			t.Errorf("got %d entries after reload want %d", len(reloaded.Entries()), len(c.Entries()))
+		}
+	})
+
+	t.Run("replaces a bundled entry", func(t *testing.T) {
+		c := New([]Entry{{Merchant: "Spotify", Category: "Music"}})
+
+		_, err := c.Put(Entry{Merchant: "SPOTIFY", Category: "Audio"})
+		if err != nil {
+			t.Fatalf("unexpected error replacing entry: %v", err)
+		}
+
+		entries := c.Entries()
+		if len(entries) != 1 || entries[0].Category != "Audio" {
+			t.Errorf("got %v want a single Audio entry", entries)
+		}
+	})
+
+	t.Run("rejects an entry without a merchant", func(t *testing.T) {
+		c := New(nil)
+		_, err := c.Put(Entry{Merchant: " ", Category: "Music"})
+		if err == nil {
+			t.Errorf("expected an error adding an entry without a merchant")
+		}
+	})
+
+	t.Run("returns ErrNotFound removing an unknown merchant", func(t *testing.T) {
+		c := New(nil)
+		err := c.Remove("nobody")
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("got %v want %v", err, ErrNotFound)
+		}
+	})
+}
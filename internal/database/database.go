@@ -3,10 +3,15 @@ package database
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"time"
 
+	"github.com/Catzkorn/subscrypt/internal/account"
+	"github.com/Catzkorn/subscrypt/internal/merchant"
+	"github.com/Catzkorn/subscrypt/internal/plaid"
 	"github.com/Catzkorn/subscrypt/internal/subscription"
+	"github.com/Catzkorn/subscrypt/internal/transaction"
 	"github.com/Catzkorn/subscrypt/internal/userprofile"
 
 	"github.com/jackc/pgtype"
@@ -33,83 +38,150 @@ func NewDatabaseConnection(databaseDSN string) (*Database, error) {
 	return &Database{database: db}, nil
 }
 
-// RecordSubscription inserts a subscription into the subscription database
-func (d *Database) RecordSubscription(sub subscription.Subscription) (*subscription.Subscription, error) {
+// RecordSubscription inserts a subscription for the user into the subscription database
+func (d *Database) RecordSubscription(ctx context.Context, userID int, sub subscription.Subscription) (*subscription.Subscription, error) {
 	var id int
 	var name string
+	var merchantName string
+	var category string
 	var amount pgtype.Numeric
 	var dateDue time.Time
+	var anchor time.Time
+	var frequency subscription.Frequency
+	var interval int
 	timestamp := time.Now()
 
+	if sub.Merchant == "" {
+		sub.Merchant = merchant.Normalize(sub.Name)
+	}
+	if sub.Frequency == "" {
+		sub.Frequency = subscription.DefaultFrequency
+	}
+	if sub.Interval == 0 {
+		sub.Interval = 1
+	}
+
 	insertQuery := `
-	INSERT INTO subscriptions (name, amount, date_due, created_at) 
-	VALUES ($1, $2, $3, $4) 
-	RETURNING id, name, amount, date_due`
+	INSERT INTO subscriptions (user_id, name, merchant, category, amount, date_due, anchor_date, frequency, frequency_interval, created_at) 
+	VALUES ($1, $2, $3, $4, $5, $6, $6, $7, $8, $9) 
+	RETURNING id, name, merchant, category, amount, date_due, anchor_date, frequency, frequency_interval`
 
-	err := d.database.QueryRowContext(context.Background(), insertQuery, sub.Name, sub.Amount, sub.DateDue, timestamp).Scan(&id, &name, &amount, &dateDue)
+	err := d.database.QueryRowContext(ctx, insertQuery, userID, sub.Name, sub.Merchant, sub.Category, sub.Amount, sub.DateDue, sub.Frequency, sub.Interval, timestamp).Scan(&id, &name, &merchantName, &category, &amount, &dateDue, &anchor, &frequency, &interval)
 	if err != nil {
 		return nil, fmt.Errorf("unexpected insert error: %w", err)
 	}
 
 	newSubscription := subscription.Subscription{
-		ID:      id,
-		Name:    name,
-		Amount:  decimal.NewFromBigInt(amount.Int, amount.Exp),
-		DateDue: dateDue,
+		ID:        id,
+		UserID:    userID,
+		Name:      name,
+		Merchant:  merchantName,
+		Category:  category,
+		Amount:    decimal.NewFromBigInt(amount.Int, amount.Exp),
+		DateDue:   dateDue,
+		Anchor:    anchor,
+		Frequency: frequency,
+		Interval:  interval,
 	}
 	return &newSubscription, nil
 }
 
-// GetSubscriptions retrieves all subscriptions from the subscription database
-func (d *Database) GetSubscriptions() ([]subscription.Subscription, error) {
-	rows, err := d.database.QueryContext(context.Background(), "select t1.id, t1.name, t1.amount, t1.date_due from subscriptions t1 left join subscriptions t2 on t1.name = t2.name and t2.created_at >t1.created_at where t2.name is null;")
+// GetSubscriptions retrieves the user's subscriptions from the subscription database
+func (d *Database) GetSubscriptions(ctx context.Context, userID int) ([]subscription.Subscription, error) {
+	subscriptions, err := d.querySubscriptions(ctx, "WHERE user_id = $1", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	payments, err := d.getPayments(ctx, "user_id = $1 AND subscription_id IS NOT NULL", userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range subscriptions {
+		subscriptions[i].Payments = payments[subscriptions[i].ID]
+	}
+	return subscriptions, nil
+}
+
+// GetAllSubscriptions retrieves every user's subscriptions from the subscription database, without their payments
+func (d *Database) GetAllSubscriptions(ctx context.Context) ([]subscription.Subscription, error) {
+	return d.querySubscriptions(ctx, "")
+}
+
+// querySubscriptions retrieves the subscriptions selected by the where clause, in the order they were recorded
+func (d *Database) querySubscriptions(ctx context.Context, where string, args ...interface{}) ([]subscription.Subscription, error) {
+	rows, err := d.database.QueryContext(ctx, "SELECT id, user_id, name, merchant, category, amount, date_due, anchor_date, frequency, frequency_interval FROM subscriptions "+where+" ORDER BY id;", args...)
 	if err != nil {
 		return nil, fmt.Errorf("unexpected retrieve error: %w", err)
 	}
+	defer rows.Close()
 
 	var subscriptions []subscription.Subscription
 
 	for rows.Next() {
 		var id int
+		var userID int
 		var name string
+		var merchantName string
+		var category string
 		var amount pgtype.Numeric
 		var dateDue time.Time
+		var anchor time.Time
+		var frequency subscription.Frequency
+		var interval int
 
-		err := rows.Scan(&id, &name, &amount, &dateDue)
+		err := rows.Scan(&id, &userID, &name, &merchantName, &category, &amount, &dateDue, &anchor, &frequency, &interval)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
 		subscriptions = append(subscriptions, subscription.Subscription{
-			ID:      id,
-			Name:    name,
-			Amount:  decimal.NewFromBigInt(amount.Int, amount.Exp),
-			DateDue: dateDue,
+			ID:        id,
+			UserID:    userID,
+			Name:      name,
+			Merchant:  merchantName,
+			Category:  category,
+			Amount:    decimal.NewFromBigInt(amount.Int, amount.Exp),
+			DateDue:   dateDue,
+			Anchor:    anchor,
+			Frequency: frequency,
+			Interval:  interval,
 		})
 	}
 	return subscriptions, nil
 }
 
-// GetSubscription retrieves a single subscription that has the given ID from the subscription database
-// If no subscription is found with the given ID, it returns a nil pointer
-func (d *Database) GetSubscription(subscriptionID int) (*subscription.Subscription, error) {
+// GetSubscription retrieves a single subscription of the user that has the given ID from the subscription database
+// If the user has no subscription with the given ID, it returns a nil pointer
+func (d *Database) GetSubscription(ctx context.Context, userID int, subscriptionID int) (*subscription.Subscription, error) {
 	var id int
 	var name string
+	var merchantName string
+	var category string
 	var amount pgtype.Numeric
 	var dateDue time.Time
+	var anchor time.Time
+	var frequency subscription.Frequency
+	var interval int
 
 	selectQuery := `
-	SELECT id, name, amount, date_due FROM subscriptions
-	WHERE id=$1`
+	SELECT id, name, merchant, category, amount, date_due, anchor_date, frequency, frequency_interval FROM subscriptions
+	WHERE id=$1 AND user_id=$2`
 
 	err := d.database.QueryRowContext(
-		context.Background(),
+		ctx,
 		selectQuery,
 		subscriptionID,
+		userID,
 	).Scan(
 		&id,
 		&name,
+		&merchantName,
+		&category,
 		&amount,
 		&dateDue,
+		&anchor,
+		&frequency,
+		&interval,
 	)
 
 	switch {
@@ -119,18 +191,31 @@ func (d *Database) GetSubscription(subscriptionID int) (*subscription.Subscripti
 		return nil, fmt.Errorf("unexpected database error: %w", err)
 	default:
 		retrievedSubscription := subscription.Subscription{
-			ID:      id,
-			Name:    name,
-			Amount:  decimal.NewFromBigInt(amount.Int, amount.Exp),
-			DateDue: dateDue,
+			ID:        id,
+			UserID:    userID,
+			Name:      name,
+			Merchant:  merchantName,
+			Category:  category,
+			Amount:    decimal.NewFromBigInt(amount.Int, amount.Exp),
+			DateDue:   dateDue,
+			Anchor:    anchor,
+			Frequency: frequency,
+			Interval:  interval,
 		}
+
+		payments, err := d.getPayments(ctx, "subscription_id = $1", id)
+		if err != nil {
+			return nil, err
+		}
+		retrievedSubscription.Payments = payments[id]
 		return &retrievedSubscription, nil
 	}
 }
 
-// DeleteSubscription deletes a subscription from the database by ID
-func (d *Database) DeleteSubscription(subscriptionID int) error {
-	subscription, err := d.GetSubscription(subscriptionID)
+// DeleteSubscription deletes a subscription of the user from the database by ID,
+// along with every other record the user has of the same merchant
+func (d *Database) DeleteSubscription(ctx context.Context, userID int, subscriptionID int) error {
+	subscription, err := d.GetSubscription(ctx, userID, subscriptionID)
 	switch {
 	case err != nil:
 		return fmt.Errorf("unexpected database error: %w", err)
@@ -138,8 +223,7 @@ func (d *Database) DeleteSubscription(subscriptionID int) error {
 		return fmt.Errorf("no subscription found: %w", err)
 	}
 
-	fmt.Println(subscription.Name)
-	result, err := d.database.ExecContext(context.Background(), "DELETE FROM subscriptions WHERE name = $1;", subscription.Name)
+	result, err := d.database.ExecContext(ctx, "DELETE FROM subscriptions WHERE merchant = $1 AND user_id = $2;", subscription.Merchant, userID)
 	if err != nil {
 		return fmt.Errorf("unexpected database error: %w", err)
 	}
@@ -155,55 +239,844 @@ func (d *Database) DeleteSubscription(subscriptionID int) error {
 	return nil
 }
 
-// RecordUserDetails records a users name and email
-func (d *Database) RecordUserDetails(name string, email string) (*userprofile.Userprofile, error) {
-	insertQuery := `
-	INSERT INTO users (name, email) 
-	VALUES ($1, $2) 
-	ON CONFLICT (id)
-	DO UPDATE SET name=EXCLUDED.name, email=EXCLUDED.email
-`
-	_, err := d.database.ExecContext(context.Background(), insertQuery, name, email)
+// UpdateSubscription replaces the name, merchant, category, amount, due date and cadence of the user's subscription
+// with those of the given subscription, which has the ID of the one to update.
+// Its anchor moves to the new due date, unless the due date and cadence are unchanged.
+// Its payments are unmatched, as the edit may mean they are no longer for it, ready to be matched again.
+// If the user has no subscription with the ID, it returns a nil pointer
+func (d *Database) UpdateSubscription(ctx context.Context, userID int, sub subscription.Subscription) (*subscription.Subscription, error) {
+	if sub.Merchant == "" {
+		sub.Merchant = merchant.Normalize(sub.Name)
+	}
+	if sub.Frequency == "" {
+		sub.Frequency = subscription.DefaultFrequency
+	}
+	if sub.Interval == 0 {
+		sub.Interval = 1
+	}
+
+	tx, err := d.database.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, fmt.Errorf("unexpected insert error: %v", err)
+		return nil, fmt.Errorf("unexpected database error: %w", err)
 	}
+	defer tx.Rollback()
+
+	updateQuery := `
+	UPDATE subscriptions
+	SET name = $1, merchant = $2, category = $3, amount = $4, date_due = $5, frequency = $6, frequency_interval = $7,
+	anchor_date = CASE WHEN date_due = $5 AND frequency = $6 AND frequency_interval = $7 THEN anchor_date ELSE $5 END
+	WHERE id = $8 AND user_id = $9`
 
-	newUserprofile := userprofile.Userprofile{
-		Name:  name,
-		Email: email,
+	result, err := tx.ExecContext(ctx, updateQuery, sub.Name, sub.Merchant, sub.Category, sub.Amount, sub.DateDue, sub.Frequency, sub.Interval, sub.ID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected update error: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("error getting rows affected: %w", err)
 	}
-	return &newUserprofile, nil
+	if rowsAffected == 0 {
+		return nil, nil
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE transactions SET subscription_id = NULL WHERE subscription_id = $1 AND user_id = $2;", sub.ID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected update error: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("unexpected database error: %w", err)
+	}
+	return d.GetSubscription(ctx, userID, sub.ID)
 }
 
-// GetUserDetails retrieves a users details
-func (d *Database) GetUserDetails() (*userprofile.Userprofile, error) {
-	var usersName string
-	var usersEmail string
+// RenewSubscription moves the user's past-due subscription on to its next due date and records the renewals it rolled past.
+// If the subscription has already been moved on to the given date, or isn't the user's, nothing is recorded.
+func (d *Database) RenewSubscription(ctx context.Context, userID int, subscriptionID int, dateDue time.Time, renewals []subscription.Renewal) error {
+	tx, err := d.database.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unexpected database error: %w", err)
+	}
+	defer tx.Rollback()
 
+	result, err := tx.ExecContext(ctx, "UPDATE subscriptions SET date_due = $1 WHERE id = $2 AND user_id = $3 AND date_due < $1;", dateDue, subscriptionID, userID)
+	if err != nil {
+		return fmt.Errorf("unexpected update error: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return nil
+	}
+
+	insertQuery := `
+	INSERT INTO renewals (subscription_id, date_due, amount, created_at)
+	VALUES ($1, $2, $3, $4)`
+
+	timestamp := time.Now()
+	for _, renewal := range renewals {
+		_, err = tx.ExecContext(ctx, insertQuery, subscriptionID, renewal.DateDue, renewal.Amount, timestamp)
+		if err != nil {
+			return fmt.Errorf("unexpected insert error: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetRenewals retrieves the past due dates of the user's subscription, oldest first
+func (d *Database) GetRenewals(ctx context.Context, userID int, subscriptionID int) ([]subscription.Renewal, error) {
 	selectQuery := `
-	SELECT name, email FROM users
-	LIMIT 1`
+	SELECT renewals.date_due, renewals.amount FROM renewals
+	JOIN subscriptions ON subscriptions.id = renewals.subscription_id
+	WHERE renewals.subscription_id = $1 AND subscriptions.user_id = $2
+	ORDER BY renewals.date_due;`
 
-	err := d.database.QueryRowContext(
-		context.Background(),
-		selectQuery,
-	).Scan(
-		&usersName,
-		&usersEmail,
+	rows, err := d.database.QueryContext(ctx, selectQuery, subscriptionID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected retrieve error: %w", err)
+	}
+	defer rows.Close()
+
+	var renewals []subscription.Renewal
+
+	for rows.Next() {
+		var dateDue time.Time
+		var amount pgtype.Numeric
+
+		err := rows.Scan(&dateDue, &amount)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		renewals = append(renewals, subscription.Renewal{
+			SubscriptionID: subscriptionID,
+			DateDue:        dateDue,
+			Amount:         decimal.NewFromBigInt(amount.Int, amount.Exp),
+		})
+	}
+	return renewals, nil
+}
+
+// GetMerchantAliases retrieves all the user's merchant alias rules
+func (d *Database) GetMerchantAliases(ctx context.Context, userID int) ([]merchant.Alias, error) {
+	rows, err := d.database.QueryContext(ctx, "SELECT id, pattern, merchant FROM merchant_aliases WHERE user_id = $1 ORDER BY id;", userID)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected retrieve error: %w", err)
+	}
+	defer rows.Close()
+
+	var aliases []merchant.Alias
+
+	for rows.Next() {
+		var alias merchant.Alias
+
+		err := rows.Scan(&alias.ID, &alias.Pattern, &alias.Merchant)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		aliases = append(aliases, alias)
+	}
+	return aliases, nil
+}
+
+// RecordMerchantAlias inserts a merchant alias rule for the user, replacing the merchant of the user's existing rule with the same pattern
+func (d *Database) RecordMerchantAlias(ctx context.Context, userID int, alias merchant.Alias) (*merchant.Alias, error) {
+	insertQuery := `
+	INSERT INTO merchant_aliases (user_id, pattern, merchant)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (user_id, pattern)
+	DO UPDATE SET merchant=EXCLUDED.merchant
+	RETURNING id, pattern, merchant`
+
+	var newAlias merchant.Alias
+	err := d.database.QueryRowContext(ctx, insertQuery, userID, alias.Pattern, alias.Merchant).Scan(&newAlias.ID, &newAlias.Pattern, &newAlias.Merchant)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected insert error: %w", err)
+	}
+	return &newAlias, nil
+}
+
+// DeleteMerchantAlias deletes one of the user's merchant alias rules by ID
+func (d *Database) DeleteMerchantAlias(ctx context.Context, userID int, aliasID int) error {
+	result, err := d.database.ExecContext(ctx, "DELETE FROM merchant_aliases WHERE id = $1 AND user_id = $2;", aliasID, userID)
+	if err != nil {
+		return fmt.Errorf("unexpected database error: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("no merchant alias found with ID %v", aliasID)
+	}
+	return nil
+}
+
+// candidateColumns are the columns selected to scan a candidate with scanCandidate
+const candidateColumns = "id, merchant, name, category, amount, date_due, frequency, frequency_interval, confidence, transactions"
+
+// scanner is a row or rows that a candidate can be scanned from
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanCandidate reads a candidate from the candidateColumns of a row
+func scanCandidate(row scanner) (*subscription.Candidate, error) {
+	var candidate subscription.Candidate
+	var amount pgtype.Numeric
+	var transactions []byte
+
+	err := row.Scan(
+		&candidate.ID,
+		&candidate.Merchant,
+		&candidate.Subscription.Name,
+		&candidate.Subscription.Category,
+		&amount,
+		&candidate.Subscription.DateDue,
+		&candidate.Subscription.Frequency,
+		&candidate.Subscription.Interval,
+		&candidate.Confidence,
+		&transactions,
 	)
+	if err != nil {
+		return nil, err
+	}
+
+	candidate.Subscription.Merchant = candidate.Merchant
+	candidate.Subscription.Amount = decimal.NewFromBigInt(amount.Int, amount.Exp)
+
+	var supporting []plaid.Transaction
+	err = json.Unmarshal(transactions, &supporting)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse candidate transactions: %w", err)
+	}
+	candidate.Transactions = supporting
+
+	return &candidate, nil
+}
+
+// RecordCandidate stores a detected subscription for the user to review,
+// replacing any candidate the user has pending for the same merchant
+func (d *Database) RecordCandidate(ctx context.Context, userID int, candidate subscription.Candidate) (*subscription.Candidate, error) {
+	transactions, err := json.Marshal(candidate.Transactions)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected encoding error: %w", err)
+	}
+
+	sub := candidate.Subscription
+	insertQuery := `
+	INSERT INTO candidates (user_id, merchant, name, category, amount, date_due, frequency, frequency_interval, confidence, transactions, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	ON CONFLICT (user_id, merchant)
+	DO UPDATE SET name=EXCLUDED.name, category=EXCLUDED.category, amount=EXCLUDED.amount, date_due=EXCLUDED.date_due,
+		frequency=EXCLUDED.frequency, frequency_interval=EXCLUDED.frequency_interval, confidence=EXCLUDED.confidence,
+		transactions=EXCLUDED.transactions
+	RETURNING ` + candidateColumns
+
+	recorded, err := scanCandidate(d.database.QueryRowContext(ctx, insertQuery,
+		userID, candidate.Merchant, sub.Name, sub.Category, sub.Amount, sub.DateDue, sub.Frequency, sub.Interval, candidate.Confidence, transactions, time.Now()))
+	if err != nil {
+		return nil, fmt.Errorf("unexpected insert error: %w", err)
+	}
+	return recorded, nil
+}
 
+// GetCandidates retrieves the detected subscriptions waiting for the user to review, most confident first
+func (d *Database) GetCandidates(ctx context.Context, userID int) ([]subscription.Candidate, error) {
+	rows, err := d.database.QueryContext(ctx, "SELECT "+candidateColumns+" FROM candidates WHERE user_id = $1 ORDER BY confidence DESC, id;", userID)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected retrieve error: %w", err)
+	}
+	defer rows.Close()
+
+	var candidates []subscription.Candidate
+
+	for rows.Next() {
+		candidate, err := scanCandidate(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		candidates = append(candidates, *candidate)
+	}
+	return candidates, nil
+}
+
+// GetCandidate retrieves the detected subscription waiting for the user to review with the given ID
+// If the user has no candidate with the given ID, it returns a nil pointer
+func (d *Database) GetCandidate(ctx context.Context, userID int, candidateID int) (*subscription.Candidate, error) {
+	candidate, err := scanCandidate(d.database.QueryRowContext(ctx, "SELECT "+candidateColumns+" FROM candidates WHERE id = $1 AND user_id = $2;", candidateID, userID))
 	switch {
 	case err == sql.ErrNoRows:
 		return nil, nil
 	case err != nil:
 		return nil, fmt.Errorf("unexpected database error: %w", err)
-	case usersName == "" || usersEmail == "":
-		return nil, fmt.Errorf("no user was returned")
 	default:
-		newUserprofile := userprofile.Userprofile{
-			Name:  usersName,
-			Email: usersEmail,
+		return candidate, nil
+	}
+}
+
+// DeleteCandidate removes a detected subscription from the user's review queue by ID
+func (d *Database) DeleteCandidate(ctx context.Context, userID int, candidateID int) error {
+	result, err := d.database.ExecContext(ctx, "DELETE FROM candidates WHERE id = $1 AND user_id = $2;", candidateID, userID)
+	if err != nil {
+		return fmt.Errorf("unexpected database error: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("no candidate found with ID %v", candidateID)
+	}
+	return nil
+}
+
+// RejectMerchant remembers that the user's payments to the merchant are not a subscription
+func (d *Database) RejectMerchant(ctx context.Context, userID int, merchantName string) error {
+	insertQuery := `
+	INSERT INTO rejected_merchants (user_id, merchant, created_at)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (user_id, merchant) DO NOTHING`
+
+	_, err := d.database.ExecContext(ctx, insertQuery, userID, merchantName, time.Now())
+	if err != nil {
+		return fmt.Errorf("unexpected insert error: %w", err)
+	}
+	return nil
+}
+
+// GetRejectedMerchants retrieves the merchants whose payments the user said are not a subscription
+func (d *Database) GetRejectedMerchants(ctx context.Context, userID int) ([]string, error) {
+	rows, err := d.database.QueryContext(ctx, "SELECT merchant FROM rejected_merchants WHERE user_id = $1 ORDER BY merchant;", userID)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected retrieve error: %w", err)
+	}
+	defer rows.Close()
+
+	var merchants []string
+
+	for rows.Next() {
+		var merchantName string
+
+		err := rows.Scan(&merchantName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		merchants = append(merchants, merchantName)
+	}
+	return merchants, nil
+}
+
+// DeleteRejectedMerchant forgets that the user rejected a merchant, so its payments can be detected again
+func (d *Database) DeleteRejectedMerchant(ctx context.Context, userID int, merchantName string) error {
+	result, err := d.database.ExecContext(ctx, "DELETE FROM rejected_merchants WHERE merchant = $1 AND user_id = $2;", merchantName, userID)
+	if err != nil {
+		return fmt.Errorf("unexpected database error: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("no rejected merchant found named %q", merchantName)
+	}
+	return nil
+}
+
+// plaidItemColumns are the columns selected to scan a linked bank with scanPlaidItem
+const plaidItemColumns = "id, user_id, source, item_id, institution_id, access_token, cursor, status, created_at"
+
+// scanPlaidItem reads a linked bank from the plaidItemColumns of a row
+func scanPlaidItem(row scanner) (*plaid.Item, error) {
+	var item plaid.Item
+	err := row.Scan(&item.ID, &item.UserID, &item.Source, &item.ItemID, &item.InstitutionID, &item.AccessToken, &item.Cursor, &item.Status, &item.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// GetPlaidItems retrieves the banks the user linked through Plaid, with their access tokens as they were stored
+func (d *Database) GetPlaidItems(ctx context.Context, userID int) ([]plaid.Item, error) {
+	rows, err := d.database.QueryContext(ctx, "SELECT "+plaidItemColumns+" FROM plaid_items WHERE user_id = $1 ORDER BY id;", userID)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected retrieve error: %w", err)
+	}
+	defer rows.Close()
+
+	var items []plaid.Item
+
+	for rows.Next() {
+		item, err := scanPlaidItem(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
-		return &newUserprofile, nil
+		items = append(items, *item)
 	}
+	return items, nil
+}
+
+// GetPlaidItem retrieves the bank linked through Plaid with the given Plaid item ID, whichever user linked it
+// If no bank is linked with the item ID, it returns a nil pointer
+func (d *Database) GetPlaidItem(ctx context.Context, itemID string) (*plaid.Item, error) {
+	item, err := scanPlaidItem(d.database.QueryRowContext(ctx, "SELECT "+plaidItemColumns+" FROM plaid_items WHERE item_id = $1;", itemID))
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("unexpected database error: %w", err)
+	default:
+		return item, nil
+	}
+}
+
+// RecordPlaidItem stores a bank linked through Plaid, replacing the access token of an item that is already stored.
+// The access token should already be encrypted.
+func (d *Database) RecordPlaidItem(ctx context.Context, item plaid.Item) (*plaid.Item, error) {
+	insertQuery := `
+	INSERT INTO plaid_items (user_id, source, item_id, institution_id, access_token, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (item_id)
+	DO UPDATE SET access_token=EXCLUDED.access_token, status=''
+	RETURNING id, created_at`
+
+	err := d.database.QueryRowContext(ctx, insertQuery,
+		item.UserID, item.Source, item.ItemID, item.InstitutionID, item.AccessToken, item.CreatedAt).Scan(&item.ID, &item.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected insert error: %w", err)
+	}
+	return &item, nil
+}
+
+// DeletePlaidItem forgets a bank the user linked and its access token by ID
+func (d *Database) DeletePlaidItem(ctx context.Context, userID int, ID int) error {
+	result, err := d.database.ExecContext(ctx, "DELETE FROM plaid_items WHERE id = $1 AND user_id = $2;", ID, userID)
+	if err != nil {
+		return fmt.Errorf("unexpected database error: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("no linked bank found with ID %v", ID)
+	}
+	return nil
+}
+
+// UpdatePlaidItemCursor saves how far the user's linked bank's transactions have been synced
+func (d *Database) UpdatePlaidItemCursor(ctx context.Context, userID int, ID int, cursor string) error {
+	result, err := d.database.ExecContext(ctx, "UPDATE plaid_items SET cursor = $1 WHERE id = $2 AND user_id = $3;", cursor, ID, userID)
+	if err != nil {
+		return fmt.Errorf("unexpected database error: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("no linked bank found with ID %v", ID)
+	}
+	return nil
+}
+
+// UpdatePlaidItemStatus saves the error code Plaid last reported for the user's linked bank
+func (d *Database) UpdatePlaidItemStatus(ctx context.Context, userID int, ID int, status string) error {
+	result, err := d.database.ExecContext(ctx, "UPDATE plaid_items SET status = $1 WHERE id = $2 AND user_id = $3;", status, ID, userID)
+	if err != nil {
+		return fmt.Errorf("unexpected database error: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("no linked bank found with ID %v", ID)
+	}
+	return nil
+}
+
+// RecordTransactions stores the user's imported transactions,
+// updating any the user already has stored with the same external ID
+func (d *Database) RecordTransactions(ctx context.Context, userID int, transactions []transaction.Transaction) error {
+	tx, err := d.database.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unexpected database error: %w", err)
+	}
+	defer tx.Rollback()
+
+	insertQuery := `
+	INSERT INTO transactions (user_id, external_id, account_id, name, merchant, amount, currency, date, pending, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	ON CONFLICT (user_id, external_id)
+	DO UPDATE SET account_id=EXCLUDED.account_id, name=EXCLUDED.name, merchant=EXCLUDED.merchant, amount=EXCLUDED.amount,
+		currency=EXCLUDED.currency, date=EXCLUDED.date, pending=EXCLUDED.pending`
+
+	timestamp := time.Now()
+	for _, t := range transactions {
+		_, err = tx.ExecContext(ctx, insertQuery,
+			userID, t.ExternalID, t.AccountID, t.Name, t.Merchant, t.Amount, t.Currency, t.Date, t.Pending, timestamp)
+		if err != nil {
+			return fmt.Errorf("unexpected insert error: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// transactionColumns are the columns selected to scan a transaction with scanTransaction
+const transactionColumns = "id, external_id, account_id, name, merchant, amount, currency, date, pending, COALESCE(subscription_id, 0)"
+
+// scanTransaction reads a transaction from the transactionColumns of a row
+func scanTransaction(row scanner) (transaction.Transaction, error) {
+	var t transaction.Transaction
+	var amount pgtype.Numeric
+
+	err := row.Scan(&t.ID, &t.ExternalID, &t.AccountID, &t.Name, &t.Merchant, &amount, &t.Currency, &t.Date, &t.Pending, &t.SubscriptionID)
+	if err != nil {
+		return transaction.Transaction{}, err
+	}
+	t.Amount = decimal.NewFromBigInt(amount.Int, amount.Exp)
+	return t, nil
+}
+
+// GetTransactions retrieves the user's imported transactions, most recent first
+func (d *Database) GetTransactions(ctx context.Context, userID int) ([]transaction.Transaction, error) {
+	return d.queryTransactions(ctx, "SELECT "+transactionColumns+" FROM transactions WHERE user_id = $1 ORDER BY date DESC, id;", userID)
+}
+
+// queryTransactions retrieves the transactions selected by the query
+func (d *Database) queryTransactions(ctx context.Context, query string, args ...interface{}) ([]transaction.Transaction, error) {
+	rows, err := d.database.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected retrieve error: %w", err)
+	}
+	defer rows.Close()
+
+	var transactions []transaction.Transaction
+
+	for rows.Next() {
+		t, err := scanTransaction(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		transactions = append(transactions, t)
+	}
+	return transactions, nil
+}
+
+// MatchPayments records that the user's transactions with the given external IDs paid for the subscription
+func (d *Database) MatchPayments(ctx context.Context, userID int, subscriptionID int, externalIDs []string) error {
+	tx, err := d.database.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unexpected database error: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, externalID := range externalIDs {
+		_, err = tx.ExecContext(ctx, "UPDATE transactions SET subscription_id = $1 WHERE external_id = $2 AND user_id = $3;", subscriptionID, externalID, userID)
+		if err != nil {
+			return fmt.Errorf("unexpected update error: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// getPayments retrieves the matched transactions selected by the condition, most recent first, by subscription ID
+func (d *Database) getPayments(ctx context.Context, condition string, args ...interface{}) (map[int][]transaction.Transaction, error) {
+	matched, err := d.queryTransactions(ctx, "SELECT "+transactionColumns+" FROM transactions WHERE "+condition+" ORDER BY date DESC, id;", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	payments := map[int][]transaction.Transaction{}
+	for _, t := range matched {
+		payments[t.SubscriptionID] = append(payments[t.SubscriptionID], t)
+	}
+	return payments, nil
+}
+
+// DeleteTransactions removes the user's transactions with the given external IDs, such as ones the bank has withdrawn
+func (d *Database) DeleteTransactions(ctx context.Context, userID int, externalIDs []string) error {
+	tx, err := d.database.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unexpected database error: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, externalID := range externalIDs {
+		_, err = tx.ExecContext(ctx, "DELETE FROM transactions WHERE external_id = $1 AND user_id = $2;", externalID, userID)
+		if err != nil {
+			return fmt.Errorf("unexpected database error: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// CreateUser inserts a new user with the hash of their password.
+// It returns account.ErrEmailTaken if another user already has the email.
+func (d *Database) CreateUser(ctx context.Context, name string, email string, passwordHash string) (*userprofile.Userprofile, error) {
+	insertQuery := `
+	INSERT INTO users (name, email, password_hash, created_at)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (email) DO NOTHING
+	RETURNING id`
+
+	user := userprofile.Userprofile{Name: name, Email: email, PasswordHash: passwordHash}
+	err := d.database.QueryRowContext(ctx, insertQuery, name, email, passwordHash, time.Now()).Scan(&user.ID)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, account.ErrEmailTaken
+	case err != nil:
+		return nil, fmt.Errorf("unexpected insert error: %w", err)
+	default:
+		return &user, nil
+	}
+}
+
+// CreateUserWithIdentity stores a new user who signs in with an identity provider, and so has no password,
+// along with the issuer and subject that identify them.
+// It returns account.ErrEmailTaken if another user already has the email.
+func (d *Database) CreateUserWithIdentity(ctx context.Context, name string, email string, issuer string, subject string) (*userprofile.Userprofile, error) {
+	insertQuery := `
+	WITH new_user AS (
+		INSERT INTO users (name, email, password_hash, created_at)
+		VALUES ($1, $2, '', $3)
+		ON CONFLICT (email) DO NOTHING
+		RETURNING id
+	)
+	INSERT INTO identities (issuer, subject, user_id, created_at)
+	SELECT $4, $5, id, $3 FROM new_user
+	RETURNING user_id`
+
+	user := userprofile.Userprofile{Name: name, Email: email}
+	err := d.database.QueryRowContext(ctx, insertQuery, name, email, time.Now(), issuer, subject).Scan(&user.ID)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, account.ErrEmailTaken
+	case err != nil:
+		return nil, fmt.Errorf("unexpected insert error: %w", err)
+	default:
+		return &user, nil
+	}
+}
+
+// GetUserByIdentity retrieves the user who signs in with the subject at the identity provider with the issuer
+// If no user has the identity, it returns a nil pointer
+func (d *Database) GetUserByIdentity(ctx context.Context, issuer string, subject string) (*userprofile.Userprofile, error) {
+	query := `
+	SELECT users.id, users.name, users.email, users.password_hash
+	FROM users JOIN identities ON identities.user_id = users.id
+	WHERE identities.issuer = $1 AND identities.subject = $2;`
+
+	return d.queryUser(ctx, query, issuer, subject)
+}
+
+// GetUserByEmail retrieves the user with the given email, along with their password hash
+// If no user has the email, it returns a nil pointer
+func (d *Database) GetUserByEmail(ctx context.Context, email string) (*userprofile.Userprofile, error) {
+	return d.queryUser(ctx, "SELECT id, name, email, password_hash FROM users WHERE email = $1;", email)
+}
+
+// RecordUserDetails updates a users name and email.
+// It returns account.ErrEmailTaken if another user already has the email.
+func (d *Database) RecordUserDetails(ctx context.Context, userID int, name string, email string) (*userprofile.Userprofile, error) {
+	existing, err := d.GetUserByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.ID != userID {
+		return nil, account.ErrEmailTaken
+	}
+
+	result, err := d.database.ExecContext(ctx, "UPDATE users SET name = $1, email = $2 WHERE id = $3;", name, email, userID)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected update error: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return nil, fmt.Errorf("no user found with ID %v", userID)
+	}
+
+	return &userprofile.Userprofile{ID: userID, Name: name, Email: email}, nil
+}
+
+// GetUserDetails retrieves a users details
+// If no user is found with the given ID, it returns a nil pointer
+func (d *Database) GetUserDetails(ctx context.Context, userID int) (*userprofile.Userprofile, error) {
+	user, err := d.queryUser(ctx, "SELECT id, name, email, password_hash FROM users WHERE id = $1;", userID)
+	if user != nil {
+		user.PasswordHash = ""
+	}
+	return user, err
+}
+
+// queryUser retrieves the single user selected by the query, or a nil pointer if there is none
+func (d *Database) queryUser(ctx context.Context, query string, args ...interface{}) (*userprofile.Userprofile, error) {
+	var user userprofile.Userprofile
+	err := d.database.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("unexpected database error: %w", err)
+	default:
+		return &user, nil
+	}
+}
+
+// CreateSession stores a session for a logged in user
+func (d *Database) CreateSession(ctx context.Context, session account.Session) error {
+	insertQuery := `
+	INSERT INTO sessions (token_hash, user_id, expires_at, created_at)
+	VALUES ($1, $2, $3, $4)`
+
+	_, err := d.database.ExecContext(ctx, insertQuery, session.TokenHash, session.UserID, session.ExpiresAt, time.Now())
+	if err != nil {
+		return fmt.Errorf("unexpected insert error: %w", err)
+	}
+	return nil
+}
+
+// GetSession retrieves the session stored with the given token hash
+// If no session is found, it returns a nil pointer
+func (d *Database) GetSession(ctx context.Context, tokenHash string) (*account.Session, error) {
+	var session account.Session
+	err := d.database.QueryRowContext(ctx, "SELECT token_hash, user_id, expires_at FROM sessions WHERE token_hash = $1;", tokenHash).Scan(&session.TokenHash, &session.UserID, &session.ExpiresAt)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("unexpected database error: %w", err)
+	default:
+		return &session, nil
+	}
+}
+
+// DeleteSession removes the session stored with the given token hash, logging its user out.
+// Deleting a session that doesn't exist is not an error.
+func (d *Database) DeleteSession(ctx context.Context, tokenHash string) error {
+	_, err := d.database.ExecContext(ctx, "DELETE FROM sessions WHERE token_hash = $1;", tokenHash)
+	if err != nil {
+		return fmt.Errorf("unexpected database error: %w", err)
+	}
+	return nil
+}
+
+// apiTokenColumns are the columns selected to scan an API token with scanAPIToken
+const apiTokenColumns = "id, user_id, name, scope, token_hash, created_at, last_used_at"
+
+// scanAPIToken reads an API token from the apiTokenColumns of a row
+func scanAPIToken(row scanner) (*account.APIToken, error) {
+	var token account.APIToken
+	var lastUsedAt sql.NullTime
+
+	err := row.Scan(&token.ID, &token.UserID, &token.Name, &token.Scope, &token.TokenHash, &token.CreatedAt, &lastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+	return &token, nil
+}
+
+// CreateAPIToken stores a new API token for the user it belongs to
+func (d *Database) CreateAPIToken(ctx context.Context, token account.APIToken) (*account.APIToken, error) {
+	insertQuery := `
+	INSERT INTO api_tokens (user_id, name, scope, token_hash, created_at)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING ` + apiTokenColumns
+
+	created, err := scanAPIToken(d.database.QueryRowContext(ctx, insertQuery, token.UserID, token.Name, token.Scope, token.TokenHash, token.CreatedAt))
+	if err != nil {
+		return nil, fmt.Errorf("unexpected insert error: %w", err)
+	}
+	return created, nil
+}
+
+// GetAPITokens retrieves the user's API tokens, in the order they were created
+func (d *Database) GetAPITokens(ctx context.Context, userID int) ([]account.APIToken, error) {
+	rows, err := d.database.QueryContext(ctx, "SELECT "+apiTokenColumns+" FROM api_tokens WHERE user_id = $1 ORDER BY id;", userID)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected retrieve error: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []account.APIToken
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		tokens = append(tokens, *token)
+	}
+	return tokens, nil
+}
+
+// GetAPITokenByHash retrieves the API token stored with the given token hash, whichever user it belongs to
+// If no token is found, it returns a nil pointer
+func (d *Database) GetAPITokenByHash(ctx context.Context, tokenHash string) (*account.APIToken, error) {
+	token, err := scanAPIToken(d.database.QueryRowContext(ctx, "SELECT "+apiTokenColumns+" FROM api_tokens WHERE token_hash = $1;", tokenHash))
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("unexpected database error: %w", err)
+	default:
+		return token, nil
+	}
+}
+
+// DeleteAPIToken revokes one of the user's API tokens by ID
+func (d *Database) DeleteAPIToken(ctx context.Context, userID int, ID int) error {
+	result, err := d.database.ExecContext(ctx, "DELETE FROM api_tokens WHERE id = $1 AND user_id = $2;", ID, userID)
+	if err != nil {
+		return fmt.Errorf("unexpected database error: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("no API token found with ID %v", ID)
+	}
+	return nil
+}
+
+// RecordAPITokenUse saves when the user's API token was last used
+func (d *Database) RecordAPITokenUse(ctx context.Context, userID int, ID int, usedAt time.Time) error {
+	_, err := d.database.ExecContext(ctx, "UPDATE api_tokens SET last_used_at = $1 WHERE id = $2 AND user_id = $3;", usedAt, ID, userID)
+	if err != nil {
+		return fmt.Errorf("unexpected database error: %w", err)
+	}
+	return nil
 }
@@ -3,17 +3,24 @@ package database
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/Catzkorn/subscrypt/internal/account"
+	"github.com/Catzkorn/subscrypt/internal/merchant"
+	"github.com/Catzkorn/subscrypt/internal/plaid"
 	"github.com/Catzkorn/subscrypt/internal/subscription"
+	"github.com/Catzkorn/subscrypt/internal/transaction"
 
 	_ "github.com/jackc/pgx/v4/stdlib"
 	"github.com/shopspring/decimal"
 )
 
+var ctx = context.Background()
+
 func TestDatabaseConnection(t *testing.T) {
 
 	t.Run("tests a successful database connection", func(t *testing.T) {
@@ -33,10 +40,11 @@ func TestDatabaseConnection(t *testing.T) {
 func TestRecordSubscriptionToDB(t *testing.T) {
 	store, err := NewDatabaseConnection(os.Getenv("DATABASE_CONN_STRING"))
 	assertDatabaseError(t, err)
+	userID := createTestUser(t, store, "gary@gopher.com")
 
 	t.Run("adds a Netflix subscription", func(t *testing.T) {
 		wantedSubscription := createTestSubscription("Netflix", "14.99", time.Date(2020, time.November, 29, 0, 0, 0, 0, time.UTC))
-		subscription, err := store.RecordSubscription(wantedSubscription)
+		subscription, err := store.RecordSubscription(ctx, userID, wantedSubscription)
 		assertDatabaseError(t, err)
 
 		if subscription.ID == 0 {
@@ -62,7 +70,7 @@ func TestRecordSubscriptionToDB(t *testing.T) {
 	t.Run("adds a climbing subscription", func(t *testing.T) {
 		wantedSubscription := createTestSubscription("Reading Climbing Centre", "50.00", time.Date(2020, time.December, 30, 0, 0, 0, 0, time.UTC))
 
-		subscription, err := store.RecordSubscription(wantedSubscription)
+		subscription, err := store.RecordSubscription(ctx, userID, wantedSubscription)
 		assertDatabaseError(t, err)
 
 		if subscription.ID == 0 {
@@ -85,13 +93,44 @@ func TestRecordSubscriptionToDB(t *testing.T) {
 		assertDatabaseError(t, err)
 	})
 
+	t.Run("adds a subscription with a frequency", func(t *testing.T) {
+		wantedSubscription := createTestSubscription("Disney+", "59.99", time.Date(2021, time.January, 4, 0, 0, 0, 0, time.UTC))
+		wantedSubscription.Frequency = subscription.EveryNMonths
+		wantedSubscription.Interval = 4
+
+		recordedSubscription, err := store.RecordSubscription(ctx, userID, wantedSubscription)
+		assertDatabaseError(t, err)
+
+		gotSubscription, err := store.GetSubscription(ctx, userID, recordedSubscription.ID)
+		assertDatabaseError(t, err)
+
+		if gotSubscription.Frequency != wantedSubscription.Frequency || gotSubscription.Interval != wantedSubscription.Interval {
+			t.Errorf("Database did not return correct frequency, got %v every %v want %v every %v", gotSubscription.Frequency, gotSubscription.Interval, wantedSubscription.Frequency, wantedSubscription.Interval)
+		}
+
+		err = clearSubscriptionsTable()
+		assertDatabaseError(t, err)
+	})
+
+	t.Run("defaults a subscription without a frequency to monthly", func(t *testing.T) {
+		recordedSubscription, err := store.RecordSubscription(ctx, userID, createTestSubscription("Spotify", "9.99", time.Date(2021, time.January, 4, 0, 0, 0, 0, time.UTC)))
+		assertDatabaseError(t, err)
+
+		if recordedSubscription.Frequency != subscription.Monthly {
+			t.Errorf("Database did not default frequency, got %v want %v", recordedSubscription.Frequency, subscription.Monthly)
+		}
+
+		err = clearSubscriptionsTable()
+		assertDatabaseError(t, err)
+	})
+
 	t.Run("fails to add a subscription", func(t *testing.T) {
 		emptySubscription := subscription.Subscription{}
-		subscription, err := store.RecordSubscription(emptySubscription)
+		subscription, err := store.RecordSubscription(ctx, userID, emptySubscription)
 		assertDatabaseError(t, err)
 
 		if subscription.Name != "" {
-			t.Errorf("database retrieved a subscription when it was not meant to: %w", err)
+			t.Errorf("database retrieved a subscription when it was not meant to: %v", err)
 		}
 
 		err = clearSubscriptionsTable()
@@ -102,14 +141,15 @@ func TestRecordSubscriptionToDB(t *testing.T) {
 func TestGetSubscriptionsFromDB(t *testing.T) {
 	store, err := NewDatabaseConnection(os.Getenv("DATABASE_CONN_STRING"))
 	assertDatabaseError(t, err)
+	userID := createTestUser(t, store, "gary@gopher.com")
 
 	t.Run("gets all the subscriptions from the database", func(t *testing.T) {
 		subscription := createTestSubscription("Amazon Prime", "7.99", time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC))
 
-		wantedSubscription, err := store.RecordSubscription(subscription)
+		wantedSubscription, err := store.RecordSubscription(ctx, userID, subscription)
 		assertDatabaseError(t, err)
 
-		gotSubscriptions, err := store.GetSubscriptions()
+		gotSubscriptions, err := store.GetSubscriptions(ctx, userID)
 		assertDatabaseError(t, err)
 
 		if gotSubscriptions[0].ID != wantedSubscription.ID {
@@ -137,14 +177,14 @@ func TestGetSubscriptionsFromDB(t *testing.T) {
 		riverfordSub := createTestSubscription("Riverford", "180.00", time.Date(2020, time.December, 5, 0, 0, 0, 0, time.UTC))
 		gymSub := createTestSubscription("PureGym", "34.99", time.Date(2020, time.December, 8, 0, 0, 0, 0, time.UTC))
 
-		_, err := store.RecordSubscription(helloFreshSub)
+		_, err := store.RecordSubscription(ctx, userID, helloFreshSub)
 		assertDatabaseError(t, err)
-		_, err = store.RecordSubscription(riverfordSub)
+		_, err = store.RecordSubscription(ctx, userID, riverfordSub)
 		assertDatabaseError(t, err)
-		_, err = store.RecordSubscription(gymSub)
+		_, err = store.RecordSubscription(ctx, userID, gymSub)
 		assertDatabaseError(t, err)
 
-		gotSubscriptions, err := store.GetSubscriptions()
+		gotSubscriptions, err := store.GetSubscriptions(ctx, userID)
 		assertDatabaseError(t, err)
 
 		if len(gotSubscriptions) != 3 {
@@ -156,11 +196,11 @@ func TestGetSubscriptionsFromDB(t *testing.T) {
 	})
 
 	t.Run("correctly handles retrieving from an empty database", func(t *testing.T) {
-		gotSubscriptions, err := store.GetSubscriptions()
+		gotSubscriptions, err := store.GetSubscriptions(ctx, userID)
 		assertDatabaseError(t, err)
 
 		if len(gotSubscriptions) != 0 {
-			t.Errorf("database retrieved subscriptions unexpectedly: %w", err)
+			t.Errorf("database retrieved subscriptions unexpectedly: %v", err)
 		}
 
 		err = clearSubscriptionsTable()
@@ -171,13 +211,14 @@ func TestGetSubscriptionsFromDB(t *testing.T) {
 func TestGetSubscriptionByIDFromDB(t *testing.T) {
 	store, err := NewDatabaseConnection(os.Getenv("DATABASE_CONN_STRING"))
 	assertDatabaseError(t, err)
+	userID := createTestUser(t, store, "gary@gopher.com")
 
 	t.Run("returns subscription with given ID from DB", func(t *testing.T) {
 		subscription := createTestSubscription("Graze Box", "20.00", time.Date(2021, time.February, 14, 0, 0, 0, 0, time.UTC))
-		wantedSubscription, err := store.RecordSubscription(subscription)
+		wantedSubscription, err := store.RecordSubscription(ctx, userID, subscription)
 		assertDatabaseError(t, err)
 
-		gotSubscription, err := store.GetSubscription(wantedSubscription.ID)
+		gotSubscription, err := store.GetSubscription(ctx, userID, wantedSubscription.ID)
 		assertDatabaseError(t, err)
 
 		if gotSubscription.ID != wantedSubscription.ID {
@@ -203,10 +244,10 @@ func TestGetSubscriptionByIDFromDB(t *testing.T) {
 	t.Run("gets a specific subscription from the database", func(t *testing.T) {
 		subscription := createTestSubscription("F1 TV", "8.95", time.Date(2020, time.June, 1, 0, 0, 0, 0, time.UTC))
 
-		wantedSubscription, err := store.RecordSubscription(subscription)
+		wantedSubscription, err := store.RecordSubscription(ctx, userID, subscription)
 		assertDatabaseError(t, err)
 
-		gotSubscription, err := store.GetSubscription(wantedSubscription.ID)
+		gotSubscription, err := store.GetSubscription(ctx, userID, wantedSubscription.ID)
 		assertDatabaseError(t, err)
 
 		if gotSubscription.ID != wantedSubscription.ID {
@@ -233,14 +274,14 @@ func TestGetSubscriptionByIDFromDB(t *testing.T) {
 		riverfordSub := createTestSubscription("Riverford", "180.00", time.Date(2020, time.December, 5, 0, 0, 0, 0, time.UTC))
 		gymSub := createTestSubscription("PureGym", "34.99", time.Date(2020, time.December, 8, 0, 0, 0, 0, time.UTC))
 
-		_, err := store.RecordSubscription(helloFreshSub)
+		_, err := store.RecordSubscription(ctx, userID, helloFreshSub)
 		assertDatabaseError(t, err)
-		wantedSubscription, err := store.RecordSubscription(riverfordSub)
+		wantedSubscription, err := store.RecordSubscription(ctx, userID, riverfordSub)
 		assertDatabaseError(t, err)
-		_, err = store.RecordSubscription(gymSub)
+		_, err = store.RecordSubscription(ctx, userID, gymSub)
 		assertDatabaseError(t, err)
 
-		gotSubscription, err := store.GetSubscription(wantedSubscription.ID)
+		gotSubscription, err := store.GetSubscription(ctx, userID, wantedSubscription.ID)
 		assertDatabaseError(t, err)
 
 		if gotSubscription.ID != wantedSubscription.ID {
@@ -264,7 +305,7 @@ func TestGetSubscriptionByIDFromDB(t *testing.T) {
 	})
 
 	t.Run("returns nil if a subscription with the given ID does not exist in the DB", func(t *testing.T) {
-		gotSubscription, err := store.GetSubscription(2)
+		gotSubscription, err := store.GetSubscription(ctx, userID, 2)
 		assertDatabaseError(t, err)
 
 		if gotSubscription != nil {
@@ -279,19 +320,20 @@ func TestGetSubscriptionByIDFromDB(t *testing.T) {
 func TestDeletingSubscriptionFromDB(t *testing.T) {
 	store, err := NewDatabaseConnection(os.Getenv("DATABASE_CONN_STRING"))
 	assertDatabaseError(t, err)
+	userID := createTestUser(t, store, "gary@gopher.com")
 
 	t.Run("deletes a subscription from the database", func(t *testing.T) {
 		subscription := createTestSubscription("BMC", "11.99", time.Date(2020, time.December, 1, 0, 0, 0, 0, time.UTC))
 
-		gotSubscription, err := store.RecordSubscription(subscription)
+		gotSubscription, err := store.RecordSubscription(ctx, userID, subscription)
 		assertDatabaseError(t, err)
 
 		subscriptionID := gotSubscription.ID
 
-		err = store.DeleteSubscription(subscriptionID)
+		err = store.DeleteSubscription(ctx, userID, subscriptionID)
 		assertDatabaseError(t, err)
 
-		gotSubscription, err = store.GetSubscription(subscriptionID)
+		gotSubscription, err = store.GetSubscription(ctx, userID, subscriptionID)
 		assertDatabaseError(t, err)
 
 		if gotSubscription != nil {
@@ -303,7 +345,7 @@ func TestDeletingSubscriptionFromDB(t *testing.T) {
 	})
 
 	t.Run("attempts to delete a subscription by an invalid ID", func(t *testing.T) {
-		err := store.DeleteSubscription(0)
+		err := store.DeleteSubscription(ctx, userID, 0)
 		if err == nil {
 			t.Errorf("deleting invalid subscription did not error")
 		}
@@ -312,15 +354,15 @@ func TestDeletingSubscriptionFromDB(t *testing.T) {
 	t.Run("deletes both instances of a subscription", func(t *testing.T) {
 		subscription := createTestSubscription("Apple TV", "7.99", time.Date(2020, time.December, 15, 0, 0, 0, 0, time.UTC))
 
-		_, err := store.RecordSubscription(subscription)
+		_, err := store.RecordSubscription(ctx, userID, subscription)
 		assertDatabaseError(t, err)
-		gotSubscription, err := store.RecordSubscription(subscription)
+		gotSubscription, err := store.RecordSubscription(ctx, userID, subscription)
 		assertDatabaseError(t, err)
 
-		err = store.DeleteSubscription(gotSubscription.ID)
+		err = store.DeleteSubscription(ctx, userID, gotSubscription.ID)
 		assertDatabaseError(t, err)
 
-		subscriptions, err := store.GetSubscriptions()
+		subscriptions, err := store.GetSubscriptions(ctx, userID)
 		assertDatabaseError(t, err)
 
 		if len(subscriptions) != 0 {
@@ -332,6 +374,403 @@ func TestDeletingSubscriptionFromDB(t *testing.T) {
 	})
 }
 
+func TestUpdatingSubscriptionInDB(t *testing.T) {
+	store, err := NewDatabaseConnection(os.Getenv("DATABASE_CONN_STRING"))
+	assertDatabaseError(t, err)
+	gary := createTestUser(t, store, "gary@gopher.com")
+	gwen := createTestUser(t, store, "gwen@gopher.com")
+
+	t.Run("replaces the fields of a subscription", func(t *testing.T) {
+		recordedSubscription, err := store.RecordSubscription(ctx, gary, createTestSubscription("Netflix", "9.99", time.Date(2020, time.December, 12, 0, 0, 0, 0, time.UTC)))
+		assertDatabaseError(t, err)
+
+		edited := *recordedSubscription
+		edited.Name = "Netflix Premium"
+		edited.Category = "Entertainment"
+		edited.Amount, _ = decimal.NewFromString("15.99")
+		edited.DateDue = time.Date(2021, time.January, 3, 0, 0, 0, 0, time.UTC)
+		edited.Frequency = subscription.EveryNMonths
+		edited.Interval = 2
+
+		updatedSubscription, err := store.UpdateSubscription(ctx, gary, edited)
+		assertDatabaseError(t, err)
+
+		gotSubscription, err := store.GetSubscription(ctx, gary, recordedSubscription.ID)
+		assertDatabaseError(t, err)
+
+		for _, got := range []*subscription.Subscription{updatedSubscription, gotSubscription} {
+			if got.Name != edited.Name || got.Category != edited.Category || !got.Amount.Equal(edited.Amount) || !got.DateDue.Equal(edited.DateDue) {
+				t.Errorf("database did not update the subscription, got %+v want %+v", got, edited)
+			}
+			if got.Frequency != edited.Frequency || got.Interval != edited.Interval {
+				t.Errorf("database did not update the cadence, got %s every %d want %s every %d", got.Frequency, got.Interval, edited.Frequency, edited.Interval)
+			}
+			if got.Merchant != recordedSubscription.Merchant {
+				t.Errorf("got merchant %q want %q", got.Merchant, recordedSubscription.Merchant)
+			}
+		}
+
+		err = clearSubscriptionsTable()
+		assertDatabaseError(t, err)
+	})
+
+	t.Run("does not update another user's subscription", func(t *testing.T) {
+		recordedSubscription, err := store.RecordSubscription(ctx, gary, createTestSubscription("Spotify", "9.99", time.Date(2020, time.December, 1, 0, 0, 0, 0, time.UTC)))
+		assertDatabaseError(t, err)
+
+		edited := *recordedSubscription
+		edited.Name = "Not Spotify"
+		updatedSubscription, err := store.UpdateSubscription(ctx, gwen, edited)
+		assertDatabaseError(t, err)
+		if updatedSubscription != nil {
+			t.Errorf("got %+v updating another user's subscription want nil", updatedSubscription)
+		}
+
+		gotSubscription, err := store.GetSubscription(ctx, gary, recordedSubscription.ID)
+		assertDatabaseError(t, err)
+		if gotSubscription.Name != "Spotify" {
+			t.Errorf("got name %q want the subscription unchanged", gotSubscription.Name)
+		}
+
+		err = clearSubscriptionsTable()
+		assertDatabaseError(t, err)
+	})
+}
+
+func TestRenewingSubscriptionInDB(t *testing.T) {
+	store, err := NewDatabaseConnection(os.Getenv("DATABASE_CONN_STRING"))
+	assertDatabaseError(t, err)
+	userID := createTestUser(t, store, "gary@gopher.com")
+
+	t.Run("moves the due date on and records the renewals", func(t *testing.T) {
+		recordedSubscription, err := store.RecordSubscription(ctx, userID, createTestSubscription("Netflix", "9.99", time.Date(2020, time.September, 12, 0, 0, 0, 0, time.UTC)))
+		assertDatabaseError(t, err)
+
+		dateDue, renewals := recordedSubscription.Rollover(time.Date(2020, time.November, 20, 0, 0, 0, 0, time.UTC))
+
+		err = store.RenewSubscription(ctx, userID, recordedSubscription.ID, dateDue, renewals)
+		assertDatabaseError(t, err)
+
+		gotSubscription, err := store.GetSubscription(ctx, userID, recordedSubscription.ID)
+		assertDatabaseError(t, err)
+
+		if !gotSubscription.DateDue.Equal(dateDue) {
+			t.Errorf("database did not move the due date on, got %v want %v", gotSubscription.DateDue, dateDue)
+		}
+		if !gotSubscription.Anchor.Equal(recordedSubscription.DateDue) {
+			t.Errorf("database moved the anchor, got %v want %v", gotSubscription.Anchor, recordedSubscription.DateDue)
+		}
+
+		gotRenewals, err := store.GetRenewals(ctx, userID, recordedSubscription.ID)
+		assertDatabaseError(t, err)
+
+		if len(gotRenewals) != 3 {
+			t.Errorf("database did not return the renewals, got %v want %v", gotRenewals, renewals)
+		}
+
+		err = clearSubscriptionsTable()
+		assertDatabaseError(t, err)
+	})
+
+	t.Run("does not record renewals twice", func(t *testing.T) {
+		recordedSubscription, err := store.RecordSubscription(ctx, userID, createTestSubscription("Spotify", "9.99", time.Date(2020, time.October, 1, 0, 0, 0, 0, time.UTC)))
+		assertDatabaseError(t, err)
+
+		dateDue, renewals := recordedSubscription.Rollover(time.Date(2020, time.November, 20, 0, 0, 0, 0, time.UTC))
+
+		err = store.RenewSubscription(ctx, userID, recordedSubscription.ID, dateDue, renewals)
+		assertDatabaseError(t, err)
+		err = store.RenewSubscription(ctx, userID, recordedSubscription.ID, dateDue, renewals)
+		assertDatabaseError(t, err)
+
+		gotRenewals, err := store.GetRenewals(ctx, userID, recordedSubscription.ID)
+		assertDatabaseError(t, err)
+
+		if len(gotRenewals) != len(renewals) {
+			t.Errorf("database recorded renewals twice, got %d want %d", len(gotRenewals), len(renewals))
+		}
+
+		err = clearSubscriptionsTable()
+		assertDatabaseError(t, err)
+	})
+}
+
+func TestCandidatesInDB(t *testing.T) {
+	store, err := NewDatabaseConnection(os.Getenv("DATABASE_CONN_STRING"))
+	assertDatabaseError(t, err)
+	userID := createTestUser(t, store, "gary@gopher.com")
+
+	newCandidate := func(amount string) subscription.Candidate {
+		sub := createTestSubscription("NETFLIX.COM", amount, time.Date(2020, time.December, 12, 0, 0, 0, 0, time.UTC))
+		sub.Merchant = "netflix"
+		sub.Frequency = subscription.Monthly
+		sub.Interval = 1
+		return subscription.Candidate{
+			Subscription: sub,
+			Merchant:     "netflix",
+			Confidence:   0.75,
+			Transactions: []plaid.Transaction{{Amount: 9.99, Date: "2020-10-12", Name: "NETFLIX.COM"}, {Amount: 9.99, Date: "2020-11-12", Name: "NETFLIX.COM"}},
+		}
+	}
+
+	t.Run("stores a candidate with its supporting transactions", func(t *testing.T) {
+		recorded, err := store.RecordCandidate(ctx, userID, newCandidate("9.99"))
+		assertDatabaseError(t, err)
+
+		got, err := store.GetCandidate(ctx, userID, recorded.ID)
+		assertDatabaseError(t, err)
+
+		if got.Merchant != "netflix" || got.Confidence != 0.75 || len(got.Transactions) != 2 {
+			t.Errorf("database did not return the candidate, got %v", got)
+		}
+
+		err = clearCandidateTables()
+		assertDatabaseError(t, err)
+	})
+
+	t.Run("replaces the pending candidate for the same merchant", func(t *testing.T) {
+		first, err := store.RecordCandidate(ctx, userID, newCandidate("9.99"))
+		assertDatabaseError(t, err)
+		second, err := store.RecordCandidate(ctx, userID, newCandidate("10.99"))
+		assertDatabaseError(t, err)
+
+		candidates, err := store.GetCandidates(ctx, userID)
+		assertDatabaseError(t, err)
+
+		if len(candidates) != 1 || first.ID != second.ID || candidates[0].Subscription.Amount.String() != "10.99" {
+			t.Errorf("database did not replace the candidate, got %v", candidates)
+		}
+
+		err = clearCandidateTables()
+		assertDatabaseError(t, err)
+	})
+
+	t.Run("deletes a candidate", func(t *testing.T) {
+		recorded, err := store.RecordCandidate(ctx, userID, newCandidate("9.99"))
+		assertDatabaseError(t, err)
+
+		err = store.DeleteCandidate(ctx, userID, recorded.ID)
+		assertDatabaseError(t, err)
+
+		got, err := store.GetCandidate(ctx, userID, recorded.ID)
+		assertDatabaseError(t, err)
+		if got != nil {
+			t.Errorf("database did not delete the candidate, got %v", got)
+		}
+
+		err = clearCandidateTables()
+		assertDatabaseError(t, err)
+	})
+
+	t.Run("remembers rejected merchants", func(t *testing.T) {
+		err := store.RejectMerchant(ctx, userID, "netflix")
+		assertDatabaseError(t, err)
+		err = store.RejectMerchant(ctx, userID, "netflix")
+		assertDatabaseError(t, err)
+
+		rejected, err := store.GetRejectedMerchants(ctx, userID)
+		assertDatabaseError(t, err)
+		if len(rejected) != 1 || rejected[0] != "netflix" {
+			t.Errorf("got rejected merchants %v want %v", rejected, []string{"netflix"})
+		}
+
+		err = store.DeleteRejectedMerchant(ctx, userID, "netflix")
+		assertDatabaseError(t, err)
+
+		rejected, err = store.GetRejectedMerchants(ctx, userID)
+		assertDatabaseError(t, err)
+		if len(rejected) != 0 {
+			t.Errorf("got rejected merchants %v want none", rejected)
+		}
+
+		err = clearCandidateTables()
+		assertDatabaseError(t, err)
+	})
+}
+
+func TestPlaidItemsInDB(t *testing.T) {
+	store, err := NewDatabaseConnection(os.Getenv("DATABASE_CONN_STRING"))
+	assertDatabaseError(t, err)
+	userID := createTestUser(t, store, "gary@gopher.com")
+
+	item := plaid.Item{UserID: userID, Source: "plaid", ItemID: "item-sandbox", InstitutionID: "ins_3", AccessToken: "encrypted-token", CreatedAt: time.Now()}
+
+	t.Run("stores a linked item and replaces its access token", func(t *testing.T) {
+		first, err := store.RecordPlaidItem(ctx, item)
+		assertDatabaseError(t, err)
+
+		relinked := item
+		relinked.AccessToken = "new-encrypted-token"
+		second, err := store.RecordPlaidItem(ctx, relinked)
+		assertDatabaseError(t, err)
+
+		items, err := store.GetPlaidItems(ctx, userID)
+		assertDatabaseError(t, err)
+
+		if len(items) != 1 || first.ID != second.ID || items[0].AccessToken != "new-encrypted-token" || items[0].Source != "plaid" {
+			t.Errorf("database did not store the linked item, got %v", items)
+		}
+
+		err = clearPlaidItemsTable()
+		assertDatabaseError(t, err)
+	})
+
+	t.Run("saves the sync cursor and status of a linked item", func(t *testing.T) {
+		recorded, err := store.RecordPlaidItem(ctx, item)
+		assertDatabaseError(t, err)
+
+		err = store.UpdatePlaidItemCursor(ctx, userID, recorded.ID, "cursor-2")
+		assertDatabaseError(t, err)
+		err = store.UpdatePlaidItemStatus(ctx, userID, recorded.ID, "ITEM_LOGIN_REQUIRED")
+		assertDatabaseError(t, err)
+
+		items, err := store.GetPlaidItems(ctx, userID)
+		assertDatabaseError(t, err)
+		if len(items) != 1 || items[0].Cursor != "cursor-2" || items[0].Status != "ITEM_LOGIN_REQUIRED" {
+			t.Errorf("database did not save the cursor and status, got %v", items)
+		}
+
+		err = clearPlaidItemsTable()
+		assertDatabaseError(t, err)
+	})
+
+	t.Run("deletes a linked item", func(t *testing.T) {
+		recorded, err := store.RecordPlaidItem(ctx, item)
+		assertDatabaseError(t, err)
+
+		err = store.DeletePlaidItem(ctx, userID, recorded.ID)
+		assertDatabaseError(t, err)
+
+		items, err := store.GetPlaidItems(ctx, userID)
+		assertDatabaseError(t, err)
+		if len(items) != 0 {
+			t.Errorf("database did not delete the linked item, got %v", items)
+		}
+
+		err = clearPlaidItemsTable()
+		assertDatabaseError(t, err)
+	})
+}
+
+func TestTransactionsInDB(t *testing.T) {
+	store, err := NewDatabaseConnection(os.Getenv("DATABASE_CONN_STRING"))
+	assertDatabaseError(t, err)
+	userID := createTestUser(t, store, "gary@gopher.com")
+
+	newTransaction := func(externalID string, amount string, date time.Time) transaction.Transaction {
+		value, _ := decimal.NewFromString(amount)
+		return transaction.Transaction{ExternalID: externalID, AccountID: "acc-1", Name: "NETFLIX.COM", Merchant: "netflix", Amount: value, Currency: "GBP", Date: date}
+	}
+	october := time.Date(2020, time.October, 12, 0, 0, 0, 0, time.UTC)
+	november := time.Date(2020, time.November, 12, 0, 0, 0, 0, time.UTC)
+
+	t.Run("stores transactions most recent first", func(t *testing.T) {
+		err := store.RecordTransactions(ctx, userID, []transaction.Transaction{newTransaction("tx-1", "9.99", october), newTransaction("tx-2", "9.99", november)})
+		assertDatabaseError(t, err)
+
+		got, err := store.GetTransactions(ctx, userID)
+		assertDatabaseError(t, err)
+
+		if len(got) != 2 || got[0].ExternalID != "tx-2" || got[1].Merchant != "netflix" || got[1].Currency != "GBP" {
+			t.Errorf("database did not return the transactions, got %v", got)
+		}
+
+		err = clearTransactionsTable()
+		assertDatabaseError(t, err)
+	})
+
+	t.Run("updates a transaction imported again", func(t *testing.T) {
+		pending := newTransaction("tx-1", "9.99", october)
+		pending.Pending = true
+		err := store.RecordTransactions(ctx, userID, []transaction.Transaction{pending})
+		assertDatabaseError(t, err)
+		err = store.RecordTransactions(ctx, userID, []transaction.Transaction{newTransaction("tx-1", "10.99", october)})
+		assertDatabaseError(t, err)
+
+		got, err := store.GetTransactions(ctx, userID)
+		assertDatabaseError(t, err)
+
+		if len(got) != 1 || got[0].Pending || got[0].Amount.String() != "10.99" {
+			t.Errorf("database did not update the transaction, got %v", got)
+		}
+
+		err = clearTransactionsTable()
+		assertDatabaseError(t, err)
+	})
+
+	t.Run("returns the payments matched to a subscription with it", func(t *testing.T) {
+		sub, err := store.RecordSubscription(ctx, userID, createTestSubscription("Netflix", "9.99", time.Date(2020, time.December, 12, 0, 0, 0, 0, time.UTC)))
+		assertDatabaseError(t, err)
+		err = store.RecordTransactions(ctx, userID, []transaction.Transaction{newTransaction("tx-1", "9.99", october), newTransaction("tx-2", "9.99", november), newTransaction("tx-3", "4.99", november)})
+		assertDatabaseError(t, err)
+
+		err = store.MatchPayments(ctx, userID, sub.ID, []string{"tx-1", "tx-2"})
+		assertDatabaseError(t, err)
+
+		got, err := store.GetSubscription(ctx, userID, sub.ID)
+		assertDatabaseError(t, err)
+		if len(got.Payments) != 2 || got.Payments[0].ExternalID != "tx-2" || got.Payments[0].SubscriptionID != sub.ID {
+			t.Errorf("database did not return the payments, got %v", got.Payments)
+		}
+
+		subscriptions, err := store.GetSubscriptions(ctx, userID)
+		assertDatabaseError(t, err)
+		if len(subscriptions) != 1 || len(subscriptions[0].Payments) != 2 {
+			t.Errorf("database did not return the payments with the subscriptions, got %v", subscriptions)
+		}
+
+		err = clearTransactionsTable()
+		assertDatabaseError(t, err)
+		err = clearSubscriptionsTable()
+		assertDatabaseError(t, err)
+	})
+
+	t.Run("unmatches the payments of an edited subscription", func(t *testing.T) {
+		sub, err := store.RecordSubscription(ctx, userID, createTestSubscription("Netflix", "9.99", time.Date(2020, time.December, 12, 0, 0, 0, 0, time.UTC)))
+		assertDatabaseError(t, err)
+		err = store.RecordTransactions(ctx, userID, []transaction.Transaction{newTransaction("tx-1", "9.99", october)})
+		assertDatabaseError(t, err)
+		err = store.MatchPayments(ctx, userID, sub.ID, []string{"tx-1"})
+		assertDatabaseError(t, err)
+
+		edited := *sub
+		edited.Merchant = "spotify"
+		updated, err := store.UpdateSubscription(ctx, userID, edited)
+		assertDatabaseError(t, err)
+		if len(updated.Payments) != 0 {
+			t.Errorf("database did not unmatch the payments, got %v", updated.Payments)
+		}
+
+		got, err := store.GetTransactions(ctx, userID)
+		assertDatabaseError(t, err)
+		if len(got) != 1 || got[0].SubscriptionID != 0 {
+			t.Errorf("database did not unmatch the transaction, got %v", got)
+		}
+
+		err = clearTransactionsTable()
+		assertDatabaseError(t, err)
+		err = clearSubscriptionsTable()
+		assertDatabaseError(t, err)
+	})
+
+	t.Run("deletes transactions by external ID", func(t *testing.T) {
+		err := store.RecordTransactions(ctx, userID, []transaction.Transaction{newTransaction("tx-1", "9.99", october), newTransaction("tx-2", "9.99", november)})
+		assertDatabaseError(t, err)
+
+		err = store.DeleteTransactions(ctx, userID, []string{"tx-1"})
+		assertDatabaseError(t, err)
+
+		got, err := store.GetTransactions(ctx, userID)
+		assertDatabaseError(t, err)
+		if len(got) != 1 || got[0].ExternalID != "tx-2" {
+			t.Errorf("database did not delete the transaction, got %v", got)
+		}
+
+		err = clearTransactionsTable()
+		assertDatabaseError(t, err)
+	})
+}
+
 func TestUserprofilesDatabase(t *testing.T) {
 	usersName := "Gary Gopher"
 	usersEmail := "gary@gopher.com"
@@ -339,30 +778,47 @@ func TestUserprofilesDatabase(t *testing.T) {
 	store, err := NewDatabaseConnection(os.Getenv("DATABASE_CONN_STRING"))
 	assertDatabaseError(t, err)
 
-	t.Run("add name and email", func(t *testing.T) {
-		returnedDetails, err := store.RecordUserDetails(usersName, usersEmail)
+	t.Run("creates a user and finds them by email", func(t *testing.T) {
+		createdUser, err := store.CreateUser(ctx, usersName, usersEmail, "password-hash")
 		assertDatabaseError(t, err)
 
-		if returnedDetails == nil {
-			t.Fatalf("no user details recorded: %v", err)
-		}
+		gotUser, err := store.GetUserByEmail(ctx, usersEmail)
+		assertDatabaseError(t, err)
 
-		if returnedDetails.Name != usersName {
-			t.Errorf("incorrect user name returned got %v want %v", returnedDetails.Name, usersName)
+		if gotUser == nil || gotUser.ID != createdUser.ID || gotUser.Name != usersName || gotUser.PasswordHash != "password-hash" {
+			t.Errorf("database did not return the created user, got %v want %v", gotUser, createdUser)
 		}
 
-		if returnedDetails.Email != usersEmail {
-			t.Errorf("incorrect email returned got %v want %v", returnedDetails.Name, usersEmail)
+		err = clearUsersTable()
+		assertDatabaseError(t, err)
+	})
+
+	t.Run("does not create two users with the same email", func(t *testing.T) {
+		_, err := store.CreateUser(ctx, usersName, usersEmail, "password-hash")
+		assertDatabaseError(t, err)
+
+		_, err = store.CreateUser(ctx, "Gwen Gopher", usersEmail, "other-hash")
+		if !errors.Is(err, account.ErrEmailTaken) {
+			t.Errorf("got error %v want %v", err, account.ErrEmailTaken)
 		}
+
 		err = clearUsersTable()
 		assertDatabaseError(t, err)
 	})
 
-	t.Run("get name and email from database", func(t *testing.T) {
-		_, err := store.RecordUserDetails(usersName, usersEmail)
+	t.Run("returns nil for an email without a user", func(t *testing.T) {
+		gotUser, err := store.GetUserByEmail(ctx, "nobody@gopher.com")
 		assertDatabaseError(t, err)
 
-		gotDetails, err := store.GetUserDetails()
+		if gotUser != nil {
+			t.Errorf("database returned a user for an unknown email, got %v", gotUser)
+		}
+	})
+
+	t.Run("get name and email from database", func(t *testing.T) {
+		userID := createTestUser(t, store, usersEmail)
+
+		gotDetails, err := store.GetUserDetails(ctx, userID)
 		assertDatabaseError(t, err)
 
 		if gotDetails.Name != usersName {
@@ -373,18 +829,21 @@ func TestUserprofilesDatabase(t *testing.T) {
 			t.Errorf("incorrect email retrieved got %v want %v", gotDetails.Email, usersEmail)
 		}
 
+		if gotDetails.PasswordHash != "" {
+			t.Errorf("user details included the password hash %q", gotDetails.PasswordHash)
+		}
+
 		err = clearUsersTable()
 		assertDatabaseError(t, err)
 	})
 
 	t.Run("update name and email", func(t *testing.T) {
-		_, err := store.RecordUserDetails(usersName, usersEmail)
-		assertDatabaseError(t, err)
+		userID := createTestUser(t, store, usersEmail)
 
 		updatedName := "Gwen Gopher"
 		updatedEmail := "gwen@gopher.com"
 
-		updatedUser, err := store.RecordUserDetails(updatedName, updatedEmail)
+		updatedUser, err := store.RecordUserDetails(ctx, userID, updatedName, updatedEmail)
 		assertDatabaseError(t, err)
 
 		if updatedUser.Name != updatedName {
@@ -397,6 +856,228 @@ func TestUserprofilesDatabase(t *testing.T) {
 		err = clearUsersTable()
 		assertDatabaseError(t, err)
 	})
+
+	t.Run("does not update a user to another user's email", func(t *testing.T) {
+		userID := createTestUser(t, store, usersEmail)
+		createTestUser(t, store, "gwen@gopher.com")
+
+		_, err := store.RecordUserDetails(ctx, userID, usersName, "gwen@gopher.com")
+		if !errors.Is(err, account.ErrEmailTaken) {
+			t.Errorf("got error %v want %v", err, account.ErrEmailTaken)
+		}
+
+		err = clearUsersTable()
+		assertDatabaseError(t, err)
+	})
+}
+
+func TestSessionsInDB(t *testing.T) {
+	store, err := NewDatabaseConnection(os.Getenv("DATABASE_CONN_STRING"))
+	assertDatabaseError(t, err)
+	userID := createTestUser(t, store, "gary@gopher.com")
+
+	t.Run("stores, finds and deletes a session by its token hash", func(t *testing.T) {
+		token, session, err := account.NewSession(userID, time.Now())
+		assertDatabaseError(t, err)
+
+		err = store.CreateSession(ctx, session)
+		assertDatabaseError(t, err)
+
+		got, err := store.GetSession(ctx, account.HashToken(token))
+		assertDatabaseError(t, err)
+		if got == nil || got.UserID != userID {
+			t.Errorf("database did not return the session, got %v want %v", got, session)
+		}
+
+		err = store.DeleteSession(ctx, session.TokenHash)
+		assertDatabaseError(t, err)
+
+		got, err = store.GetSession(ctx, session.TokenHash)
+		assertDatabaseError(t, err)
+		if got != nil {
+			t.Errorf("database did not delete the session, got %v", got)
+		}
+	})
+
+	err = clearUsersTable()
+	assertDatabaseError(t, err)
+}
+
+func TestIdentitiesInDB(t *testing.T) {
+	store, err := NewDatabaseConnection(os.Getenv("DATABASE_CONN_STRING"))
+	assertDatabaseError(t, err)
+	err = clearUsersTable()
+	assertDatabaseError(t, err)
+
+	t.Run("creates a user without a password and finds them by their identity", func(t *testing.T) {
+		created, err := store.CreateUserWithIdentity(ctx, "Gary Gopher", "gary@gopher.com", "https://idp.example.com", "user-1")
+		assertDatabaseError(t, err)
+
+		got, err := store.GetUserByIdentity(ctx, "https://idp.example.com", "user-1")
+		assertDatabaseError(t, err)
+		if got == nil || got.ID != created.ID || got.Email != "gary@gopher.com" || got.PasswordHash != "" {
+			t.Errorf("database did not find the user by their identity, got %+v want %+v", got, created)
+		}
+
+		got, err = store.GetUserByIdentity(ctx, "https://other.example.com", "user-1")
+		assertDatabaseError(t, err)
+		if got != nil {
+			t.Errorf("found a user for the same subject at another issuer, got %+v", got)
+		}
+	})
+
+	t.Run("returns ErrEmailTaken without linking the identity to another user", func(t *testing.T) {
+		_, err := store.CreateUserWithIdentity(ctx, "Gary Gopher", "gary@gopher.com", "https://idp.example.com", "user-2")
+		if !errors.Is(err, account.ErrEmailTaken) {
+			t.Errorf("got %v want %v", err, account.ErrEmailTaken)
+		}
+
+		got, err := store.GetUserByIdentity(ctx, "https://idp.example.com", "user-2")
+		assertDatabaseError(t, err)
+		if got != nil {
+			t.Errorf("linked the identity to another user, got %+v", got)
+		}
+	})
+
+	err = clearUsersTable()
+	assertDatabaseError(t, err)
+}
+
+func TestAPITokensInDB(t *testing.T) {
+	store, err := NewDatabaseConnection(os.Getenv("DATABASE_CONN_STRING"))
+	assertDatabaseError(t, err)
+	gary := createTestUser(t, store, "gary@gopher.com")
+	gwen := createTestUser(t, store, "gwen@gopher.com")
+
+	t.Run("stores, finds, records the use of and deletes a token", func(t *testing.T) {
+		token, apiToken, err := account.NewAPIToken(gary, "deploy script", account.ReadOnly, time.Now())
+		assertDatabaseError(t, err)
+
+		created, err := store.CreateAPIToken(ctx, apiToken)
+		assertDatabaseError(t, err)
+		if created.ID == 0 || created.Name != "deploy script" || created.Scope != account.ReadOnly || created.LastUsedAt != nil {
+			t.Errorf("database did not store the token, got %+v", created)
+		}
+
+		got, err := store.GetAPITokenByHash(ctx, account.HashToken(token))
+		assertDatabaseError(t, err)
+		if got == nil || got.ID != created.ID || got.UserID != gary {
+			t.Errorf("database did not find the token by its hash, got %+v", got)
+		}
+
+		usedAt := time.Date(2020, time.November, 1, 12, 0, 0, 0, time.UTC)
+		err = store.RecordAPITokenUse(ctx, gary, created.ID, usedAt)
+		assertDatabaseError(t, err)
+
+		tokens, err := store.GetAPITokens(ctx, gary)
+		assertDatabaseError(t, err)
+		if len(tokens) != 1 || tokens[0].LastUsedAt == nil || !tokens[0].LastUsedAt.Equal(usedAt) {
+			t.Errorf("database did not record when the token was used, got %+v", tokens)
+		}
+
+		err = store.DeleteAPIToken(ctx, gwen, created.ID)
+		if err == nil {
+			t.Errorf("database let another user delete the token")
+		}
+
+		tokens, err = store.GetAPITokens(ctx, gwen)
+		assertDatabaseError(t, err)
+		if len(tokens) != 0 {
+			t.Errorf("got another user's tokens %+v", tokens)
+		}
+
+		err = store.DeleteAPIToken(ctx, gary, created.ID)
+		assertDatabaseError(t, err)
+
+		got, err = store.GetAPITokenByHash(ctx, created.TokenHash)
+		assertDatabaseError(t, err)
+		if got != nil {
+			t.Errorf("database did not delete the token, got %+v", got)
+		}
+	})
+
+	err = clearUsersTable()
+	assertDatabaseError(t, err)
+}
+
+func TestUsersDataIsSeparateInDB(t *testing.T) {
+	store, err := NewDatabaseConnection(os.Getenv("DATABASE_CONN_STRING"))
+	assertDatabaseError(t, err)
+	gary := createTestUser(t, store, "gary@gopher.com")
+	gwen := createTestUser(t, store, "gwen@gopher.com")
+
+	t.Run("only returns a user's own subscriptions", func(t *testing.T) {
+		recorded, err := store.RecordSubscription(ctx, gary, createTestSubscription("Netflix", "9.99", time.Date(2020, time.December, 12, 0, 0, 0, 0, time.UTC)))
+		assertDatabaseError(t, err)
+
+		subscriptions, err := store.GetSubscriptions(ctx, gwen)
+		assertDatabaseError(t, err)
+		if len(subscriptions) != 0 {
+			t.Errorf("got another user's subscriptions %v", subscriptions)
+		}
+
+		got, err := store.GetSubscription(ctx, gwen, recorded.ID)
+		assertDatabaseError(t, err)
+		if got != nil {
+			t.Errorf("got another user's subscription %v", got)
+		}
+
+		err = store.DeleteSubscription(ctx, gwen, recorded.ID)
+		if err == nil {
+			t.Errorf("deleting another user's subscription did not error")
+		}
+
+		got, err = store.GetSubscription(ctx, gary, recorded.ID)
+		assertDatabaseError(t, err)
+		if got == nil {
+			t.Errorf("another user deleted the subscription")
+		}
+	})
+
+	t.Run("does not renew another user's subscription", func(t *testing.T) {
+		recorded, err := store.RecordSubscription(ctx, gary, createTestSubscription("Spotify", "9.99", time.Date(2020, time.October, 1, 0, 0, 0, 0, time.UTC)))
+		assertDatabaseError(t, err)
+
+		dateDue, renewals := recorded.Rollover(time.Date(2020, time.November, 20, 0, 0, 0, 0, time.UTC))
+		err = store.RenewSubscription(ctx, gwen, recorded.ID, dateDue, renewals)
+		assertDatabaseError(t, err)
+
+		got, err := store.GetSubscription(ctx, gary, recorded.ID)
+		assertDatabaseError(t, err)
+		if !got.DateDue.Equal(recorded.DateDue) {
+			t.Errorf("another user moved the subscription on to %v", got.DateDue)
+		}
+
+		err = store.RenewSubscription(ctx, gary, recorded.ID, dateDue, renewals)
+		assertDatabaseError(t, err)
+
+		gotRenewals, err := store.GetRenewals(ctx, gwen, recorded.ID)
+		assertDatabaseError(t, err)
+		if len(gotRenewals) != 0 {
+			t.Errorf("got another user's renewals %v", gotRenewals)
+		}
+	})
+
+	t.Run("keeps each user's merchant aliases separate", func(t *testing.T) {
+		recorded, err := store.RecordMerchantAlias(ctx, gary, merchant.Alias{Pattern: "amzn", Merchant: "amazon"})
+		assertDatabaseError(t, err)
+		_, err = store.RecordMerchantAlias(ctx, gwen, merchant.Alias{Pattern: "amzn", Merchant: "amazon prime"})
+		assertDatabaseError(t, err)
+
+		err = store.DeleteMerchantAlias(ctx, gwen, recorded.ID)
+		if err == nil {
+			t.Errorf("deleting another user's merchant alias did not error")
+		}
+
+		aliases, err := store.GetMerchantAliases(ctx, gary)
+		assertDatabaseError(t, err)
+		if len(aliases) != 1 || aliases[0].Merchant != "amazon" {
+			t.Errorf("got merchant aliases %v want only the user's own", aliases)
+		}
+	})
+
+	err = clearUsersTable()
+	assertDatabaseError(t, err)
 }
 
 func createTestSubscription(name string, price string, date time.Time) subscription.Subscription {
@@ -414,7 +1095,37 @@ func clearSubscriptionsTable() error {
 	if err != nil {
 		return fmt.Errorf("unexpected connection error: %w", err)
 	}
-	_, err = db.ExecContext(context.Background(), "TRUNCATE TABLE subscriptions;")
+	_, err = db.ExecContext(context.Background(), "TRUNCATE TABLE subscriptions CASCADE;")
+
+	return err
+}
+
+func clearCandidateTables() error {
+	db, err := sql.Open("pgx", os.Getenv("DATABASE_CONN_STRING"))
+	if err != nil {
+		return fmt.Errorf("unexpected connection error: %w", err)
+	}
+	_, err = db.ExecContext(context.Background(), "TRUNCATE TABLE candidates, rejected_merchants;")
+
+	return err
+}
+
+func clearPlaidItemsTable() error {
+	db, err := sql.Open("pgx", os.Getenv("DATABASE_CONN_STRING"))
+	if err != nil {
+		return fmt.Errorf("unexpected connection error: %w", err)
+	}
+	_, err = db.ExecContext(context.Background(), "TRUNCATE TABLE plaid_items;")
+
+	return err
+}
+
+func clearTransactionsTable() error {
+	db, err := sql.Open("pgx", os.Getenv("DATABASE_CONN_STRING"))
+	if err != nil {
+		return fmt.Errorf("unexpected connection error: %w", err)
+	}
+	_, err = db.ExecContext(context.Background(), "TRUNCATE TABLE transactions;")
 
 	return err
 }
@@ -424,11 +1135,23 @@ func clearUsersTable() error {
 	if err != nil {
 		return fmt.Errorf("unexpected connection error: %w", err)
 	}
-	_, err = db.ExecContext(context.Background(), "TRUNCATE TABLE users;")
+	_, err = db.ExecContext(context.Background(), "TRUNCATE TABLE users CASCADE;")
 
 	return err
 }
 
+// createTestUser returns the ID of the user with the email, creating them if they are not stored yet
+func createTestUser(t *testing.T, store *Database, email string) int {
+	t.Helper()
+	user, err := store.GetUserByEmail(ctx, email)
+	assertDatabaseError(t, err)
+	if user == nil {
+		user, err = store.CreateUser(ctx, "Gary Gopher", email, "password-hash")
+		assertDatabaseError(t, err)
+	}
+	return user.ID
+}
+
 func assertDatabaseError(t *testing.T, err error) {
 	t.Helper()
 	if err != nil {
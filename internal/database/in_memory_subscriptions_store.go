@@ -1,71 +1,577 @@
 package database
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"time"
 
+	"github.com/Catzkorn/subscrypt/internal/account"
+	"github.com/Catzkorn/subscrypt/internal/merchant"
+	"github.com/Catzkorn/subscrypt/internal/plaid"
 	"github.com/Catzkorn/subscrypt/internal/subscription"
+	"github.com/Catzkorn/subscrypt/internal/transaction"
 	"github.com/Catzkorn/subscrypt/internal/userprofile"
 )
 
 // NewInMemorySubscriptionStore returns a instance of InMemorySubscriptionStore
 func NewInMemorySubscriptionStore() *InMemorySubscriptionStore {
-	return &InMemorySubscriptionStore{[]subscription.Subscription{}, &userprofile.Userprofile{}}
+	return &InMemorySubscriptionStore{
+		subscriptions: []subscription.Subscription{},
+		users:         []userprofile.Userprofile{},
+		sessions:      map[string]account.Session{},
+		identities:    map[identity]int{},
+		apiTokens:     []account.APIToken{},
+		renewals:      map[int][]subscription.Renewal{},
+		aliases:       []merchant.Alias{},
+		candidates:    []subscription.Candidate{},
+		rejected:      map[int][]string{},
+		plaidItems:    []plaid.Item{},
+		transactions:  []transaction.Transaction{},
+		owners:        map[int]int{},
+	}
 }
 
 // InMemorySubscriptionStore stores information about individual subscriptions
+// Every record is given an ID from the same sequence, so owners maps the ID of any record to the user it belongs to.
 type InMemorySubscriptionStore struct {
 	subscriptions []subscription.Subscription
-	userProfile   *userprofile.Userprofile
+	users         []userprofile.Userprofile
+	sessions      map[string]account.Session
+	identities    map[identity]int
+	apiTokens     []account.APIToken
+	renewals      map[int][]subscription.Renewal
+	aliases       []merchant.Alias
+	candidates    []subscription.Candidate
+	rejected      map[int][]string
+	plaidItems    []plaid.Item
+	transactions  []transaction.Transaction
+	owners        map[int]int
+	lastID        int
+}
+
+// GetSubscriptions is a method that returns the user's subscriptions
+func (i *InMemorySubscriptionStore) GetSubscriptions(ctx context.Context, userID int) ([]subscription.Subscription, error) {
+	subscriptions := []subscription.Subscription{}
+	for _, sub := range i.subscriptions {
+		if i.owners[sub.ID] != userID {
+			continue
+		}
+		sub.Payments = i.payments(sub.ID)
+		subscriptions = append(subscriptions, sub)
+	}
+	return subscriptions, nil
 }
 
-// GetSubscriptions is a method that returns all subscriptions
-func (i *InMemorySubscriptionStore) GetSubscriptions() ([]subscription.Subscription, error) {
-	return i.subscriptions, nil
+// GetAllSubscriptions returns every user's subscriptions
+func (i *InMemorySubscriptionStore) GetAllSubscriptions(ctx context.Context) ([]subscription.Subscription, error) {
+	return append([]subscription.Subscription{}, i.subscriptions...), nil
 }
 
-// GetSubscription retrieves a single subscription that has the given ID from the InMemoryDataStore
-// If no subscription is found with the given ID, it returns a nil pointer
-func (i *InMemorySubscriptionStore) GetSubscription(ID int) (*subscription.Subscription, error) {
+// GetSubscription retrieves a single subscription of the user that has the given ID from the InMemoryDataStore
+// If the user has no subscription with the given ID, it returns a nil pointer
+func (i *InMemorySubscriptionStore) GetSubscription(ctx context.Context, userID int, ID int) (*subscription.Subscription, error) {
 	index := i.findSubscriptionIndex(ID)
-	if index == -1 {
+	if index == -1 || i.owners[ID] != userID {
 		return nil, nil
 	}
-	return &i.subscriptions[index], nil
+	sub := i.subscriptions[index]
+	sub.Payments = i.payments(ID)
+	return &sub, nil
 }
 
-// RecordSubscription is a method that stores a subscription into the store
-func (i *InMemorySubscriptionStore) RecordSubscription(subscription subscription.Subscription) (*subscription.Subscription, error) {
+// RecordSubscription is a method that stores a subscription for the user into the store
+func (i *InMemorySubscriptionStore) RecordSubscription(ctx context.Context, userID int, subscription subscription.Subscription) (*subscription.Subscription, error) {
+	subscription.ID = i.nextID(userID)
+	subscription.UserID = userID
+	subscription.Anchor = subscription.DateDue
+	if subscription.Merchant == "" {
+		subscription.Merchant = merchant.Normalize(subscription.Name)
+	}
 	i.subscriptions = append(i.subscriptions, subscription)
 	return &subscription, nil
 }
 
-// DeleteSubscription deletes a subscription from the data store with the given ID
-func (i *InMemorySubscriptionStore) DeleteSubscription(subscriptionID int) error {
+// UpdateSubscription replaces the user's subscription with the given one of the same ID and unmatches its payments,
+// returning nil if the user has no such subscription
+func (i *InMemorySubscriptionStore) UpdateSubscription(ctx context.Context, userID int, sub subscription.Subscription) (*subscription.Subscription, error) {
+	index := i.findSubscriptionIndex(sub.ID)
+	if index == -1 || i.owners[sub.ID] != userID {
+		return nil, nil
+	}
+
+	sub.UserID = userID
+	sub.Payments = nil
+	if sub.Merchant == "" {
+		sub.Merchant = merchant.Normalize(sub.Name)
+	}
+	sub.Anchor = sub.DateDue
+	if existing := i.subscriptions[index]; existing.DateDue.Equal(sub.DateDue) && existing.Frequency == sub.Frequency && existing.Interval == sub.Interval {
+		sub.Anchor = existing.Anchor
+	}
+	i.subscriptions[index] = sub
+
+	for index, t := range i.transactions {
+		if t.SubscriptionID == sub.ID {
+			i.transactions[index].SubscriptionID = 0
+		}
+	}
+	return i.GetSubscription(ctx, userID, sub.ID)
+}
+
+// DeleteSubscription deletes a subscription of the user from the data store with the given ID
+func (i *InMemorySubscriptionStore) DeleteSubscription(ctx context.Context, userID int, subscriptionID int) error {
 
 	index := i.findSubscriptionIndex(subscriptionID)
 	lastIndex := len(i.subscriptions) - 1
 
-	if index == -1 {
+	if index == -1 || i.owners[subscriptionID] != userID {
 		return fmt.Errorf("failed to delete subscription with ID %v", subscriptionID)
 	}
 	i.subscriptions[lastIndex], i.subscriptions[index] = i.subscriptions[index], i.subscriptions[lastIndex]
 	i.subscriptions = i.subscriptions[:lastIndex]
+
+	for index, t := range i.transactions {
+		if t.SubscriptionID == subscriptionID {
+			i.transactions[index].SubscriptionID = 0
+		}
+	}
+	return nil
+}
+
+// RenewSubscription moves the user's subscription on to its next due date and stores the renewals it rolled past
+func (i *InMemorySubscriptionStore) RenewSubscription(ctx context.Context, userID int, subscriptionID int, dateDue time.Time, renewals []subscription.Renewal) error {
+	index := i.findSubscriptionIndex(subscriptionID)
+	if index == -1 || i.owners[subscriptionID] != userID {
+		return fmt.Errorf("failed to renew subscription with ID %v", subscriptionID)
+	}
+	if !i.subscriptions[index].DateDue.Before(dateDue) {
+		return nil
+	}
+
+	i.subscriptions[index].DateDue = dateDue
+	i.renewals[subscriptionID] = append(i.renewals[subscriptionID], renewals...)
+	return nil
+}
+
+// GetRenewals returns the past due dates stored for the user's subscription
+func (i *InMemorySubscriptionStore) GetRenewals(ctx context.Context, userID int, subscriptionID int) ([]subscription.Renewal, error) {
+	if i.owners[subscriptionID] != userID {
+		return nil, nil
+	}
+	return i.renewals[subscriptionID], nil
+}
+
+// GetMerchantAliases returns all the user's merchant alias rules
+func (i *InMemorySubscriptionStore) GetMerchantAliases(ctx context.Context, userID int) ([]merchant.Alias, error) {
+	aliases := []merchant.Alias{}
+	for _, alias := range i.aliases {
+		if i.owners[alias.ID] == userID {
+			aliases = append(aliases, alias)
+		}
+	}
+	return aliases, nil
+}
+
+// RecordMerchantAlias stores a merchant alias rule for the user, replacing the merchant of the user's existing rule with the same pattern
+func (i *InMemorySubscriptionStore) RecordMerchantAlias(ctx context.Context, userID int, alias merchant.Alias) (*merchant.Alias, error) {
+	for index, existing := range i.aliases {
+		if existing.Pattern == alias.Pattern && i.owners[existing.ID] == userID {
+			i.aliases[index].Merchant = alias.Merchant
+			return &i.aliases[index], nil
+		}
+	}
+
+	alias.ID = i.nextID(userID)
+	i.aliases = append(i.aliases, alias)
+	return &alias, nil
+}
+
+// DeleteMerchantAlias deletes one of the user's merchant alias rules with the given ID
+func (i *InMemorySubscriptionStore) DeleteMerchantAlias(ctx context.Context, userID int, aliasID int) error {
+	for index, alias := range i.aliases {
+		if alias.ID == aliasID && i.owners[aliasID] == userID {
+			i.aliases = append(i.aliases[:index], i.aliases[index+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to delete merchant alias with ID %v", aliasID)
+}
+
+// RecordCandidate stores a detected subscription for the user to review,
+// replacing any candidate the user has pending for the same merchant
+func (i *InMemorySubscriptionStore) RecordCandidate(ctx context.Context, userID int, candidate subscription.Candidate) (*subscription.Candidate, error) {
+	for index, existing := range i.candidates {
+		if existing.Merchant == candidate.Merchant && i.owners[existing.ID] == userID {
+			candidate.ID = existing.ID
+			i.candidates[index] = candidate
+			return &candidate, nil
+		}
+	}
+
+	candidate.ID = i.nextID(userID)
+	i.candidates = append(i.candidates, candidate)
+	return &candidate, nil
+}
+
+// GetCandidates returns the detected subscriptions waiting for the user to review
+func (i *InMemorySubscriptionStore) GetCandidates(ctx context.Context, userID int) ([]subscription.Candidate, error) {
+	candidates := []subscription.Candidate{}
+	for _, candidate := range i.candidates {
+		if i.owners[candidate.ID] == userID {
+			candidates = append(candidates, candidate)
+		}
+	}
+	return candidates, nil
+}
+
+// GetCandidate returns the detected subscription waiting for the user to review with the given ID
+// If the user has no candidate with the given ID, it returns a nil pointer
+func (i *InMemorySubscriptionStore) GetCandidate(ctx context.Context, userID int, candidateID int) (*subscription.Candidate, error) {
+	for index, candidate := range i.candidates {
+		if candidate.ID == candidateID && i.owners[candidateID] == userID {
+			return &i.candidates[index], nil
+		}
+	}
+	return nil, nil
+}
+
+// DeleteCandidate removes a detected subscription from the user's review queue by ID
+func (i *InMemorySubscriptionStore) DeleteCandidate(ctx context.Context, userID int, candidateID int) error {
+	for index, candidate := range i.candidates {
+		if candidate.ID == candidateID && i.owners[candidateID] == userID {
+			i.candidates = append(i.candidates[:index], i.candidates[index+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to delete candidate with ID %v", candidateID)
+}
+
+// RejectMerchant remembers that the user's payments to the merchant are not a subscription
+func (i *InMemorySubscriptionStore) RejectMerchant(ctx context.Context, userID int, merchantName string) error {
+	for _, rejected := range i.rejected[userID] {
+		if rejected == merchantName {
+			return nil
+		}
+	}
+	i.rejected[userID] = append(i.rejected[userID], merchantName)
+	return nil
+}
+
+// GetRejectedMerchants returns the merchants whose payments the user said are not a subscription
+func (i *InMemorySubscriptionStore) GetRejectedMerchants(ctx context.Context, userID int) ([]string, error) {
+	return append([]string{}, i.rejected[userID]...), nil
+}
+
+// DeleteRejectedMerchant forgets that the user rejected a merchant
+func (i *InMemorySubscriptionStore) DeleteRejectedMerchant(ctx context.Context, userID int, merchantName string) error {
+	for index, rejected := range i.rejected[userID] {
+		if rejected == merchantName {
+			i.rejected[userID] = append(i.rejected[userID][:index], i.rejected[userID][index+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("no rejected merchant found named %q", merchantName)
+}
+
+// GetPlaidItems returns the banks the user linked through Plaid
+func (i *InMemorySubscriptionStore) GetPlaidItems(ctx context.Context, userID int) ([]plaid.Item, error) {
+	items := []plaid.Item{}
+	for _, item := range i.plaidItems {
+		if item.UserID == userID {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// GetPlaidItem returns the bank linked through Plaid with the given Plaid item ID, whichever user linked it
+// If no bank is linked with the item ID, it returns a nil pointer
+func (i *InMemorySubscriptionStore) GetPlaidItem(ctx context.Context, itemID string) (*plaid.Item, error) {
+	for _, item := range i.plaidItems {
+		if item.ItemID == itemID {
+			return &item, nil
+		}
+	}
+	return nil, nil
+}
+
+// RecordPlaidItem stores a bank linked through Plaid, replacing the access token of an item that is already stored
+func (i *InMemorySubscriptionStore) RecordPlaidItem(ctx context.Context, item plaid.Item) (*plaid.Item, error) {
+	for index, existing := range i.plaidItems {
+		if existing.ItemID == item.ItemID {
+			i.plaidItems[index].AccessToken = item.AccessToken
+			i.plaidItems[index].Status = ""
+			return &i.plaidItems[index], nil
+		}
+	}
+
+	i.lastID++
+	item.ID = i.lastID
+	i.plaidItems = append(i.plaidItems, item)
+	return &item, nil
+}
+
+// DeletePlaidItem forgets a bank the user linked with the given ID
+func (i *InMemorySubscriptionStore) DeletePlaidItem(ctx context.Context, userID int, ID int) error {
+	for index, item := range i.plaidItems {
+		if item.ID == ID && item.UserID == userID {
+			i.plaidItems = append(i.plaidItems[:index], i.plaidItems[index+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to delete linked bank with ID %v", ID)
+}
+
+// UpdatePlaidItemCursor saves how far the user's linked bank's transactions have been synced
+func (i *InMemorySubscriptionStore) UpdatePlaidItemCursor(ctx context.Context, userID int, ID int, cursor string) error {
+	for index, item := range i.plaidItems {
+		if item.ID == ID && item.UserID == userID {
+			i.plaidItems[index].Cursor = cursor
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to update linked bank with ID %v", ID)
+}
+
+// UpdatePlaidItemStatus saves the error code Plaid last reported for the user's linked bank
+func (i *InMemorySubscriptionStore) UpdatePlaidItemStatus(ctx context.Context, userID int, ID int, status string) error {
+	for index, item := range i.plaidItems {
+		if item.ID == ID && item.UserID == userID {
+			i.plaidItems[index].Status = status
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to update linked bank with ID %v", ID)
+}
+
+// RecordTransactions stores the user's imported transactions,
+// updating any the user already has stored with the same external ID
+func (i *InMemorySubscriptionStore) RecordTransactions(ctx context.Context, userID int, transactions []transaction.Transaction) error {
+	for _, t := range transactions {
+		index := i.findTransactionIndex(userID, t.ExternalID)
+		if index != -1 {
+			t.ID = i.transactions[index].ID
+			i.transactions[index] = t
+			continue
+		}
+
+		t.ID = i.nextID(userID)
+		i.transactions = append(i.transactions, t)
+	}
+	return nil
+}
+
+// GetTransactions returns the user's imported transactions, most recent first
+func (i *InMemorySubscriptionStore) GetTransactions(ctx context.Context, userID int) ([]transaction.Transaction, error) {
+	transactions := []transaction.Transaction{}
+	for _, t := range i.transactions {
+		if i.owners[t.ID] == userID {
+			transactions = append(transactions, t)
+		}
+	}
+	sort.SliceStable(transactions, func(a, b int) bool {
+		return transactions[a].Date.After(transactions[b].Date)
+	})
+	return transactions, nil
+}
+
+// DeleteTransactions removes the user's transactions with the given external IDs
+func (i *InMemorySubscriptionStore) DeleteTransactions(ctx context.Context, userID int, externalIDs []string) error {
+	for _, externalID := range externalIDs {
+		index := i.findTransactionIndex(userID, externalID)
+		if index != -1 {
+			i.transactions = append(i.transactions[:index], i.transactions[index+1:]...)
+		}
+	}
+	return nil
+}
+
+// MatchPayments records that the user's transactions with the given external IDs paid for the subscription
+func (i *InMemorySubscriptionStore) MatchPayments(ctx context.Context, userID int, subscriptionID int, externalIDs []string) error {
+	for _, externalID := range externalIDs {
+		index := i.findTransactionIndex(userID, externalID)
+		if index != -1 {
+			i.transactions[index].SubscriptionID = subscriptionID
+		}
+	}
 	return nil
 }
 
+// CreateUser stores a new user with the hash of their password.
+// It returns account.ErrEmailTaken if another user already has the email.
+func (i *InMemorySubscriptionStore) CreateUser(ctx context.Context, name string, email string, passwordHash string) (*userprofile.Userprofile, error) {
+	if i.findUserIndexByEmail(email) != -1 {
+		return nil, account.ErrEmailTaken
+	}
+
+	i.lastID++
+	user := userprofile.Userprofile{ID: i.lastID, Name: name, Email: email, PasswordHash: passwordHash}
+	i.users = append(i.users, user)
+	return &user, nil
+}
+
+// identity is the issuer and subject a user signs in with at an identity provider
+type identity struct {
+	issuer  string
+	subject string
+}
+
+// CreateUserWithIdentity stores a new user who signs in with an identity provider, and so has no password,
+// along with the issuer and subject that identify them.
+// It returns account.ErrEmailTaken if another user already has the email.
+func (i *InMemorySubscriptionStore) CreateUserWithIdentity(ctx context.Context, name string, email string, issuer string, subject string) (*userprofile.Userprofile, error) {
+	user, err := i.CreateUser(ctx, name, email, "")
+	if err != nil {
+		return nil, err
+	}
+	i.identities[identity{issuer: issuer, subject: subject}] = user.ID
+	return user, nil
+}
+
+// GetUserByIdentity returns the user who signs in with the subject at the identity provider with the issuer
+// If no user has the identity, it returns a nil pointer
+func (i *InMemorySubscriptionStore) GetUserByIdentity(ctx context.Context, issuer string, subject string) (*userprofile.Userprofile, error) {
+	userID, ok := i.identities[identity{issuer: issuer, subject: subject}]
+	if !ok {
+		return nil, nil
+	}
+	for _, user := range i.users {
+		if user.ID == userID {
+			return &user, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetUserByEmail returns the user with the given email, along with their password hash
+// If no user has the email, it returns a nil pointer
+func (i *InMemorySubscriptionStore) GetUserByEmail(ctx context.Context, email string) (*userprofile.Userprofile, error) {
+	index := i.findUserIndexByEmail(email)
+	if index == -1 {
+		return nil, nil
+	}
+	user := i.users[index]
+	return &user, nil
+}
+
 // RecordUserDetails stores the users name and email
-func (i *InMemorySubscriptionStore) RecordUserDetails(name string, email string) (*userprofile.Userprofile, error) {
-	i.userProfile = &userprofile.Userprofile{
-		Name:  name,
-		Email: email,
+// It returns account.ErrEmailTaken if another user already has the email.
+func (i *InMemorySubscriptionStore) RecordUserDetails(ctx context.Context, userID int, name string, email string) (*userprofile.Userprofile, error) {
+	if index := i.findUserIndexByEmail(email); index != -1 && i.users[index].ID != userID {
+		return nil, account.ErrEmailTaken
 	}
 
-	return i.userProfile, nil
+	for index, user := range i.users {
+		if user.ID == userID {
+			i.users[index].Name = name
+			i.users[index].Email = email
+			return &userprofile.Userprofile{ID: userID, Name: name, Email: email}, nil
+		}
+	}
+	return nil, fmt.Errorf("failed to update user with ID %v", userID)
 }
 
 // GetUserDetails returns the users name and email
-func (i *InMemorySubscriptionStore) GetUserDetails() (*userprofile.Userprofile, error) {
-	return i.userProfile, nil
+// If no user is found with the given ID, it returns a nil pointer
+func (i *InMemorySubscriptionStore) GetUserDetails(ctx context.Context, userID int) (*userprofile.Userprofile, error) {
+	for _, user := range i.users {
+		if user.ID == userID {
+			user.PasswordHash = ""
+			return &user, nil
+		}
+	}
+	return nil, nil
+}
+
+// CreateSession stores a session for a logged in user
+func (i *InMemorySubscriptionStore) CreateSession(ctx context.Context, session account.Session) error {
+	i.sessions[session.TokenHash] = session
+	return nil
+}
+
+// GetSession returns the session stored with the given token hash
+// If no session is found, it returns a nil pointer
+func (i *InMemorySubscriptionStore) GetSession(ctx context.Context, tokenHash string) (*account.Session, error) {
+	session, ok := i.sessions[tokenHash]
+	if !ok {
+		return nil, nil
+	}
+	return &session, nil
+}
+
+// DeleteSession removes the session stored with the given token hash
+func (i *InMemorySubscriptionStore) DeleteSession(ctx context.Context, tokenHash string) error {
+	delete(i.sessions, tokenHash)
+	return nil
+}
+
+// CreateAPIToken stores a new API token for the user it belongs to
+func (i *InMemorySubscriptionStore) CreateAPIToken(ctx context.Context, token account.APIToken) (*account.APIToken, error) {
+	token.ID = i.nextID(token.UserID)
+	i.apiTokens = append(i.apiTokens, token)
+	return &token, nil
+}
+
+// GetAPITokens returns the user's API tokens, in the order they were created
+func (i *InMemorySubscriptionStore) GetAPITokens(ctx context.Context, userID int) ([]account.APIToken, error) {
+	tokens := []account.APIToken{}
+	for _, token := range i.apiTokens {
+		if token.UserID == userID {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
+
+// GetAPITokenByHash returns the API token stored with the given token hash, whichever user it belongs to
+// If no token is found, it returns a nil pointer
+func (i *InMemorySubscriptionStore) GetAPITokenByHash(ctx context.Context, tokenHash string) (*account.APIToken, error) {
+	for _, token := range i.apiTokens {
+		if token.TokenHash == tokenHash {
+			return &token, nil
+		}
+	}
+	return nil, nil
+}
+
+// DeleteAPIToken revokes one of the user's API tokens by ID
+func (i *InMemorySubscriptionStore) DeleteAPIToken(ctx context.Context, userID int, ID int) error {
+	for index, token := range i.apiTokens {
+		if token.ID == ID && token.UserID == userID {
+			i.apiTokens = append(i.apiTokens[:index], i.apiTokens[index+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to delete API token with ID %v", ID)
+}
+
+// RecordAPITokenUse saves when the user's API token was last used
+func (i *InMemorySubscriptionStore) RecordAPITokenUse(ctx context.Context, userID int, ID int, usedAt time.Time) error {
+	for index, token := range i.apiTokens {
+		if token.ID == ID && token.UserID == userID {
+			i.apiTokens[index].LastUsedAt = &usedAt
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to update API token with ID %v", ID)
+}
+
+// nextID returns the ID of a new record belonging to the user
+func (i *InMemorySubscriptionStore) nextID(userID int) int {
+	i.lastID++
+	i.owners[i.lastID] = userID
+	return i.lastID
+}
+
+// findUserIndexByEmail finds the index of the user with the given email, or -1 if there is none
+func (i *InMemorySubscriptionStore) findUserIndexByEmail(email string) int {
+	for index, user := range i.users {
+		if user.Email == email {
+			return index
+		}
+	}
+	return -1
 }
 
 // FindSubscriptionIndex finds the index of a given subscription ID, from the InMemoryDataStore's subscriptions
@@ -78,3 +584,27 @@ func (i *InMemorySubscriptionStore) findSubscriptionIndex(ID int) (index int) {
 	}
 	return -1
 }
+
+// payments returns the transactions matched to the subscription, most recent first
+func (i *InMemorySubscriptionStore) payments(subscriptionID int) []transaction.Transaction {
+	var payments []transaction.Transaction
+	for _, t := range i.transactions {
+		if t.SubscriptionID == subscriptionID {
+			payments = append(payments, t)
+		}
+	}
+	sort.SliceStable(payments, func(a, b int) bool {
+		return payments[a].Date.After(payments[b].Date)
+	})
+	return payments
+}
+
+// findTransactionIndex finds the index of the user's transaction with the given external ID, or -1 if it isn't stored
+func (i *InMemorySubscriptionStore) findTransactionIndex(userID int, externalID string) int {
+	for index, t := range i.transactions {
+		if t.ExternalID == externalID && i.owners[t.ID] == userID {
+			return index
+		}
+	}
+	return -1
+}
@@ -1,6 +1,7 @@
 package email
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"net/http"
@@ -18,16 +19,16 @@ type Mailer interface {
 	Send(email *mail.SGMailV3) (*rest.Response, error)
 }
 
-// DataStore defines the interface required to get a subscription
+// DataStore defines the interface required to get a user's subscription
 type DataStore interface {
-	GetSubscription(subscriptionID int) (*subscription.Subscription, error)
+	GetSubscription(ctx context.Context, userID int, subscriptionID int) (*subscription.Subscription, error)
 }
 
 const timeLayout = "January 2, 2006"
 
 // SendEmail sends a reminder email
-func SendEmail(reminder reminder.Reminder, user userprofile.Userprofile, event *ics.Calendar, mailer Mailer, datastore DataStore) error {
-	subscription, err := datastore.GetSubscription(reminder.SubscriptionID)
+func SendEmail(ctx context.Context, reminder reminder.Reminder, user userprofile.Userprofile, event *ics.Calendar, mailer Mailer, datastore DataStore) error {
+	subscription, err := datastore.GetSubscription(ctx, user.ID, reminder.SubscriptionID)
 	if err != nil {
 		return fmt.Errorf("failed to get subscription: %w", err)
 	}
@@ -36,7 +37,7 @@ func SendEmail(reminder reminder.Reminder, user userprofile.Userprofile, event *
 	}
 
 	from := mail.NewEmail("Subscrypt Team", "team@subscrypt.com")
-	subject := fmt.Sprintf("Your %s subscription is due for renewal on %v", subscription.Name, subscription.DateDue.Format(timeLayout))
+	subject := fmt.Sprintf("Your %s subscription is due for renewal on %v", subscription.Name, subscription.NextDue(reminder.ReminderDate).Format(timeLayout))
 	to := mail.NewEmail(user.Name, reminder.Email)
 	plainTextContent := fmt.Sprintf("Hey there %s!\nYou asked for a reminder and here it is!", user.Name)
 	htmlContent := fmt.Sprintf("<strong>Hey there %s!\nYou asked for a reminder and here it is!</strong>", user.Name)
@@ -1,6 +1,7 @@
 package email
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
@@ -29,7 +30,7 @@ type StubDataStore struct {
 	subscription subscription.Subscription
 }
 
-func (s *StubDataStore) GetSubscription(subscriptionID int) (*subscription.Subscription, error) {
+func (s *StubDataStore) GetSubscription(ctx context.Context, userID int, subscriptionID int) (*subscription.Subscription, error) {
 	return &s.subscription, nil
 }
 
@@ -58,7 +59,7 @@ func TestSendingAnEmail(t *testing.T) {
 		client := &StubMailer{}
 		datastore := &StubDataStore{subscription: subscription}
 
-		err := SendEmail(reminder, user, cal, client, datastore)
+		err := SendEmail(context.Background(), reminder, user, cal, client, datastore)
 		if err != nil {
 			t.Errorf("there was an error sending the email %v", err)
 		}
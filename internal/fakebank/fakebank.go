@@ -0,0 +1,375 @@
+package fakebank
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Catzkorn/subscrypt/internal/plaid"
+)
+
+// The credentials the fake bank accepts
+const (
+	ClientID = "fake-client-id"
+	Secret   = "fake-secret"
+)
+
+// dateLayout is the format of the dates of Plaid transactions
+const dateLayout = "2006-01-02"
+
+// Payment is a scripted payment out of the account, or into it if Amount is negative.
+// It is made Count times, every Months months and Days days, the last time LastDaysAgo days before the bank's today.
+type Payment struct {
+	Name        string  `json:"name"`
+	Amount      float32 `json:"amount"`
+	Months      int     `json:"months"`
+	Days        int     `json:"days"`
+	Count       int     `json:"count"`
+	LastDaysAgo int     `json:"lastDaysAgo"`
+}
+
+// History is the scripted transaction history of the fake bank's account
+type History struct {
+	AccountID string    `json:"accountId"`
+	Currency  string    `json:"currency"`
+	Payments  []Payment `json:"payments"`
+}
+
+// DefaultHistory is a year of a current account with monthly and annual subscriptions,
+// a salary and payments that aren't subscriptions
+var DefaultHistory = History{
+	AccountID: "fake-current-account",
+	Currency:  "GBP",
+	Payments: []Payment{
+		{Name: "Netflix", Amount: 9.99, Months: 1, Count: 12, LastDaysAgo: 5},
+		{Name: "Spotify", Amount: 9.99, Months: 1, Count: 12, LastDaysAgo: 12},
+		{Name: "PureGym", Amount: 24.99, Months: 1, Count: 6, LastDaysAgo: 20},
+		{Name: "Amazon Prime", Amount: 79, Months: 12, Count: 2, LastDaysAgo: 100},
+		{Name: "Salary", Amount: -2000, Months: 1, Count: 12, LastDaysAgo: 8},
+		{Name: "Pret A Manger", Amount: 4.35, Count: 1, LastDaysAgo: 3},
+		{Name: "Trainline", Amount: 58.2, Count: 1, LastDaysAgo: 40},
+	},
+}
+
+// LoadHistory reads a transaction history from a JSON file
+func LoadHistory(path string) (History, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return History{}, fmt.Errorf("unable to read history: %w", err)
+	}
+
+	var history History
+	err = json.Unmarshal(data, &history)
+	if err != nil {
+		return History{}, fmt.Errorf("unable to parse history: %w", err)
+	}
+	return history, nil
+}
+
+// Transactions returns the transactions of the history, oldest first, dated back from today.
+// Transactions are identified by their position, so the same history and day always give the same transactions.
+func (h History) Transactions(today time.Time) []plaid.Transaction {
+	var transactions []plaid.Transaction
+	for _, payment := range h.Payments {
+		last := today.AddDate(0, 0, -payment.LastDaysAgo)
+		for i := 0; i < payment.Count; i++ {
+			transactions = append(transactions, plaid.Transaction{
+				AccountID:       h.AccountID,
+				Amount:          payment.Amount,
+				ISOCurrencyCode: h.Currency,
+				Date:            last.AddDate(0, -payment.Months*i, -payment.Days*i).Format(dateLayout),
+				Name:            payment.Name,
+			})
+		}
+	}
+
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return transactions[i].Date < transactions[j].Date
+	})
+	for i := range transactions {
+		transactions[i].TransactionID = fmt.Sprintf("%s-%d", h.AccountID, i+1)
+	}
+	return transactions
+}
+
+// change is an entry of the bank's log of changes to the account, which sync cursors point into.
+// A change either adds or modifies a transaction, or removes the transaction with removedID.
+type change struct {
+	transaction plaid.Transaction
+	modified    bool
+	removedID   string
+}
+
+// Bank is a stand-in for the Plaid endpoints the client uses, serving a scripted transaction history.
+// Every linked item sees the same account. Changes made after the bank is created are returned by the next sync.
+type Bank struct {
+	mu       sync.Mutex
+	changes  []change
+	items    map[string]string
+	linked   int
+	failure  *plaid.Error
+	requests []string
+}
+
+// New returns a fake bank with the history dated back from today, accepting ClientID and Secret
+func New(history History, today time.Time) *Bank {
+	b := &Bank{items: map[string]string{}}
+	for _, transaction := range history.Transactions(today) {
+		b.changes = append(b.changes, change{transaction: transaction})
+	}
+	return b
+}
+
+// Config returns the configuration of a Plaid client that uses the bank without a network connection
+func (b *Bank) Config() plaid.Config {
+	return plaid.Config{
+		BaseURL:    "http://fakebank",
+		ClientID:   ClientID,
+		Secret:     Secret,
+		HTTPClient: &http.Client{Transport: handlerTransport{b}},
+	}
+}
+
+// Add adds transactions to the account
+func (b *Bank) Add(transactions ...plaid.Transaction) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, transaction := range transactions {
+		b.changes = append(b.changes, change{transaction: transaction})
+	}
+}
+
+// Modify replaces a transaction of the account with one with the same ID, such as a settled pending transaction
+func (b *Bank) Modify(transaction plaid.Transaction) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.changes = append(b.changes, change{transaction: transaction, modified: true})
+}
+
+// Remove removes the transaction with the given ID from the account
+func (b *Bank) Remove(transactionID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.changes = append(b.changes, change{removedID: transactionID})
+}
+
+// Fail makes every request for transactions fail with the Plaid error, or succeed again if it is nil
+func (b *Bank) Fail(plaidError *plaid.Error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failure = plaidError
+}
+
+// Requests returns the paths of the requests the bank has received
+func (b *Bank) Requests() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string{}, b.requests...)
+}
+
+// ServeHTTP handles the Plaid endpoints for linking a sandbox item, getting and syncing its transactions
+// and removing it, returning errors in Plaid's format
+func (b *Bank) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.requests = append(b.requests, r.URL.Path)
+
+	if r.Method != http.MethodPost {
+		b.writeError(w, http.StatusMethodNotAllowed, &plaid.Error{Type: "INVALID_REQUEST", Code: "INVALID_HTTP_METHOD", Message: "only POST requests are accepted"})
+		return
+	}
+
+	var credentials struct {
+		ClientID string `json:"client_id"`
+		Secret   string `json:"secret"`
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &credentials)
+	}
+	if err != nil {
+		b.writeError(w, http.StatusBadRequest, &plaid.Error{Type: "INVALID_REQUEST", Code: "INVALID_BODY", Message: "the request body is not valid JSON"})
+		return
+	}
+	if credentials.ClientID != ClientID || credentials.Secret != Secret {
+		b.writeError(w, http.StatusBadRequest, &plaid.Error{Type: "INVALID_INPUT", Code: "INVALID_API_KEYS", Message: "invalid client_id or secret provided"})
+		return
+	}
+
+	switch r.URL.Path {
+	case "/sandbox/public_token/create":
+		b.linked++
+		b.write(w, plaid.PublicToken{Token: fmt.Sprintf("public-fake-%d", b.linked)})
+	case "/item/public_token/exchange":
+		var exchange plaid.GetAccessToken
+		_ = json.Unmarshal(body, &exchange)
+		b.exchange(w, exchange.PublicToken)
+	case "/item/remove":
+		var remove plaid.RemoveItem
+		_ = json.Unmarshal(body, &remove)
+		if !b.known(w, remove.AccessToken) {
+			return
+		}
+		delete(b.items, remove.AccessToken)
+		b.write(w, struct{}{})
+	case "/transactions/get":
+		var get plaid.GetTransactions
+		_ = json.Unmarshal(body, &get)
+		if !b.known(w, get.AccessToken) || !b.working(w) {
+			return
+		}
+		b.write(w, page(b.between(get.StartDate, get.EndDate), get.Options))
+	case "/transactions/sync":
+		var sync plaid.SyncTransactions
+		_ = json.Unmarshal(body, &sync)
+		if !b.known(w, sync.AccessToken) || !b.working(w) {
+			return
+		}
+		b.sync(w, sync)
+	default:
+		b.writeError(w, http.StatusNotFound, &plaid.Error{Type: "INVALID_REQUEST", Code: "UNKNOWN_FIELDS", Message: "the fake bank doesn't support " + r.URL.Path})
+	}
+}
+
+// exchange swaps a public token the bank created for an access token to a new item
+func (b *Bank) exchange(w http.ResponseWriter, publicToken string) {
+	var number int
+	_, err := fmt.Sscanf(publicToken, "public-fake-%d", &number)
+	if err != nil || number < 1 || number > b.linked {
+		b.writeError(w, http.StatusBadRequest, &plaid.Error{Type: "INVALID_INPUT", Code: "INVALID_PUBLIC_TOKEN", Message: "unknown public token"})
+		return
+	}
+
+	access := plaid.AccessToken{Token: fmt.Sprintf("access-fake-%d", number), ItemID: fmt.Sprintf("item-fake-%d", number)}
+	b.items[access.Token] = access.ItemID
+	b.write(w, access)
+}
+
+// known writes an error and returns false if the access token isn't for a linked item
+func (b *Bank) known(w http.ResponseWriter, accessToken string) bool {
+	if _, ok := b.items[accessToken]; !ok {
+		b.writeError(w, http.StatusBadRequest, &plaid.Error{Type: "INVALID_INPUT", Code: "INVALID_ACCESS_TOKEN", Message: "provided access token is invalid"})
+		return false
+	}
+	return true
+}
+
+// working writes the error the bank has been told to fail with and returns false, if there is one
+func (b *Bank) working(w http.ResponseWriter) bool {
+	if b.failure != nil {
+		b.writeError(w, http.StatusBadRequest, b.failure)
+		return false
+	}
+	return true
+}
+
+// between returns the current transactions of the account dated from start to end
+func (b *Bank) between(start string, end string) []plaid.Transaction {
+	current := map[string]plaid.Transaction{}
+	var order []string
+	for _, c := range b.changes {
+		switch {
+		case c.removedID != "":
+			delete(current, c.removedID)
+		case !c.modified:
+			order = append(order, c.transaction.TransactionID)
+			fallthrough
+		default:
+			current[c.transaction.TransactionID] = c.transaction
+		}
+	}
+
+	transactions := []plaid.Transaction{}
+	for _, id := range order {
+		transaction, ok := current[id]
+		if ok && transaction.Date >= start && transaction.Date <= end {
+			transactions = append(transactions, transaction)
+		}
+	}
+	return transactions
+}
+
+// page returns the page of the transactions picked by the options, which is the first 100 by default like Plaid
+func page(transactions []plaid.Transaction, options plaid.TransactionOptions) plaid.TransactionPage {
+	count := options.Count
+	if count <= 0 {
+		count = 100
+	}
+
+	start := options.Offset
+	if start > len(transactions) {
+		start = len(transactions)
+	}
+	end := start + count
+	if end > len(transactions) {
+		end = len(transactions)
+	}
+	return plaid.TransactionPage{Transactions: transactions[start:end], TotalTransactions: len(transactions)}
+}
+
+// sync writes a page of the changes after the cursor, which is the number of changes already synced
+func (b *Bank) sync(w http.ResponseWriter, sync plaid.SyncTransactions) {
+	position := 0
+	if sync.Cursor != "" {
+		var err error
+		position, err = strconv.Atoi(sync.Cursor)
+		if err != nil || position < 0 || position > len(b.changes) {
+			b.writeError(w, http.StatusBadRequest, &plaid.Error{Type: "INVALID_INPUT", Code: "INVALID_FIELD", Message: "cursor is not valid"})
+			return
+		}
+	}
+
+	end := len(b.changes)
+	if sync.Count > 0 && position+sync.Count < end {
+		end = position + sync.Count
+	}
+
+	page := plaid.SyncedTransactions{
+		Added:        []plaid.Transaction{},
+		Modified:     []plaid.Transaction{},
+		Removed:      []plaid.RemovedTransaction{},
+		NextCursor:   strconv.Itoa(end),
+		HasMore:      end < len(b.changes),
+		UpdateStatus: "HISTORICAL_UPDATE_COMPLETE",
+	}
+	for _, c := range b.changes[position:end] {
+		switch {
+		case c.removedID != "":
+			page.Removed = append(page.Removed, plaid.RemovedTransaction{TransactionID: c.removedID})
+		case c.modified:
+			page.Modified = append(page.Modified, c.transaction)
+		default:
+			page.Added = append(page.Added, c.transaction)
+		}
+	}
+	b.write(w, page)
+}
+
+func (b *Bank) write(w http.ResponseWriter, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (b *Bank) writeError(w http.ResponseWriter, status int, plaidError *plaid.Error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(plaidError)
+}
+
+// handlerTransport sends requests straight to a handler instead of over the network
+type handlerTransport struct {
+	handler http.Handler
+}
+
+// RoundTrip serves the request with the handler and returns its response
+func (t handlerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	recorder := httptest.NewRecorder()
+	t.handler.ServeHTTP(recorder, r)
+	return recorder.Result(), nil
+}
@@ -0,0 +1,230 @@
+package fakebank
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Catzkorn/subscrypt/internal/account"
+	"github.com/Catzkorn/subscrypt/internal/database"
+	"github.com/Catzkorn/subscrypt/internal/plaid"
+	"github.com/Catzkorn/subscrypt/internal/secret"
+)
+
+var today = time.Date(2020, time.November, 1, 0, 0, 0, 0, time.UTC)
+
+// testContext is the context of the user the tests link banks for
+var testContext = account.WithUser(context.Background(), 1)
+
+// newStoringAPI returns a Plaid client for the bank that stores the items it links, so syncs carry on from their cursor
+func newStoringAPI(t *testing.T, bank *Bank) *plaid.PlaidAPI {
+	t.Helper()
+	cipher, err := secret.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatalf("unable to create cipher: %v", err)
+	}
+
+	config := bank.Config()
+	config.Items = database.NewInMemorySubscriptionStore()
+	config.TokenCipher = cipher
+	return plaid.NewPlaidAPI(config)
+}
+
+func TestHistory(t *testing.T) {
+	history := History{
+		AccountID: "acc",
+		Currency:  "GBP",
+		Payments: []Payment{
+			{Name: "Netflix", Amount: 9.99, Months: 1, Count: 3, LastDaysAgo: 5},
+			{Name: "Coffee", Amount: 2.5, Days: 7, Count: 2},
+		},
+	}
+
+	got := history.Transactions(today)
+
+	want := []plaid.Transaction{
+		{TransactionID: "acc-1", AccountID: "acc", Amount: 9.99, ISOCurrencyCode: "GBP", Date: "2020-08-27", Name: "Netflix"},
+		{TransactionID: "acc-2", AccountID: "acc", Amount: 9.99, ISOCurrencyCode: "GBP", Date: "2020-09-27", Name: "Netflix"},
+		{TransactionID: "acc-3", AccountID: "acc", Amount: 2.5, ISOCurrencyCode: "GBP", Date: "2020-10-25", Name: "Coffee"},
+		{TransactionID: "acc-4", AccountID: "acc", Amount: 9.99, ISOCurrencyCode: "GBP", Date: "2020-10-27", Name: "Netflix"},
+		{TransactionID: "acc-5", AccountID: "acc", Amount: 2.5, ISOCurrencyCode: "GBP", Date: "2020-11-01", Name: "Coffee"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d transactions want %d: %v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got transaction %d %v want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestBank(t *testing.T) {
+	t.Run("links a sandbox item and gets its transactions", func(t *testing.T) {
+		bank := New(DefaultHistory, time.Now())
+		api := plaid.NewPlaidAPI(bank.Config())
+
+		got, err := api.GetTransactions(testContext)
+		if err != nil {
+			t.Fatalf("unexpected error getting transactions: %v", err)
+		}
+		if len(got.Transactions) != len(DefaultHistory.Transactions(time.Now())) {
+			t.Errorf("got %d transactions want the whole history", len(got.Transactions))
+		}
+
+		want := []string{"/sandbox/public_token/create", "/item/public_token/exchange", "/transactions/get"}
+		if strings.Join(bank.Requests(), " ") != strings.Join(want, " ") {
+			t.Errorf("got requests %v want %v", bank.Requests(), want)
+		}
+	})
+
+	t.Run("syncs the changes made since the last sync", func(t *testing.T) {
+		bank := New(DefaultHistory, today)
+		api := newStoringAPI(t, bank)
+
+		first, err := api.SyncTransactions(testContext)
+		if err != nil {
+			t.Fatalf("unexpected error syncing transactions: %v", err)
+		}
+		if len(first.Added) != len(DefaultHistory.Transactions(today)) {
+			t.Errorf("got %d transactions added by the first sync want the whole history", len(first.Added))
+		}
+		err = api.SaveCursors(testContext, first)
+		if err != nil {
+			t.Fatalf("unexpected error saving sync cursors: %v", err)
+		}
+
+		bank.Add(plaid.Transaction{TransactionID: "new", Amount: 7.99, Date: "2020-11-01", Name: "Disney Plus", Pending: true})
+		bank.Modify(plaid.Transaction{TransactionID: "new", Amount: 7.99, Date: "2020-11-01", Name: "Disney Plus"})
+		bank.Remove(first.Added[0].TransactionID)
+
+		second, err := api.SyncTransactions(testContext)
+		if err != nil {
+			t.Fatalf("unexpected error syncing transactions: %v", err)
+		}
+		if len(second.Added) != 1 || second.Added[0].Name != "Disney Plus" {
+			t.Errorf("got added %v want Disney Plus", second.Added)
+		}
+		if len(second.Modified) != 1 || second.Modified[0].Pending {
+			t.Errorf("got modified %v want the settled Disney Plus payment", second.Modified)
+		}
+		if len(second.Removed) != 1 || second.Removed[0] != first.Added[0].TransactionID {
+			t.Errorf("got removed %v want %v", second.Removed, first.Added[0].TransactionID)
+		}
+		err = api.SaveCursors(testContext, second)
+		if err != nil {
+			t.Fatalf("unexpected error saving sync cursors: %v", err)
+		}
+
+		third, err := api.SyncTransactions(testContext)
+		if err != nil {
+			t.Fatalf("unexpected error syncing transactions: %v", err)
+		}
+		if len(third.Added)+len(third.Modified)+len(third.Removed) != 0 {
+			t.Errorf("got changes %v want none", third)
+		}
+	})
+
+	t.Run("pages through long histories", func(t *testing.T) {
+		history := History{AccountID: "acc", Payments: []Payment{{Name: "Coffee", Amount: 2.5, Days: 1, Count: 1200}}}
+		api := newStoringAPI(t, New(history, today))
+
+		got, err := api.SyncTransactions(testContext)
+		if err != nil {
+			t.Fatalf("unexpected error syncing transactions: %v", err)
+		}
+		if len(got.Added) != 1200 {
+			t.Errorf("got %d transactions added want 1200", len(got.Added))
+		}
+	})
+
+	t.Run("gets long histories a page at a time", func(t *testing.T) {
+		history := History{AccountID: "acc", Payments: []Payment{{Name: "Coffee", Amount: 2.5, Days: 1, Count: 600}}}
+		bank := New(history, time.Now())
+		api := plaid.NewPlaidAPI(bank.Config())
+
+		got, err := api.GetTransactions(testContext)
+		if err != nil {
+			t.Fatalf("unexpected error getting transactions: %v", err)
+		}
+		if len(got.Transactions) != 600 {
+			t.Errorf("got %d transactions want 600", len(got.Transactions))
+		}
+	})
+
+	t.Run("returns the error it is told to fail with", func(t *testing.T) {
+		bank := New(DefaultHistory, today)
+		api := plaid.NewPlaidAPI(bank.Config())
+		bank.Fail(&plaid.Error{Type: "ITEM_ERROR", Code: "ITEM_LOGIN_REQUIRED", Message: "the login details of this item have changed"})
+
+		_, err := api.SyncTransactions(testContext)
+		if !errors.Is(err, plaid.ErrItemLoginRequired) {
+			t.Errorf("got %v want %v", err, plaid.ErrItemLoginRequired)
+		}
+
+		bank.Fail(nil)
+		_, err = api.SyncTransactions(testContext)
+		if err != nil {
+			t.Errorf("unexpected error after the bank recovered: %v", err)
+		}
+	})
+
+	t.Run("rejects other credentials", func(t *testing.T) {
+		config := New(DefaultHistory, today).Config()
+		config.Secret = "wrong"
+
+		_, err := plaid.NewPlaidAPI(config).GetTransactions(testContext)
+		if !errors.Is(err, plaid.ErrAuth) {
+			t.Errorf("got %v want %v", err, plaid.ErrAuth)
+		}
+	})
+
+	t.Run("forgets removed items", func(t *testing.T) {
+		bank := New(DefaultHistory, today)
+		api := newStoringAPI(t, bank)
+
+		_, err := api.SyncTransactions(testContext)
+		if err != nil {
+			t.Fatalf("unexpected error syncing transactions: %v", err)
+		}
+		items, _ := api.Items(testContext)
+		if len(items) != 1 {
+			t.Fatalf("got %d linked items want 1", len(items))
+		}
+
+		err = api.Unlink(testContext, items[0].ID)
+		if err != nil {
+			t.Fatalf("unexpected error unlinking item: %v", err)
+		}
+		if len(bank.items) != 0 {
+			t.Errorf("got %d items still linked at the bank want none", len(bank.items))
+		}
+	})
+
+	t.Run("serves the endpoints over HTTP", func(t *testing.T) {
+		server := httptest.NewServer(New(DefaultHistory, time.Now()))
+		defer server.Close()
+
+		response, err := http.Get(server.URL + "/transactions/get")
+		if err != nil {
+			t.Fatalf("unexpected request error: %v", err)
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("got status %d want %d", response.StatusCode, http.StatusMethodNotAllowed)
+		}
+
+		config := plaid.Config{BaseURL: server.URL, ClientID: ClientID, Secret: Secret}
+		got, err := plaid.NewPlaidAPI(config).GetTransactions(testContext)
+		if err != nil {
+			t.Fatalf("unexpected error getting transactions: %v", err)
+		}
+		if len(got.Transactions) == 0 {
+			t.Errorf("got no transactions want the history")
+		}
+	})
+}
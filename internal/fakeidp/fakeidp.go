@@ -0,0 +1,266 @@
+package fakeidp
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/Catzkorn/subscrypt/internal/oidc"
+)
+
+// The credentials the fake identity provider accepts
+const (
+	ClientID     = "fake-client-id"
+	ClientSecret = "fake-client-secret"
+)
+
+// Issuer is the issuer of a fake identity provider used without a network connection
+const Issuer = "http://fakeidp"
+
+// keyID is the ID of the key the fake identity provider signs ID tokens with
+const keyID = "fakeidp-1"
+
+// tokenLifetime is how long the ID tokens the fake identity provider issues last
+const tokenLifetime = time.Hour
+
+// DefaultUser is who signs in to a fake identity provider when no user is given
+var DefaultUser = User{Subject: "248289761001", Email: "gary@gopher.com", Name: "Gary Gopher"}
+
+// User is who the fake identity provider says signed in.
+// Their email is reported as verified unless UnverifiedEmail is set.
+type User struct {
+	Subject         string
+	Email           string
+	Name            string
+	UnverifiedEmail bool
+}
+
+// grant is an authorization code the fake identity provider issued, waiting to be exchanged for an ID token
+type grant struct {
+	redirectURI string
+	challenge   string
+	nonce       string
+	user        User
+}
+
+// IdentityProvider is an OpenID Connect identity provider that signs the user in without asking for a password.
+// It serves the discovery document, key set, sign in page and token endpoint of the authorization code flow with PKCE.
+type IdentityProvider struct {
+	issuer string
+	key    *rsa.PrivateKey
+	mu     sync.Mutex
+	user   User
+	codes  map[string]grant
+}
+
+// New returns a fake identity provider with the issuer that signs in the user
+func New(issuer string, user User) (*IdentityProvider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate signing key: %w", err)
+	}
+	return &IdentityProvider{issuer: issuer, key: key, user: user, codes: map[string]grant{}}, nil
+}
+
+// Config returns the configuration of an OpenID Connect provider that uses the identity provider without a network connection
+func (p *IdentityProvider) Config(redirectURL string) oidc.Config {
+	return oidc.Config{
+		IssuerURL:    p.issuer,
+		ClientID:     ClientID,
+		ClientSecret: ClientSecret,
+		RedirectURL:  redirectURL,
+		HTTPClient:   &http.Client{Transport: handlerTransport{p}},
+	}
+}
+
+// SignIn sets who signs in from now on
+func (p *IdentityProvider) SignIn(user User) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.user = user
+}
+
+// Authorize visits the sign in page at the address as a browser would,
+// and returns the address of the callback the identity provider sends the browser back to
+func (p *IdentityProvider) Authorize(authCodeURL string) (*url.URL, error) {
+	recorder := httptest.NewRecorder()
+	p.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, authCodeURL, nil))
+	if recorder.Code != http.StatusFound {
+		return nil, fmt.Errorf("sign in page responded with %d: %s", recorder.Code, recorder.Body)
+	}
+	return url.Parse(recorder.Header().Get("Location"))
+}
+
+// ServeHTTP serves the identity provider's endpoints
+func (p *IdentityProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		p.write(w, map[string]interface{}{
+			"issuer":                                p.issuer,
+			"authorization_endpoint":                p.issuer + "/authorize",
+			"token_endpoint":                        p.issuer + "/token",
+			"jwks_uri":                              p.issuer + "/jwks",
+			"response_types_supported":              []string{"code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+			"code_challenge_methods_supported":      []string{"S256"},
+		})
+	case "/jwks":
+		p.write(w, map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}}})
+	case "/authorize":
+		p.authorize(w, r)
+	case "/token":
+		p.token(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// authorize signs in the user and sends the browser back to the client's callback with an authorization code
+func (p *IdentityProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	switch {
+	case query.Get("client_id") != ClientID:
+		http.Error(w, "unknown client", http.StatusBadRequest)
+		return
+	case err != nil || query.Get("redirect_uri") == "":
+		http.Error(w, "missing redirect_uri", http.StatusBadRequest)
+		return
+	case query.Get("response_type") != "code":
+		http.Error(w, "only the code response type is supported", http.StatusBadRequest)
+		return
+	case query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256":
+		http.Error(w, "an S256 code challenge is required", http.StatusBadRequest)
+		return
+	}
+
+	code, err := randomString()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	p.mu.Lock()
+	p.codes[code] = grant{
+		redirectURI: redirectURI.String(),
+		challenge:   query.Get("code_challenge"),
+		nonce:       query.Get("nonce"),
+		user:        p.user,
+	}
+	p.mu.Unlock()
+
+	callback := redirectURI.Query()
+	callback.Set("code", code)
+	callback.Set("state", query.Get("state"))
+	redirectURI.RawQuery = callback.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// token exchanges an authorization code, once, for an ID token of the user who signed in
+func (p *IdentityProvider) token(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok || clientID != ClientID || clientSecret != ClientSecret {
+		p.writeError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+	if r.FormValue("grant_type") != "authorization_code" {
+		p.writeError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	p.mu.Lock()
+	code, ok := p.codes[r.FormValue("code")]
+	delete(p.codes, r.FormValue("code"))
+	p.mu.Unlock()
+
+	if !ok || code.redirectURI != r.FormValue("redirect_uri") || oidc.CodeChallenge(r.FormValue("code_verifier")) != code.challenge {
+		p.writeError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	issuedAt := time.Now()
+	idToken, err := p.sign(map[string]interface{}{
+		"iss":            p.issuer,
+		"sub":            code.user.Subject,
+		"aud":            ClientID,
+		"exp":            issuedAt.Add(tokenLifetime).Unix(),
+		"iat":            issuedAt.Unix(),
+		"nonce":          code.nonce,
+		"email":          code.user.Email,
+		"email_verified": !code.user.UnverifiedEmail,
+		"name":           code.user.Name,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	p.write(w, map[string]interface{}{"access_token": "fake-access-token", "token_type": "Bearer", "id_token": idToken})
+}
+
+// sign returns an RS256 JSON web token of the claims signed with the identity provider's key
+func (p *IdentityProvider) sign(claims map[string]interface{}) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": keyID, "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("unable to sign ID token: %w", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func (p *IdentityProvider) write(w http.ResponseWriter, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (p *IdentityProvider) writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
+
+// randomString returns a random base64url string, used for authorization codes
+func randomString() (string, error) {
+	random := make([]byte, 32)
+	_, err := rand.Read(random)
+	if err != nil {
+		return "", fmt.Errorf("unable to create authorization code: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(random), nil
+}
+
+// handlerTransport sends requests straight to a handler instead of over the network
+type handlerTransport struct {
+	handler http.Handler
+}
+
+// RoundTrip serves the request with the handler and returns its response
+func (t handlerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	recorder := httptest.NewRecorder()
+	t.handler.ServeHTTP(recorder, r)
+	return recorder.Result(), nil
+}
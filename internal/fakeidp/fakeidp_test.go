@@ -0,0 +1,98 @@
+package fakeidp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Catzkorn/subscrypt/internal/oidc"
+)
+
+const redirectURL = "http://subscrypt/api/sso/callback"
+
+func newTestProvider(t *testing.T, idp *IdentityProvider) *oidc.Provider {
+	t.Helper()
+	provider, err := oidc.NewProvider(context.Background(), idp.Config(redirectURL))
+	if err != nil {
+		t.Fatalf("unable to create provider: %v", err)
+	}
+	return provider
+}
+
+// signIn starts a sign in, visits the identity provider's sign in page and returns the code it sends back
+func signIn(t *testing.T, idp *IdentityProvider, provider *oidc.Provider, request oidc.AuthRequest) string {
+	t.Helper()
+	callback, err := idp.Authorize(provider.AuthCodeURL(request))
+	if err != nil {
+		t.Fatalf("unable to sign in: %v", err)
+	}
+	if callback.Scheme+"://"+callback.Host+callback.Path != redirectURL {
+		t.Errorf("got sent back to %v want %s", callback, redirectURL)
+	}
+	if callback.Query().Get("state") != request.State {
+		t.Errorf("got state %q want %q", callback.Query().Get("state"), request.State)
+	}
+	return callback.Query().Get("code")
+}
+
+func TestIdentityProvider(t *testing.T) {
+	idp, err := New(Issuer, DefaultUser)
+	if err != nil {
+		t.Fatalf("unable to create identity provider: %v", err)
+	}
+	provider := newTestProvider(t, idp)
+
+	t.Run("signs in the user with the authorization code flow and PKCE", func(t *testing.T) {
+		request, err := oidc.NewAuthRequest()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		code := signIn(t, idp, provider, request)
+
+		identity, err := provider.Authenticate(context.Background(), code, request)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := oidc.Identity{Issuer: Issuer, Subject: DefaultUser.Subject, Email: DefaultUser.Email, EmailVerified: true, Name: DefaultUser.Name}
+		if *identity != want {
+			t.Errorf("got identity %+v want %+v", *identity, want)
+		}
+
+		_, err = provider.Authenticate(context.Background(), code, request)
+		if !errors.Is(err, oidc.ErrCodeRejected) {
+			t.Errorf("got %v reusing a code want %v", err, oidc.ErrCodeRejected)
+		}
+	})
+
+	t.Run("rejects a code exchanged without its verifier", func(t *testing.T) {
+		request, err := oidc.NewAuthRequest()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		code := signIn(t, idp, provider, request)
+
+		request.Verifier = "stolen-code-without-the-verifier"
+		_, err = provider.Authenticate(context.Background(), code, request)
+		if !errors.Is(err, oidc.ErrCodeRejected) {
+			t.Errorf("got %v want %v", err, oidc.ErrCodeRejected)
+		}
+	})
+
+	t.Run("signs in whoever it is told to", func(t *testing.T) {
+		gwen := User{Subject: "99", Email: "gwen@gopher.com", Name: "Gwen Gopher"}
+		idp.SignIn(gwen)
+		defer idp.SignIn(DefaultUser)
+
+		request, err := oidc.NewAuthRequest()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		identity, err := provider.Authenticate(context.Background(), signIn(t, idp, provider, request), request)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if identity.Subject != gwen.Subject || identity.Email != gwen.Email {
+			t.Errorf("got identity %+v want %+v", identity, gwen)
+		}
+	})
+}
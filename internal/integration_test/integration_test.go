@@ -14,10 +14,14 @@ import (
 	"testing"
 	"time"
 
+	"github.com/Catzkorn/subscrypt/internal/account"
+	"github.com/Catzkorn/subscrypt/internal/catalogue"
 	"github.com/Catzkorn/subscrypt/internal/database"
 	"github.com/Catzkorn/subscrypt/internal/plaid"
 	"github.com/Catzkorn/subscrypt/internal/server"
 	"github.com/Catzkorn/subscrypt/internal/subscription"
+	"github.com/Catzkorn/subscrypt/internal/transaction"
+	"github.com/Catzkorn/subscrypt/internal/userprofile"
 	"github.com/sendgrid/rest"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
 	"github.com/shopspring/decimal"
@@ -34,10 +38,21 @@ func (s *StubMailer) Send(email *mail.SGMailV3) (*rest.Response, error) {
 	return &rest.Response{StatusCode: http.StatusAccepted}, nil
 }
 
+// plaidSources returns a registry with an unconfigured Plaid API as its only source
+func plaidSources(t *testing.T) *server.Sources {
+	t.Helper()
+	sources := server.NewSources()
+	err := sources.Register(plaid.DefaultSource, plaid.NewPlaidAPI(plaid.Config{}))
+	if err != nil {
+		t.Fatalf("unable to register plaid: %v", err)
+	}
+	return sources
+}
+
 func TestCreatingSubsAndRetrievingThem(t *testing.T) {
 	store := database.NewInMemorySubscriptionStore()
-	api := &plaid.PlaidAPI{}
-	testServer := server.NewServer(store, &StubMailer{}, api)
+	testServer := server.NewServer(store, &StubMailer{}, plaidSources(t))
+	session, _ := signUp(t, testServer, "gary@gopher.com")
 
 	amount, _ := decimal.NewFromString("100")
 	newSubscription := subscription.Subscription{
@@ -46,13 +61,13 @@ func TestCreatingSubsAndRetrievingThem(t *testing.T) {
 		DateDue: time.Date(2020, time.November, 11, 0, 0, 0, 0, time.UTC),
 	}
 
-	postRequest := newPostSubscriptionRequest(t, newSubscription)
+	postRequest := newPostSubscriptionRequest(t, session, newSubscription)
 	response := httptest.NewRecorder()
 
 	testServer.ServeHTTP(response, postRequest)
 	assertStatus(t, response.Code, http.StatusOK)
 
-	getRequest := newGetSubscriptionRequest()
+	getRequest := newGetSubscriptionRequest(session)
 	response = httptest.NewRecorder()
 
 	testServer.ServeHTTP(response, getRequest)
@@ -67,8 +82,8 @@ func TestCreatingSubsAndRetrievingThem(t *testing.T) {
 
 func TestDeletingSubscriptionFromInMemoryStore(t *testing.T) {
 	store := database.NewInMemorySubscriptionStore()
-	api := &plaid.PlaidAPI{}
-	testServer := server.NewServer(store, &StubMailer{}, api)
+	testServer := server.NewServer(store, &StubMailer{}, plaidSources(t))
+	session, userID := signUp(t, testServer, "gary@gopher.com")
 
 	amount, _ := decimal.NewFromString("100")
 	newSubscription := subscription.Subscription{
@@ -77,18 +92,18 @@ func TestDeletingSubscriptionFromInMemoryStore(t *testing.T) {
 		DateDue: time.Date(2020, time.November, 11, 0, 0, 0, 0, time.UTC),
 	}
 
-	storedSubscription, err := store.RecordSubscription(newSubscription)
+	storedSubscription, err := store.RecordSubscription(context.Background(), userID, newSubscription)
 	if err != nil {
 		fmt.Println(err)
 	}
 
-	request := newDeleteSubscriptionRequest(storedSubscription.ID)
+	request := newDeleteSubscriptionRequest(session, storedSubscription.ID)
 	response := httptest.NewRecorder()
 
 	testServer.ServeHTTP(response, request)
 	assertStatus(t, response.Code, http.StatusOK)
 
-	gotSubscription, err := store.GetSubscription(storedSubscription.ID)
+	gotSubscription, err := store.GetSubscription(context.Background(), userID, storedSubscription.ID)
 	if err != nil {
 		fmt.Println(err)
 	}
@@ -96,17 +111,126 @@ func TestDeletingSubscriptionFromInMemoryStore(t *testing.T) {
 	if gotSubscription != nil {
 		t.Errorf("subscription not deleted, got %v for given id, want nil", gotSubscription)
 	}
+}
+
+func TestEditingSubscriptionInInMemoryStore(t *testing.T) {
+	store := database.NewInMemorySubscriptionStore()
+	testServer := server.NewServer(store, &StubMailer{}, plaidSources(t))
+	session, userID := signUp(t, testServer, "gary@gopher.com")
+
+	amount, _ := decimal.NewFromString("9.99")
+	storedSubscription, err := store.RecordSubscription(context.Background(), userID, subscription.Subscription{
+		Name:    "Netflix",
+		Amount:  amount,
+		DateDue: time.Date(2020, time.November, 11, 0, 0, 0, 0, time.UTC),
+	})
+	assertDatabaseError(t, err)
+
+	request, _ := http.NewRequest(http.MethodPatch, fmt.Sprintf("/api/subscriptions/%d", storedSubscription.ID), bytes.NewBufferString(`{"amount": "12.99", "frequency": "annually"}`))
+	addSession(request, session)
+	response := httptest.NewRecorder()
+	testServer.ServeHTTP(response, request)
+	assertStatus(t, response.Code, http.StatusOK)
+
+	gotSubscription, err := store.GetSubscription(context.Background(), userID, storedSubscription.ID)
+	assertDatabaseError(t, err)
+
+	want, _ := decimal.NewFromString("12.99")
+	if gotSubscription.Name != "Netflix" || !gotSubscription.Amount.Equal(want) || gotSubscription.Frequency != subscription.Annually {
+		t.Errorf("subscription not edited, got %+v want Netflix at %v annually", gotSubscription, want)
+	}
+}
+
+func TestMatchingPaymentsToAHandEnteredSubscription(t *testing.T) {
+	store := database.NewInMemorySubscriptionStore()
+	merchants := catalogue.New([]catalogue.Entry{{Merchant: "Amazon Prime", Patterns: []string{"prime video"}}})
+	testServer := server.NewServer(store, &StubMailer{}, plaidSources(t), server.WithCatalogue(merchants))
+	session, userID := signUp(t, testServer, "gary@gopher.com")
+
+	amount, _ := decimal.NewFromString("9.99")
+	err := store.RecordTransactions(context.Background(), userID, []transaction.Transaction{
+		{ExternalID: "tx-1", Name: "AMAZON PRIME", Merchant: "amazon prime", Amount: amount, Currency: "GBP", Date: time.Date(2020, time.October, 11, 0, 0, 0, 0, time.UTC)},
+	})
+	assertDatabaseError(t, err)
+
+	response := httptest.NewRecorder()
+	testServer.ServeHTTP(response, newPostSubscriptionRequest(t, session, subscription.Subscription{
+		Name:    "Prime Video",
+		Amount:  amount,
+		DateDue: time.Date(2020, time.November, 11, 0, 0, 0, 0, time.UTC),
+	}))
+	assertStatus(t, response.Code, http.StatusOK)
+
+	transactions, err := store.GetTransactions(context.Background(), userID)
+	assertDatabaseError(t, err)
+	if len(transactions) != 1 || transactions[0].SubscriptionID == 0 {
+		t.Errorf("got transactions %v want the Amazon Prime payment matched to the new subscription", transactions)
+	}
+}
 
-	err = clearSubscriptionsTable()
+func TestUsersCannotReachEachOthersSubscriptions(t *testing.T) {
+	store := database.NewInMemorySubscriptionStore()
+	testServer := server.NewServer(store, &StubMailer{}, plaidSources(t))
+	garySession, gary := signUp(t, testServer, "gary@gopher.com")
+	gwenSession, _ := signUp(t, testServer, "gwen@gopher.com")
+
+	amount, _ := decimal.NewFromString("9.99")
+	garys, err := store.RecordSubscription(context.Background(), gary, subscription.Subscription{
+		Name:    "Netflix",
+		Amount:  amount,
+		DateDue: time.Date(2020, time.November, 11, 0, 0, 0, 0, time.UTC),
+	})
 	assertDatabaseError(t, err)
+
+	response := httptest.NewRecorder()
+	testServer.ServeHTTP(response, newGetSubscriptionRequest(gwenSession))
+	assertStatus(t, response.Code, http.StatusOK)
+	if got := getSubscriptionsFromResponse(t, response.Body); len(got) != 0 {
+		t.Errorf("got another user's subscriptions %v", got)
+	}
+
+	for _, path := range []string{"/renewals", "/payments"} {
+		request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/api/subscriptions/%d%s", garys.ID, path), nil)
+		addSession(request, gwenSession)
+		response = httptest.NewRecorder()
+		testServer.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusNotFound)
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodPatch} {
+		request, _ := http.NewRequest(method, fmt.Sprintf("/api/subscriptions/%d", garys.ID), bytes.NewBufferString(`{"name": "Not Netflix", "amount": "1", "dateDue": "2020-11-11T00:00:00Z"}`))
+		addSession(request, gwenSession)
+		response = httptest.NewRecorder()
+		testServer.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusNotFound)
+	}
+
+	reminder := bytes.NewBufferString(fmt.Sprintf(`{"id": %d}`, garys.ID))
+	request, _ := http.NewRequest(http.MethodPost, "/api/reminders", reminder)
+	addSession(request, gwenSession)
+	response = httptest.NewRecorder()
+	testServer.ServeHTTP(response, request)
+	assertStatus(t, response.Code, http.StatusNotFound)
+
+	response = httptest.NewRecorder()
+	testServer.ServeHTTP(response, newDeleteSubscriptionRequest(gwenSession, garys.ID))
+	assertStatus(t, response.Code, http.StatusNotFound)
+
+	response = httptest.NewRecorder()
+	testServer.ServeHTTP(response, newGetSubscriptionRequest(garySession))
+	if got := getSubscriptionsFromResponse(t, response.Body); len(got) != 1 || got[0].ID != garys.ID {
+		t.Errorf("got subscriptions %v want the user's own subscription", got)
+	}
 }
 
 func TestCreatingSubsAndRetrievingThemFromDatabase(t *testing.T) {
 	store, err := database.NewDatabaseConnection(os.Getenv("DATABASE_CONN_STRING"))
 	assertDatabaseError(t, err)
+	err = clearUsersTable()
+	assertDatabaseError(t, err)
 
-	api := &plaid.PlaidAPI{}
-	testServer := server.NewServer(store, &StubMailer{}, api)
+	testServer := server.NewServer(store, &StubMailer{}, plaidSources(t))
+	session, _ := signUp(t, testServer, "gary@gopher.com")
 
 	amount, _ := decimal.NewFromString("100")
 	newSubscription := subscription.Subscription{
@@ -115,13 +239,13 @@ func TestCreatingSubsAndRetrievingThemFromDatabase(t *testing.T) {
 		DateDue: time.Date(2020, time.November, 11, 0, 0, 0, 0, time.UTC),
 	}
 
-	postRequest := newPostSubscriptionRequest(t, newSubscription)
+	postRequest := newPostSubscriptionRequest(t, session, newSubscription)
 	response := httptest.NewRecorder()
 	testServer.ServeHTTP(response, postRequest)
 
 	assertStatus(t, response.Code, http.StatusOK)
 
-	getRequest := newGetSubscriptionRequest()
+	getRequest := newGetSubscriptionRequest(session)
 	response = httptest.NewRecorder()
 	testServer.ServeHTTP(response, getRequest)
 
@@ -135,15 +259,17 @@ func TestCreatingSubsAndRetrievingThemFromDatabase(t *testing.T) {
 		t.Errorf("Subscription not saved and retrieved successfully, got ")
 	}
 
-	err = clearSubscriptionsTable()
+	err = clearUsersTable()
 	assertDatabaseError(t, err)
 }
 
 func TestDeletingSubscriptionFromDatabase(t *testing.T) {
 	store, err := database.NewDatabaseConnection(os.Getenv("DATABASE_CONN_STRING"))
 	assertDatabaseError(t, err)
-	api := &plaid.PlaidAPI{}
-	testServer := server.NewServer(store, &StubMailer{}, api)
+	err = clearUsersTable()
+	assertDatabaseError(t, err)
+	testServer := server.NewServer(store, &StubMailer{}, plaidSources(t))
+	session, userID := signUp(t, testServer, "gary@gopher.com")
 
 	amount, _ := decimal.NewFromString("100")
 	newSubscription := subscription.Subscription{
@@ -152,18 +278,18 @@ func TestDeletingSubscriptionFromDatabase(t *testing.T) {
 		DateDue: time.Date(2020, time.November, 11, 0, 0, 0, 0, time.UTC),
 	}
 
-	storedSubscription, err := store.RecordSubscription(newSubscription)
+	storedSubscription, err := store.RecordSubscription(context.Background(), userID, newSubscription)
 	if err != nil {
 		fmt.Println(err)
 	}
 
-	request := newDeleteSubscriptionRequest(storedSubscription.ID)
+	request := newDeleteSubscriptionRequest(session, storedSubscription.ID)
 	response := httptest.NewRecorder()
 
 	testServer.ServeHTTP(response, request)
 	assertStatus(t, response.Code, http.StatusOK)
 
-	gotSubscription, err := store.GetSubscription(storedSubscription.ID)
+	gotSubscription, err := store.GetSubscription(context.Background(), userID, storedSubscription.ID)
 	if err != nil {
 		fmt.Println(err)
 	}
@@ -172,7 +298,7 @@ func TestDeletingSubscriptionFromDatabase(t *testing.T) {
 		t.Errorf("subscription not deleted, got %v for given id, want nil", gotSubscription)
 	}
 
-	err = clearSubscriptionsTable()
+	err = clearUsersTable()
 	assertDatabaseError(t, err)
 }
 
@@ -212,28 +338,60 @@ func assertContentType(t *testing.T, response *httptest.ResponseRecorder, want s
 	}
 }
 
-func newGetSubscriptionRequest() *http.Request {
+// signUp creates an account on the server, returning its session cookie and the new user's ID
+func signUp(t *testing.T, testServer *server.Server, email string) (*http.Cookie, int) {
+	t.Helper()
+	body := fmt.Sprintf(`{"name": "Gary Gopher", "email": %q, "password": "correct horse"}`, email)
+	request := httptest.NewRequest(http.MethodPost, "/api/signup", bytes.NewBufferString(body))
+	response := httptest.NewRecorder()
+	testServer.ServeHTTP(response, request)
+	assertStatus(t, response.Code, http.StatusCreated)
+
+	var user userprofile.Userprofile
+	err := json.NewDecoder(response.Body).Decode(&user)
+	if err != nil {
+		t.Fatalf("unable to parse the signed up user %q: %v", response.Body, err)
+	}
+	for _, cookie := range response.Result().Cookies() {
+		if cookie.Name == server.SessionCookie {
+			return cookie, user.ID
+		}
+	}
+	t.Fatalf("signing up did not start a session")
+	return nil, 0
+}
+
+// addSession makes the request as the web UI of the user logged in to the session, sending the session's CSRF token
+func addSession(request *http.Request, session *http.Cookie) {
+	request.AddCookie(session)
+	request.Header.Set(server.CSRFHeader, account.CSRFToken(session.Value))
+}
+
+func newGetSubscriptionRequest(session *http.Cookie) *http.Request {
 	req, _ := http.NewRequest(http.MethodGet, "/api/subscriptions", nil)
+	addSession(req, session)
 	return req
 }
 
-func newPostSubscriptionRequest(t *testing.T, subscription subscription.Subscription) *http.Request {
+func newPostSubscriptionRequest(t *testing.T, session *http.Cookie, subscription subscription.Subscription) *http.Request {
 	postBody, _ := json.Marshal(subscription)
 	req, err := http.NewRequest(http.MethodPost, "/api/subscriptions", bytes.NewBuffer(postBody))
 
 	if err != nil {
 		t.Errorf("failed to generate new POST subscription request")
 	}
+	addSession(req, session)
 	return req
 }
 
-func newDeleteSubscriptionRequest(ID int) *http.Request {
+func newDeleteSubscriptionRequest(session *http.Cookie, ID int) *http.Request {
 	bodyStr := []byte(fmt.Sprintf("{\"id\": %v}", ID))
 	deleteURL := fmt.Sprintf("/api/subscriptions/%v", ID)
 	req, err := http.NewRequest(http.MethodDelete, deleteURL, bytes.NewBuffer(bodyStr))
 	if err != nil {
 		panic(err)
 	}
+	addSession(req, session)
 	return req
 }
 
@@ -246,12 +404,12 @@ func getSubscriptionsFromResponse(t *testing.T, body io.Reader) (subscriptions [
 	return
 }
 
-func clearSubscriptionsTable() error {
+func clearUsersTable() error {
 	db, err := sql.Open("pgx", os.Getenv("DATABASE_CONN_STRING"))
 	if err != nil {
 		return fmt.Errorf("unexpected connection error: %w", err)
 	}
-	_, err = db.ExecContext(context.Background(), "TRUNCATE TABLE subscriptions;")
+	_, err = db.ExecContext(context.Background(), "TRUNCATE TABLE users CASCADE;")
 	if err != nil {
 		return fmt.Errorf("unexpected connection error: %w", err)
 	}
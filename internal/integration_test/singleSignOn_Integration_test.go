@@ -0,0 +1,83 @@
+package integration_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Catzkorn/subscrypt/internal/database"
+	"github.com/Catzkorn/subscrypt/internal/fakeidp"
+	"github.com/Catzkorn/subscrypt/internal/oidc"
+	"github.com/Catzkorn/subscrypt/internal/server"
+	"github.com/Catzkorn/subscrypt/internal/subscription"
+	"github.com/Catzkorn/subscrypt/internal/userprofile"
+	"github.com/shopspring/decimal"
+)
+
+// signInWithIdP signs in to the server through the fake identity provider, as a browser would, and returns the session cookie
+func signInWithIdP(t *testing.T, testServer *server.Server, idp *fakeidp.IdentityProvider) *http.Cookie {
+	t.Helper()
+	response := httptest.NewRecorder()
+	testServer.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/api/sso/login", nil))
+	assertStatus(t, response.Code, http.StatusFound)
+	cookies := response.Result().Cookies()
+
+	callback, err := idp.Authorize(response.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("unable to sign in to the identity provider: %v", err)
+	}
+
+	request := httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+	for _, cookie := range cookies {
+		request.AddCookie(cookie)
+	}
+	response = httptest.NewRecorder()
+	testServer.ServeHTTP(response, request)
+	assertStatus(t, response.Code, http.StatusFound)
+
+	for _, cookie := range response.Result().Cookies() {
+		if cookie.Name == server.SessionCookie {
+			return cookie
+		}
+	}
+	t.Fatalf("signing in did not start a session")
+	return nil
+}
+
+func TestSigningInWithIdentityProvider(t *testing.T) {
+	idp, err := fakeidp.New(fakeidp.Issuer, fakeidp.DefaultUser)
+	if err != nil {
+		t.Fatalf("unable to create identity provider: %v", err)
+	}
+	provider, err := oidc.NewProvider(context.Background(), idp.Config("http://subscrypt/api/sso/callback"))
+	if err != nil {
+		t.Fatalf("unable to create provider: %v", err)
+	}
+	store := database.NewInMemorySubscriptionStore()
+	testServer := server.NewServer(store, &StubMailer{}, nil, server.WithSingleSignOn(provider), server.WithoutPasswordLogin())
+
+	session := signInWithIdP(t, testServer, idp)
+
+	var user userprofile.Userprofile
+	serveJSON(t, testServer, session, http.MethodGet, "/api/users", &user)
+	if user.Name != fakeidp.DefaultUser.Name || user.Email != fakeidp.DefaultUser.Email {
+		t.Errorf("got user %+v want %+v", user, fakeidp.DefaultUser)
+	}
+
+	amount, _ := decimal.NewFromString("9.99")
+	_, err = store.RecordSubscription(context.Background(), user.ID, subscription.Subscription{
+		Name:    "Netflix",
+		Amount:  amount,
+		DateDue: time.Date(2020, time.November, 11, 0, 0, 0, 0, time.UTC),
+	})
+	assertDatabaseError(t, err)
+
+	session = signInWithIdP(t, testServer, idp)
+	response := httptest.NewRecorder()
+	testServer.ServeHTTP(response, newGetSubscriptionRequest(session))
+	if got := getSubscriptionsFromResponse(t, response.Body); len(got) != 1 || got[0].Name != "Netflix" {
+		t.Errorf("got subscriptions %v want the subscription recorded before signing in again", got)
+	}
+}
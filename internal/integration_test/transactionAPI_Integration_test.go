@@ -1,67 +1,138 @@
-package integration
-//
-//import (
-//	"github.com/Catzkorn/subscrypt/internal/database"
-//	"github.com/Catzkorn/subscrypt/internal/plaid"
-//	"github.com/Catzkorn/subscrypt/internal/server"
-//	"github.com/sendgrid/rest"
-//	"github.com/sendgrid/sendgrid-go/helpers/mail"
-//	"io/ioutil"
-//	"net/http"
-//	"net/http/httptest"
-//	"strings"
-//	"testing"
-//)
-//
-//func TestCallingAPIAndSeeingSubscriptions(t *testing.T) {
-//	store := database.NewInMemorySubscriptionStore()
-//
-//	api := &plaid.PlaidAPI{}
-//
-//	testServer := server.NewServer(store, &StubMailer{}, api)
-//
-//
-//	getRequest := newTransactionAPIRequest()
-//	response := httptest.NewRecorder()
-//	testServer.ServeHTTP(response, getRequest)
-//
-//	getRequest = newGetSubscriptionRequest()
-//	response = httptest.NewRecorder()
-//	testServer.ServeHTTP(response, getRequest)
-//
-//	body, err := ioutil.ReadAll(response.Body)
-//
-//	if err != nil {
-//		t.Errorf("unexpected error: %w", err)
-//	}
-//
-//	bodyString := string(body)
-//	got := bodyString
-//
-//	res := strings.Contains(got, "Touchstone Climbing")
-//
-//	if res != true {
-//		t.Errorf("webpage did not contain subscription of name %v", "Touchstone Climbing")
-//	}
-//}
-//
-//type StubMailer struct {
-//	sentEmail *mail.SGMailV3
-//}
-//
-//func (s *StubMailer) Send(email *mail.SGMailV3) (*rest.Response, error) {
-//	s.sentEmail = email
-//	return &rest.Response{StatusCode: http.StatusAccepted}, nil
-//}
-//
-//const indexTemplatePath = "../../web/index.html"
-//
-//func newTransactionAPIRequest() *http.Request {
-//	req, _ := http.NewRequest(http.MethodGet, "/api/transactions/", nil)
-//	return req
-//}
-//
-//func newGetSubscriptionRequest() *http.Request {
-//	req, _ := http.NewRequest(http.MethodGet, "/", nil)
-//	return req
-//}
+package integration_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Catzkorn/subscrypt/internal/database"
+	"github.com/Catzkorn/subscrypt/internal/fakebank"
+	"github.com/Catzkorn/subscrypt/internal/plaid"
+	"github.com/Catzkorn/subscrypt/internal/secret"
+	"github.com/Catzkorn/subscrypt/internal/server"
+	"github.com/Catzkorn/subscrypt/internal/subscription"
+	"github.com/Catzkorn/subscrypt/internal/transaction"
+)
+
+// newFakeBankServer returns a server importing from the fake bank as the "fake" source, storing everything in memory
+func newFakeBankServer(t *testing.T, bank *fakebank.Bank) *server.Server {
+	t.Helper()
+	store := database.NewInMemorySubscriptionStore()
+	cipher, err := secret.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatalf("unable to create cipher: %v", err)
+	}
+
+	config := bank.Config()
+	config.Source = "fake"
+	config.Items = store
+	config.TokenCipher = cipher
+
+	sources := server.NewSources()
+	err = sources.Register("fake", plaid.NewPlaidAPI(config))
+	if err != nil {
+		t.Fatalf("unable to register the fake bank: %v", err)
+	}
+	return server.NewServer(store, &StubMailer{}, sources)
+}
+
+func TestImportingFromFakeBank(t *testing.T) {
+	bank := fakebank.New(fakebank.DefaultHistory, time.Now())
+	testServer := newFakeBankServer(t, bank)
+	session, _ := signUp(t, testServer, "gary@gopher.com")
+	history := fakebank.DefaultHistory.Transactions(time.Now())
+
+	var candidates []subscription.Candidate
+	serveJSON(t, testServer, session, http.MethodPost, "/api/sources/fake/import", &candidates)
+
+	detected := map[string]subscription.Candidate{}
+	for _, candidate := range candidates {
+		detected[candidate.Subscription.Name] = candidate
+	}
+	for _, name := range []string{"Netflix", "Spotify", "PureGym"} {
+		if _, ok := detected[name]; !ok {
+			t.Errorf("%s was not detected in %v", name, candidates)
+		}
+	}
+	for _, name := range []string{"Pret A Manger", "Trainline", "Salary"} {
+		if _, ok := detected[name]; ok {
+			t.Errorf("%s was detected as a subscription", name)
+		}
+	}
+
+	var transactions []transaction.Transaction
+	serveJSON(t, testServer, session, http.MethodGet, "/api/transactions", &transactions)
+	if len(transactions) != len(history) {
+		t.Errorf("got %d stored transactions want %d", len(transactions), len(history))
+	}
+
+	var netflix subscription.Subscription
+	serveJSON(t, testServer, session, http.MethodPost, fmt.Sprintf("/api/candidates/%d/accept", detected["Netflix"].ID), &netflix)
+
+	var payments []transaction.Transaction
+	paymentsPath := fmt.Sprintf("/api/subscriptions/%d/payments", netflix.ID)
+	serveJSON(t, testServer, session, http.MethodGet, paymentsPath, &payments)
+	if len(payments) != 12 {
+		t.Errorf("got %d Netflix payments want 12", len(payments))
+	}
+
+	bank.Add(plaid.Transaction{
+		TransactionID:   "next-netflix",
+		AccountID:       fakebank.DefaultHistory.AccountID,
+		Amount:          9.99,
+		ISOCurrencyCode: "GBP",
+		Date:            time.Now().Format("2006-01-02"),
+		Name:            "Netflix",
+	})
+	serveJSON(t, testServer, session, http.MethodPost, "/api/sources/fake/import", &candidates)
+
+	serveJSON(t, testServer, session, http.MethodGet, "/api/transactions", &transactions)
+	if len(transactions) != len(history)+1 {
+		t.Errorf("got %d stored transactions after the second import want %d", len(transactions), len(history)+1)
+	}
+	serveJSON(t, testServer, session, http.MethodGet, paymentsPath, &payments)
+	if len(payments) != 13 {
+		t.Errorf("got %d Netflix payments after the second import want 13", len(payments))
+	}
+
+	want := []string{"/sandbox/public_token/create", "/item/public_token/exchange", "/transactions/sync", "/transactions/sync"}
+	if got := bank.Requests(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got requests %v want one link and a sync for each import %v", got, want)
+	}
+}
+
+func TestImportingFromFakeBankWithExpiredLogin(t *testing.T) {
+	bank := fakebank.New(fakebank.DefaultHistory, time.Now())
+	testServer := newFakeBankServer(t, bank)
+	session, _ := signUp(t, testServer, "gary@gopher.com")
+	bank.Fail(&plaid.Error{Type: "ITEM_ERROR", Code: "ITEM_LOGIN_REQUIRED", Message: "the login details of this item have changed"})
+
+	request := httptest.NewRequest(http.MethodPost, "/api/sources/fake/import", nil)
+	addSession(request, session)
+	response := httptest.NewRecorder()
+	testServer.ServeHTTP(response, request)
+
+	if response.Code != http.StatusConflict {
+		t.Errorf("got status %d want %d while the bank login has expired", response.Code, http.StatusConflict)
+	}
+}
+
+// serveJSON makes a request to the server as the user logged in to the session and decodes its JSON response into out, failing unless it succeeds
+func serveJSON(t *testing.T, testServer *server.Server, session *http.Cookie, method string, path string, out interface{}) {
+	t.Helper()
+	request := httptest.NewRequest(method, path, nil)
+	addSession(request, session)
+	response := httptest.NewRecorder()
+	testServer.ServeHTTP(response, request)
+
+	if response.Code != http.StatusOK {
+		t.Fatalf("%s %s: got status %d: %s", method, path, response.Code, response.Body)
+	}
+	err := json.NewDecoder(response.Body).Decode(out)
+	if err != nil {
+		t.Fatalf("%s %s: unable to parse response %q: %v", method, path, response.Body, err)
+	}
+}
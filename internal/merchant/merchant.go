@@ -0,0 +1,150 @@
+package merchant
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Alias is a user defined rule that maps bank descriptors containing Pattern to the canonical Merchant
+type Alias struct {
+	ID       int    `json:"id"`
+	Pattern  string `json:"pattern"`
+	Merchant string `json:"merchant"`
+}
+
+// domainSuffix matches web addresses used as part of a descriptor, such as NETFLIX.COM
+var domainSuffix = regexp.MustCompile(`\.(com|co\.uk|org\.uk|net|org|io|tv|fm)\b`)
+
+// paymentPrefixes are the words banks and card processors put in front of the merchant's name
+var paymentPrefixes = [][]string{
+	{"card", "payment", "to"},
+	{"direct", "debit", "payment", "to"},
+	{"direct", "debit"},
+	{"standing", "order"},
+	{"contactless"},
+	{"www"},
+	{"dd"},
+	{"so"},
+	{"pos"},
+	{"vis"},
+	{"visa"},
+	{"cpt"},
+	{"bcc"},
+	{"paypal"},
+	{"pp"},
+	{"sq"},
+	{"sp"},
+	{"sumup"},
+	{"izettle"},
+	{"zettle"},
+}
+
+// trailingWords are locations, company types, dates and billing words banks add after the merchant's name.
+// Single letters, such as the B V of B.V., are also removed from the end.
+var trailingWords = map[string]bool{
+	"gb": true, "uk": true, "gbr": true, "us": true, "usa": true, "ie": true, "irl": true, "nl": true, "lu": true, "eu": true,
+	"london": true, "manchester": true, "birmingham": true, "leeds": true, "glasgow": true, "edinburgh": true, "bristol": true,
+	"dublin": true, "amsterdam": true, "luxembourg": true, "gatos": true, "los": true, "cupertino": true, "seattle": true,
+	"intl": true, "international": true, "ltd": true, "limited": true, "inc": true, "llc": true, "plc": true, "bv": true,
+	"gmbh": true, "sarl": true, "sa": true, "co": true, "com": true,
+	"card": true, "payment": true, "ref": true, "bill": true, "billing": true, "subscription": true, "on": true,
+	"jan": true, "feb": true, "mar": true, "apr": true, "may": true, "jun": true,
+	"jul": true, "aug": true, "sep": true, "oct": true, "nov": true, "dec": true,
+}
+
+// Normalize reduces a bank descriptor to the canonical name of the merchant, in lower case.
+// Reference and card numbers, payment prefixes, web domains, locations and company types are removed,
+// so "NETFLIX.COM 866-579" and "Netflix Intl" both become "netflix".
+func Normalize(descriptor string) string {
+	lower := domainSuffix.ReplaceAllString(strings.ToLower(descriptor), " ")
+
+	all := strings.FieldsFunc(lower, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var words []string
+	for _, word := range all {
+		if strings.IndexFunc(word, unicode.IsDigit) == -1 {
+			words = append(words, word)
+		}
+	}
+	if len(words) == 0 {
+		return strings.Join(all, " ")
+	}
+
+	trimmed := trimPrefixes(words)
+	for len(trimmed) > 0 && (trailingWords[trimmed[len(trimmed)-1]] || len(trimmed[len(trimmed)-1]) == 1) {
+		trimmed = trimmed[:len(trimmed)-1]
+	}
+	if len(trimmed) == 0 {
+		return strings.Join(words, " ")
+	}
+	return strings.Join(trimmed, " ")
+}
+
+// trimPrefixes removes payment prefixes from the front of the words, for as long as one matches
+func trimPrefixes(words []string) []string {
+	for {
+		trimmed := false
+		for _, prefix := range paymentPrefixes {
+			if len(words) > len(prefix) && hasPrefix(words, prefix) {
+				words = words[len(prefix):]
+				trimmed = true
+			}
+		}
+		if !trimmed {
+			return words
+		}
+	}
+}
+
+func hasPrefix(words []string, prefix []string) bool {
+	for i, word := range prefix {
+		if words[i] != word {
+			return false
+		}
+	}
+	return true
+}
+
+// Resolver maps bank descriptors to canonical merchants using the normalization rules and a set of aliases
+type Resolver struct {
+	aliases []Alias
+}
+
+// NewResolver returns a Resolver that applies the given aliases
+func NewResolver(aliases []Alias) *Resolver {
+	var normalized []Alias
+	for _, alias := range aliases {
+		pattern := Normalize(alias.Pattern)
+		if pattern == "" {
+			continue
+		}
+		normalized = append(normalized, Alias{ID: alias.ID, Pattern: pattern, Merchant: Normalize(alias.Merchant)})
+	}
+	return &Resolver{aliases: normalized}
+}
+
+// Resolve returns the canonical merchant for the descriptor.
+// If the normalized descriptor contains the pattern of an alias the alias's merchant is used,
+// preferring the longest pattern when more than one matches. A nil Resolver only normalizes.
+func (r *Resolver) Resolve(descriptor string) string {
+	normalized := Normalize(descriptor)
+	if r == nil {
+		return normalized
+	}
+
+	var match *Alias
+	padded := " " + normalized + " "
+	for i, alias := range r.aliases {
+		if strings.Contains(padded, " "+alias.Pattern+" ") && (match == nil || len(alias.Pattern) > len(match.Pattern)) {
+			match = &r.aliases[i]
+		}
+	}
+
+	if match == nil {
+		return normalized
+	}
+	return match.Merchant
+}
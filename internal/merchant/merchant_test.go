@@ -0,0 +1,59 @@
+package merchant
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	cases := map[string]string{
+		"Netflix":                              "netflix",
+		"NETFLIX.COM 866-579":                  "netflix",
+		"Netflix Intl":                         "netflix",
+		"NETFLIX INTERNATIONAL B.V. AMSTERDAM": "netflix",
+		"CARD PAYMENT TO SPOTIFY P0D4F3B1C2 ON 12 OCT": "spotify",
+		"PAYPAL *SPOTIFY":               "spotify",
+		"DD THE GUARDIAN":               "the guardian",
+		"Amazon.co.uk*MK1234 London GB": "amazon",
+		"AMZN Mktp UK*1A2B3C":           "amzn mktp",
+		"Touchstone Climbing":           "touchstone climbing",
+		"APPLE.COM/BILL":                "apple",
+		"PureGym Ltd":                   "puregym",
+		"  ":                            "",
+		"1234":                          "1234",
+		"UK":                            "uk",
+	}
+
+	for descriptor, want := range cases {
+		if got := Normalize(descriptor); got != want {
+			t.Errorf("Normalize(%q) got %q want %q", descriptor, got, want)
+		}
+	}
+}
+
+func TestResolver(t *testing.T) {
+	resolver := NewResolver([]Alias{
+		{ID: 1, Pattern: "AMZN Mktp", Merchant: "Amazon"},
+		{ID: 2, Pattern: "amzn", Merchant: "Amazon"},
+		{ID: 3, Pattern: "amzn prime", Merchant: "Amazon Prime"},
+		{ID: 4, Pattern: "", Merchant: "Everything"},
+	})
+
+	cases := map[string]string{
+		"AMZN Mktp UK*1A2B3C": "amazon",
+		"Amazon.co.uk*MK1234": "amazon",
+		"AMZN PRIME*2K4DX0":   "amazon prime",
+		"Netflix.com 866-579": "netflix",
+		"AMZNX Digital":       "amznx digital",
+	}
+
+	for descriptor, want := range cases {
+		if got := resolver.Resolve(descriptor); got != want {
+			t.Errorf("Resolve(%q) got %q want %q", descriptor, got, want)
+		}
+	}
+
+	t.Run("a nil resolver only normalizes", func(t *testing.T) {
+		var resolver *Resolver
+		if got := resolver.Resolve("Netflix Intl"); got != "netflix" {
+			t.Errorf("got %q want %q", got, "netflix")
+		}
+	})
+}
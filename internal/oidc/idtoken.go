@@ -0,0 +1,250 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// ErrInvalidIDToken is returned for an ID token that wasn't issued by the identity provider for this sign in
+var ErrInvalidIDToken = errors.New("ID token is not valid")
+
+// clockSkew is how far the identity provider's clock can be from ours when checking when a token expires
+const clockSkew = time.Minute
+
+// keyFetchInterval is the least time between requests for the key set made for keys that aren't cached,
+// so tokens naming made up keys can't make us flood the identity provider with requests
+const keyFetchInterval = 10 * time.Second
+
+// Identity is who the identity provider says signed in.
+// Subject identifies the user within the Issuer and never changes, unlike their email and name.
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// audience is the aud claim of an ID token, which is either a single client ID or a list of them
+type audience []string
+
+// UnmarshalJSON parses either form of the aud claim
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if json.Unmarshal(data, &single) == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	err := json.Unmarshal(data, &list)
+	*a = list
+	return err
+}
+
+// contains reports whether the client ID is one of the audience
+func (a audience) contains(clientID string) bool {
+	for _, member := range a {
+		if member == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// idTokenHeader is the header of an ID token
+type idTokenHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// idTokenClaims are the claims of an ID token the sign in uses
+type idTokenClaims struct {
+	Issuer          string   `json:"iss"`
+	Subject         string   `json:"sub"`
+	Audience        audience `json:"aud"`
+	AuthorizedParty string   `json:"azp"`
+	ExpiresAt       int64    `json:"exp"`
+	IssuedAt        int64    `json:"iat"`
+	Nonce           string   `json:"nonce"`
+	Email           string   `json:"email"`
+	EmailVerified   bool     `json:"email_verified"`
+	Name            string   `json:"name"`
+}
+
+// jsonWebKey is a public key from the identity provider's key set
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// keySet is the identity provider's JSON web key set
+type keySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// VerifyIDToken checks that the ID token was signed by the identity provider with RS256 or ES256,
+// was issued for this client with the nonce the sign in was started with and hasn't expired, and returns its identity.
+// It returns ErrInvalidIDToken if the token can't be verified.
+func (p *Provider) VerifyIDToken(ctx context.Context, token string, nonce string) (*Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidIDToken)
+	}
+
+	var header idTokenHeader
+	err := decodeSegment(parts[0], &header)
+	if err != nil || (header.Alg != "RS256" && header.Alg != "ES256") {
+		return nil, fmt.Errorf("%w: unsupported token header", ErrInvalidIDToken)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidIDToken)
+	}
+	key, err := p.signingKey(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if !verifySignature(header.Alg, key, digest[:], signature) {
+		return nil, fmt.Errorf("%w: signature does not match", ErrInvalidIDToken)
+	}
+
+	var claims idTokenClaims
+	err = decodeSegment(parts[1], &claims)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed claims", ErrInvalidIDToken)
+	}
+
+	switch {
+	case claims.Issuer != p.endpoints.Issuer:
+		return nil, fmt.Errorf("%w: issued by %q", ErrInvalidIDToken, claims.Issuer)
+	case !claims.Audience.contains(p.config.ClientID):
+		return nil, fmt.Errorf("%w: not issued for this client", ErrInvalidIDToken)
+	case claims.AuthorizedParty != "" && claims.AuthorizedParty != p.config.ClientID:
+		return nil, fmt.Errorf("%w: authorized for another client", ErrInvalidIDToken)
+	case !now().Before(time.Unix(claims.ExpiresAt, 0).Add(clockSkew)):
+		return nil, fmt.Errorf("%w: token has expired", ErrInvalidIDToken)
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return nil, fmt.Errorf("%w: nonce does not match", ErrInvalidIDToken)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	}
+
+	return &Identity{
+		Issuer:        claims.Issuer,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+	}, nil
+}
+
+// verifySignature reports whether the signature of the digest was made with the key using the algorithm
+func verifySignature(alg string, key crypto.PublicKey, digest []byte, signature []byte) bool {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return alg == "RS256" && rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, signature) == nil
+	case *ecdsa.PublicKey:
+		if alg != "ES256" || len(signature) != 64 {
+			return false
+		}
+		r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(key, digest, r, s)
+	default:
+		return false
+	}
+}
+
+// signingKey returns the identity provider's public key with the key ID.
+// The key set is fetched again for a key ID that hasn't been seen, so keys the provider rotates in are found,
+// at most once every keyFetchInterval.
+func (p *Provider) signingKey(ctx context.Context, keyID string) (crypto.PublicKey, error) {
+	p.mutex.Lock()
+	key, ok := p.keys[keyID]
+	switch {
+	case ok:
+		p.mutex.Unlock()
+		return key, nil
+	case now().Sub(p.lastKeyFetch) < keyFetchInterval:
+		p.mutex.Unlock()
+		return nil, fmt.Errorf("%w: unknown signing key %q, too many requests for unknown signing keys", ErrInvalidIDToken, keyID)
+	}
+	p.lastKeyFetch = now()
+	p.mutex.Unlock()
+
+	var set keySet
+	err := p.get(ctx, p.endpoints.JWKSURI, &set)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get signing keys: %w", err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if publicKey, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = publicKey
+		}
+	}
+
+	p.mutex.Lock()
+	p.keys = keys
+	p.mutex.Unlock()
+
+	key, ok = keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidIDToken, keyID)
+	}
+	return key, nil
+}
+
+// publicKey returns the RSA or P-256 public key the JSON web key describes
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch {
+	case k.Kty == "RSA":
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("malformed RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case k.Kty == "EC" && k.Crv == "P-256":
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		if errX != nil || errY != nil {
+			return nil, errors.New("malformed EC key")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// decodeSegment decodes a base64url encoded JSON segment of a JSON web token
+func decodeSegment(segment string, out interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,207 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout is the timeout of the HTTP client used when none is configured
+const DefaultTimeout = 30 * time.Second
+
+// DefaultScopes are the scopes asked for when none are configured, enough for the user's email and name
+var DefaultScopes = []string{"openid", "email", "profile"}
+
+// ErrCodeRejected is returned when the identity provider won't exchange an authorization code for tokens
+var ErrCodeRejected = errors.New("identity provider rejected the authorization code")
+
+// now returns the current time, it is a variable so tests can fix the date
+var now = time.Now
+
+// Config configures a Provider.
+// IssuerURL is the identity provider's issuer, which its discovery document is found under.
+// ClientID and ClientSecret are the credentials the application is registered with,
+// and RedirectURL is the application's callback the provider sends users back to.
+// Scopes are asked for when signing in, and HTTPClient is used to make the requests.
+// Zero values are replaced by DefaultScopes and a client with DefaultTimeout.
+type Config struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	HTTPClient   *http.Client
+}
+
+// discovery is the part of an identity provider's discovery document the sign in flow uses
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// tokenResponse is the identity provider's response to exchanging an authorization code
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Provider signs users in with an OpenID Connect identity provider,
+// using the authorization code flow with PKCE
+type Provider struct {
+	config       Config
+	endpoints    discovery
+	mutex        sync.Mutex
+	keys         map[string]crypto.PublicKey
+	lastKeyFetch time.Time
+}
+
+// NewProvider returns a Provider for the identity provider described by the discovery document under the config's issuer.
+// The document must be for the same issuer.
+func NewProvider(ctx context.Context, config Config) (*Provider, error) {
+	if config.Scopes == nil {
+		config.Scopes = DefaultScopes
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: DefaultTimeout}
+	}
+	p := &Provider{config: config, keys: map[string]crypto.PublicKey{}}
+
+	issuer := strings.TrimSuffix(config.IssuerURL, "/")
+	err := p.get(ctx, issuer+"/.well-known/openid-configuration", &p.endpoints)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get discovery document: %w", err)
+	}
+	if p.endpoints.Issuer != issuer {
+		return nil, fmt.Errorf("discovery document is for issuer %q not %q", p.endpoints.Issuer, issuer)
+	}
+	if p.endpoints.AuthorizationEndpoint == "" || p.endpoints.TokenEndpoint == "" || p.endpoints.JWKSURI == "" {
+		return nil, errors.New("discovery document is missing an endpoint")
+	}
+	return p, nil
+}
+
+// Issuer returns the issuer identifying the identity provider, which users' subjects are unique within
+func (p *Provider) Issuer() string {
+	return p.endpoints.Issuer
+}
+
+// AuthRequest is what a sign in is started with and has to be finished with.
+// State ties the identity provider's response to the browser that started the sign in,
+// Nonce ties the ID token to it, and Verifier is the PKCE code verifier that proves the code was asked for by us.
+type AuthRequest struct {
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+// NewAuthRequest returns an AuthRequest with new random values
+func NewAuthRequest() (AuthRequest, error) {
+	var values [3]string
+	for index := range values {
+		random := make([]byte, 32)
+		_, err := rand.Read(random)
+		if err != nil {
+			return AuthRequest{}, fmt.Errorf("unable to start sign in: %w", err)
+		}
+		values[index] = base64.RawURLEncoding.EncodeToString(random)
+	}
+	return AuthRequest{State: values[0], Nonce: values[1], Verifier: values[2]}, nil
+}
+
+// CodeChallenge returns the S256 PKCE code challenge of a code verifier
+func CodeChallenge(verifier string) string {
+	hash := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// AuthCodeURL returns the address of the identity provider's sign in page for the request
+func (p *Provider) AuthCodeURL(request AuthRequest) string {
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {request.State},
+		"nonce":                 {request.Nonce},
+		"code_challenge":        {CodeChallenge(request.Verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(p.endpoints.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.endpoints.AuthorizationEndpoint + separator + query.Encode()
+}
+
+// Authenticate exchanges the authorization code the identity provider sent back for the request
+// and returns the identity of the user from the verified ID token.
+// It returns ErrCodeRejected if the provider won't exchange the code and ErrInvalidIDToken if the ID token can't be verified.
+func (p *Provider) Authenticate(ctx context.Context, code string, request AuthRequest) (*Identity, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {request.Verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoints.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+
+	resp, err := p.config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to exchange authorization code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var tokens tokenResponse
+	err = json.NewDecoder(resp.Body).Decode(&tokens)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || tokens.Error != "" {
+		return nil, fmt.Errorf("%w: %s %s", ErrCodeRejected, tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("%w: no ID token in the token response", ErrInvalidIDToken)
+	}
+
+	return p.VerifyIDToken(ctx, tokens.IDToken, request.Nonce)
+}
+
+// get fetches the JSON document at the address into out
+func (p *Provider) get(ctx context.Context, address string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.config.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s responded with %d: %s", address, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
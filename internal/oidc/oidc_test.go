@@ -0,0 +1,356 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuer   = "https://idp.example.com"
+	testClientID = "subscrypt"
+	testSecret   = "client-secret"
+	testRedirect = "https://subscrypt.example.com/api/sso/callback"
+)
+
+// fakeIdP is an identity provider that issues the ID token it is given for any code, and counts key set requests
+type fakeIdP struct {
+	issuer      string
+	rsaKeys     map[string]*rsa.PrivateKey
+	ecKeys      map[string]*ecdsa.PrivateKey
+	idToken     string
+	tokenForm   url.Values
+	keyRequests int
+}
+
+func (f *fakeIdP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		_ = json.NewEncoder(w).Encode(discovery{
+			Issuer:                f.issuer,
+			AuthorizationEndpoint: testIssuer + "/authorize",
+			TokenEndpoint:         testIssuer + "/token",
+			JWKSURI:               testIssuer + "/jwks",
+		})
+	case "/jwks":
+		f.keyRequests++
+		var set keySet
+		for kid, key := range f.rsaKeys {
+			set.Keys = append(set.Keys, jsonWebKey{
+				Kty: "RSA", Kid: kid, Use: "sig",
+				N: base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		for kid, key := range f.ecKeys {
+			set.Keys = append(set.Keys, jsonWebKey{
+				Kty: "EC", Kid: kid, Crv: "P-256",
+				X: base64.RawURLEncoding.EncodeToString(key.X.Bytes()),
+				Y: base64.RawURLEncoding.EncodeToString(key.Y.Bytes()),
+			})
+		}
+		_ = json.NewEncoder(w).Encode(set)
+	case "/token":
+		clientID, secret, _ := r.BasicAuth()
+		_ = r.ParseForm()
+		f.tokenForm = r.PostForm
+		if clientID != testClientID || secret != testSecret || r.PostForm.Get("code") != "good-code" {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(tokenResponse{Error: "invalid_grant"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(tokenResponse{IDToken: f.idToken})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t handlerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	recorder := httptest.NewRecorder()
+	t.handler.ServeHTTP(recorder, r)
+	return recorder.Result(), nil
+}
+
+func newTestProvider(t *testing.T, idp *fakeIdP) *Provider {
+	t.Helper()
+	provider, err := NewProvider(context.Background(), Config{
+		IssuerURL:    testIssuer,
+		ClientID:     testClientID,
+		ClientSecret: testSecret,
+		RedirectURL:  testRedirect,
+		HTTPClient:   &http.Client{Transport: handlerTransport{idp}},
+	})
+	if err != nil {
+		t.Fatalf("unable to create provider: %v", err)
+	}
+	return provider
+}
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	return key
+}
+
+// validClaims returns the claims of an ID token the provider accepts for the nonce
+func validClaims(nonce string) map[string]interface{} {
+	return map[string]interface{}{
+		"iss":            testIssuer,
+		"sub":            "user-1",
+		"aud":            testClientID,
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          nonce,
+		"email":          "gary@gopher.com",
+		"email_verified": true,
+		"name":           "Gary Gopher",
+	}
+}
+
+// signToken returns a JSON web token of the claims signed with the key using the algorithm
+func signToken(t *testing.T, alg string, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatalf("unable to sign token: %v", err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatalf("unable to sign token: %v", err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestNewProvider(t *testing.T) {
+	t.Run("rejects a discovery document for another issuer", func(t *testing.T) {
+		idp := &fakeIdP{issuer: "https://evil.example.com"}
+		_, err := NewProvider(context.Background(), Config{IssuerURL: testIssuer, HTTPClient: &http.Client{Transport: handlerTransport{idp}}})
+		if err == nil {
+			t.Errorf("expected an error for a discovery document of another issuer")
+		}
+	})
+
+	t.Run("asks for the default scopes with a PKCE challenge", func(t *testing.T) {
+		provider := newTestProvider(t, &fakeIdP{issuer: testIssuer})
+		request := AuthRequest{State: "the-state", Nonce: "the-nonce", Verifier: "the-verifier"}
+
+		address, err := url.Parse(provider.AuthCodeURL(request))
+		if err != nil {
+			t.Fatalf("unable to parse auth code URL: %v", err)
+		}
+		query := address.Query()
+
+		want := map[string]string{
+			"response_type":         "code",
+			"client_id":             testClientID,
+			"redirect_uri":          testRedirect,
+			"scope":                 "openid email profile",
+			"state":                 "the-state",
+			"nonce":                 "the-nonce",
+			"code_challenge":        CodeChallenge("the-verifier"),
+			"code_challenge_method": "S256",
+		}
+		for name, value := range want {
+			if query.Get(name) != value {
+				t.Errorf("got %s %q want %q", name, query.Get(name), value)
+			}
+		}
+		if address.Host != "idp.example.com" || address.Path != "/authorize" {
+			t.Errorf("got sign in page %v", address)
+		}
+	})
+}
+
+func TestCodeChallenge(t *testing.T) {
+	// The example from RFC 7636 appendix B
+	got := CodeChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	want := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	if got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestNewAuthRequest(t *testing.T) {
+	first, err := NewAuthRequest()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := NewAuthRequest()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if first.State == "" || first.State == first.Nonce || first.Nonce == first.Verifier || first == second {
+		t.Errorf("got requests %+v and %+v want different random values", first, second)
+	}
+	if len(first.Verifier) < 43 {
+		t.Errorf("got verifier %q shorter than the 43 characters PKCE needs", first.Verifier)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	key := newRSAKey(t)
+	request := AuthRequest{State: "the-state", Nonce: "the-nonce", Verifier: "the-verifier"}
+
+	t.Run("exchanges the code with the verifier and returns the identity", func(t *testing.T) {
+		idp := &fakeIdP{issuer: testIssuer, rsaKeys: map[string]*rsa.PrivateKey{"key-1": key}}
+		idp.idToken = signToken(t, "RS256", "key-1", key, validClaims("the-nonce"))
+		provider := newTestProvider(t, idp)
+
+		identity, err := provider.Authenticate(context.Background(), "good-code", request)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		want := Identity{Issuer: testIssuer, Subject: "user-1", Email: "gary@gopher.com", EmailVerified: true, Name: "Gary Gopher"}
+		if *identity != want {
+			t.Errorf("got identity %+v want %+v", *identity, want)
+		}
+		if idp.tokenForm.Get("code_verifier") != "the-verifier" || idp.tokenForm.Get("redirect_uri") != testRedirect || idp.tokenForm.Get("grant_type") != "authorization_code" {
+			t.Errorf("got token request %v", idp.tokenForm)
+		}
+	})
+
+	t.Run("returns ErrCodeRejected when the code can't be exchanged", func(t *testing.T) {
+		provider := newTestProvider(t, &fakeIdP{issuer: testIssuer})
+
+		_, err := provider.Authenticate(context.Background(), "bad-code", request)
+		if !errors.Is(err, ErrCodeRejected) {
+			t.Errorf("got %v want %v", err, ErrCodeRejected)
+		}
+	})
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	key := newRSAKey(t)
+	otherKey := newRSAKey(t)
+
+	idp := &fakeIdP{issuer: testIssuer, rsaKeys: map[string]*rsa.PrivateKey{"key-1": key}}
+	provider := newTestProvider(t, idp)
+
+	withClaim := func(name string, value interface{}) map[string]interface{} {
+		claims := validClaims("the-nonce")
+		claims[name] = value
+		return claims
+	}
+
+	t.Run("accepts a token signed by the provider and caches its keys", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			_, err := provider.VerifyIDToken(context.Background(), signToken(t, "RS256", "key-1", key, validClaims("the-nonce")), "the-nonce")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		if idp.keyRequests != 1 {
+			t.Errorf("got %d key set requests want 1", idp.keyRequests)
+		}
+	})
+
+	t.Run("accepts an audience list including the client", func(t *testing.T) {
+		token := signToken(t, "RS256", "key-1", key, withClaim("aud", []string{"another-client", testClientID}))
+		_, err := provider.VerifyIDToken(context.Background(), token, "the-nonce")
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("finds keys the provider rotates in", func(t *testing.T) {
+		later := time.Now().Add(keyFetchInterval)
+		now = func() time.Time { return later }
+		t.Cleanup(func() { now = time.Now })
+
+		ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("unable to generate key: %v", err)
+		}
+		idp.ecKeys = map[string]*ecdsa.PrivateKey{"key-2": ecKey}
+
+		_, err = provider.VerifyIDToken(context.Background(), signToken(t, "ES256", "key-2", ecKey, validClaims("the-nonce")), "the-nonce")
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("fetches the key set for unknown keys at most once every interval", func(t *testing.T) {
+		idp := &fakeIdP{issuer: testIssuer, rsaKeys: map[string]*rsa.PrivateKey{"key-1": key}}
+		provider := newTestProvider(t, idp)
+		fixed := time.Now()
+		now = func() time.Time { return fixed }
+		t.Cleanup(func() { now = time.Now })
+
+		for _, keyID := range []string{"key-8", "key-9"} {
+			_, err := provider.VerifyIDToken(context.Background(), signToken(t, "RS256", keyID, otherKey, validClaims("the-nonce")), "the-nonce")
+			if !errors.Is(err, ErrInvalidIDToken) {
+				t.Errorf("got %v want %v", err, ErrInvalidIDToken)
+			}
+		}
+		if idp.keyRequests != 1 {
+			t.Errorf("got %d key set requests want 1", idp.keyRequests)
+		}
+
+		fixed = fixed.Add(keyFetchInterval)
+		_, err := provider.VerifyIDToken(context.Background(), signToken(t, "RS256", "key-7", otherKey, validClaims("the-nonce")), "the-nonce")
+		if !errors.Is(err, ErrInvalidIDToken) {
+			t.Errorf("got %v want %v", err, ErrInvalidIDToken)
+		}
+		if idp.keyRequests != 2 {
+			t.Errorf("got %d key set requests want 2 once the interval has passed", idp.keyRequests)
+		}
+	})
+
+	cases := map[string]string{
+		"signed by another key":    signToken(t, "RS256", "key-1", otherKey, validClaims("the-nonce")),
+		"signed with unknown key":  signToken(t, "RS256", "key-9", otherKey, validClaims("the-nonce")),
+		"for another nonce":        signToken(t, "RS256", "key-1", key, validClaims("another-nonce")),
+		"from another issuer":      signToken(t, "RS256", "key-1", key, withClaim("iss", "https://evil.example.com")),
+		"for another client":       signToken(t, "RS256", "key-1", key, withClaim("aud", "another-client")),
+		"authorized for another":   signToken(t, "RS256", "key-1", key, withClaim("azp", "another-client")),
+		"that has expired":         signToken(t, "RS256", "key-1", key, withClaim("exp", time.Now().Add(-2*time.Minute).Unix())),
+		"without a subject":        signToken(t, "RS256", "key-1", key, withClaim("sub", "")),
+		"with the wrong algorithm": signToken(t, "ES256", "key-1", key, validClaims("the-nonce")),
+		"that is unsigned":         base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + base64.RawURLEncoding.EncodeToString([]byte(`{}`)) + ".",
+		"that is malformed":        "not-a-token",
+	}
+	for name, token := range cases {
+		t.Run("rejects a token "+name, func(t *testing.T) {
+			_, err := provider.VerifyIDToken(context.Background(), token, "the-nonce")
+			if !errors.Is(err, ErrInvalidIDToken) {
+				t.Errorf("got %v want %v", err, ErrInvalidIDToken)
+			}
+		})
+	}
+}
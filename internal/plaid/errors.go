@@ -0,0 +1,73 @@
+package plaid
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// The kinds of failure Plaid reports that callers handle differently.
+// An *Error returned by the client matches one of these with errors.Is.
+var (
+	ErrAuth              = errors.New("plaid rejected the client credentials")
+	ErrRateLimit         = errors.New("plaid rate limit exceeded")
+	ErrInstitutionDown   = errors.New("bank is not available")
+	ErrItemLoginRequired = errors.New("bank login has expired")
+	ErrProductNotReady   = errors.New("transactions are not ready yet")
+)
+
+// authCodes are the error codes Plaid returns when the client id, secret or access token are not accepted
+var authCodes = map[string]bool{
+	"INVALID_API_KEYS":         true,
+	"UNAUTHORIZED_ENVIRONMENT": true,
+	"INVALID_ACCESS_TOKEN":     true,
+	"INVALID_PUBLIC_TOKEN":     true,
+	"MISSING_CLIENT_ID":        true,
+	"MISSING_SECRET":           true,
+}
+
+// Error is an error response from the Plaid API
+type Error struct {
+	StatusCode     int    `json:"-"`
+	Type           string `json:"error_type"`
+	Code           string `json:"error_code"`
+	Message        string `json:"error_message"`
+	DisplayMessage string `json:"display_message"`
+	RequestID      string `json:"request_id"`
+}
+
+// Error returns the Plaid error type, code and message
+func (e *Error) Error() string {
+	return fmt.Sprintf("plaid error %s %s (status %d): %s", e.Type, e.Code, e.StatusCode, e.Message)
+}
+
+// Is reports whether the error is one of the kinds of failure callers handle
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrAuth:
+		return authCodes[e.Code] || e.StatusCode == http.StatusUnauthorized
+	case ErrRateLimit:
+		return e.Type == "RATE_LIMIT_EXCEEDED" || e.StatusCode == http.StatusTooManyRequests
+	case ErrInstitutionDown:
+		return e.Type == "INSTITUTION_ERROR"
+	case ErrItemLoginRequired:
+		return e.Code == "ITEM_LOGIN_REQUIRED"
+	case ErrProductNotReady:
+		return e.Code == "PRODUCT_NOT_READY"
+	default:
+		return false
+	}
+}
+
+// parseError reads the Plaid error from the body of a response with an error status
+func parseError(statusCode int, body []byte) error {
+	plaidError := &Error{StatusCode: statusCode}
+	err := json.Unmarshal(body, plaidError)
+	if err != nil || plaidError.Code == "" {
+		plaidError.Type = "API_ERROR"
+		plaidError.Code = "UNEXPECTED_RESPONSE"
+		plaidError.Message = http.StatusText(statusCode)
+	}
+	return plaidError
+}
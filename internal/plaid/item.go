@@ -0,0 +1,239 @@
+package plaid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Catzkorn/subscrypt/internal/account"
+)
+
+// ErrItemNotFound is returned when unlinking an item that isn't linked
+var ErrItemNotFound = errors.New("linked bank not found")
+
+// ErrLinkRequired is returned when the user has no linked item outside the sandbox,
+// where banks can't be linked without the user signing in to them through Plaid Link
+var ErrLinkRequired = errors.New("no bank is linked, banks can only be linked automatically in the plaid sandbox")
+
+// ErrNoUser is returned when linked items are read or stored without a user logged in to the context
+var ErrNoUser = errors.New("no user is logged in to link banks for")
+
+// Item is a bank linked through Plaid by the user with UserID.
+// Source is the name of the transaction source that linked it, which is the only one that reads it.
+// ItemID is Plaid's identifier for the link and AccessToken is the token used to read it,
+// which is encrypted whenever the item is stored and never sent to the browser.
+// Cursor marks how far the item's transactions have been synced, it is empty before the first sync.
+// Status is the error code Plaid last reported for the item, such as ITEM_LOGIN_REQUIRED, or empty while it is working.
+type Item struct {
+	ID            int       `json:"id"`
+	UserID        int       `json:"-"`
+	Source        string    `json:"source"`
+	ItemID        string    `json:"itemId"`
+	InstitutionID string    `json:"institutionId"`
+	AccessToken   string    `json:"-"`
+	Cursor        string    `json:"-"`
+	Status        string    `json:"status"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// ItemStore stores the linked items, with their access tokens already encrypted.
+// GetPlaidItem finds an item by Plaid's item ID whichever user linked it, returning a nil pointer if it isn't stored.
+type ItemStore interface {
+	GetPlaidItems(ctx context.Context, userID int) ([]Item, error)
+	GetPlaidItem(ctx context.Context, itemID string) (*Item, error)
+	RecordPlaidItem(ctx context.Context, item Item) (*Item, error)
+	DeletePlaidItem(ctx context.Context, userID int, ID int) error
+	UpdatePlaidItemCursor(ctx context.Context, userID int, ID int, cursor string) error
+	UpdatePlaidItemStatus(ctx context.Context, userID int, ID int, status string) error
+}
+
+type RemoveItem struct {
+	ClientId    string `json:"client_id"`
+	Secret      string `json:"secret"`
+	AccessToken string `json:"access_token"`
+}
+
+// Items returns the items linked by the user logged in to the context, without their access tokens
+func (p *PlaidAPI) Items(ctx context.Context) ([]Item, error) {
+	items, err := p.storedItems(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	listed := []Item{}
+	for _, item := range items {
+		item.AccessToken = ""
+		item.Cursor = ""
+		listed = append(listed, item)
+	}
+	return listed, nil
+}
+
+// Unlink removes the item with the given ID from Plaid and forgets its access token.
+// It returns ErrItemNotFound if the user logged in to the context has no linked item with the ID.
+func (p *PlaidAPI) Unlink(ctx context.Context, ID int) error {
+	items, err := p.linkedItems(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if item.ID != ID {
+			continue
+		}
+
+		r := RemoveItem{ClientId: p.config.ClientID, Secret: p.config.Secret, AccessToken: item.AccessToken}
+		var response struct{}
+		err = p.post(ctx, "/item/remove", r, &response)
+		if err != nil && !errors.Is(err, ErrAuth) {
+			return fmt.Errorf("unable to remove linked bank: %w", err)
+		}
+
+		err = p.config.Items.DeletePlaidItem(ctx, item.UserID, ID)
+		if err != nil {
+			return fmt.Errorf("unable to delete linked bank: %w", err)
+		}
+		return nil
+	}
+	return ErrItemNotFound
+}
+
+// SetItemStatus records the error code Plaid reported for the item with the given Plaid item ID,
+// or clears it if the code is empty. It returns ErrItemNotFound if the item isn't linked.
+func (p *PlaidAPI) SetItemStatus(ctx context.Context, itemID string, status string) error {
+	item, err := p.sourceItem(ctx, itemID)
+	if err != nil {
+		return err
+	}
+
+	err = p.config.Items.UpdatePlaidItemStatus(ctx, item.UserID, item.ID, status)
+	if err != nil {
+		return fmt.Errorf("unable to update linked bank: %w", err)
+	}
+	return nil
+}
+
+// LinkedItem returns the item with the given Plaid item ID, with the user who linked it and the source that reads it,
+// without its access token. It returns ErrItemNotFound if the item isn't linked by the API's source.
+func (p *PlaidAPI) LinkedItem(ctx context.Context, itemID string) (*Item, error) {
+	item, err := p.sourceItem(ctx, itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	item.AccessToken = ""
+	item.Cursor = ""
+	return item, nil
+}
+
+// sourceItem returns the stored item with the given Plaid item ID if it was linked by the API's source
+func (p *PlaidAPI) sourceItem(ctx context.Context, itemID string) (*Item, error) {
+	if p.config.Items == nil {
+		return nil, ErrItemNotFound
+	}
+
+	item, err := p.config.Items.GetPlaidItem(ctx, itemID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get linked bank: %w", err)
+	}
+	if item == nil || item.Source != p.config.Source {
+		return nil, ErrItemNotFound
+	}
+	return item, nil
+}
+
+// storedItems returns the stored items linked by the API's source for the user logged in to the context,
+// with their access tokens encrypted. It returns ErrNoUser if no user is logged in.
+func (p *PlaidAPI) storedItems(ctx context.Context) ([]Item, error) {
+	if p.config.Items == nil {
+		return nil, nil
+	}
+
+	userID, ok := account.UserID(ctx)
+	if !ok {
+		return nil, ErrNoUser
+	}
+	items, err := p.config.Items.GetPlaidItems(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get linked banks: %w", err)
+	}
+
+	var linked []Item
+	for _, item := range items {
+		if item.Source == p.config.Source {
+			linked = append(linked, item)
+		}
+	}
+	return linked, nil
+}
+
+// linkedItems returns the stored items linked by the API's source for the user logged in to the context,
+// with their access tokens decrypted
+func (p *PlaidAPI) linkedItems(ctx context.Context) ([]Item, error) {
+	items, err := p.storedItems(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return p.decryptTokens(items)
+}
+
+// decryptTokens returns the stored items with their access tokens decrypted
+func (p *PlaidAPI) decryptTokens(items []Item) ([]Item, error) {
+	if p.config.Items != nil && p.config.TokenCipher == nil {
+		return nil, errors.New("linked banks can't be stored without a token encryption key")
+	}
+
+	var err error
+	for i := range items {
+		items[i].AccessToken, err = p.config.TokenCipher.Decrypt(items[i].AccessToken)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read access token of linked bank %d: %w", items[i].ID, err)
+		}
+	}
+	return items, nil
+}
+
+// link links a new sandbox item for the user logged in to the context and stores it, if there is an item store,
+// returning ErrNoUser if there is a store but no user.
+// Against the development and production environments it returns ErrLinkRequired instead.
+func (p *PlaidAPI) link(ctx context.Context) (Item, error) {
+	if p.config.BaseURL == DevelopmentURL || p.config.BaseURL == ProductionURL {
+		return Item{}, ErrLinkRequired
+	}
+
+	userID, ok := account.UserID(ctx)
+	if !ok && p.config.Items != nil {
+		return Item{}, ErrNoUser
+	}
+
+	publicToken, err := p.getPublicToken(ctx)
+	if err != nil {
+		return Item{}, err
+	}
+
+	access, err := p.getAccessToken(ctx, publicToken)
+	if err != nil {
+		return Item{}, err
+	}
+
+	item := Item{UserID: userID, Source: p.config.Source, ItemID: access.ItemID, InstitutionID: p.config.InstitutionID, AccessToken: access.Token, CreatedAt: time.Now()}
+	if p.config.Items == nil {
+		return item, nil
+	}
+
+	encrypted, err := p.config.TokenCipher.Encrypt(access.Token)
+	if err != nil {
+		return Item{}, err
+	}
+
+	stored := item
+	stored.AccessToken = encrypted
+	recorded, err := p.config.Items.RecordPlaidItem(ctx, stored)
+	if err != nil {
+		return Item{}, fmt.Errorf("unable to store linked bank: %w", err)
+	}
+
+	item.ID = recorded.ID
+	return item, nil
+}
@@ -0,0 +1,244 @@
+package plaid
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Catzkorn/subscrypt/internal/account"
+	"github.com/Catzkorn/subscrypt/internal/secret"
+)
+
+// testContext is the context of the user the tests link banks for
+var testContext = account.WithUser(context.Background(), 1)
+
+type stubItemStore struct {
+	items []Item
+}
+
+func (s *stubItemStore) GetPlaidItems(ctx context.Context, userID int) ([]Item, error) {
+	items := []Item{}
+	for _, item := range s.items {
+		if item.UserID == userID {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (s *stubItemStore) GetPlaidItem(ctx context.Context, itemID string) (*Item, error) {
+	for _, item := range s.items {
+		if item.ItemID == itemID {
+			return &item, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *stubItemStore) RecordPlaidItem(ctx context.Context, item Item) (*Item, error) {
+	item.ID = len(s.items) + 1
+	s.items = append(s.items, item)
+	return &item, nil
+}
+
+func (s *stubItemStore) DeletePlaidItem(ctx context.Context, userID int, ID int) error {
+	for index, item := range s.items {
+		if item.ID == ID && item.UserID == userID {
+			s.items = append(s.items[:index], s.items[index+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("no item with ID %d", ID)
+}
+
+func (s *stubItemStore) UpdatePlaidItemCursor(ctx context.Context, userID int, ID int, cursor string) error {
+	for index, item := range s.items {
+		if item.ID == ID && item.UserID == userID {
+			s.items[index].Cursor = cursor
+			return nil
+		}
+	}
+	return fmt.Errorf("no item with ID %d", ID)
+}
+
+func (s *stubItemStore) UpdatePlaidItemStatus(ctx context.Context, userID int, ID int, status string) error {
+	for index, item := range s.items {
+		if item.ID == ID && item.UserID == userID {
+			s.items[index].Status = status
+			return nil
+		}
+	}
+	return fmt.Errorf("no item with ID %d", ID)
+}
+
+func newTestCipher(t *testing.T) *secret.Cipher {
+	t.Helper()
+	tokenCipher, err := secret.NewCipher(bytes.Repeat([]byte{7}, secret.KeySize))
+	if err != nil {
+		t.Fatalf("unexpected error creating cipher: %v", err)
+	}
+	return tokenCipher
+}
+
+func TestLinkedItems(t *testing.T) {
+	t.Run("fails without a logged in user", func(t *testing.T) {
+		fake := &fakePlaid{}
+		store := &stubItemStore{}
+		api := newTestAPI(t, fake, Config{Items: store, TokenCipher: newTestCipher(t)})
+
+		_, err := api.GetTransactions(context.Background())
+		if !errors.Is(err, ErrNoUser) {
+			t.Errorf("got error %v want %v", err, ErrNoUser)
+		}
+		_, err = api.link(context.Background())
+		if !errors.Is(err, ErrNoUser) {
+			t.Errorf("got error %v linking want %v", err, ErrNoUser)
+		}
+		if len(fake.requests) != 0 || len(store.items) != 0 {
+			t.Errorf("got requests %v and stored items %v want none", fake.requests, store.items)
+		}
+	})
+
+	t.Run("links an item once and reuses it", func(t *testing.T) {
+		fake := &fakePlaid{}
+		store := &stubItemStore{}
+		api := newTestAPI(t, fake, Config{Items: store, TokenCipher: newTestCipher(t)})
+
+		_, err := api.GetTransactions(testContext)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_, err = api.GetTransactions(testContext)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		want := []string{"/sandbox/public_token/create", "/item/public_token/exchange", "/transactions/get", "/transactions/get"}
+		if fmt.Sprint(fake.requests) != fmt.Sprint(want) {
+			t.Errorf("got requests %v want %v", fake.requests, want)
+		}
+		if len(store.items) != 1 || store.items[0].ItemID != "item-sandbox" {
+			t.Fatalf("got stored items %v want item-sandbox", store.items)
+		}
+		if fake.fetched.AccessToken != "access-sandbox-token" {
+			t.Errorf("got access token %q want %q", fake.fetched.AccessToken, "access-sandbox-token")
+		}
+	})
+
+	t.Run("stores the access token encrypted", func(t *testing.T) {
+		store := &stubItemStore{}
+		api := newTestAPI(t, &fakePlaid{}, Config{Items: store, TokenCipher: newTestCipher(t)})
+
+		_, err := api.GetTransactions(testContext)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if store.items[0].AccessToken == "" || store.items[0].AccessToken == "access-sandbox-token" {
+			t.Errorf("got stored access token %q want it encrypted", store.items[0].AccessToken)
+		}
+	})
+
+	t.Run("does not store items without a cipher", func(t *testing.T) {
+		api := newTestAPI(t, &fakePlaid{}, Config{Items: &stubItemStore{}})
+
+		_, err := api.GetTransactions(testContext)
+		if err == nil {
+			t.Errorf("expected an error storing an item without a cipher")
+		}
+	})
+
+	t.Run("keeps the items of each source separate", func(t *testing.T) {
+		store := &stubItemStore{}
+		sandbox := newTestAPI(t, &fakePlaid{}, Config{Items: store, TokenCipher: newTestCipher(t)})
+		monzo := newTestAPI(t, &fakePlaid{}, Config{Items: store, TokenCipher: newTestCipher(t), Source: "monzo"})
+
+		_, err := sandbox.GetTransactions(testContext)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		items, err := monzo.Items(testContext)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(items) != 0 {
+			t.Errorf("got items %v want none linked by monzo", items)
+		}
+		if store.items[0].Source != DefaultSource {
+			t.Errorf("got item linked by %q want %q", store.items[0].Source, DefaultSource)
+		}
+	})
+
+	t.Run("keeps the items of each user separate", func(t *testing.T) {
+		store := &stubItemStore{}
+		api := newTestAPI(t, &fakePlaid{}, Config{Items: store, TokenCipher: newTestCipher(t)})
+		alice := account.WithUser(context.Background(), 1)
+		bob := account.WithUser(context.Background(), 2)
+
+		_, err := api.GetTransactions(alice)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		items, err := api.Items(bob)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(items) != 0 {
+			t.Errorf("got items %v want none linked by the other user", items)
+		}
+		if store.items[0].UserID != 1 {
+			t.Errorf("got item linked by user %d want 1", store.items[0].UserID)
+		}
+
+		err = api.Unlink(bob, store.items[0].ID)
+		if !errors.Is(err, ErrItemNotFound) {
+			t.Errorf("got error %v want %v unlinking another user's item", err, ErrItemNotFound)
+		}
+	})
+
+	t.Run("lists linked items without their access tokens", func(t *testing.T) {
+		store := &stubItemStore{}
+		api := newTestAPI(t, &fakePlaid{}, Config{Items: store, TokenCipher: newTestCipher(t)})
+		_, _ = api.GetTransactions(testContext)
+
+		items, err := api.Items(testContext)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(items) != 1 || items[0].AccessToken != "" || items[0].ItemID != "item-sandbox" {
+			t.Errorf("got items %v want item-sandbox without its token", items)
+		}
+	})
+}
+
+func TestUnlink(t *testing.T) {
+	t.Run("removes the item from plaid and the store", func(t *testing.T) {
+		fake := &fakePlaid{}
+		store := &stubItemStore{}
+		api := newTestAPI(t, fake, Config{Items: store, TokenCipher: newTestCipher(t)})
+		_, _ = api.GetTransactions(testContext)
+
+		err := api.Unlink(testContext, store.items[0].ID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(fake.removed) != 1 || fake.removed[0] != "access-sandbox-token" {
+			t.Errorf("got removed access tokens %v want %v", fake.removed, []string{"access-sandbox-token"})
+		}
+		if len(store.items) != 0 {
+			t.Errorf("got stored items %v want none", store.items)
+		}
+	})
+
+	t.Run("returns ErrItemNotFound for an item that isn't linked", func(t *testing.T) {
+		api := newTestAPI(t, &fakePlaid{}, Config{Items: &stubItemStore{}, TokenCipher: newTestCipher(t)})
+
+		err := api.Unlink(testContext, 3)
+		if !errors.Is(err, ErrItemNotFound) {
+			t.Errorf("got error %v want %v", err, ErrItemNotFound)
+		}
+	})
+}
@@ -2,15 +2,127 @@ package plaid
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"os"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/Catzkorn/subscrypt/internal/secret"
+)
+
+// The base URLs of the Plaid environments
+const (
+	SandboxURL     = "https://sandbox.plaid.com"
+	DevelopmentURL = "https://development.plaid.com"
+	ProductionURL  = "https://production.plaid.com"
+)
+
+// DefaultInstitutionID is the sandbox bank linked when no institution is configured
+const DefaultInstitutionID = "ins_3"
+
+// DefaultSource is the name of the transaction source items are linked by when no source is configured
+const DefaultSource = "plaid"
+
+// DefaultLookbackDays is how many days of transactions are imported when no lookback is configured
+const DefaultLookbackDays = 730
+
+// DefaultTimeout is the timeout of the HTTP client used when none is configured
+const DefaultTimeout = 30 * time.Second
+
+// transactionsPageSize is the number of transactions requested in each page of a get, the most Plaid returns at once
+const transactionsPageSize = 500
+
+// dateLayout is the format of dates sent to Plaid
+const dateLayout = "2006-01-02"
+
+// now returns the current time, it is a variable so tests can fix the date
+var now = time.Now
+
+// DefaultReadyTimeout is how long to wait for a new item's transactions to be ready when no timeout is configured
+const DefaultReadyTimeout = 30 * time.Second
+
+// initialBackoff and maxBackoff bound the wait between requests for transactions that are not ready yet.
+// The wait doubles after every attempt.
+var (
+	initialBackoff = 250 * time.Millisecond
+	maxBackoff     = 4 * time.Second
 )
 
+// Config configures a PlaidAPI.
+// BaseURL is the Plaid environment to use, such as SandboxURL, or the address of a local stand-in.
+// ClientID and Secret are the API credentials, InstitutionID is the bank to link,
+// and LookbackDays is how many days of transactions before today to import.
+// HTTPClient is used to make the requests.
+// ReadyTimeout is how long to keep asking for transactions while Plaid is still preparing them.
+// Items, if set, stores the linked items so they are reused, with their access tokens encrypted by TokenCipher.
+// Without it a new sandbox item is linked for every request.
+// Webhook, if set, is the address Plaid notifies about changes to the linked item.
+// Source is the name of the transaction source the API is registered as. Stored items are kept separate for each source.
+// Zero values are replaced by SandboxURL, DefaultInstitutionID, DefaultLookbackDays,
+// a client with DefaultTimeout, DefaultReadyTimeout and DefaultSource.
+type Config struct {
+	BaseURL       string
+	ClientID      string
+	Secret        string
+	InstitutionID string
+	LookbackDays  int
+	HTTPClient    *http.Client
+	ReadyTimeout  time.Duration
+	Items         ItemStore
+	TokenCipher   *secret.Cipher
+	Webhook       string
+	Source        string
+}
+
+// EnvironmentURL returns the base URL of the named Plaid environment: sandbox, development or production
+func EnvironmentURL(environment string) (string, error) {
+	switch strings.ToLower(environment) {
+	case "", "sandbox":
+		return SandboxURL, nil
+	case "development":
+		return DevelopmentURL, nil
+	case "production":
+		return ProductionURL, nil
+	default:
+		return "", fmt.Errorf("unknown plaid environment %q", environment)
+	}
+}
+
+// PlaidAPI gets transactions from Plaid
 type PlaidAPI struct {
+	config       Config
+	mutex        sync.Mutex
+	webhookKeys  map[string]webhookKey
+	lastKeyFetch time.Time
+}
+
+// NewPlaidAPI returns a PlaidAPI using the given configuration
+func NewPlaidAPI(config Config) *PlaidAPI {
+	if config.BaseURL == "" {
+		config.BaseURL = SandboxURL
+	}
+	config.BaseURL = strings.TrimSuffix(config.BaseURL, "/")
+	if config.InstitutionID == "" {
+		config.InstitutionID = DefaultInstitutionID
+	}
+	if config.LookbackDays <= 0 {
+		config.LookbackDays = DefaultLookbackDays
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: DefaultTimeout}
+	}
+	if config.ReadyTimeout <= 0 {
+		config.ReadyTimeout = DefaultReadyTimeout
+	}
+	if config.Source == "" {
+		config.Source = DefaultSource
+	}
+	return &PlaidAPI{config: config, webhookKeys: map[string]webhookKey{}}
 }
 
 type GetPublicToken struct {
@@ -18,7 +130,7 @@ type GetPublicToken struct {
 	Secret          string            `json:"secret"`
 	InstitutionId   string            `json:"institution_id"`
 	InitialProducts []string          `json:"initial_products"`
-	Options         map[string]string `json:"options"`
+	Options         map[string]string `json:"options,omitempty"`
 }
 
 type PublicToken struct {
@@ -32,115 +144,206 @@ type GetAccessToken struct {
 }
 
 type AccessToken struct {
-	Token string `json:"access_token"`
+	Token  string `json:"access_token"`
+	ItemID string `json:"item_id"`
 }
 
 type GetTransactions struct {
-	ClientId    string `json:"client_id"`
-	Secret      string `json:"secret"`
-	AccessToken string `json:"access_token"`
-	StartDate   string `json:"start_date"`
-	EndDate     string `json:"end_date"`
+	ClientId    string             `json:"client_id"`
+	Secret      string             `json:"secret"`
+	AccessToken string             `json:"access_token"`
+	StartDate   string             `json:"start_date"`
+	EndDate     string             `json:"end_date"`
+	Options     TransactionOptions `json:"options"`
+}
+
+// TransactionOptions picks the page of transactions to get, starting at Offset
+type TransactionOptions struct {
+	Count  int `json:"count"`
+	Offset int `json:"offset"`
 }
 
 type TransactionList struct {
 	Transactions []Transaction `json:"transactions"`
 }
 
-type Transaction struct {
-	Amount float32 `json:"amount"`
-	Date   string  `json:"date"`
-	Name   string  `json:"name"`
+// TransactionPage is a page of the transactions between the dates of a get, out of TotalTransactions
+type TransactionPage struct {
+	Transactions      []Transaction `json:"transactions"`
+	TotalTransactions int           `json:"total_transactions"`
 }
 
-func (p *PlaidAPI) GetTransactions() (TransactionList, error) {
-	response := getPublicToken()
-	time.Sleep(2 * time.Second)
-	access := getAccessToken(response)
-	time.Sleep(2 * time.Second)
-	TransactionList := getTransactions(access)
-
-	return TransactionList, nil
+type Transaction struct {
+	TransactionID   string  `json:"transaction_id,omitempty"`
+	AccountID       string  `json:"account_id,omitempty"`
+	Amount          float32 `json:"amount"`
+	ISOCurrencyCode string  `json:"iso_currency_code,omitempty"`
+	Date            string  `json:"date"`
+	Name            string  `json:"name"`
+	Pending         bool    `json:"pending,omitempty"`
 }
 
-func getPublicToken() PublicToken {
-	m := GetPublicToken{ClientId: os.Getenv("CLIENT_ID"), Secret: os.Getenv("SECRET"), InstitutionId: "ins_3", InitialProducts: []string{"auth", "transactions"}, Options: map[string]string{"webhook": "https://www.genericwebhookurl.com/webhook"}}
-
-	b, err := json.Marshal(m)
+// GetTransactions returns the transactions of the items linked by the user logged in to the context
+// from the configured lookback window,
+// linking a sandbox item first if none are linked, or returning ErrLinkRequired outside the sandbox.
+// Errors returned by Plaid are returned as an *Error, which can be compared to ErrAuth,
+// ErrRateLimit, ErrInstitutionDown, ErrItemLoginRequired and ErrProductNotReady with errors.Is.
+func (p *PlaidAPI) GetTransactions(ctx context.Context) (TransactionList, error) {
+	items, err := p.linkedItems(ctx)
 	if err != nil {
-		_ = fmt.Errorf("unexpected error: %w", err)
+		return TransactionList{}, err
 	}
 
-	r, err := http.Post("https://sandbox.plaid.com/sandbox/public_token/create", "application/json", bytes.NewBuffer(b))
-	if err != nil {
-		_ = fmt.Errorf("unexpected error: %w", err)
+	if len(items) == 0 {
+		item, err := p.link(ctx)
+		if err != nil {
+			return TransactionList{}, err
+		}
+		items = append(items, item)
 	}
 
-	data, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		_ = fmt.Errorf("unexpected error: %w", err)
+	var all TransactionList
+	for _, item := range items {
+		transactions, err := p.getTransactions(ctx, AccessToken{Token: item.AccessToken, ItemID: item.ItemID})
+		if err != nil {
+			return TransactionList{}, err
+		}
+		all.Transactions = append(all.Transactions, transactions.Transactions...)
+	}
+	return all, nil
+}
+
+func (p *PlaidAPI) getPublicToken(ctx context.Context) (PublicToken, error) {
+	m := GetPublicToken{ClientId: p.config.ClientID, Secret: p.config.Secret, InstitutionId: p.config.InstitutionID, InitialProducts: []string{"auth", "transactions"}}
+	if p.config.Webhook != "" {
+		m.Options = map[string]string{"webhook": p.config.Webhook}
 	}
 
 	var response PublicToken
-	err = json.Unmarshal(data, &response)
+	err := p.post(ctx, "/sandbox/public_token/create", m, &response)
 	if err != nil {
-		_ = fmt.Errorf("unexpected error: %w", err)
+		return PublicToken{}, fmt.Errorf("unable to create public token: %w", err)
 	}
-
-	return response
+	return response, nil
 }
 
-func getAccessToken(response PublicToken) AccessToken {
-	e := GetAccessToken{ClientId: os.Getenv("CLIENT_ID"), Secret: os.Getenv("SECRET"), PublicToken: response.Token}
+func (p *PlaidAPI) getAccessToken(ctx context.Context, response PublicToken) (AccessToken, error) {
+	e := GetAccessToken{ClientId: p.config.ClientID, Secret: p.config.Secret, PublicToken: response.Token}
 
-	b, err := json.Marshal(e)
+	var access AccessToken
+	err := p.post(ctx, "/item/public_token/exchange", e, &access)
 	if err != nil {
-		_ = fmt.Errorf("unexpected error: %w", err)
+		return AccessToken{}, fmt.Errorf("unable to exchange public token: %w", err)
 	}
+	return access, nil
+}
 
-	r, err := http.Post("https://sandbox.plaid.com/item/public_token/exchange", "application/json", bytes.NewBuffer(b))
-	if err != nil {
-		_ = fmt.Errorf("unexpected error: %w", err)
-	}
+// getTransactions requests the item's transactions from the configured lookback window,
+// a page at a time until all of them have been read
+func (p *PlaidAPI) getTransactions(ctx context.Context, access AccessToken) (TransactionList, error) {
+	endDate := now()
+	startDate := endDate.AddDate(0, 0, -p.config.LookbackDays)
+	t := GetTransactions{ClientId: p.config.ClientID, Secret: p.config.Secret, AccessToken: access.Token, StartDate: startDate.Format(dateLayout), EndDate: endDate.Format(dateLayout)}
 
-	data, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		_ = fmt.Errorf("unexpected error: %w", err)
+	var listOfTransactions TransactionList
+	for {
+		t.Options = TransactionOptions{Count: transactionsPageSize, Offset: len(listOfTransactions.Transactions)}
+
+		var page TransactionPage
+		err := p.whenReady(ctx, func() error {
+			page = TransactionPage{}
+			return p.post(ctx, "/transactions/get", t, &page)
+		})
+		if err != nil {
+			return TransactionList{}, err
+		}
+
+		listOfTransactions.Transactions = append(listOfTransactions.Transactions, page.Transactions...)
+		if len(page.Transactions) == 0 || len(listOfTransactions.Transactions) >= page.TotalTransactions {
+			return listOfTransactions, nil
+		}
 	}
+}
 
-	var access AccessToken
+// whenReady makes the request, making it again with an exponential backoff
+// while Plaid reports the transactions are not ready, until the ready timeout passes
+func (p *PlaidAPI) whenReady(ctx context.Context, request func() error) error {
+	deadline := time.Now().Add(p.config.ReadyTimeout)
+	backoff := initialBackoff
+	for {
+		err := request()
+		switch {
+		case err == nil:
+			return nil
+		case !errors.Is(err, ErrProductNotReady):
+			return fmt.Errorf("unable to get transactions: %w", err)
+		case time.Now().Add(backoff).After(deadline):
+			return fmt.Errorf("transactions were not ready after %v: %w", p.config.ReadyTimeout, err)
+		}
 
-	err = json.Unmarshal(data, &access)
-	if err != nil {
-		_ = fmt.Errorf("unexpected error: %w", err)
+		err = wait(ctx, backoff)
+		if err != nil {
+			return err
+		}
+
+		backoff = nextBackoff(backoff)
 	}
+}
 
-	return access
+// nextBackoff returns the wait after the given one, which is twice as long up to maxBackoff
+func nextBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+	return backoff
 }
 
-func getTransactions(access AccessToken) TransactionList {
-	t := GetTransactions{ClientId: os.Getenv("CLIENT_ID"), Secret: os.Getenv("SECRET"), AccessToken: access.Token, StartDate: "2018-11-10", EndDate: "2020-11-10"}
+// post sends the request body as JSON to a Plaid endpoint and decodes the JSON response into out.
+// Responses with an error status are returned as an *Error.
+func (p *PlaidAPI) post(ctx context.Context, path string, body interface{}, out interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("unexpected encoding error: %w", err)
+	}
 
-	b, err := json.Marshal(t)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, p.config.BaseURL+path, bytes.NewBuffer(b))
 	if err != nil {
-		_ = fmt.Errorf("unexpected error: %w", err)
+		return fmt.Errorf("unexpected request error: %w", err)
 	}
+	request.Header.Set("Content-Type", "application/json")
 
-	r, err := http.Post("https://sandbox.plaid.com/transactions/get", "application/json", bytes.NewBuffer(b))
+	r, err := p.config.HTTPClient.Do(request)
 	if err != nil {
-		_ = fmt.Errorf("unexpected error: %w", err)
+		return fmt.Errorf("unexpected request error: %w", err)
 	}
+	defer r.Body.Close()
 
 	data, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		_ = fmt.Errorf("unexpected error: %w", err)
+		return fmt.Errorf("unexpected read error: %w", err)
 	}
 
-	var listOfTransactions TransactionList
+	if r.StatusCode != http.StatusOK {
+		return parseError(r.StatusCode, data)
+	}
 
-	err = json.Unmarshal(data, &listOfTransactions)
+	err = json.Unmarshal(data, out)
 	if err != nil {
-		_ = fmt.Errorf("unexpected error: %w", err)
+		return fmt.Errorf("unexpected decoding error: %w", err)
+	}
+	return nil
+}
+
+// wait pauses for the given duration, returning early with the context's error if it is cancelled
+func wait(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
 	}
-	return listOfTransactions
 }
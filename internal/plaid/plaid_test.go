@@ -0,0 +1,398 @@
+package plaid
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakePlaid is an httptest stand-in for the Plaid endpoints used to link a sandbox item and get its transactions
+type fakePlaid struct {
+	transactions []Transaction
+	pageSize     int
+	offsets      []int
+	failPath     string
+	failStatus   int
+	failBody     string
+	requests     []string
+	linked       GetPublicToken
+	fetched      GetTransactions
+	notReady     int
+	removed      []string
+	syncPages    map[string]SyncedTransactions
+	synced       []SyncTransactions
+	mutations    int
+	syncNotReady int
+	webhookKey   *ecdsa.PrivateKey
+	keyExpired   bool
+	keyRequests  int
+}
+
+func (f *fakePlaid) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.requests = append(f.requests, r.URL.Path)
+
+	if r.URL.Path == f.failPath {
+		w.WriteHeader(f.failStatus)
+		_, _ = w.Write([]byte(f.failBody))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/sandbox/public_token/create":
+		_ = json.NewDecoder(r.Body).Decode(&f.linked)
+		if f.linked.ClientId != testClientID || f.linked.Secret != testSecret {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error_type": "INVALID_INPUT", "error_code": "INVALID_API_KEYS", "error_message": "invalid client_id or secret provided"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(PublicToken{Token: "public-sandbox-token"})
+	case "/item/public_token/exchange":
+		var body GetAccessToken
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body.PublicToken != "public-sandbox-token" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error_type": "INVALID_INPUT", "error_code": "INVALID_PUBLIC_TOKEN", "error_message": "unknown public token"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(AccessToken{Token: "access-sandbox-token", ItemID: "item-sandbox"})
+	case "/transactions/get":
+		_ = json.NewDecoder(r.Body).Decode(&f.fetched)
+		if f.notReady > 0 {
+			f.notReady--
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error_type": "ITEM_ERROR", "error_code": "PRODUCT_NOT_READY", "error_message": "the requested product is not yet ready"}`))
+			return
+		}
+		f.offsets = append(f.offsets, f.fetched.Options.Offset)
+		start, end := f.fetched.Options.Offset, f.fetched.Options.Offset+f.fetched.Options.Count
+		if f.pageSize > 0 && end > start+f.pageSize {
+			end = start + f.pageSize
+		}
+		if start > len(f.transactions) {
+			start = len(f.transactions)
+		}
+		if end > len(f.transactions) {
+			end = len(f.transactions)
+		}
+		_ = json.NewEncoder(w).Encode(TransactionPage{Transactions: f.transactions[start:end], TotalTransactions: len(f.transactions)})
+	case "/transactions/sync":
+		var body SyncTransactions
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		f.synced = append(f.synced, body)
+		if f.syncNotReady > 0 {
+			f.syncNotReady--
+			_ = json.NewEncoder(w).Encode(SyncedTransactions{UpdateStatus: "NOT_READY"})
+			return
+		}
+		page, ok := f.syncPages[body.Cursor]
+		if ok && body.Cursor != "" && f.mutations > 0 {
+			f.mutations--
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error_type": "TRANSACTIONS_ERROR", "error_code": "TRANSACTIONS_SYNC_MUTATION_DURING_PAGINATION", "error_message": "underlying transaction data changed since last page was fetched"}`))
+			return
+		}
+		if !ok {
+			page = SyncedTransactions{NextCursor: body.Cursor}
+		}
+		_ = json.NewEncoder(w).Encode(page)
+	case "/webhook_verification_key/get":
+		f.keyRequests++
+		var body GetVerificationKey
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if f.webhookKey == nil || body.KeyID != testKeyID {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error_type": "INVALID_INPUT", "error_code": "INVALID_WEBHOOK_VERIFICATION_KEY_ID", "error_message": "invalid key_id provided"}`))
+			return
+		}
+		var key VerificationKey
+		key.Key.Alg, key.Key.Crv, key.Key.Kid, key.Key.Kty = "ES256", "P-256", testKeyID, "EC"
+		key.Key.X = base64.RawURLEncoding.EncodeToString(f.webhookKey.X.Bytes())
+		key.Key.Y = base64.RawURLEncoding.EncodeToString(f.webhookKey.Y.Bytes())
+		if f.keyExpired {
+			expiredAt := time.Now().Unix()
+			key.Key.ExpiredAt = &expiredAt
+		}
+		_ = json.NewEncoder(w).Encode(key)
+	case "/item/remove":
+		var body RemoveItem
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		f.removed = append(f.removed, body.AccessToken)
+		_, _ = w.Write([]byte(`{"request_id": "remove"}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+const (
+	testClientID = "test-client"
+	testSecret   = "test-secret"
+)
+
+// newTestAPI starts the fake and returns a client that talks to it, configured by the given config
+func newTestAPI(t *testing.T, fake *fakePlaid, config Config) *PlaidAPI {
+	t.Helper()
+
+	initial := initialBackoff
+	initialBackoff = time.Millisecond
+
+	server := httptest.NewServer(fake)
+	t.Cleanup(func() {
+		server.Close()
+		initialBackoff = initial
+	})
+
+	config.BaseURL = server.URL + "/"
+	config.HTTPClient = server.Client()
+	if config.ClientID == "" {
+		config.ClientID = testClientID
+	}
+	if config.Secret == "" {
+		config.Secret = testSecret
+	}
+	return NewPlaidAPI(config)
+}
+
+func TestGetTransactions(t *testing.T) {
+	t.Run("links an item and returns its transactions", func(t *testing.T) {
+		fake := &fakePlaid{transactions: []Transaction{{Amount: 9.99, Date: "2020-09-12", Name: "Netflix"}}}
+		api := newTestAPI(t, fake, Config{})
+
+		got, err := api.GetTransactions(testContext)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(got.Transactions) != 1 || got.Transactions[0].Name != "Netflix" {
+			t.Errorf("got %v want the Netflix transaction", got)
+		}
+		if len(fake.requests) != 3 {
+			t.Errorf("got requests %v want 3", fake.requests)
+		}
+	})
+
+	t.Run("reads every page of transactions", func(t *testing.T) {
+		transactions := []Transaction{
+			{TransactionID: "tx-1", Amount: 9.99, Date: "2020-09-12", Name: "Netflix"},
+			{TransactionID: "tx-2", Amount: 9.99, Date: "2020-09-14", Name: "Spotify"},
+			{TransactionID: "tx-3", Amount: 34.99, Date: "2020-10-01", Name: "PureGym"},
+		}
+		fake := &fakePlaid{transactions: transactions, pageSize: 2}
+		api := newTestAPI(t, fake, Config{})
+
+		got, err := api.GetTransactions(testContext)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !reflect.DeepEqual(got.Transactions, transactions) {
+			t.Errorf("got %v want every transaction", got.Transactions)
+		}
+		if !reflect.DeepEqual(fake.offsets, []int{0, 2}) {
+			t.Errorf("got pages from offsets %v want %v", fake.offsets, []int{0, 2})
+		}
+	})
+
+	t.Run("uses the configured institution and lookback window", func(t *testing.T) {
+		fixed := time.Date(2020, time.November, 20, 9, 0, 0, 0, time.UTC)
+		now = func() time.Time { return fixed }
+		t.Cleanup(func() { now = time.Now })
+
+		fake := &fakePlaid{}
+		api := newTestAPI(t, fake, Config{InstitutionID: "ins_109508", LookbackDays: 90})
+
+		_, err := api.GetTransactions(testContext)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if fake.linked.InstitutionId != "ins_109508" {
+			t.Errorf("got institution %q want %q", fake.linked.InstitutionId, "ins_109508")
+		}
+		if fake.fetched.StartDate != "2020-08-22" || fake.fetched.EndDate != "2020-11-20" {
+			t.Errorf("got window %s to %s want %s to %s", fake.fetched.StartDate, fake.fetched.EndDate, "2020-08-22", "2020-11-20")
+		}
+		if fake.fetched.AccessToken != "access-sandbox-token" {
+			t.Errorf("got access token %q want %q", fake.fetched.AccessToken, "access-sandbox-token")
+		}
+	})
+
+	t.Run("does not link an item outside the sandbox", func(t *testing.T) {
+		fake := &fakePlaid{}
+		api := newTestAPI(t, fake, Config{})
+		api.config.BaseURL = ProductionURL
+
+		_, err := api.GetTransactions(testContext)
+		if !errors.Is(err, ErrLinkRequired) {
+			t.Errorf("got error %v want %v", err, ErrLinkRequired)
+		}
+		if len(fake.requests) != 0 {
+			t.Errorf("got requests %v want none", fake.requests)
+		}
+	})
+
+	t.Run("returns an auth error for the wrong credentials", func(t *testing.T) {
+		api := newTestAPI(t, &fakePlaid{}, Config{Secret: "wrong"})
+
+		_, err := api.GetTransactions(testContext)
+		if !errors.Is(err, ErrAuth) {
+			t.Errorf("got error %v want %v", err, ErrAuth)
+		}
+	})
+
+	errorCases := []struct {
+		name   string
+		path   string
+		status int
+		body   string
+		want   error
+	}{
+		{
+			name: "invalid credentials", path: "/sandbox/public_token/create", status: http.StatusBadRequest,
+			body: `{"error_type": "INVALID_INPUT", "error_code": "INVALID_API_KEYS", "error_message": "invalid client_id or secret provided"}`,
+			want: ErrAuth,
+		},
+		{
+			name: "rate limited", path: "/transactions/get", status: http.StatusTooManyRequests,
+			body: `{"error_type": "RATE_LIMIT_EXCEEDED", "error_code": "TRANSACTIONS_LIMIT", "error_message": "rate limit exceeded"}`,
+			want: ErrRateLimit,
+		},
+		{
+			name: "bank is down", path: "/transactions/get", status: http.StatusBadRequest,
+			body: `{"error_type": "INSTITUTION_ERROR", "error_code": "INSTITUTION_DOWN", "error_message": "this institution is not currently responding"}`,
+			want: ErrInstitutionDown,
+		},
+		{
+			name: "bank login has expired", path: "/transactions/get", status: http.StatusBadRequest,
+			body: `{"error_type": "ITEM_ERROR", "error_code": "ITEM_LOGIN_REQUIRED", "error_message": "the login details of this item have changed"}`,
+			want: ErrItemLoginRequired,
+		},
+	}
+
+	for _, c := range errorCases {
+		t.Run(c.name, func(t *testing.T) {
+			api := newTestAPI(t, &fakePlaid{failPath: c.path, failStatus: c.status, failBody: c.body}, Config{})
+
+			_, err := api.GetTransactions(testContext)
+
+			if !errors.Is(err, c.want) {
+				t.Errorf("got error %v want %v", err, c.want)
+			}
+			var plaidError *Error
+			if !errors.As(err, &plaidError) || plaidError.StatusCode != c.status {
+				t.Errorf("got error %v want a plaid error with status %d", err, c.status)
+			}
+		})
+	}
+
+	t.Run("returns an error for a response that isn't a plaid error", func(t *testing.T) {
+		api := newTestAPI(t, &fakePlaid{failPath: "/transactions/get", failStatus: http.StatusBadGateway, failBody: "<html>bad gateway</html>"}, Config{})
+
+		_, err := api.GetTransactions(testContext)
+
+		var plaidError *Error
+		if !errors.As(err, &plaidError) || plaidError.StatusCode != http.StatusBadGateway {
+			t.Errorf("got error %v want a plaid error with status %d", err, http.StatusBadGateway)
+		}
+		for _, kind := range []error{ErrAuth, ErrRateLimit, ErrInstitutionDown, ErrItemLoginRequired} {
+			if errors.Is(err, kind) {
+				t.Errorf("got error %v that should not match %v", err, kind)
+			}
+		}
+	})
+
+	t.Run("stops when the context is cancelled", func(t *testing.T) {
+		api := newTestAPI(t, &fakePlaid{notReady: 1000}, Config{ReadyTimeout: time.Minute})
+
+		ctx, cancel := context.WithTimeout(testContext, 20*time.Millisecond)
+		defer cancel()
+
+		_, err := api.GetTransactions(ctx)
+
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got error %v want %v", err, context.DeadlineExceeded)
+		}
+	})
+}
+
+func TestGetTransactionsReadiness(t *testing.T) {
+	t.Run("asks again until the transactions are ready", func(t *testing.T) {
+		fake := &fakePlaid{notReady: 3, transactions: []Transaction{{Amount: 9.99, Date: "2020-09-12", Name: "Netflix"}}}
+		api := newTestAPI(t, fake, Config{})
+
+		start := time.Now()
+		got, err := api.GetTransactions(testContext)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(got.Transactions) != 1 {
+			t.Errorf("got %v want the Netflix transaction", got)
+		}
+		if len(fake.requests) != 6 {
+			t.Errorf("got requests %v want 6", fake.requests)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("took %v to get transactions that were ready after 3 attempts", elapsed)
+		}
+	})
+
+	t.Run("does not wait when the transactions are ready", func(t *testing.T) {
+		initial := initialBackoff
+		api := newTestAPI(t, &fakePlaid{}, Config{})
+		initialBackoff = time.Minute
+		defer func() { initialBackoff = initial }()
+
+		start := time.Now()
+		_, err := api.GetTransactions(testContext)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("took %v to get transactions that were ready", elapsed)
+		}
+	})
+
+	t.Run("gives up when the transactions are never ready", func(t *testing.T) {
+		api := newTestAPI(t, &fakePlaid{notReady: 1000}, Config{ReadyTimeout: 50 * time.Millisecond})
+
+		start := time.Now()
+		_, err := api.GetTransactions(testContext)
+
+		if !errors.Is(err, ErrProductNotReady) {
+			t.Errorf("got error %v want %v", err, ErrProductNotReady)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("took %v to give up with a ready timeout of 50ms", elapsed)
+		}
+	})
+}
+
+func TestEnvironmentURL(t *testing.T) {
+	cases := map[string]string{
+		"":            SandboxURL,
+		"sandbox":     SandboxURL,
+		"Development": DevelopmentURL,
+		"production":  ProductionURL,
+	}
+
+	for environment, want := range cases {
+		got, err := EnvironmentURL(environment)
+		if err != nil || got != want {
+			t.Errorf("got %q, %v for %q want %q", got, err, environment, want)
+		}
+	}
+
+	_, err := EnvironmentURL("staging")
+	if err == nil {
+		t.Errorf("expected an error for an unknown environment")
+	}
+}
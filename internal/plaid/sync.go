@@ -0,0 +1,195 @@
+package plaid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// syncPageSize is the number of changes requested in each page of a sync
+const syncPageSize = 500
+
+// mutationDuringPagination is the error code Plaid returns when the transactions change while a sync is paging through them
+const mutationDuringPagination = "TRANSACTIONS_SYNC_MUTATION_DURING_PAGINATION"
+
+// maxSyncAttempts is how many times an item's sync is started when its transactions keep changing while it pages through them
+const maxSyncAttempts = 3
+
+// notReady is the update status of an item whose transactions have not been fetched from the bank yet
+const notReady = "NOT_READY"
+
+type SyncTransactions struct {
+	ClientId    string `json:"client_id"`
+	Secret      string `json:"secret"`
+	AccessToken string `json:"access_token"`
+	Cursor      string `json:"cursor,omitempty"`
+	Count       int    `json:"count"`
+}
+
+type SyncedTransactions struct {
+	Added        []Transaction        `json:"added"`
+	Modified     []Transaction        `json:"modified"`
+	Removed      []RemovedTransaction `json:"removed"`
+	NextCursor   string               `json:"next_cursor"`
+	HasMore      bool                 `json:"has_more"`
+	UpdateStatus string               `json:"transactions_update_status,omitempty"`
+}
+
+type RemovedTransaction struct {
+	TransactionID string `json:"transaction_id"`
+}
+
+// TransactionChanges are the transactions added, modified and removed since the last sync.
+// Removed holds the IDs of the removed transactions.
+// Cursors holds how far each synced item has been read, which is only saved by SaveCursors once the changes are stored.
+type TransactionChanges struct {
+	Added    []Transaction `json:"added"`
+	Modified []Transaction `json:"modified"`
+	Removed  []string      `json:"removed"`
+	Cursors  []SyncCursor  `json:"-"`
+}
+
+// SyncCursor is the cursor the next sync of the user's stored item with the given ID carries on from
+type SyncCursor struct {
+	UserID int
+	ID     int
+	Cursor string
+}
+
+// SyncTransactions returns the changes to the transactions of the items linked by the user logged in to the context
+// since they were last synced,
+// linking a sandbox item first if none are linked. The first sync of an item returns all of its transactions as added.
+// The changes carry each item's new cursor, which is not saved until they are given to SaveCursors,
+// so changes that are never stored are returned again by the next sync. Any error recorded for an item is cleared.
+// Errors are returned in the same way as GetTransactions.
+func (p *PlaidAPI) SyncTransactions(ctx context.Context) (TransactionChanges, error) {
+	items, err := p.linkedItems(ctx)
+	if err != nil {
+		return TransactionChanges{}, err
+	}
+
+	if len(items) == 0 {
+		item, err := p.link(ctx)
+		if err != nil {
+			return TransactionChanges{}, err
+		}
+		items = append(items, item)
+	}
+	return p.syncItems(ctx, items)
+}
+
+// SyncItem returns the changes to the transactions of the linked item with the given Plaid item ID since it was last synced,
+// in the same way as SyncTransactions, without linking an item or syncing the user's other items.
+// It returns ErrItemNotFound if the item wasn't linked by the API's source.
+func (p *PlaidAPI) SyncItem(ctx context.Context, itemID string) (TransactionChanges, error) {
+	item, err := p.sourceItem(ctx, itemID)
+	if err != nil {
+		return TransactionChanges{}, err
+	}
+
+	items, err := p.decryptTokens([]Item{*item})
+	if err != nil {
+		return TransactionChanges{}, err
+	}
+	return p.syncItems(ctx, items)
+}
+
+// syncItems returns the changes to the transactions of the items with the cursors they carry on from,
+// clearing any error recorded for them
+func (p *PlaidAPI) syncItems(ctx context.Context, items []Item) (TransactionChanges, error) {
+	var all TransactionChanges
+	for _, item := range items {
+		changes, cursor, err := p.syncItem(ctx, item)
+		if err != nil {
+			return TransactionChanges{}, err
+		}
+
+		if p.config.Items != nil && item.ID != 0 && cursor != item.Cursor {
+			all.Cursors = append(all.Cursors, SyncCursor{UserID: item.UserID, ID: item.ID, Cursor: cursor})
+		}
+		if p.config.Items != nil && item.ID != 0 && item.Status != "" {
+			err = p.config.Items.UpdatePlaidItemStatus(ctx, item.UserID, item.ID, "")
+			if err != nil {
+				return TransactionChanges{}, fmt.Errorf("unable to clear status of linked bank %d: %w", item.ID, err)
+			}
+		}
+
+		all.Added = append(all.Added, changes.Added...)
+		all.Modified = append(all.Modified, changes.Modified...)
+		all.Removed = append(all.Removed, changes.Removed...)
+	}
+	return all, nil
+}
+
+// SaveCursors saves the cursors of synced changes once they have been stored, so the next sync carries on after them
+func (p *PlaidAPI) SaveCursors(ctx context.Context, changes TransactionChanges) error {
+	if p.config.Items == nil {
+		return nil
+	}
+
+	for _, cursor := range changes.Cursors {
+		err := p.config.Items.UpdatePlaidItemCursor(ctx, cursor.UserID, cursor.ID, cursor.Cursor)
+		if err != nil {
+			return fmt.Errorf("unable to save sync cursor of linked bank %d: %w", cursor.ID, err)
+		}
+	}
+	return nil
+}
+
+// syncItem pages through the item's changes from its cursor, returning them with the cursor to carry on from.
+// If the transactions change while paging, it waits and starts again from the item's cursor, up to maxSyncAttempts times.
+func (p *PlaidAPI) syncItem(ctx context.Context, item Item) (TransactionChanges, string, error) {
+	backoff := initialBackoff
+	for attempt := 1; ; attempt++ {
+		changes, cursor, err := p.syncPages(ctx, item)
+		var plaidError *Error
+		if !errors.As(err, &plaidError) || plaidError.Code != mutationDuringPagination {
+			return changes, cursor, err
+		}
+		if attempt == maxSyncAttempts {
+			return TransactionChanges{}, "", fmt.Errorf("transactions kept changing after %d attempts to sync them: %w", attempt, err)
+		}
+
+		err = wait(ctx, backoff)
+		if err != nil {
+			return TransactionChanges{}, "", err
+		}
+		backoff = nextBackoff(backoff)
+	}
+}
+
+// syncPages reads every page of the item's changes from its cursor.
+// It returns an error if Plaid says there are more pages without moving the cursor on, rather than asking for the same page forever.
+func (p *PlaidAPI) syncPages(ctx context.Context, item Item) (TransactionChanges, string, error) {
+	var changes TransactionChanges
+	cursor := item.Cursor
+	for {
+		s := SyncTransactions{ClientId: p.config.ClientID, Secret: p.config.Secret, AccessToken: item.AccessToken, Cursor: cursor, Count: syncPageSize}
+
+		var page SyncedTransactions
+		err := p.whenReady(ctx, func() error {
+			page = SyncedTransactions{}
+			err := p.post(ctx, "/transactions/sync", s, &page)
+			if err == nil && page.UpdateStatus == notReady && page.NextCursor == "" {
+				return &Error{Type: "ITEM_ERROR", Code: "PRODUCT_NOT_READY", Message: "transactions have not been fetched from the bank yet"}
+			}
+			return err
+		})
+		if err != nil {
+			return TransactionChanges{}, "", err
+		}
+
+		changes.Added = append(changes.Added, page.Added...)
+		changes.Modified = append(changes.Modified, page.Modified...)
+		for _, removed := range page.Removed {
+			changes.Removed = append(changes.Removed, removed.TransactionID)
+		}
+		if !page.HasMore {
+			return changes, page.NextCursor, nil
+		}
+		if page.NextCursor == cursor {
+			return TransactionChanges{}, "", fmt.Errorf("unable to sync transactions: plaid has more changes but returned the same cursor %q", cursor)
+		}
+		cursor = page.NextCursor
+	}
+}
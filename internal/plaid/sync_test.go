@@ -0,0 +1,219 @@
+package plaid
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Catzkorn/subscrypt/internal/account"
+)
+
+func TestSyncTransactions(t *testing.T) {
+	netflix := Transaction{TransactionID: "tx-1", Amount: 9.99, Date: "2020-10-12", Name: "Netflix"}
+	spotify := Transaction{TransactionID: "tx-2", Amount: 9.99, Date: "2020-10-14", Name: "Spotify"}
+	gym := Transaction{TransactionID: "tx-3", Amount: 34.99, Date: "2020-11-01", Name: "PureGym"}
+
+	t.Run("returns every page of changes and saves the cursor", func(t *testing.T) {
+		fake := &fakePlaid{syncPages: map[string]SyncedTransactions{
+			"":         {Added: []Transaction{netflix}, NextCursor: "cursor-1", HasMore: true},
+			"cursor-1": {Added: []Transaction{spotify}, NextCursor: "cursor-2"},
+		}}
+		store := &stubItemStore{}
+		api := newTestAPI(t, fake, Config{Items: store, TokenCipher: newTestCipher(t)})
+
+		got, err := api.SyncTransactions(testContext)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !reflect.DeepEqual(got.Added, []Transaction{netflix, spotify}) {
+			t.Errorf("got added %v want %v", got.Added, []Transaction{netflix, spotify})
+		}
+		if store.items[0].Cursor != "" {
+			t.Errorf("got cursor %q saved before the changes were stored", store.items[0].Cursor)
+		}
+
+		err = api.SaveCursors(testContext, got)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if store.items[0].Cursor != "cursor-2" {
+			t.Errorf("got cursor %q want %q", store.items[0].Cursor, "cursor-2")
+		}
+	})
+
+	t.Run("carries on from the saved cursor", func(t *testing.T) {
+		fake := &fakePlaid{syncPages: map[string]SyncedTransactions{
+			"":         {Added: []Transaction{netflix, spotify}, NextCursor: "cursor-1"},
+			"cursor-1": {Added: []Transaction{gym}, Modified: []Transaction{spotify}, Removed: []RemovedTransaction{{TransactionID: "tx-1"}}, NextCursor: "cursor-2"},
+		}}
+		store := &stubItemStore{}
+		api := newTestAPI(t, fake, Config{Items: store, TokenCipher: newTestCipher(t)})
+
+		first, err := api.SyncTransactions(testContext)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		err = api.SaveCursors(testContext, first)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got, err := api.SyncTransactions(testContext)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		want := TransactionChanges{Added: []Transaction{gym}, Modified: []Transaction{spotify}, Removed: []string{"tx-1"}}
+		got.Cursors = nil
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v want %v", got, want)
+		}
+		if last := fake.synced[len(fake.synced)-1]; last.Cursor != "cursor-1" {
+			t.Errorf("got sync from cursor %q want %q", last.Cursor, "cursor-1")
+		}
+	})
+
+	t.Run("returns the changes again if they were never stored", func(t *testing.T) {
+		fake := &fakePlaid{syncPages: map[string]SyncedTransactions{
+			"":         {Added: []Transaction{netflix}, NextCursor: "cursor-1"},
+			"cursor-1": {Added: []Transaction{spotify}, NextCursor: "cursor-2"},
+		}}
+		store := &stubItemStore{}
+		api := newTestAPI(t, fake, Config{Items: store, TokenCipher: newTestCipher(t)})
+
+		_, err := api.SyncTransactions(testContext)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got, err := api.SyncTransactions(testContext)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !reflect.DeepEqual(got.Added, []Transaction{netflix}) {
+			t.Errorf("got added %v want the unsaved changes again", got.Added)
+		}
+	})
+
+	t.Run("starts again when the transactions change while paging", func(t *testing.T) {
+		fake := &fakePlaid{mutations: 1, syncPages: map[string]SyncedTransactions{
+			"":         {Added: []Transaction{netflix}, NextCursor: "cursor-1", HasMore: true},
+			"cursor-1": {Added: []Transaction{spotify}, NextCursor: "cursor-2", HasMore: true},
+			"cursor-2": {Added: []Transaction{gym}, NextCursor: "cursor-3"},
+		}}
+		api := newTestAPI(t, fake, Config{})
+
+		got, err := api.SyncTransactions(testContext)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !reflect.DeepEqual(got.Added, []Transaction{netflix, spotify, gym}) {
+			t.Errorf("got added %v want each transaction once", got.Added)
+		}
+	})
+
+	t.Run("gives up when the transactions keep changing while paging", func(t *testing.T) {
+		fake := &fakePlaid{mutations: 10, syncPages: map[string]SyncedTransactions{
+			"":         {Added: []Transaction{netflix}, NextCursor: "cursor-1", HasMore: true},
+			"cursor-1": {Added: []Transaction{spotify}, NextCursor: "cursor-2"},
+		}}
+		api := newTestAPI(t, fake, Config{})
+
+		_, err := api.SyncTransactions(testContext)
+		var plaidError *Error
+		if !errors.As(err, &plaidError) || plaidError.Code != mutationDuringPagination {
+			t.Errorf("got error %v want %s", err, mutationDuringPagination)
+		}
+		if len(fake.synced) != 2*maxSyncAttempts {
+			t.Errorf("got %d syncs want %d", len(fake.synced), 2*maxSyncAttempts)
+		}
+	})
+
+	t.Run("stops syncing when the context is cancelled", func(t *testing.T) {
+		fake := &fakePlaid{mutations: 10, syncPages: map[string]SyncedTransactions{
+			"":         {Added: []Transaction{netflix}, NextCursor: "cursor-1", HasMore: true},
+			"cursor-1": {Added: []Transaction{spotify}, NextCursor: "cursor-2"},
+		}}
+		api := newTestAPI(t, fake, Config{})
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := api.SyncTransactions(ctx)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("got error %v want %v", err, context.Canceled)
+		}
+	})
+
+	t.Run("returns an error when there are more changes but the cursor doesn't move", func(t *testing.T) {
+		fake := &fakePlaid{syncPages: map[string]SyncedTransactions{
+			"":         {Added: []Transaction{netflix}, NextCursor: "cursor-1", HasMore: true},
+			"cursor-1": {NextCursor: "cursor-1", HasMore: true},
+		}}
+		api := newTestAPI(t, fake, Config{})
+
+		_, err := api.SyncTransactions(testContext)
+		if err == nil {
+			t.Errorf("expected an error but didn't get one")
+		}
+		if len(fake.synced) != 2 {
+			t.Errorf("got %d syncs want %d", len(fake.synced), 2)
+		}
+	})
+
+	t.Run("waits for the first transactions to be fetched", func(t *testing.T) {
+		fake := &fakePlaid{syncNotReady: 2, syncPages: map[string]SyncedTransactions{
+			"": {Added: []Transaction{netflix}, NextCursor: "cursor-1"},
+		}}
+		api := newTestAPI(t, fake, Config{})
+
+		got, err := api.SyncTransactions(testContext)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(got.Added) != 1 || len(fake.synced) != 3 {
+			t.Errorf("got added %v after %d syncs want the Netflix transaction after 3", got.Added, len(fake.synced))
+		}
+	})
+}
+
+func TestSyncItem(t *testing.T) {
+	netflix := Transaction{TransactionID: "tx-1", Amount: 9.99, Date: "2020-10-12", Name: "Netflix"}
+
+	store := &stubItemStore{}
+	fake := &fakePlaid{syncPages: map[string]SyncedTransactions{
+		"": {Added: []Transaction{netflix}, NextCursor: "cursor-1"},
+	}}
+	api := newTestAPI(t, fake, Config{Items: store, TokenCipher: newTestCipher(t)})
+	_, err := api.GetTransactions(account.WithUser(context.Background(), 4))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	t.Run("syncs the item linked by the source", func(t *testing.T) {
+		got, err := api.SyncItem(testContext, "item-sandbox")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		want := []SyncCursor{{UserID: 4, ID: 1, Cursor: "cursor-1"}}
+		if !reflect.DeepEqual(got.Added, []Transaction{netflix}) || !reflect.DeepEqual(got.Cursors, want) {
+			t.Errorf("got %+v want the Netflix transaction up to %v", got, want)
+		}
+	})
+
+	t.Run("doesn't link a bank for an item linked by another source", func(t *testing.T) {
+		monzoFake := &fakePlaid{}
+		monzo := newTestAPI(t, monzoFake, Config{Items: store, TokenCipher: newTestCipher(t), Source: "monzo"})
+
+		_, err := monzo.SyncItem(testContext, "item-sandbox")
+		if !errors.Is(err, ErrItemNotFound) {
+			t.Errorf("got error %v want %v", err, ErrItemNotFound)
+		}
+		if len(monzoFake.requests) != 0 || len(store.items) != 1 {
+			t.Errorf("got requests %v and %d linked items want no new link", monzoFake.requests, len(store.items))
+		}
+	})
+}
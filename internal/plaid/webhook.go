@@ -0,0 +1,187 @@
+package plaid
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// ErrWebhookSignature is returned for a webhook that wasn't signed by Plaid
+var ErrWebhookSignature = errors.New("webhook signature is not valid")
+
+// maxWebhookAge is how old a webhook's signature can be before it is rejected as a replay
+const maxWebhookAge = 5 * time.Minute
+
+// webhookKeyCheckInterval is how long a cached verification key is trusted before Plaid is asked again whether it has expired
+const webhookKeyCheckInterval = time.Hour
+
+// webhookKeyFetchInterval is the least time between requests for verification keys that aren't cached,
+// so webhooks naming made up keys can't use up our Plaid rate limit
+const webhookKeyFetchInterval = 10 * time.Second
+
+// webhookClockSkew is how far in the future a webhook's signature can be dated, allowing for our clock being behind Plaid's
+const webhookClockSkew = 30 * time.Second
+
+// Webhook is a notification from Plaid about a change to a linked item.
+// Type and Code say what changed, such as TRANSACTIONS and SYNC_UPDATES_AVAILABLE,
+// and Error is set for ITEM ERROR webhooks.
+type Webhook struct {
+	Type   string `json:"webhook_type"`
+	Code   string `json:"webhook_code"`
+	ItemID string `json:"item_id"`
+	Error  *Error `json:"error"`
+}
+
+type GetVerificationKey struct {
+	ClientId string `json:"client_id"`
+	Secret   string `json:"secret"`
+	KeyID    string `json:"key_id"`
+}
+
+type VerificationKey struct {
+	Key struct {
+		Alg       string `json:"alg"`
+		Crv       string `json:"crv"`
+		Kid       string `json:"kid"`
+		Kty       string `json:"kty"`
+		X         string `json:"x"`
+		Y         string `json:"y"`
+		ExpiredAt *int64 `json:"expired_at"`
+	} `json:"key"`
+}
+
+// webhookHeader is the header of the JSON web token Plaid signs webhooks with
+type webhookHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// webhookClaims are the claims of the JSON web token Plaid signs webhooks with
+type webhookClaims struct {
+	IssuedAt          int64  `json:"iat"`
+	RequestBodySHA256 string `json:"request_body_sha256"`
+}
+
+// VerifyWebhook checks that the webhook body was sent by Plaid, using the JSON web token from its Plaid-Verification header.
+// The token must be signed with one of Plaid's current keys, be less than five minutes old, not be dated in the future
+// and carry the hash of the body.
+// It returns ErrWebhookSignature if the webhook can't be verified.
+func (p *PlaidAPI) VerifyWebhook(ctx context.Context, body []byte, token string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("%w: malformed token", ErrWebhookSignature)
+	}
+
+	var header webhookHeader
+	err := decodeSegment(parts[0], &header)
+	if err != nil || header.Alg != "ES256" || header.Kid == "" {
+		return fmt.Errorf("%w: unsupported token header", ErrWebhookSignature)
+	}
+
+	key, err := p.verificationKey(ctx, header.Kid)
+	if err != nil {
+		return err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(signature) != 64 {
+		return fmt.Errorf("%w: malformed signature", ErrWebhookSignature)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(key, digest[:], r, s) {
+		return fmt.Errorf("%w: signature does not match", ErrWebhookSignature)
+	}
+
+	var claims webhookClaims
+	err = decodeSegment(parts[1], &claims)
+	if err != nil {
+		return fmt.Errorf("%w: malformed claims", ErrWebhookSignature)
+	}
+	issuedAt := time.Unix(claims.IssuedAt, 0)
+	if now().Sub(issuedAt) > maxWebhookAge {
+		return fmt.Errorf("%w: token is too old", ErrWebhookSignature)
+	}
+	if issuedAt.After(now().Add(webhookClockSkew)) {
+		return fmt.Errorf("%w: token is dated in the future", ErrWebhookSignature)
+	}
+
+	bodyHash := sha256.Sum256(body)
+	if subtle.ConstantTimeCompare([]byte(hex.EncodeToString(bodyHash[:])), []byte(claims.RequestBodySHA256)) != 1 {
+		return fmt.Errorf("%w: body does not match", ErrWebhookSignature)
+	}
+	return nil
+}
+
+// webhookKey is a verification key with the time Plaid last said it hadn't expired
+type webhookKey struct {
+	key       *ecdsa.PublicKey
+	checkedAt time.Time
+}
+
+// verificationKey returns the public key Plaid signed webhooks with, fetching it the first time it is used
+// and again once it has been cached for webhookKeyCheckInterval, in case it has expired.
+// Keys that aren't cached are fetched at most once every webhookKeyFetchInterval.
+func (p *PlaidAPI) verificationKey(ctx context.Context, keyID string) (*ecdsa.PublicKey, error) {
+	p.mutex.Lock()
+	cached, ok := p.webhookKeys[keyID]
+	switch {
+	case ok && now().Sub(cached.checkedAt) < webhookKeyCheckInterval:
+		p.mutex.Unlock()
+		return cached.key, nil
+	case !ok && now().Sub(p.lastKeyFetch) < webhookKeyFetchInterval:
+		p.mutex.Unlock()
+		return nil, fmt.Errorf("%w: too many requests for unknown verification keys", ErrWebhookSignature)
+	case !ok:
+		p.lastKeyFetch = now()
+	}
+	p.mutex.Unlock()
+
+	g := GetVerificationKey{ClientId: p.config.ClientID, Secret: p.config.Secret, KeyID: keyID}
+	var response VerificationKey
+	err := p.post(ctx, "/webhook_verification_key/get", g, &response)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get webhook verification key: %w", err)
+	}
+
+	jwk := response.Key
+	if jwk.ExpiredAt != nil {
+		p.mutex.Lock()
+		delete(p.webhookKeys, keyID)
+		p.mutex.Unlock()
+		return nil, fmt.Errorf("%w: verification key %s has expired", ErrWebhookSignature, keyID)
+	}
+	if jwk.Kty != "EC" || jwk.Crv != "P-256" {
+		return nil, fmt.Errorf("%w: verification key %s can't be used", ErrWebhookSignature, keyID)
+	}
+	x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+	y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+	if errX != nil || errY != nil {
+		return nil, fmt.Errorf("%w: malformed verification key %s", ErrWebhookSignature, keyID)
+	}
+	key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+
+	p.mutex.Lock()
+	p.webhookKeys[keyID] = webhookKey{key: key, checkedAt: now()}
+	p.mutex.Unlock()
+	return key, nil
+}
+
+// decodeSegment decodes a base64url encoded JSON segment of a JSON web token
+func decodeSegment(segment string, out interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,223 @@
+package plaid
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Catzkorn/subscrypt/internal/account"
+)
+
+const testKeyID = "6c5516e1-92dc-479e-a8ff-5a51992e0001"
+
+// signWebhook returns the Plaid-Verification token for the body, signed with the key and issued at the given time
+func signWebhook(t *testing.T, key *ecdsa.PrivateKey, keyID string, body []byte, issuedAt time.Time) string {
+	t.Helper()
+
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": keyID, "typ": "JWT"})
+	bodyHash := sha256.Sum256(body)
+	claims, _ := json.Marshal(map[string]interface{}{"iat": issuedAt.Unix(), "request_body_sha256": hex.EncodeToString(bodyHash[:])})
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatalf("unable to sign webhook: %v", err)
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func newTestKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	return key
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	body := []byte(`{"webhook_type": "TRANSACTIONS", "webhook_code": "SYNC_UPDATES_AVAILABLE", "item_id": "item-sandbox"}`)
+
+	t.Run("accepts a webhook signed by plaid and caches the key", func(t *testing.T) {
+		key := newTestKey(t)
+		fake := &fakePlaid{webhookKey: key}
+		api := newTestAPI(t, fake, Config{})
+
+		for i := 0; i < 2; i++ {
+			err := api.VerifyWebhook(testContext, body, signWebhook(t, key, testKeyID, body, time.Now()))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		if fake.keyRequests != 1 {
+			t.Errorf("got %d verification key requests want 1", fake.keyRequests)
+		}
+	})
+
+	cases := []struct {
+		name  string
+		token func(key *ecdsa.PrivateKey) string
+		body  []byte
+	}{
+		{"signed by another key", func(key *ecdsa.PrivateKey) string {
+			return signWebhook(t, newTestKey(t), testKeyID, body, time.Now())
+		}, body},
+		{"with a body that was changed", func(key *ecdsa.PrivateKey) string {
+			return signWebhook(t, key, testKeyID, body, time.Now())
+		}, []byte(`{"webhook_type": "TRANSACTIONS", "webhook_code": "TRANSACTIONS_REMOVED", "item_id": "item-sandbox"}`)},
+		{"signed too long ago", func(key *ecdsa.PrivateKey) string {
+			return signWebhook(t, key, testKeyID, body, time.Now().Add(-10*time.Minute))
+		}, body},
+		{"dated in the future", func(key *ecdsa.PrivateKey) string {
+			return signWebhook(t, key, testKeyID, body, time.Now().Add(10*time.Minute))
+		}, body},
+		{"without a token", func(key *ecdsa.PrivateKey) string {
+			return ""
+		}, body},
+		{"with an unsigned token", func(key *ecdsa.PrivateKey) string {
+			header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg": "none", "kid": "` + testKeyID + `"}`))
+			return header + "." + base64.RawURLEncoding.EncodeToString([]byte(`{}`)) + "."
+		}, body},
+	}
+
+	for _, c := range cases {
+		t.Run("rejects a webhook "+c.name, func(t *testing.T) {
+			key := newTestKey(t)
+			api := newTestAPI(t, &fakePlaid{webhookKey: key}, Config{})
+
+			err := api.VerifyWebhook(testContext, c.body, c.token(key))
+			if !errors.Is(err, ErrWebhookSignature) {
+				t.Errorf("got error %v want %v", err, ErrWebhookSignature)
+			}
+		})
+	}
+
+	t.Run("accepts a webhook dated slightly ahead of our clock", func(t *testing.T) {
+		key := newTestKey(t)
+		api := newTestAPI(t, &fakePlaid{webhookKey: key}, Config{})
+
+		err := api.VerifyWebhook(testContext, body, signWebhook(t, key, testKeyID, body, time.Now().Add(10*time.Second)))
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("limits how often it asks plaid for keys it hasn't seen", func(t *testing.T) {
+		key := newTestKey(t)
+		fake := &fakePlaid{webhookKey: key}
+		api := newTestAPI(t, fake, Config{})
+
+		for _, keyID := range []string{"made-up-1", "made-up-2", testKeyID} {
+			err := api.VerifyWebhook(testContext, body, signWebhook(t, key, keyID, body, time.Now()))
+			if err == nil {
+				t.Errorf("expected an error for key %s straight after asking for another", keyID)
+			}
+		}
+
+		if fake.keyRequests != 1 {
+			t.Errorf("got %d verification key requests want 1", fake.keyRequests)
+		}
+	})
+
+	t.Run("checks a cached key again and stops trusting it once it has expired", func(t *testing.T) {
+		fixed := time.Now()
+		now = func() time.Time { return fixed }
+		t.Cleanup(func() { now = time.Now })
+
+		key := newTestKey(t)
+		fake := &fakePlaid{webhookKey: key}
+		api := newTestAPI(t, fake, Config{})
+
+		err := api.VerifyWebhook(testContext, body, signWebhook(t, key, testKeyID, body, now()))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		fixed = fixed.Add(2 * webhookKeyCheckInterval)
+		fake.keyExpired = true
+		err = api.VerifyWebhook(testContext, body, signWebhook(t, key, testKeyID, body, now()))
+		if !errors.Is(err, ErrWebhookSignature) {
+			t.Errorf("got error %v want %v", err, ErrWebhookSignature)
+		}
+		if fake.keyRequests != 2 {
+			t.Errorf("got %d verification key requests want 2", fake.keyRequests)
+		}
+	})
+
+	t.Run("rejects a webhook signed with a key plaid doesn't know", func(t *testing.T) {
+		key := newTestKey(t)
+		api := newTestAPI(t, &fakePlaid{webhookKey: key}, Config{})
+
+		err := api.VerifyWebhook(testContext, body, signWebhook(t, key, "unknown-key", body, time.Now()))
+		if err == nil {
+			t.Errorf("expected an error for an unknown key")
+		}
+	})
+}
+
+func TestSetItemStatus(t *testing.T) {
+	store := &stubItemStore{}
+	api := newTestAPI(t, &fakePlaid{}, Config{Items: store, TokenCipher: newTestCipher(t)})
+	_, err := api.GetTransactions(testContext)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = api.SetItemStatus(testContext, "item-sandbox", "ITEM_LOGIN_REQUIRED")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if store.items[0].Status != "ITEM_LOGIN_REQUIRED" {
+		t.Errorf("got status %q want %q", store.items[0].Status, "ITEM_LOGIN_REQUIRED")
+	}
+
+	_, err = api.SyncTransactions(testContext)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if store.items[0].Status != "" {
+		t.Errorf("got status %q want it cleared by a successful sync", store.items[0].Status)
+	}
+
+	err = api.SetItemStatus(testContext, "item-unknown", "ITEM_LOGIN_REQUIRED")
+	if !errors.Is(err, ErrItemNotFound) {
+		t.Errorf("got error %v want %v", err, ErrItemNotFound)
+	}
+}
+
+func TestLinkedItem(t *testing.T) {
+	store := &stubItemStore{}
+	api := newTestAPI(t, &fakePlaid{}, Config{Items: store, TokenCipher: newTestCipher(t)})
+	_, err := api.GetTransactions(account.WithUser(context.Background(), 4))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	item, err := api.LinkedItem(testContext, "item-sandbox")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if item.UserID != 4 || item.Source != DefaultSource || item.AccessToken != "" {
+		t.Errorf("got %+v want the item linked by user 4 from the default source without its access token", item)
+	}
+
+	monzo := newTestAPI(t, &fakePlaid{}, Config{Items: store, TokenCipher: newTestCipher(t), Source: "monzo"})
+	_, err = monzo.LinkedItem(testContext, "item-sandbox")
+	if !errors.Is(err, ErrItemNotFound) {
+		t.Errorf("got error %v want %v for an item linked by another source", err, ErrItemNotFound)
+	}
+}
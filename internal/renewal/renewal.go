@@ -0,0 +1,73 @@
+package renewal
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Catzkorn/subscrypt/internal/subscription"
+)
+
+// DataStore defines the interface required to roll subscriptions on to their next due date
+type DataStore interface {
+	GetAllSubscriptions(ctx context.Context) ([]subscription.Subscription, error)
+	RenewSubscription(ctx context.Context, userID int, subscriptionID int, dateDue time.Time, renewals []subscription.Renewal) error
+}
+
+// RolloverSubscriptions moves every user's subscription that was due before today on to its next due date,
+// recording the due dates it passed. A subscription that can't be renewed is logged and skipped so the rest still are,
+// and the failures are returned together. It returns the number of subscriptions that were renewed.
+func RolloverSubscriptions(ctx context.Context, dataStore DataStore, now time.Time) (int, error) {
+	subscriptions, err := dataStore.GetAllSubscriptions(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get subscriptions: %w", err)
+	}
+
+	year, month, day := now.Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+
+	renewed := 0
+	var failures []string
+	for _, sub := range subscriptions {
+		dateDue, renewals := sub.Rollover(today)
+		if !dateDue.After(sub.DateDue) {
+			continue
+		}
+
+		err = dataStore.RenewSubscription(ctx, sub.UserID, sub.ID, dateDue, renewals)
+		if err != nil {
+			log.Printf("failed to renew subscription %v: %v", sub.ID, err)
+			failures = append(failures, fmt.Sprintf("subscription %v: %v", sub.ID, err))
+			continue
+		}
+		renewed++
+	}
+
+	if len(failures) > 0 {
+		return renewed, fmt.Errorf("failed to renew %d subscriptions: %s", len(failures), strings.Join(failures, "; "))
+	}
+	return renewed, nil
+}
+
+// Schedule rolls subscriptions over straight away and then once every interval, until the context is cancelled
+func Schedule(ctx context.Context, dataStore DataStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		renewed, err := RolloverSubscriptions(ctx, dataStore, time.Now())
+		if err != nil {
+			log.Printf("failed to roll over subscriptions: %v", err)
+		} else if renewed > 0 {
+			log.Printf("rolled over %d subscriptions", renewed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
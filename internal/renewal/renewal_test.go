@@ -0,0 +1,111 @@
+package renewal
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Catzkorn/subscrypt/internal/subscription"
+	"github.com/shopspring/decimal"
+)
+
+type StubDataStore struct {
+	subscriptions []subscription.Subscription
+	renewed       map[int]time.Time
+	renewedFor    map[int]int
+	renewals      map[int][]subscription.Renewal
+	err           error
+	failFor       map[int]bool
+}
+
+func (s *StubDataStore) GetAllSubscriptions(ctx context.Context) ([]subscription.Subscription, error) {
+	return s.subscriptions, s.err
+}
+
+func (s *StubDataStore) RenewSubscription(ctx context.Context, userID int, subscriptionID int, dateDue time.Time, renewals []subscription.Renewal) error {
+	if s.renewed == nil {
+		s.renewed = map[int]time.Time{}
+		s.renewedFor = map[int]int{}
+		s.renewals = map[int][]subscription.Renewal{}
+	}
+	if s.failFor[subscriptionID] {
+		return errors.New("constraint violated")
+	}
+	s.renewed[subscriptionID] = dateDue
+	s.renewedFor[subscriptionID] = userID
+	s.renewals[subscriptionID] = renewals
+	return nil
+}
+
+func TestRolloverSubscriptions(t *testing.T) {
+	now := time.Date(2020, time.November, 20, 15, 30, 0, 0, time.UTC)
+	amount, _ := decimal.NewFromString("9.99")
+
+	t.Run("moves past-due subscriptions on and keeps their history", func(t *testing.T) {
+		store := &StubDataStore{subscriptions: []subscription.Subscription{
+			{ID: 1, UserID: 7, Name: "Netflix", Amount: amount, DateDue: time.Date(2020, time.October, 12, 0, 0, 0, 0, time.UTC), Frequency: subscription.Monthly},
+			{ID: 2, UserID: 8, Name: "The Guardian", Amount: amount, DateDue: time.Date(2020, time.November, 6, 0, 0, 0, 0, time.UTC), Frequency: subscription.Weekly},
+			{ID: 3, Name: "Amazon Prime", Amount: amount, DateDue: time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC), Frequency: subscription.Annually},
+		}}
+
+		renewed, err := RolloverSubscriptions(context.Background(), store, now)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if renewed != 2 {
+			t.Errorf("got %d renewed subscriptions want %d", renewed, 2)
+		}
+
+		if want := time.Date(2020, time.December, 12, 0, 0, 0, 0, time.UTC); !store.renewed[1].Equal(want) {
+			t.Errorf("got next due date %v want %v", store.renewed[1], want)
+		}
+
+		if want := time.Date(2020, time.November, 20, 0, 0, 0, 0, time.UTC); !store.renewed[2].Equal(want) {
+			t.Errorf("got next due date %v want %v", store.renewed[2], want)
+		}
+
+		if len(store.renewals[2]) != 2 {
+			t.Errorf("got %d renewals want %d", len(store.renewals[2]), 2)
+		}
+
+		if store.renewedFor[1] != 7 || store.renewedFor[2] != 8 {
+			t.Errorf("got subscriptions renewed for users %v want each for the user it belongs to", store.renewedFor)
+		}
+
+		if _, ok := store.renewed[3]; ok {
+			t.Errorf("renewed a subscription that is not due yet")
+		}
+	})
+
+	t.Run("returns an error when the subscriptions can't be read", func(t *testing.T) {
+		store := &StubDataStore{err: errors.New("database is down")}
+
+		_, err := RolloverSubscriptions(context.Background(), store, now)
+		if err == nil {
+			t.Errorf("expected an error but didn't get one")
+		}
+	})
+
+	t.Run("renews the other subscriptions when one can't be renewed", func(t *testing.T) {
+		store := &StubDataStore{
+			subscriptions: []subscription.Subscription{
+				{ID: 1, UserID: 7, Name: "Netflix", Amount: amount, DateDue: time.Date(2020, time.October, 12, 0, 0, 0, 0, time.UTC), Frequency: subscription.Monthly},
+				{ID: 2, UserID: 8, Name: "Spotify", Amount: amount, DateDue: time.Date(2020, time.October, 1, 0, 0, 0, 0, time.UTC), Frequency: subscription.Monthly},
+				{ID: 3, UserID: 9, Name: "Disney+", Amount: amount, DateDue: time.Date(2020, time.October, 3, 0, 0, 0, 0, time.UTC), Frequency: subscription.Monthly},
+			},
+			failFor: map[int]bool{1: true, 3: true},
+		}
+
+		renewed, err := RolloverSubscriptions(context.Background(), store, now)
+		if err == nil || !strings.Contains(err.Error(), "subscription 1") || !strings.Contains(err.Error(), "subscription 3") {
+			t.Errorf("got error %v want one naming subscriptions 1 and 3", err)
+		}
+
+		if _, ok := store.renewed[2]; !ok || renewed != 1 {
+			t.Errorf("got %d renewed subscriptions want subscription 2 renewed", renewed)
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCipher(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, KeySize)
+	c, err := NewCipher(key)
+	if err != nil {
+		t.Fatalf("unexpected error creating cipher: %v", err)
+	}
+
+	t.Run("decrypts what it encrypts", func(t *testing.T) {
+		encrypted, err := c.Encrypt("access-sandbox-token")
+		if err != nil {
+			t.Fatalf("unexpected error encrypting: %v", err)
+		}
+		if strings.Contains(encrypted, "access-sandbox-token") {
+			t.Errorf("encrypted secret %q contains the plaintext", encrypted)
+		}
+
+		got, err := c.Decrypt(encrypted)
+		if err != nil || got != "access-sandbox-token" {
+			t.Errorf("got %q, %v want %q", got, err, "access-sandbox-token")
+		}
+	})
+
+	t.Run("encrypts the same secret differently each time", func(t *testing.T) {
+		first, _ := c.Encrypt("access-sandbox-token")
+		second, _ := c.Encrypt("access-sandbox-token")
+		if first == second {
+			t.Errorf("got the same ciphertext twice")
+		}
+	})
+
+	t.Run("does not decrypt with another key", func(t *testing.T) {
+		encrypted, _ := c.Encrypt("access-sandbox-token")
+		other, _ := NewCipher(bytes.Repeat([]byte{8}, KeySize))
+
+		_, err := other.Decrypt(encrypted)
+		if !errors.Is(err, ErrDecrypt) {
+			t.Errorf("got error %v want %v", err, ErrDecrypt)
+		}
+	})
+
+	t.Run("does not decrypt a changed secret", func(t *testing.T) {
+		encrypted, _ := c.Encrypt("access-sandbox-token")
+		sealed, _ := base64.StdEncoding.DecodeString(encrypted)
+		sealed[len(sealed)-1] ^= 1
+
+		_, err := c.Decrypt(base64.StdEncoding.EncodeToString(sealed))
+		if !errors.Is(err, ErrDecrypt) {
+			t.Errorf("got error %v want %v", err, ErrDecrypt)
+		}
+	})
+}
+
+func TestParseKey(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, KeySize)
+
+	got, err := ParseKey(base64.StdEncoding.EncodeToString(key))
+	if err != nil || !bytes.Equal(got, key) {
+		t.Errorf("got %v, %v want %v", got, err, key)
+	}
+
+	_, err = ParseKey(base64.StdEncoding.EncodeToString(key[:16]))
+	if err == nil {
+		t.Errorf("expected an error for a short key")
+	}
+
+	_, err = ParseKey("not base64!")
+	if err == nil {
+		t.Errorf("expected an error for a key that isn't base64")
+	}
+}
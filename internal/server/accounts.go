@@ -0,0 +1,228 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Catzkorn/subscrypt/internal/account"
+	"github.com/Catzkorn/subscrypt/internal/userprofile"
+)
+
+// SessionCookie is the name of the cookie that holds the session token of a logged in user
+const SessionCookie = "subscrypt_session"
+
+// errPasswordLoginDisabled is the reason signing up or logging in with a password is refused when the server only allows single sign on
+var errPasswordLoginDisabled = errors.New("log in with single sign on instead of a password")
+
+// credentials are the details posted to sign up or log in
+type credentials struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// normalizeEmail returns the email a user is stored and looked up by
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// currentUser returns the ID of the user logged in to the request, which requireUser makes sure there is
+func currentUser(r *http.Request) int {
+	userID, _ := account.UserID(r.Context())
+	return userID
+}
+
+// requireUser only lets requests from a logged in user, or with one of a user's API tokens as a bearer token,
+// through to the handler, which can find the user's ID in the request's context with currentUser.
+// Requests made with the session cookie that change something must come from this site with the session's CSRF token.
+// Expired sessions are deleted when they are next used.
+func (s *Server) requireUser(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token, ok := bearerToken(r); ok {
+			s.serveWithAPIToken(w, r, token, handler)
+			return
+		}
+
+		cookie, err := r.Cookie(SessionCookie)
+		if err != nil {
+			http.Error(w, "you need to log in", http.StatusUnauthorized)
+			return
+		}
+
+		tokenHash := account.HashToken(cookie.Value)
+		session, err := s.dataStore.GetSession(r.Context(), tokenHash)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if session == nil {
+			http.Error(w, "you need to log in", http.StatusUnauthorized)
+			return
+		}
+		if session.Expired(time.Now()) {
+			err = s.dataStore.DeleteSession(r.Context(), tokenHash)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			http.Error(w, "your session has expired, please log in again", http.StatusUnauthorized)
+			return
+		}
+
+		if !checkSessionRequest(w, r, cookie.Value) {
+			return
+		}
+		if csrf, err := r.Cookie(CSRFCookie); err != nil || csrf.Value != account.CSRFToken(cookie.Value) {
+			setCSRFCookie(w, r, cookie.Value, session.ExpiresAt)
+		}
+
+		handler.ServeHTTP(w, r.WithContext(account.WithUser(r.Context(), session.UserID)))
+	})
+}
+
+// signupHandler handles the routing logic for the '/api/signup' path
+// Posting a name, email and password creates an account and logs in to it.
+func (s *Server) signupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		return
+	}
+	if s.noPasswords {
+		http.Error(w, errPasswordLoginDisabled.Error(), http.StatusForbidden)
+		return
+	}
+
+	var details credentials
+	err := json.NewDecoder(r.Body).Decode(&details)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	details.Name = strings.TrimSpace(details.Name)
+	details.Email = normalizeEmail(details.Email)
+	if details.Name == "" || details.Email == "" {
+		http.Error(w, "an account needs a name and an email", http.StatusBadRequest)
+		return
+	}
+
+	passwordHash, err := account.HashPassword(details.Password)
+	if errors.Is(err, account.ErrPasswordTooShort) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user, err := s.dataStore.CreateUser(r.Context(), details.Name, details.Email, passwordHash)
+	switch {
+	case errors.Is(err, account.ErrEmailTaken):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.processLogin(w, r, *user, http.StatusCreated)
+}
+
+// loginHandler handles the routing logic for the '/api/login' path
+// Posting the email and password of an account logs in to it, and getting it returns the ways a user can log in.
+func (s *Server) loginHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		s.processGetLoginMethods(w)
+		return
+	}
+	if r.Method != http.MethodPost {
+		return
+	}
+	if s.noPasswords {
+		http.Error(w, errPasswordLoginDisabled.Error(), http.StatusForbidden)
+		return
+	}
+
+	var details credentials
+	err := json.NewDecoder(r.Body).Decode(&details)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.dataStore.GetUserByEmail(r.Context(), normalizeEmail(details.Email))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if user == nil || !account.CheckPassword(user.PasswordHash, details.Password) {
+		http.Error(w, "incorrect email or password", http.StatusUnauthorized)
+		return
+	}
+
+	s.processLogin(w, r, *user, http.StatusOK)
+}
+
+// processLogin starts a session for the user, setting its cookie, and writes the user's details as json with the status
+func (s *Server) processLogin(w http.ResponseWriter, r *http.Request, user userprofile.Userprofile, status int) {
+	err := s.startSession(w, r, user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user.PasswordHash = ""
+	w.Header().Set("content-type", JSONContentType)
+	w.WriteHeader(status)
+	err = json.NewEncoder(w).Encode(user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// startSession ends any session the request already has, so its token stops working,
+// then stores a new session for the user and sets its cookies in place of the old ones
+func (s *Server) startSession(w http.ResponseWriter, r *http.Request, userID int) error {
+	if cookie, err := r.Cookie(SessionCookie); err == nil {
+		err = s.dataStore.DeleteSession(r.Context(), account.HashToken(cookie.Value))
+		if err != nil {
+			return err
+		}
+	}
+
+	token, session, err := account.NewSession(userID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	err = s.dataStore.CreateSession(r.Context(), session)
+	if err != nil {
+		return err
+	}
+
+	setSessionCookies(w, r, token, session.ExpiresAt)
+	return nil
+}
+
+// logoutHandler handles the routing logic for the '/api/logout' path
+// Posting to it ends the request's session and clears its cookies.
+func (s *Server) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		return
+	}
+
+	if cookie, err := r.Cookie(SessionCookie); err == nil {
+		err = s.dataStore.DeleteSession(r.Context(), account.HashToken(cookie.Value))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	clearSessionCookies(w, r)
+	w.WriteHeader(http.StatusOK)
+}
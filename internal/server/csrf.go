@@ -0,0 +1,130 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Catzkorn/subscrypt/internal/account"
+)
+
+// CSRFCookie is the name of the cookie the web UI reads its CSRF token from.
+// Unlike the session cookie it isn't HttpOnly, since the JavaScript has to read it.
+const CSRFCookie = "subscrypt_csrf"
+
+// CSRFHeader is the header the web UI sends its CSRF token back in
+const CSRFHeader = "X-CSRF-Token"
+
+// changesState reports whether a request with the method can change something, and so needs protecting from other sites
+func changesState(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	default:
+		return true
+	}
+}
+
+// secureRequest reports whether the request reached us over HTTPS, directly or through a proxy like Heroku's router,
+// in which case cookies are only sent back over HTTPS
+func secureRequest(r *http.Request) bool {
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// sameOrigin reports whether the request was sent by a page of this site, going by its Origin header,
+// or its Referer header if the browser didn't send an Origin.
+// Requests with neither are let through, since browsers send an Origin with every cross-site request that changes something.
+func sameOrigin(r *http.Request) bool {
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Header.Get("Referer")
+	}
+	if source == "" {
+		return true
+	}
+
+	sourceURL, err := url.Parse(source)
+	if err != nil || sourceURL.Host == "" {
+		return false
+	}
+	return strings.EqualFold(sourceURL.Host, r.Host)
+}
+
+// validCSRFToken reports whether the request sent back the CSRF token of the session
+func validCSRFToken(r *http.Request, sessionToken string) bool {
+	token := r.Header.Get(CSRFHeader)
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(account.CSRFToken(sessionToken))) == 1
+}
+
+// requireSameOrigin only lets requests that change something through to the handler if they came from a page of this site.
+// It protects the handlers used before there is a session, which have no CSRF token to check.
+func (s *Server) requireSameOrigin(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if changesState(r.Method) && !sameOrigin(r) {
+			http.Error(w, "requests from other sites are not allowed", http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// checkSessionRequest checks that a request made with the session cookie, if it changes something,
+// came from a page of this site that was given the session's CSRF token, and writes the error if it didn't.
+// It reports whether the request can go through.
+func checkSessionRequest(w http.ResponseWriter, r *http.Request, sessionToken string) bool {
+	if !changesState(r.Method) {
+		return true
+	}
+	if !sameOrigin(r) {
+		http.Error(w, "requests from other sites are not allowed", http.StatusForbidden)
+		return false
+	}
+	if !validCSRFToken(r, sessionToken) {
+		http.Error(w, "missing or invalid CSRF token, reload the page", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// setSessionCookies sets the session cookie and the cookie the web UI reads the session's CSRF token from
+func setSessionCookies(w http.ResponseWriter, r *http.Request, sessionToken string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    sessionToken,
+		Path:     "/",
+		Expires:  expires,
+		Secure:   secureRequest(r),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	setCSRFCookie(w, r, sessionToken, expires)
+}
+
+// setCSRFCookie sets the cookie the web UI reads the session's CSRF token from
+func setCSRFCookie(w http.ResponseWriter, r *http.Request, sessionToken string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookie,
+		Value:    account.CSRFToken(sessionToken),
+		Path:     "/",
+		Expires:  expires,
+		Secure:   secureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// clearSessionCookies removes the session and CSRF cookies from the browser
+func clearSessionCookies(w http.ResponseWriter, r *http.Request) {
+	for _, name := range []string{SessionCookie, CSRFCookie} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    "",
+			Path:     "/",
+			MaxAge:   -1,
+			Secure:   secureRequest(r),
+			HttpOnly: name == SessionCookie,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+}
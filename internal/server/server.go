@@ -1,16 +1,31 @@
 package server
 
 import (
+	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/Catzkorn/subscrypt/internal/account"
 	"github.com/Catzkorn/subscrypt/internal/calendar"
+	"github.com/Catzkorn/subscrypt/internal/catalogue"
 	"github.com/Catzkorn/subscrypt/internal/email"
+	"github.com/Catzkorn/subscrypt/internal/merchant"
 	"github.com/Catzkorn/subscrypt/internal/plaid"
 	"github.com/Catzkorn/subscrypt/internal/reminder"
+	"github.com/Catzkorn/subscrypt/internal/statement"
 	"github.com/Catzkorn/subscrypt/internal/subscription"
+	"github.com/Catzkorn/subscrypt/internal/transaction"
 	"github.com/Catzkorn/subscrypt/internal/userprofile"
 )
 
@@ -19,15 +34,74 @@ const JSONContentType = "application/json"
 
 // Server is the HTTP interface for subscription information
 type Server struct {
-	dataStore      DataStore
-	router         *http.ServeMux
-	mailer         email.Mailer
-	transactionAPI TransactionAPI
+	dataStore     DataStore
+	router        *http.ServeMux
+	mailer        email.Mailer
+	sources       *Sources
+	merchants     *catalogue.Catalogue
+	adminToken    string
+	plaidWebhooks PlaidWebhooks
+	sso           SingleSignOn
+	noPasswords   bool
+	webhookSyncs  sync.WaitGroup
+	syncLocks     map[int]*sync.Mutex
+	syncLocksLock sync.Mutex
 }
 
-// TransactionAPI defines the transaction api interface
+// Option configures optional parts of a Server
+type Option func(*Server)
+
+// WithCatalogue sets the catalogue of known merchants used to detect and describe subscriptions
+func WithCatalogue(merchants *catalogue.Catalogue) Option {
+	return func(s *Server) {
+		s.merchants = merchants
+	}
+}
+
+// WithAdminToken enables the admin API for requests that send the token as a bearer token
+func WithAdminToken(token string) Option {
+	return func(s *Server) {
+		s.adminToken = token
+	}
+}
+
+// WithPlaidWebhooks enables the Plaid webhook endpoint, which imports transactions as soon as Plaid reports new ones
+func WithPlaidWebhooks(webhooks PlaidWebhooks) Option {
+	return func(s *Server) {
+		s.plaidWebhooks = webhooks
+	}
+}
+
+// PlaidWebhooks verifies webhooks from Plaid, records the errors it reports for linked banks
+// and finds a linked bank, whose source imports a webhook's updates for the user who linked it
+type PlaidWebhooks interface {
+	VerifyWebhook(ctx context.Context, body []byte, token string) error
+	SetItemStatus(ctx context.Context, itemID string, status string) error
+	LinkedItem(ctx context.Context, itemID string) (*plaid.Item, error)
+}
+
+// BankLinks is a TransactionAPI that lists and removes the banks the logged in user linked to import transactions from
+type BankLinks interface {
+	Items(ctx context.Context) ([]plaid.Item, error)
+	Unlink(ctx context.Context, ID int) error
+}
+
+// TransactionAPI is a source of transactions to import for the user logged in to the context
 type TransactionAPI interface {
-	GetTransactions() (plaid.TransactionList, error)
+	GetTransactions(ctx context.Context) (plaid.TransactionList, error)
+}
+
+// TransactionSyncer is a TransactionAPI that can return only the transactions that changed since it was last asked.
+// The changes are returned again until they are given to SaveCursors, which is done once they are stored.
+type TransactionSyncer interface {
+	SyncTransactions(ctx context.Context) (plaid.TransactionChanges, error)
+	SaveCursors(ctx context.Context, changes plaid.TransactionChanges) error
+}
+
+// ItemSyncer is a TransactionSyncer that can return the changes of just one of the banks it linked, without linking any
+type ItemSyncer interface {
+	TransactionSyncer
+	SyncItem(ctx context.Context, itemID string) (plaid.TransactionChanges, error)
 }
 
 // IndexPageData defines data shown on the page
@@ -38,29 +112,97 @@ type IndexPageData struct {
 }
 
 // DataStore provides an interface to store information about individual subscriptions
+// Subscriptions and their renewals, merchant aliases, candidates, rejected merchants and transactions belong to
+// the user whose ID they are stored with, and are only returned, changed or deleted for that user.
 type DataStore interface {
-	GetSubscriptions() ([]subscription.Subscription, error)
-	RecordSubscription(subscription subscription.Subscription) (*subscription.Subscription, error)
-	DeleteSubscription(ID int) error
-	GetSubscription(ID int) (*subscription.Subscription, error)
-	RecordUserDetails(name string, email string) (*userprofile.Userprofile, error)
-	GetUserDetails() (*userprofile.Userprofile, error)
+	GetSubscriptions(ctx context.Context, userID int) ([]subscription.Subscription, error)
+	RecordSubscription(ctx context.Context, userID int, subscription subscription.Subscription) (*subscription.Subscription, error)
+	DeleteSubscription(ctx context.Context, userID int, ID int) error
+	GetSubscription(ctx context.Context, userID int, ID int) (*subscription.Subscription, error)
+	UpdateSubscription(ctx context.Context, userID int, subscription subscription.Subscription) (*subscription.Subscription, error)
+	RenewSubscription(ctx context.Context, userID int, ID int, dateDue time.Time, renewals []subscription.Renewal) error
+	GetRenewals(ctx context.Context, userID int, subscriptionID int) ([]subscription.Renewal, error)
+	GetMerchantAliases(ctx context.Context, userID int) ([]merchant.Alias, error)
+	RecordMerchantAlias(ctx context.Context, userID int, alias merchant.Alias) (*merchant.Alias, error)
+	DeleteMerchantAlias(ctx context.Context, userID int, ID int) error
+	RecordCandidate(ctx context.Context, userID int, candidate subscription.Candidate) (*subscription.Candidate, error)
+	GetCandidates(ctx context.Context, userID int) ([]subscription.Candidate, error)
+	GetCandidate(ctx context.Context, userID int, ID int) (*subscription.Candidate, error)
+	DeleteCandidate(ctx context.Context, userID int, ID int) error
+	RejectMerchant(ctx context.Context, userID int, merchant string) error
+	GetRejectedMerchants(ctx context.Context, userID int) ([]string, error)
+	DeleteRejectedMerchant(ctx context.Context, userID int, merchant string) error
+	RecordTransactions(ctx context.Context, userID int, transactions []transaction.Transaction) error
+	GetTransactions(ctx context.Context, userID int) ([]transaction.Transaction, error)
+	DeleteTransactions(ctx context.Context, userID int, externalIDs []string) error
+	MatchPayments(ctx context.Context, userID int, subscriptionID int, externalIDs []string) error
+	CreateUser(ctx context.Context, name string, email string, passwordHash string) (*userprofile.Userprofile, error)
+	GetUserByEmail(ctx context.Context, email string) (*userprofile.Userprofile, error)
+	RecordUserDetails(ctx context.Context, userID int, name string, email string) (*userprofile.Userprofile, error)
+	GetUserDetails(ctx context.Context, userID int) (*userprofile.Userprofile, error)
+	CreateSession(ctx context.Context, session account.Session) error
+	GetSession(ctx context.Context, tokenHash string) (*account.Session, error)
+	DeleteSession(ctx context.Context, tokenHash string) error
+	GetUserByIdentity(ctx context.Context, issuer string, subject string) (*userprofile.Userprofile, error)
+	CreateUserWithIdentity(ctx context.Context, name string, email string, issuer string, subject string) (*userprofile.Userprofile, error)
+	CreateAPIToken(ctx context.Context, token account.APIToken) (*account.APIToken, error)
+	GetAPITokens(ctx context.Context, userID int) ([]account.APIToken, error)
+	GetAPITokenByHash(ctx context.Context, tokenHash string) (*account.APIToken, error)
+	DeleteAPIToken(ctx context.Context, userID int, ID int) error
+	RecordAPITokenUse(ctx context.Context, userID int, ID int, usedAt time.Time) error
 }
 
-// NewServer returns a instance of a Server
-func NewServer(dataStore DataStore, mailer email.Mailer, transactionAPI TransactionAPI) *Server {
-	s := &Server{dataStore: dataStore, router: http.NewServeMux(), transactionAPI: transactionAPI}
+// NewServer returns a instance of a Server that imports transactions from the given sources
+// Without a catalogue option the server starts with an empty catalogue of known merchants.
+// Every API other than signing up, logging in and out, single sign on, the merchant catalogue, the admin API
+// and Plaid's webhooks needs a logged in user, or one of their API tokens sent as a bearer token.
+func NewServer(dataStore DataStore, mailer email.Mailer, sources *Sources, options ...Option) *Server {
+	if sources == nil {
+		sources = NewSources()
+	}
+	s := &Server{dataStore: dataStore, router: http.NewServeMux(), sources: sources}
+	for _, option := range options {
+		option(s)
+	}
+	if s.merchants == nil {
+		s.merchants = catalogue.New(nil)
+	}
 
 	s.router.Handle("/transactions/", http.HandlerFunc(s.transactionsHandler))
 
 	s.router.Handle("/web/", http.StripPrefix("/web/", http.FileServer(http.Dir("web"))))
 	s.router.Handle("/", http.HandlerFunc(s.indexHandler))
-	s.router.Handle("/api/reminders", http.HandlerFunc(s.reminderHandler))
-	s.router.Handle("/api/subscriptions", http.HandlerFunc(s.subscriptionsAPIHandler))
-	s.router.Handle("/api/subscriptions/", http.HandlerFunc(s.subscriptionIDAPIHandler))
-	s.router.Handle("/api/transactions/load-subscriptions", http.HandlerFunc(s.transactionAPIHandler))
-	s.router.Handle("/api/users", http.HandlerFunc(s.userHandler))
-	s.router.Handle("/api/transactions", http.HandlerFunc(s.listTransactionAPIHandler))
+	s.router.Handle("/api/signup", s.requireSameOrigin(http.HandlerFunc(s.signupHandler)))
+	s.router.Handle("/api/login", s.requireSameOrigin(http.HandlerFunc(s.loginHandler)))
+	s.router.Handle("/api/logout", s.requireSameOrigin(http.HandlerFunc(s.logoutHandler)))
+	s.router.Handle("/api/sso/login", http.HandlerFunc(s.ssoLoginHandler))
+	s.router.Handle("/api/sso/callback", http.HandlerFunc(s.ssoCallbackHandler))
+	s.router.Handle("/api/tokens", s.requireUser(http.HandlerFunc(s.tokensAPIHandler)))
+	s.router.Handle("/api/tokens/", s.requireUser(http.HandlerFunc(s.tokenIDAPIHandler)))
+	s.router.Handle("/api/reminders", s.requireUser(http.HandlerFunc(s.reminderHandler)))
+	s.router.Handle("/api/subscriptions", s.requireUser(http.HandlerFunc(s.subscriptionsAPIHandler)))
+	s.router.Handle("/api/subscriptions/", s.requireUser(http.HandlerFunc(s.subscriptionIDAPIHandler)))
+	s.router.Handle("/api/transactions/load-subscriptions", s.requireUser(http.HandlerFunc(s.transactionAPIHandler)))
+	s.router.Handle("/api/statements/csv", s.requireUser(http.HandlerFunc(s.csvStatementAPIHandler)))
+	s.router.Handle("/api/statements/ofx", s.requireUser(s.statementAPIHandler(statement.ParseOFX)))
+	s.router.Handle("/api/statements/camt053", s.requireUser(s.statementAPIHandler(statement.ParseCAMT053)))
+	s.router.Handle("/api/statements/mt940", s.requireUser(s.statementAPIHandler(statement.ParseMT940)))
+	s.router.Handle("/api/users", s.requireUser(http.HandlerFunc(s.userHandler)))
+	s.router.Handle("/api/transactions", s.requireUser(http.HandlerFunc(s.listTransactionAPIHandler)))
+	s.router.Handle("/api/merchant-aliases", s.requireUser(http.HandlerFunc(s.merchantAliasesAPIHandler)))
+	s.router.Handle("/api/merchant-aliases/", s.requireUser(http.HandlerFunc(s.merchantAliasIDAPIHandler)))
+	s.router.Handle("/api/candidates", s.requireUser(http.HandlerFunc(s.candidatesAPIHandler)))
+	s.router.Handle("/api/candidates/", s.requireUser(http.HandlerFunc(s.candidateIDAPIHandler)))
+	s.router.Handle("/api/rejected-merchants", s.requireUser(http.HandlerFunc(s.rejectedMerchantsAPIHandler)))
+	s.router.Handle("/api/rejected-merchants/", s.requireUser(http.HandlerFunc(s.rejectedMerchantAPIHandler)))
+	s.router.Handle("/api/sources", s.requireUser(http.HandlerFunc(s.sourcesAPIHandler)))
+	s.router.Handle("/api/sources/", s.requireUser(http.HandlerFunc(s.sourceImportAPIHandler)))
+	s.router.Handle("/api/linked-banks", s.requireUser(http.HandlerFunc(s.linkedBanksAPIHandler)))
+	s.router.Handle("/api/linked-banks/", s.requireUser(http.HandlerFunc(s.linkedBankIDAPIHandler)))
+	s.router.Handle("/api/webhooks/plaid", http.HandlerFunc(s.plaidWebhookHandler))
+	s.router.Handle("/api/merchant-catalogue", http.HandlerFunc(s.merchantCatalogueAPIHandler))
+	s.router.Handle("/api/admin/merchant-catalogue", s.requireAdmin(http.HandlerFunc(s.adminMerchantCatalogueHandler)))
+	s.router.Handle("/api/admin/merchant-catalogue/", s.requireAdmin(http.HandlerFunc(s.adminMerchantCatalogueEntryHandler)))
 
 	s.mailer = mailer
 
@@ -79,17 +221,20 @@ func (s *Server) processGetTransactionPage(w http.ResponseWriter, r *http.Reques
 	http.ServeFile(w, r, "./web/transactions.html")
 }
 
-// listTransactionAPIHandler returns a list of transactions from the API in JSON format
+// listTransactionAPIHandler returns the user's imported transactions in JSON format
 func (s *Server) listTransactionAPIHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		w.Header().Set("content-type", JSONContentType)
-		transactions, err := s.transactionAPI.GetTransactions()
+		transactions, err := s.dataStore.GetTransactions(r.Context(), currentUser(r))
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		if transactions == nil {
+			transactions = []transaction.Transaction{}
+		}
 
+		w.Header().Set("content-type", JSONContentType)
 		err = json.NewEncoder(w).Encode(transactions)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -98,25 +243,392 @@ func (s *Server) listTransactionAPIHandler(w http.ResponseWriter, r *http.Reques
 	}
 }
 
-// transactionsAPIHandler calls the Plaid API to get a list of transactions and then stores relevant subscriptions in the database
+// transactionAPIError writes the response for an error getting transactions from the bank
+func transactionAPIError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, plaid.ErrItemLoginRequired):
+		http.Error(w, "your bank needs you to log in again before transactions can be imported", http.StatusConflict)
+	case errors.Is(err, plaid.ErrLinkRequired):
+		http.Error(w, "link a bank before importing transactions", http.StatusConflict)
+	case errors.Is(err, plaid.ErrInstitutionDown):
+		http.Error(w, "your bank is not available at the moment, please try again later", http.StatusServiceUnavailable)
+	case errors.Is(err, plaid.ErrProductNotReady):
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "your bank is still preparing your transactions, please try again shortly", http.StatusServiceUnavailable)
+	case errors.Is(err, plaid.ErrRateLimit):
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "too many requests to the bank, please try again in a minute", http.StatusTooManyRequests)
+	case errors.Is(err, plaid.ErrAuth):
+		http.Error(w, "the bank connection is not configured correctly", http.StatusBadGateway)
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		http.Error(w, "timed out waiting for the bank", http.StatusGatewayTimeout)
+	default:
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	}
+}
+
+// transactionsAPIHandler imports the new and changed transactions from the default source, stores them and then queues
+// the subscriptions detected in them for review. Merchants that already have a subscription or were rejected are skipped.
+// It returns the candidates waiting for review as json
 func (s *Server) transactionAPIHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodPost:
-		transactions, err := s.transactionAPI.GetTransactions()
+		s.processImport(w, r, "")
+	}
+}
+
+// sourcesAPIHandler returns the transaction sources that can be imported from in JSON format
+func (s *Server) sourcesAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		return
+	}
+
+	w.Header().Set("content-type", JSONContentType)
+	err := json.NewEncoder(w).Encode(s.sources.List())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// sourceImportAPIHandler handles the routing logic for the '/api/sources/:name/import' paths
+// Posting to it imports the transactions of the named source like '/api/transactions/load-subscriptions'.
+func (s *Server) sourceImportAPIHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/api/sources/")
+	if !strings.HasSuffix(name, "/import") {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		s.processImport(w, r, strings.TrimSuffix(name, "/import"))
+	}
+}
+
+// processImport imports the new and changed transactions from the named source, or the default source if the name
+// is empty, and queues the subscriptions detected in them for review, then writes the candidates waiting for review
+func (s *Server) processImport(w http.ResponseWriter, r *http.Request, source string) {
+	api, err := s.sources.Get(source)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	lock := s.syncLock(currentUser(r))
+	lock.Lock()
+	defer lock.Unlock()
+
+	changes, err := transactionChanges(r.Context(), api)
+	if err != nil {
+		transactionAPIError(w, err)
+		return
+	}
+
+	err = s.processTransactionChanges(r.Context(), currentUser(r), changes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = saveCursors(r.Context(), api, changes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.processGetCandidates(w, r)
+}
+
+// maxStatementSize is the largest statement upload that is read
+const maxStatementSize = 10 << 20
+
+// csvStatementAPIHandler imports the transactions of a CSV bank statement uploaded as the 'statement' field of
+// a multipart form, and queues the subscriptions detected in them for review like the transactions of a linked bank.
+// The columns are read using the preset named by the 'bank' field, with any of the mapping's fields
+// overridden by form fields of the same name.
+// It returns the candidates waiting for review as json
+func (s *Server) csvStatementAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		return
+	}
+
+	file, err := statementFile(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	mapping, err := statementMapping(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.processStatement(w, r, file, func(r io.Reader) (plaid.TransactionList, error) {
+		return statement.ParseCSV(r, mapping)
+	})
+}
+
+// statementAPIHandler returns a handler that imports the transactions of a statement read by parse, uploaded as
+// the 'statement' field of a multipart form, and queues the subscriptions detected in them for review.
+// The handler returns the candidates waiting for review as json
+func (s *Server) statementAPIHandler(parse statement.Parser) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			return
+		}
+
+		file, err := statementFile(w, r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		defer file.Close()
 
-		subscriptions := subscription.ProcessTransactions(transactions)
-		for _, entry := range subscriptions {
-			_, err = s.dataStore.RecordSubscription(entry)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
+		s.processStatement(w, r, file, parse)
+	}
+}
+
+// statementFile returns the statement uploaded in the 'statement' field of the request's multipart form
+func statementFile(w http.ResponseWriter, r *http.Request) (multipart.File, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxStatementSize)
+	err := r.ParseMultipartForm(maxStatementSize)
+	if err != nil {
+		return nil, err
+	}
+
+	file, _, err := r.FormFile("statement")
+	return file, err
+}
+
+// processStatement reads the transactions from a statement the user uploaded, stores them and queues the subscriptions
+// detected in them for review, then writes the candidates waiting for review.
+// It holds the user's sync lock while storing them, so it doesn't run alongside an import from a bank.
+func (s *Server) processStatement(w http.ResponseWriter, r *http.Request, file io.Reader, parse statement.Parser) {
+	transactions, err := parse(file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lock := s.syncLock(currentUser(r))
+	lock.Lock()
+	defer lock.Unlock()
+
+	err = s.processTransactionChanges(r.Context(), currentUser(r), plaid.TransactionChanges{Added: transactions.Transactions})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.processGetCandidates(w, r)
+}
+
+// statementMapping returns the mapping of the uploaded statement's columns from the bank preset and form fields
+func statementMapping(r *http.Request) (statement.Mapping, error) {
+	var mapping statement.Mapping
+	if bank := r.FormValue("bank"); bank != "" {
+		preset, ok := statement.Presets[strings.ToLower(bank)]
+		if !ok {
+			return statement.Mapping{}, fmt.Errorf("no statement preset for bank %q", bank)
+		}
+		mapping = preset
+	}
+
+	fields := map[string]*string{
+		"date":            &mapping.Date,
+		"description":     &mapping.Description,
+		"amount":          &mapping.Amount,
+		"debit":           &mapping.Debit,
+		"credit":          &mapping.Credit,
+		"dateFormat":      &mapping.DateFormat,
+		"id":              &mapping.ID,
+		"account":         &mapping.Account,
+		"currency":        &mapping.Currency,
+		"defaultCurrency": &mapping.DefaultCurrency,
+	}
+	for name, field := range fields {
+		if value := r.FormValue(name); value != "" {
+			*field = value
+		}
+	}
+	if sign := r.FormValue("sign"); sign != "" {
+		mapping.Sign = statement.Sign(sign)
+	}
+	if noHeader := r.FormValue("noHeader"); noHeader != "" {
+		mapping.NoHeader = noHeader == "true"
+	}
+
+	return mapping, mapping.Validate()
+}
+
+// processTransactionChanges stores the user's changed transactions, matches them to the user's subscriptions
+// and queues the subscriptions detected for the merchants paid in the new and changed ones for the user to review.
+// Detection runs over every stored payment to those merchants, so a single new payment adds to the history before it.
+func (s *Server) processTransactionChanges(ctx context.Context, userID int, changes plaid.TransactionChanges) error {
+	resolver, err := s.merchantResolver(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = s.storeTransactions(ctx, userID, changes, resolver)
+	if err != nil {
+		return err
+	}
+
+	err = s.matchPayments(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	known, err := s.knownMerchants(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	history, err := s.changedMerchantHistory(ctx, userID, changes, resolver)
+	if err != nil {
+		return err
+	}
+
+	for _, candidate := range subscription.DetectSubscriptions(history, resolver, s.merchants) {
+		if known[candidate.Merchant] {
+			continue
+		}
+		_, err = s.dataStore.RecordCandidate(ctx, userID, candidate)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// changedMerchantHistory returns the user's stored transactions paid to the merchants in the added and modified transactions
+func (s *Server) changedMerchantHistory(ctx context.Context, userID int, changes plaid.TransactionChanges, resolver *merchant.Resolver) (plaid.TransactionList, error) {
+	changed := map[string]bool{}
+	for _, t := range append(changes.Added, changes.Modified...) {
+		changed[s.merchantName(resolver, t.Name)] = true
+	}
+
+	stored, err := s.dataStore.GetTransactions(ctx, userID)
+	if err != nil {
+		return plaid.TransactionList{}, fmt.Errorf("unable to get stored transactions: %w", err)
+	}
+
+	var history []transaction.Transaction
+	for _, t := range stored {
+		if changed[t.Merchant] {
+			history = append(history, t)
+		}
+	}
+	return transaction.List(history), nil
+}
+
+// transactionChanges returns the transactions added, modified and removed since the last import from the source.
+// If the source can't sync, every transaction is returned as added.
+func transactionChanges(ctx context.Context, api TransactionAPI) (plaid.TransactionChanges, error) {
+	if syncer, ok := api.(TransactionSyncer); ok {
+		return syncer.SyncTransactions(ctx)
+	}
+
+	transactions, err := api.GetTransactions(ctx)
+	if err != nil {
+		return plaid.TransactionChanges{}, err
+	}
+	return plaid.TransactionChanges{Added: transactions.Transactions}, nil
+}
+
+// saveCursors marks the changes as imported once they are stored, if the source syncs,
+// so the next import from the source carries on after them rather than returning them again
+func saveCursors(ctx context.Context, api TransactionAPI, changes plaid.TransactionChanges) error {
+	if syncer, ok := api.(TransactionSyncer); ok {
+		return syncer.SaveCursors(ctx, changes)
+	}
+	return nil
+}
+
+// storeTransactions stores the user's added and modified transactions and deletes the ones the bank removed.
+// Transactions with a date that can't be read are not stored.
+func (s *Server) storeTransactions(ctx context.Context, userID int, changes plaid.TransactionChanges, resolver *merchant.Resolver) error {
+	var stored []transaction.Transaction
+	for _, t := range append(changes.Added, changes.Modified...) {
+		converted, err := transaction.FromPlaid(t, s.merchantName(resolver, t.Name))
+		if err != nil {
+			continue
+		}
+		stored = append(stored, converted)
+	}
+
+	err := s.dataStore.RecordTransactions(ctx, userID, stored)
+	if err != nil {
+		return fmt.Errorf("unable to store transactions: %w", err)
+	}
+
+	if len(changes.Removed) > 0 {
+		err = s.dataStore.DeleteTransactions(ctx, userID, changes.Removed)
+		if err != nil {
+			return fmt.Errorf("unable to delete removed transactions: %w", err)
+		}
+	}
+	return nil
+}
+
+// matchPayments matches the user's stored transactions that haven't been matched yet to the subscriptions they paid for
+func (s *Server) matchPayments(ctx context.Context, userID int) error {
+	subscriptions, err := s.dataStore.GetSubscriptions(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	transactions, err := s.dataStore.GetTransactions(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	matches := subscription.MatchPayments(subscriptions, transactions)
+	for _, sub := range subscriptions {
+		if len(matches[sub.ID]) == 0 {
+			continue
+		}
+		err = s.dataStore.MatchPayments(ctx, userID, sub.ID, matches[sub.ID])
+		if err != nil {
+			return fmt.Errorf("unable to match payments to subscription %d: %w", sub.ID, err)
 		}
 	}
+	return nil
+}
+
+// merchantName returns the canonical merchant of a bank descriptor, using the catalogue's name for known merchants
+func (s *Server) merchantName(resolver *merchant.Resolver, name string) string {
+	merchantName := resolver.Resolve(name)
+	if entry, ok := s.merchants.Match(merchantName); ok {
+		return entry.Merchant
+	}
+	return merchantName
+}
+
+// knownMerchants returns the merchants the user already has a subscription for or rejected
+func (s *Server) knownMerchants(ctx context.Context, userID int) (map[string]bool, error) {
+	known := map[string]bool{}
+
+	subscriptions, err := s.dataStore.GetSubscriptions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range subscriptions {
+		known[entry.Merchant] = true
+	}
+
+	rejected, err := s.dataStore.GetRejectedMerchants(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range rejected {
+		known[name] = true
+	}
+
+	return known, nil
 }
 
 // ServeHTTP implements the http handler interface
@@ -150,31 +662,38 @@ func (s *Server) processPostReminder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	subscription, err := s.dataStore.GetSubscription(newSubscription.ID)
+	subscription, err := s.dataStore.GetSubscription(r.Context(), currentUser(r), newSubscription.ID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if subscription == nil {
+		http.Error(w, "subscription not found", http.StatusNotFound)
+		return
+	}
 
-	user, err := s.dataStore.GetUserDetails()
+	user, err := s.dataStore.GetUserDetails(r.Context(), currentUser(r))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 	if user == nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		http.Error(w, "user not found", http.StatusBadRequest)
 		return
 	}
 
+	year, month, day := time.Now().Date()
+	dateDue := subscription.NextDue(time.Date(year, month, day, 0, 0, 0, 0, time.UTC))
+
 	newReminder = reminder.Reminder{
 		Email:          user.Email,
 		SubscriptionID: subscription.ID,
-		ReminderDate:   subscription.DateDue.AddDate(0, 0, -5),
+		ReminderDate:   dateDue.AddDate(0, 0, -5),
 	}
 
 	cal := calendar.CreateReminderInvite(*subscription, newReminder)
 
-	err = email.SendEmail(newReminder, *user, cal, s.mailer, s.dataStore)
+	err = email.SendEmail(r.Context(), newReminder, *user, cal, s.mailer, s.dataStore)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -186,7 +705,7 @@ func (s *Server) processPostReminder(w http.ResponseWriter, r *http.Request) {
 func (s *Server) subscriptionsAPIHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		s.processGetSubscriptions(w)
+		s.processGetSubscriptions(w, r)
 	case http.MethodPost:
 		s.processPostSubscription(w, r)
 	}
@@ -195,6 +714,10 @@ func (s *Server) subscriptionsAPIHandler(w http.ResponseWriter, r *http.Request)
 // subscriptionIDAPIHandler handles the routing logic for the '/api/subscriptions/:id' paths
 func (s *Server) subscriptionIDAPIHandler(w http.ResponseWriter, r *http.Request) {
 	urlID := strings.TrimPrefix(r.URL.Path, "/api/subscriptions/")
+	var resource string
+	if index := strings.Index(urlID, "/"); index != -1 {
+		urlID, resource = urlID[:index], urlID[index+1:]
+	}
 	ID, err := strconv.Atoi(urlID)
 
 	if err != nil {
@@ -202,8 +725,21 @@ func (s *Server) subscriptionIDAPIHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if r.Method == http.MethodDelete {
-		s.processDeleteSubscription(w, ID)
+	switch {
+	case resource == "" && r.Method == http.MethodGet:
+		s.processGetSubscription(w, r, ID)
+	case resource == "" && r.Method == http.MethodPut:
+		s.processPutSubscription(w, r, ID)
+	case resource == "" && r.Method == http.MethodPatch:
+		s.processPatchSubscription(w, r, ID)
+	case resource == "" && r.Method == http.MethodDelete:
+		s.processDeleteSubscription(w, r, ID)
+	case resource == "renewals" && r.Method == http.MethodGet:
+		s.processGetRenewals(w, r, ID)
+	case resource == "payments" && r.Method == http.MethodGet:
+		s.processGetPayments(w, r, ID)
+	case resource != "" && resource != "renewals" && resource != "payments":
+		http.NotFound(w, r)
 	}
 }
 
@@ -211,17 +747,17 @@ func (s *Server) subscriptionIDAPIHandler(w http.ResponseWriter, r *http.Request
 func (s *Server) userHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		s.processGetUser(w)
+		s.processGetUser(w, r)
 	case http.MethodPost:
 		s.processPostUser(w, r)
 	}
 }
 
-// processGetUser processes the get /api/users request and returns the user
-func (s *Server) processGetUser(w http.ResponseWriter) {
+// processGetUser processes the get /api/users request and returns the logged in user
+func (s *Server) processGetUser(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", JSONContentType)
 
-	userInfo, err := s.dataStore.GetUserDetails()
+	userInfo, err := s.dataStore.GetUserDetails(r.Context(), currentUser(r))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -234,7 +770,7 @@ func (s *Server) processGetUser(w http.ResponseWriter) {
 	}
 }
 
-// processPostUser processes the post /api/users request and records a users details
+// processPostUser processes the post /api/users request and records the logged in users details
 func (s *Server) processPostUser(w http.ResponseWriter, r *http.Request) {
 	var userProfile userprofile.Userprofile
 
@@ -244,8 +780,12 @@ func (s *Server) processPostUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = s.dataStore.RecordUserDetails(userProfile.Name, userProfile.Email)
-	if err != nil {
+	_, err = s.dataStore.RecordUserDetails(r.Context(), currentUser(r), strings.TrimSpace(userProfile.Name), normalizeEmail(userProfile.Email))
+	switch {
+	case errors.Is(err, account.ErrEmailTaken):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -259,10 +799,10 @@ func (s *Server) processGetIndex(w http.ResponseWriter, r *http.Request) {
 }
 
 // processGetSubscriptions processes the GET /api/subscriptions request
-// It returns the stored subscriptions as json
-func (s *Server) processGetSubscriptions(w http.ResponseWriter) {
+// It returns the user's subscriptions as json
+func (s *Server) processGetSubscriptions(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", JSONContentType)
-	subscriptions, err := s.dataStore.GetSubscriptions()
+	subscriptions, err := s.dataStore.GetSubscriptions(r.Context(), currentUser(r))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -277,13 +817,43 @@ func (s *Server) processGetSubscriptions(w http.ResponseWriter) {
 
 // processPostSubscription tells the SubscriptionStore to record the subscription from the post body
 func (s *Server) processPostSubscription(w http.ResponseWriter, r *http.Request) {
-	var subscription subscription.Subscription
-	err := json.NewDecoder(r.Body).Decode(&subscription)
+	var newSubscription subscription.Subscription
+	err := json.NewDecoder(r.Body).Decode(&newSubscription)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	_, err = s.dataStore.RecordSubscription(subscription)
+	newSubscription.Name = strings.TrimSpace(newSubscription.Name)
+	if newSubscription.Frequency == "" {
+		newSubscription.Frequency = subscription.DefaultFrequency
+	}
+
+	if newSubscription.Merchant == "" {
+		resolver, err := s.merchantResolver(r.Context(), currentUser(r))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		newSubscription.Merchant = s.merchantName(resolver, newSubscription.Name)
+	}
+
+	if entry, ok := s.merchants.Match(newSubscription.Merchant); ok && newSubscription.Category == "" {
+		newSubscription.Category = entry.Category
+	}
+
+	err = newSubscription.Validate()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, err = s.dataStore.RecordSubscription(r.Context(), currentUser(r), newSubscription)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = s.matchPayments(r.Context(), currentUser(r))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -291,24 +861,808 @@ func (s *Server) processPostSubscription(w http.ResponseWriter, r *http.Request)
 	defer r.Body.Close()
 }
 
-// processDeleteSubscription tells the SubscriptionStore to delete the subscription with the given ID
-func (s *Server) processDeleteSubscription(w http.ResponseWriter, ID int) {
-	retrievedSubscription, err := s.dataStore.GetSubscription(ID)
-
+// processGetSubscription processes the GET /api/subscriptions/:id request and returns the subscription as json
+func (s *Server) processGetSubscription(w http.ResponseWriter, r *http.Request, ID int) {
+	retrievedSubscription, err := s.dataStore.GetSubscription(r.Context(), currentUser(r), ID)
 	switch {
 	case err != nil:
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	case retrievedSubscription == nil:
-		errorMessage := "Failed to delete subscription - subscription not found"
-		http.Error(w, errorMessage, http.StatusNotFound)
+		http.Error(w, "subscription not found", http.StatusNotFound)
 		return
-	default:
-		err = s.dataStore.DeleteSubscription(retrievedSubscription.ID)
+	}
+
+	w.Header().Set("content-type", JSONContentType)
+	err = json.NewEncoder(w).Encode(retrievedSubscription)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// processPutSubscription processes the PUT /api/subscriptions/:id request, replacing the subscription with the one in the body
+// Like a new subscription, its merchant is resolved from its name and its category is defaulted from the catalogue when they're left out.
+func (s *Server) processPutSubscription(w http.ResponseWriter, r *http.Request, ID int) {
+	if !s.subscriptionExists(w, r, ID) {
+		return
+	}
+
+	var replacement subscription.Subscription
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&replacement)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if replacement.ID != 0 && replacement.ID != ID {
+		http.Error(w, "a subscription's ID can't be changed", http.StatusBadRequest)
+		return
+	}
+	replacement.ID = ID
+
+	if replacement.Merchant == "" {
+		resolver, err := s.merchantResolver(r.Context(), currentUser(r))
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		w.WriteHeader(http.StatusOK)
+		replacement.Merchant = s.merchantName(resolver, replacement.Name)
+	}
+	if entry, ok := s.merchants.Match(replacement.Merchant); ok && replacement.Category == "" {
+		replacement.Category = entry.Category
+	}
+
+	s.processUpdateSubscription(w, r, replacement)
+}
+
+// processPatchSubscription processes the PATCH /api/subscriptions/:id request, changing only the fields in the body
+func (s *Server) processPatchSubscription(w http.ResponseWriter, r *http.Request, ID int) {
+	existing, err := s.dataStore.GetSubscription(r.Context(), currentUser(r), ID)
+	switch {
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	case existing == nil:
+		http.Error(w, "subscription not found", http.StatusNotFound)
+		return
+	}
+
+	var changes subscription.Changes
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&changes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.processUpdateSubscription(w, r, changes.Apply(*existing))
+}
+
+// processUpdateSubscription validates the edited subscription, stores it in place of the one with its ID,
+// which unmatches its payments, matches the user's payments again and returns the updated subscription as json
+func (s *Server) processUpdateSubscription(w http.ResponseWriter, r *http.Request, edited subscription.Subscription) {
+	edited.Name = strings.TrimSpace(edited.Name)
+	if edited.Frequency == "" {
+		edited.Frequency = subscription.DefaultFrequency
+	}
+	err := edited.Validate()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if edited.Interval == 0 {
+		edited.Interval = 1
+	}
+
+	updated, err := s.dataStore.UpdateSubscription(r.Context(), currentUser(r), edited)
+	switch {
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	case updated == nil:
+		http.Error(w, "subscription not found", http.StatusNotFound)
+		return
+	}
+
+	err = s.matchPayments(r.Context(), currentUser(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("content-type", JSONContentType)
+	err = json.NewEncoder(w).Encode(updated)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// subscriptionExists reports whether the user has a subscription with the ID, writing the error if they don't
+func (s *Server) subscriptionExists(w http.ResponseWriter, r *http.Request, ID int) bool {
+	retrievedSubscription, err := s.dataStore.GetSubscription(r.Context(), currentUser(r), ID)
+	switch {
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	case retrievedSubscription == nil:
+		http.Error(w, "subscription not found", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// processGetRenewals processes the GET /api/subscriptions/:id/renewals request
+// It returns the past due dates of the subscription as json
+func (s *Server) processGetRenewals(w http.ResponseWriter, r *http.Request, ID int) {
+	retrievedSubscription, err := s.dataStore.GetSubscription(r.Context(), currentUser(r), ID)
+	switch {
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	case retrievedSubscription == nil:
+		http.Error(w, "subscription not found", http.StatusNotFound)
+		return
+	}
+
+	renewals, err := s.dataStore.GetRenewals(r.Context(), currentUser(r), ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if renewals == nil {
+		renewals = []subscription.Renewal{}
+	}
+
+	w.Header().Set("content-type", JSONContentType)
+	err = json.NewEncoder(w).Encode(renewals)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// processGetPayments processes the GET /api/subscriptions/:id/payments request
+// It returns the transactions that paid for the subscription as json, most recent first
+func (s *Server) processGetPayments(w http.ResponseWriter, r *http.Request, ID int) {
+	retrievedSubscription, err := s.dataStore.GetSubscription(r.Context(), currentUser(r), ID)
+	switch {
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	case retrievedSubscription == nil:
+		http.Error(w, "subscription not found", http.StatusNotFound)
+		return
+	}
+
+	payments := retrievedSubscription.Payments
+	if payments == nil {
+		payments = []transaction.Transaction{}
+	}
+
+	w.Header().Set("content-type", JSONContentType)
+	err = json.NewEncoder(w).Encode(payments)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// processDeleteSubscription tells the SubscriptionStore to delete the user's subscription with the given ID
+func (s *Server) processDeleteSubscription(w http.ResponseWriter, r *http.Request, ID int) {
+	retrievedSubscription, err := s.dataStore.GetSubscription(r.Context(), currentUser(r), ID)
+
+	switch {
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	case retrievedSubscription == nil:
+		errorMessage := "Failed to delete subscription - subscription not found"
+		http.Error(w, errorMessage, http.StatusNotFound)
+		return
+	default:
+		err = s.dataStore.DeleteSubscription(r.Context(), currentUser(r), retrievedSubscription.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// merchantResolver returns a resolver that applies the merchant alias rules the user stored
+func (s *Server) merchantResolver(ctx context.Context, userID int) (*merchant.Resolver, error) {
+	aliases, err := s.dataStore.GetMerchantAliases(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return merchant.NewResolver(aliases), nil
+}
+
+// merchantAliasesAPIHandler handles the routing logic for the '/api/merchant-aliases' paths
+func (s *Server) merchantAliasesAPIHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.processGetMerchantAliases(w, r)
+	case http.MethodPost:
+		s.processPostMerchantAlias(w, r)
+	}
+}
+
+// merchantAliasIDAPIHandler handles the routing logic for the '/api/merchant-aliases/:id' paths
+func (s *Server) merchantAliasIDAPIHandler(w http.ResponseWriter, r *http.Request) {
+	urlID := strings.TrimPrefix(r.URL.Path, "/api/merchant-aliases/")
+	ID, err := strconv.Atoi(urlID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		err = s.dataStore.DeleteMerchantAlias(r.Context(), currentUser(r), ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// processGetMerchantAliases processes the GET /api/merchant-aliases request and returns the user's alias rules as json
+func (s *Server) processGetMerchantAliases(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", JSONContentType)
+	aliases, err := s.dataStore.GetMerchantAliases(r.Context(), currentUser(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if aliases == nil {
+		aliases = []merchant.Alias{}
+	}
+
+	err = json.NewEncoder(w).Encode(aliases)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// processPostMerchantAlias processes the POST /api/merchant-aliases request and records the alias rule from the post body
+func (s *Server) processPostMerchantAlias(w http.ResponseWriter, r *http.Request) {
+	var alias merchant.Alias
+	err := json.NewDecoder(r.Body).Decode(&alias)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if merchant.Normalize(alias.Pattern) == "" || merchant.Normalize(alias.Merchant) == "" {
+		http.Error(w, "a merchant alias needs a pattern and a merchant", http.StatusBadRequest)
+		return
+	}
+
+	recordedAlias, err := s.dataStore.RecordMerchantAlias(r.Context(), currentUser(r), alias)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("content-type", JSONContentType)
+	err = json.NewEncoder(w).Encode(recordedAlias)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// requireAdmin only lets requests carrying the admin token through to the handler
+func (s *Server) requireAdmin(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.adminToken == "" {
+			http.Error(w, "the admin API is disabled", http.StatusForbidden)
+			return
+		}
+
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			http.Error(w, "invalid admin token", http.StatusUnauthorized)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// merchantCatalogueAPIHandler handles the routing logic for the '/api/merchant-catalogue' path
+func (s *Server) merchantCatalogueAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		s.processGetMerchantCatalogue(w)
+	}
+}
+
+// adminMerchantCatalogueHandler handles the routing logic for the '/api/admin/merchant-catalogue' path
+func (s *Server) adminMerchantCatalogueHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.processGetMerchantCatalogue(w)
+	case http.MethodPost:
+		s.processPostCatalogueEntry(w, r)
+	}
+}
+
+// adminMerchantCatalogueEntryHandler handles the routing logic for the '/api/admin/merchant-catalogue/:merchant' paths
+func (s *Server) adminMerchantCatalogueEntryHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/api/admin/merchant-catalogue/")
+
+	if r.Method == http.MethodDelete {
+		err := s.merchants.Remove(name)
+		switch {
+		case errors.Is(err, catalogue.ErrNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}
+}
+
+// processGetMerchantCatalogue returns the known merchants as json
+func (s *Server) processGetMerchantCatalogue(w http.ResponseWriter) {
+	w.Header().Set("content-type", JSONContentType)
+	err := json.NewEncoder(w).Encode(s.merchants.Entries())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// processPostCatalogueEntry adds the merchant in the post body to the catalogue, replacing any existing entry for it
+func (s *Server) processPostCatalogueEntry(w http.ResponseWriter, r *http.Request) {
+	var entry catalogue.Entry
+	err := json.NewDecoder(r.Body).Decode(&entry)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if merchant.Normalize(entry.Merchant) == "" {
+		http.Error(w, "a catalogue entry needs a merchant", http.StatusBadRequest)
+		return
+	}
+
+	if entry.Frequency != "" {
+		interval := entry.Interval
+		if interval == 0 {
+			interval = 1
+		}
+		err = subscription.ValidateCadence(subscription.Frequency(entry.Frequency), interval)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	recordedEntry, err := s.merchants.Put(entry)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("content-type", JSONContentType)
+	err = json.NewEncoder(w).Encode(recordedEntry)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// candidatesAPIHandler handles the routing logic for the '/api/candidates' path
+func (s *Server) candidatesAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		s.processGetCandidates(w, r)
+	}
+}
+
+// candidateIDAPIHandler handles the routing logic for the '/api/candidates/:id/accept' and '/api/candidates/:id/reject' paths
+func (s *Server) candidateIDAPIHandler(w http.ResponseWriter, r *http.Request) {
+	urlID := strings.TrimPrefix(r.URL.Path, "/api/candidates/")
+	var action string
+	if index := strings.Index(urlID, "/"); index != -1 {
+		urlID, action = urlID[:index], urlID[index+1:]
+	}
+	ID, err := strconv.Atoi(urlID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if action != "accept" && action != "reject" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		return
+	}
+
+	candidate, err := s.dataStore.GetCandidate(r.Context(), currentUser(r), ID)
+	switch {
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	case candidate == nil:
+		http.Error(w, "candidate not found", http.StatusNotFound)
+		return
+	}
+
+	if action == "accept" {
+		s.processAcceptCandidate(w, r, *candidate)
+	} else {
+		s.processRejectCandidate(w, r, *candidate)
+	}
+}
+
+// processGetCandidates returns the detected subscriptions waiting for the user to review as json
+func (s *Server) processGetCandidates(w http.ResponseWriter, r *http.Request) {
+	candidates, err := s.dataStore.GetCandidates(r.Context(), currentUser(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if candidates == nil {
+		candidates = []subscription.Candidate{}
+	}
+
+	w.Header().Set("content-type", JSONContentType)
+	err = json.NewEncoder(w).Encode(candidates)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// processAcceptCandidate records the candidate as a subscription and takes it out of the review queue.
+// Fields of a subscription in the post body replace the detected ones, so the user can correct them before accepting.
+func (s *Server) processAcceptCandidate(w http.ResponseWriter, r *http.Request, candidate subscription.Candidate) {
+	accepted := candidate.Subscription
+	err := json.NewDecoder(r.Body).Decode(&accepted)
+	if err != nil && err != io.EOF {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	accepted.ID = 0
+
+	err = subscription.ValidateCadence(accepted.Frequency, accepted.Interval)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := currentUser(r)
+	recordedSubscription, err := s.dataStore.RecordSubscription(r.Context(), userID, accepted)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = s.dataStore.DeleteCandidate(r.Context(), userID, candidate.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = s.matchPayments(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("content-type", JSONContentType)
+	err = json.NewEncoder(w).Encode(recordedSubscription)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// processRejectCandidate takes the candidate out of the review queue and remembers its merchant is not a subscription
+func (s *Server) processRejectCandidate(w http.ResponseWriter, r *http.Request, candidate subscription.Candidate) {
+	err := s.dataStore.RejectMerchant(r.Context(), currentUser(r), candidate.Merchant)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = s.dataStore.DeleteCandidate(r.Context(), currentUser(r), candidate.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// rejectedMerchantsAPIHandler handles the routing logic for the '/api/rejected-merchants' path
+func (s *Server) rejectedMerchantsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		return
+	}
+
+	rejected, err := s.dataStore.GetRejectedMerchants(r.Context(), currentUser(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rejected == nil {
+		rejected = []string{}
+	}
+
+	w.Header().Set("content-type", JSONContentType)
+	err = json.NewEncoder(w).Encode(rejected)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// rejectedMerchantAPIHandler handles the routing logic for the '/api/rejected-merchants/:merchant' paths
+func (s *Server) rejectedMerchantAPIHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/api/rejected-merchants/")
+
+	if r.Method == http.MethodDelete {
+		err := s.dataStore.DeleteRejectedMerchant(r.Context(), currentUser(r), name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// linkedBanksAPIHandler handles the routing logic for the '/api/linked-banks' path
+// It lists the banks the user linked with every source that links banks.
+func (s *Server) linkedBanksAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		return
+	}
+
+	items := []plaid.Item{}
+	for _, bankLinks := range s.bankLinks() {
+		linked, err := bankLinks.Items(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		items = append(items, linked...)
+	}
+
+	w.Header().Set("content-type", JSONContentType)
+	err := json.NewEncoder(w).Encode(items)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// linkedBankIDAPIHandler handles the routing logic for the '/api/linked-banks/:id' paths
+// Deleting a linked bank removes it from Plaid and forgets its access token.
+func (s *Server) linkedBankIDAPIHandler(w http.ResponseWriter, r *http.Request) {
+	urlID := strings.TrimPrefix(r.URL.Path, "/api/linked-banks/")
+	ID, err := strconv.Atoi(urlID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		err = plaid.ErrItemNotFound
+		for _, bankLinks := range s.bankLinks() {
+			err = bankLinks.Unlink(r.Context(), ID)
+			if !errors.Is(err, plaid.ErrItemNotFound) {
+				break
+			}
+		}
+
+		switch {
+		case errors.Is(err, plaid.ErrItemNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case err != nil:
+			transactionAPIError(w, err)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}
+}
+
+// bankLinks returns the sources that link banks
+func (s *Server) bankLinks() []BankLinks {
+	var bankLinks []BankLinks
+	for _, api := range s.sources.all() {
+		if links, ok := api.(BankLinks); ok {
+			bankLinks = append(bankLinks, links)
+		}
+	}
+	return bankLinks
+}
+
+// maxWebhookSize is the largest webhook body that is read
+const maxWebhookSize = 1 << 20
+
+// plaidWebhookHandler handles the routing logic for the '/api/webhooks/plaid' path.
+// Webhooks are only accepted with a valid Plaid-Verification signature. TRANSACTIONS webhooks import the
+// changed transactions, and ITEM webhooks record or clear the error Plaid reports for the linked bank.
+func (s *Server) plaidWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		return
+	}
+	if s.plaidWebhooks == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxWebhookSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.plaidWebhooks.VerifyWebhook(r.Context(), body, r.Header.Get("Plaid-Verification"))
+	switch {
+	case errors.Is(err, plaid.ErrWebhookSignature):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	case err != nil:
+		transactionAPIError(w, err)
+		return
+	}
+
+	var webhook plaid.Webhook
+	err = json.Unmarshal(body, &webhook)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch webhook.Type {
+	case "TRANSACTIONS":
+		s.processTransactionsWebhook(w, r, webhook)
+	case "ITEM":
+		s.processItemWebhook(w, r, webhook)
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// processTransactionsWebhook imports the changed transactions when Plaid reports there are updates.
+// Only the bank's changes are imported, by the source that linked it, for the user who linked it.
+// Plaid sends a webhook again when the response is slow, so the import runs in the background after responding.
+func (s *Server) processTransactionsWebhook(w http.ResponseWriter, r *http.Request, webhook plaid.Webhook) {
+	switch webhook.Code {
+	case "SYNC_UPDATES_AVAILABLE", "INITIAL_UPDATE", "HISTORICAL_UPDATE", "DEFAULT_UPDATE", "TRANSACTIONS_REMOVED":
+	default:
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	item, err := s.linkedItem(r.Context(), webhook.ItemID)
+	switch {
+	case errors.Is(err, plaid.ErrItemNotFound):
+		w.WriteHeader(http.StatusOK)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.webhookSyncs.Add(1)
+	go func() {
+		defer s.webhookSyncs.Done()
+		err := s.syncItem(context.Background(), *item)
+		if err != nil {
+			log.Printf("failed to import transactions for linked bank %s: %v", webhook.ItemID, err)
+		}
+	}()
+	w.WriteHeader(http.StatusOK)
+}
+
+// syncItem imports the changed transactions of a linked bank from the source that linked it
+func (s *Server) syncItem(ctx context.Context, item plaid.Item) error {
+	lock := s.syncLock(item.UserID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	api, err := s.sources.Get(item.Source)
+	if err != nil {
+		return err
+	}
+	syncer, ok := api.(ItemSyncer)
+	if !ok {
+		return fmt.Errorf("transaction source %q can't sync a linked bank", item.Source)
+	}
+
+	changes, err := syncer.SyncItem(account.WithUser(ctx, item.UserID), item.ItemID)
+	if err != nil {
+		return err
+	}
+
+	err = s.processTransactionChanges(ctx, item.UserID, changes)
+	if err != nil {
+		return err
+	}
+	return syncer.SaveCursors(ctx, changes)
+}
+
+// syncLock returns the lock held while the user's transactions are imported,
+// so imports started together carry on from each other's sync cursor rather than reading the same changes twice
+func (s *Server) syncLock(userID int) *sync.Mutex {
+	s.syncLocksLock.Lock()
+	defer s.syncLocksLock.Unlock()
+
+	if s.syncLocks == nil {
+		s.syncLocks = map[int]*sync.Mutex{}
+	}
+	lock, ok := s.syncLocks[userID]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.syncLocks[userID] = lock
+	}
+	return lock
+}
+
+// processItemWebhook records the error Plaid reports for a linked bank, or clears it once the bank is working again
+func (s *Server) processItemWebhook(w http.ResponseWriter, r *http.Request, webhook plaid.Webhook) {
+	var status string
+	switch webhook.Code {
+	case "ERROR":
+		if webhook.Error == nil {
+			http.Error(w, "item error webhook without an error", http.StatusBadRequest)
+			return
+		}
+		status = webhook.Error.Code
+	case "PENDING_EXPIRATION", "USER_PERMISSION_REVOKED":
+		status = webhook.Code
+	case "LOGIN_REPAIRED":
+		status = ""
+	default:
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	for _, recorder := range s.plaidRecorders() {
+		err := recorder.SetItemStatus(r.Context(), webhook.ItemID, status)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, plaid.ErrItemNotFound) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// linkedItem returns the bank with the given Plaid item ID, with the user and source that linked it.
+// It returns plaid.ErrItemNotFound if none of the Plaid sources linked it.
+func (s *Server) linkedItem(ctx context.Context, itemID string) (*plaid.Item, error) {
+	for _, recorder := range s.plaidRecorders() {
+		item, err := recorder.LinkedItem(ctx, itemID)
+		if !errors.Is(err, plaid.ErrItemNotFound) {
+			return item, err
+		}
+	}
+	return nil, plaid.ErrItemNotFound
+}
+
+// plaidRecorders returns the webhook recorder and every Plaid source, since an item was linked
+// by one of the Plaid sources, which only finds its own items
+func (s *Server) plaidRecorders() []PlaidWebhooks {
+	recorders := []PlaidWebhooks{s.plaidWebhooks}
+	for _, api := range s.sources.all() {
+		if recorder, ok := api.(PlaidWebhooks); ok && recorder != s.plaidWebhooks {
+			recorders = append(recorders, recorder)
+		}
 	}
+	return recorders
 }
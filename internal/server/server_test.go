@@ -2,18 +2,31 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/Catzkorn/subscrypt/internal/account"
+	"github.com/Catzkorn/subscrypt/internal/catalogue"
+	"github.com/Catzkorn/subscrypt/internal/fakeidp"
+	"github.com/Catzkorn/subscrypt/internal/merchant"
+	"github.com/Catzkorn/subscrypt/internal/oidc"
 	"github.com/Catzkorn/subscrypt/internal/plaid"
+	"github.com/Catzkorn/subscrypt/internal/statement"
 
 	"github.com/Catzkorn/subscrypt/internal/subscription"
+	"github.com/Catzkorn/subscrypt/internal/transaction"
 	"github.com/Catzkorn/subscrypt/internal/userprofile"
 	"github.com/sendgrid/rest"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
@@ -29,307 +42,2361 @@ func (s *StubMailer) Send(email *mail.SGMailV3) (*rest.Response, error) {
 	return &rest.Response{StatusCode: http.StatusAccepted}, nil
 }
 
+// testUserID is the ID of the user logged in with testSessionToken
+const testUserID = 1
+
+// testSessionToken is the session token every StubDataStore has a session for
+const testSessionToken = "test-session-token"
+
 type StubDataStore struct {
-	subscriptions []subscription.Subscription
-	deleteCount   []int
-	userprofile   userprofile.Userprofile
+	subscriptions   []subscription.Subscription
+	deleteCount     []int
+	userprofile     userprofile.Userprofile
+	users           []userprofile.Userprofile
+	sessions        map[string]account.Session
+	deletedSessions []string
+	identities      map[string]int
+	apiTokens       []account.APIToken
+	recordedFor     []int
+	renewals        []subscription.Renewal
+	aliases         []merchant.Alias
+	candidates      []subscription.Candidate
+	rejected        []string
+	transactions    []transaction.Transaction
+	removed         []string
+	updated         []subscription.Subscription
+	recordErr       error
 }
 
-func (s *StubDataStore) GetSubscriptions() ([]subscription.Subscription, error) {
+func (s *StubDataStore) GetSubscriptions(ctx context.Context, userID int) ([]subscription.Subscription, error) {
+	if s.subscriptions != nil {
+		return s.subscriptions, nil
+	}
 	amount, _ := decimal.NewFromString("100.99")
 	return []subscription.Subscription{{ID: 1, Name: "Netflix", Amount: amount, DateDue: time.Date(2020, time.November, 11, 0, 0, 0, 0, time.UTC)}}, nil
 }
 
-func (s *StubDataStore) RecordSubscription(subscription subscription.Subscription) (*subscription.Subscription, error) {
+func (s *StubDataStore) RecordSubscription(ctx context.Context, userID int, subscription subscription.Subscription) (*subscription.Subscription, error) {
+	s.recordedFor = append(s.recordedFor, userID)
 	s.subscriptions = append(s.subscriptions, subscription)
 	return &subscription, nil
 }
 
-func (s *StubDataStore) GetSubscription(ID int) (*subscription.Subscription, error) {
+func (s *StubDataStore) GetSubscription(ctx context.Context, userID int, ID int) (*subscription.Subscription, error) {
 	amount, _ := decimal.NewFromString("100.99")
 	retrievedSubscription := subscription.Subscription{ID: 1, Name: "Netflix", Amount: amount, DateDue: time.Date(2020, time.November, 11, 0, 0, 0, 0, time.UTC)}
 	if ID != 1 {
 		return nil, nil
 	}
+	for _, t := range s.transactions {
+		if t.SubscriptionID == ID {
+			retrievedSubscription.Payments = append(retrievedSubscription.Payments, t)
+		}
+	}
 	return &retrievedSubscription, nil
 }
 
-func (s *StubDataStore) DeleteSubscription(ID int) error {
+func (s *StubDataStore) UpdateSubscription(ctx context.Context, userID int, sub subscription.Subscription) (*subscription.Subscription, error) {
+	if sub.ID != 1 {
+		return nil, nil
+	}
+	s.updated = append(s.updated, sub)
+	for index, existing := range s.subscriptions {
+		if existing.ID == sub.ID {
+			s.subscriptions[index] = sub
+		}
+	}
+	for index, t := range s.transactions {
+		if t.SubscriptionID == sub.ID {
+			s.transactions[index].SubscriptionID = 0
+		}
+	}
+	return &sub, nil
+}
+
+func (s *StubDataStore) DeleteSubscription(ctx context.Context, userID int, ID int) error {
 	s.deleteCount = append(s.deleteCount, ID)
 	return nil
 }
 
-func (s *StubDataStore) RecordUserDetails(name string, email string) (*userprofile.Userprofile, error) {
-	s.userprofile = userprofile.Userprofile{Name: name, Email: email}
-
-	return &s.userprofile, nil
+func (s *StubDataStore) RenewSubscription(ctx context.Context, userID int, ID int, dateDue time.Time, renewals []subscription.Renewal) error {
+	s.renewals = append(s.renewals, renewals...)
+	return nil
 }
-func (s *StubDataStore) GetUserDetails() (*userprofile.Userprofile, error) {
 
-	return &s.userprofile, nil
+func (s *StubDataStore) GetRenewals(ctx context.Context, userID int, subscriptionID int) ([]subscription.Renewal, error) {
+	return s.renewals, nil
 }
 
-type stubTransactionAPI struct {
-	transactionCount   int
+func (s *StubDataStore) GetMerchantAliases(ctx context.Context, userID int) ([]merchant.Alias, error) {
+	return s.aliases, nil
 }
 
-func (s *stubTransactionAPI) GetTransactions() (plaid.TransactionList, error) {
-	transactions := plaid.TransactionList{Transactions: []plaid.Transaction{{Amount: 9.99, Date: "2020-09-12", Name: "Netflix"}}}
-	s.transactionCount ++
-	return transactions, nil
+func (s *StubDataStore) RecordMerchantAlias(ctx context.Context, userID int, alias merchant.Alias) (*merchant.Alias, error) {
+	s.recordedFor = append(s.recordedFor, userID)
+	alias.ID = len(s.aliases) + 1
+	s.aliases = append(s.aliases, alias)
+	return &alias, nil
 }
 
-func TestGetTransactions(t *testing.T) {
-	t.Run("Successfully calls the transactionAPI", func(t *testing.T) {
-		store := &StubDataStore{}
-		transactionAPI := &stubTransactionAPI{}
-		server := NewServer(store, &StubMailer{}, transactionAPI)
+func (s *StubDataStore) DeleteMerchantAlias(ctx context.Context, userID int, ID int) error {
+	s.deleteCount = append(s.deleteCount, ID)
+	return nil
+}
 
-		request, _ := http.NewRequest(http.MethodGet, "/api/transactions", nil)
-		response := httptest.NewRecorder()
+func (s *StubDataStore) RecordCandidate(ctx context.Context, userID int, candidate subscription.Candidate) (*subscription.Candidate, error) {
+	s.recordedFor = append(s.recordedFor, userID)
+	candidate.ID = len(s.candidates) + 1
+	s.candidates = append(s.candidates, candidate)
+	return &candidate, nil
+}
 
-		server.ServeHTTP(response, request)
+func (s *StubDataStore) GetCandidates(ctx context.Context, userID int) ([]subscription.Candidate, error) {
+	return s.candidates, nil
+}
 
-		assertStatus(t, response.Code, http.StatusOK)
-	})
+func (s *StubDataStore) GetCandidate(ctx context.Context, userID int, ID int) (*subscription.Candidate, error) {
+	for _, candidate := range s.candidates {
+		if candidate.ID == ID {
+			return &candidate, nil
+		}
+	}
+	return nil, nil
 }
 
-func TestLoadSubscriptions(t *testing.T) {
-	t.Run("Successfully calls the transactionAPI and loads Transactions", func(t *testing.T) {
-		store := &StubDataStore{}
-		transactionAPI := &stubTransactionAPI{}
-		server := NewServer(store, &StubMailer{}, transactionAPI)
+func (s *StubDataStore) DeleteCandidate(ctx context.Context, userID int, ID int) error {
+	for index, candidate := range s.candidates {
+		if candidate.ID == ID {
+			s.candidates = append(s.candidates[:index], s.candidates[index+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("no candidate with ID %v", ID)
+}
 
-		request, _ := http.NewRequest(http.MethodPost, "/api/transactions/load-subscriptions", nil)
-		response := httptest.NewRecorder()
+func (s *StubDataStore) RejectMerchant(ctx context.Context, userID int, merchant string) error {
+	s.rejected = append(s.rejected, merchant)
+	return nil
+}
 
-		server.ServeHTTP(response, request)
+func (s *StubDataStore) GetRejectedMerchants(ctx context.Context, userID int) ([]string, error) {
+	return s.rejected, nil
+}
 
-		if transactionAPI.transactionCount != 1 {
-			t.Errorf("got %d calls to GetTransactions want %d", transactionAPI.transactionCount, 1)
+func (s *StubDataStore) DeleteRejectedMerchant(ctx context.Context, userID int, merchant string) error {
+	for index, rejected := range s.rejected {
+		if rejected == merchant {
+			s.rejected = append(s.rejected[:index], s.rejected[index+1:]...)
+			return nil
 		}
+	}
+	return fmt.Errorf("no rejected merchant %q", merchant)
+}
 
-		assertStatus(t, response.Code, http.StatusOK)
-	})
+func (s *StubDataStore) RecordTransactions(ctx context.Context, userID int, transactions []transaction.Transaction) error {
+	if s.recordErr != nil {
+		return s.recordErr
+	}
+	s.recordedFor = append(s.recordedFor, userID)
+	s.transactions = append(s.transactions, transactions...)
+	return nil
 }
 
-func TestGETSubscriptions(t *testing.T) {
+func (s *StubDataStore) GetTransactions(ctx context.Context, userID int) ([]transaction.Transaction, error) {
+	return s.transactions, nil
+}
 
-	t.Run("return subscriptions in JSON format", func(t *testing.T) {
-		amount, _ := decimal.NewFromString("100.99")
-		wantedSubscriptions := []subscription.Subscription{
-			{ID: 1, Name: "Netflix", Amount: amount, DateDue: time.Date(2020, time.November, 11, 0, 0, 0, 0, time.UTC)},
+func (s *StubDataStore) DeleteTransactions(ctx context.Context, userID int, externalIDs []string) error {
+	s.removed = append(s.removed, externalIDs...)
+	return nil
+}
+
+func (s *StubDataStore) MatchPayments(ctx context.Context, userID int, subscriptionID int, externalIDs []string) error {
+	for _, externalID := range externalIDs {
+		for index, t := range s.transactions {
+			if t.ExternalID == externalID {
+				s.transactions[index].SubscriptionID = subscriptionID
+			}
 		}
+	}
+	return nil
+}
 
-		store := &StubDataStore{subscriptions: wantedSubscriptions}
+func (s *StubDataStore) CreateUser(ctx context.Context, name string, email string, passwordHash string) (*userprofile.Userprofile, error) {
+	for _, user := range s.users {
+		if user.Email == email {
+			return nil, account.ErrEmailTaken
+		}
+	}
+	user := userprofile.Userprofile{ID: len(s.users) + 2, Name: name, Email: email, PasswordHash: passwordHash}
+	s.users = append(s.users, user)
+	return &user, nil
+}
 
-		transactionAPI := &stubTransactionAPI{}
-		server := NewServer(store, &StubMailer{}, transactionAPI)
+func (s *StubDataStore) CreateUserWithIdentity(ctx context.Context, name string, email string, issuer string, subject string) (*userprofile.Userprofile, error) {
+	user, err := s.CreateUser(ctx, name, email, "")
+	if err != nil {
+		return nil, err
+	}
+	if s.identities == nil {
+		s.identities = map[string]int{}
+	}
+	s.identities[issuer+" "+subject] = user.ID
+	return user, nil
+}
 
-		request := newGetSubscriptionRequest(t)
-		response := httptest.NewRecorder()
+func (s *StubDataStore) GetUserByIdentity(ctx context.Context, issuer string, subject string) (*userprofile.Userprofile, error) {
+	userID, ok := s.identities[issuer+" "+subject]
+	if !ok {
+		return nil, nil
+	}
+	for _, user := range s.users {
+		if user.ID == userID {
+			return &user, nil
+		}
+	}
+	return nil, nil
+}
 
-		server.ServeHTTP(response, request)
+func (s *StubDataStore) GetUserByEmail(ctx context.Context, email string) (*userprofile.Userprofile, error) {
+	for _, user := range s.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+	return nil, nil
+}
 
-		got := getSubscriptionsFromResponse(t, response.Body)
-		assertSubscriptions(t, got, wantedSubscriptions)
+func (s *StubDataStore) RecordUserDetails(ctx context.Context, userID int, name string, email string) (*userprofile.Userprofile, error) {
+	for _, user := range s.users {
+		if user.Email == email && user.ID != userID {
+			return nil, account.ErrEmailTaken
+		}
+	}
+	s.userprofile = userprofile.Userprofile{ID: userID, Name: name, Email: email}
 
-		assertStatus(t, response.Code, http.StatusOK)
-		assertContentType(t, response, JSONContentType)
-	})
+	return &s.userprofile, nil
 }
+func (s *StubDataStore) GetUserDetails(ctx context.Context, userID int) (*userprofile.Userprofile, error) {
 
-func TestStoreSubscription(t *testing.T) {
+	return &s.userprofile, nil
+}
 
-	t.Run("stores a subscription we POST to the server", func(t *testing.T) {
-		amount, _ := decimal.NewFromString("100.99")
-		subscription := subscription.Subscription{Name: "Netflix", Amount: amount, DateDue: time.Date(2020, time.November, 11, 0, 0, 0, 0, time.UTC)}
+func (s *StubDataStore) CreateSession(ctx context.Context, session account.Session) error {
+	if s.sessions == nil {
+		s.sessions = map[string]account.Session{}
+	}
+	s.sessions[session.TokenHash] = session
+	return nil
+}
 
-		store := &StubDataStore{}
-		transactionAPI := &stubTransactionAPI{}
-		server := NewServer(store, &StubMailer{}, transactionAPI)
+func (s *StubDataStore) GetSession(ctx context.Context, tokenHash string) (*account.Session, error) {
+	if session, ok := s.sessions[tokenHash]; ok {
+		return &session, nil
+	}
+	if tokenHash == account.HashToken(testSessionToken) {
+		return &account.Session{TokenHash: tokenHash, UserID: testUserID, ExpiresAt: time.Now().Add(time.Hour)}, nil
+	}
+	return nil, nil
+}
 
-		request := newPostSubscriptionRequest(t, subscription)
-		response := httptest.NewRecorder()
+func (s *StubDataStore) DeleteSession(ctx context.Context, tokenHash string) error {
+	delete(s.sessions, tokenHash)
+	s.deletedSessions = append(s.deletedSessions, tokenHash)
+	return nil
+}
 
-		server.ServeHTTP(response, request)
-		assertStatus(t, response.Code, http.StatusOK)
+func (s *StubDataStore) CreateAPIToken(ctx context.Context, token account.APIToken) (*account.APIToken, error) {
+	token.ID = len(s.apiTokens) + 1
+	s.apiTokens = append(s.apiTokens, token)
+	return &token, nil
+}
 
-		if len(store.subscriptions) != 1 {
-			t.Errorf("got %d calls to RecordSubscription want %d", len(store.subscriptions), 1)
+func (s *StubDataStore) GetAPITokens(ctx context.Context, userID int) ([]account.APIToken, error) {
+	var tokens []account.APIToken
+	for _, token := range s.apiTokens {
+		if token.UserID == userID {
+			tokens = append(tokens, token)
 		}
+	}
+	return tokens, nil
+}
 
-		if !reflect.DeepEqual(store.subscriptions[0], subscription) {
-			t.Errorf("did not store correct subscription got %v want %v", store.subscriptions[0], subscription)
+func (s *StubDataStore) GetAPITokenByHash(ctx context.Context, tokenHash string) (*account.APIToken, error) {
+	for _, token := range s.apiTokens {
+		if token.TokenHash == tokenHash {
+			return &token, nil
 		}
-	})
+	}
+	return nil, nil
 }
 
-func TestCreateReminder(t *testing.T) {
-
-	t.Run("creates a reminder for subscription and returns a confirmation that a reminder invite has been sent", func(t *testing.T) {
-		amount, _ := decimal.NewFromString("100.99")
-		subscriptions := []subscription.Subscription{
-			{ID: 1, Name: "Netflix", Amount: amount, DateDue: time.Date(2020, time.November, 11, 0, 0, 0, 0, time.UTC)},
+func (s *StubDataStore) DeleteAPIToken(ctx context.Context, userID int, ID int) error {
+	for index, token := range s.apiTokens {
+		if token.ID == ID && token.UserID == userID {
+			s.apiTokens = append(s.apiTokens[:index], s.apiTokens[index+1:]...)
+			return nil
 		}
-
-		store := &StubDataStore{subscriptions: subscriptions}
-		transactionAPI := &stubTransactionAPI{}
-		server := NewServer(store, &StubMailer{}, transactionAPI)
-
-		request := newPostReminderRequest(t, subscriptions[0].ID)
-		response := httptest.NewRecorder()
-
-		server.ServeHTTP(response, request)
-		assertStatus(t, response.Code, http.StatusOK)
-	})
-
+	}
+	return fmt.Errorf("no API token with ID %d", ID)
 }
 
-func assertStatus(t *testing.T, got, want int) {
-	t.Helper()
-	if got != want {
-		t.Errorf("did not get correct status, got %d, want %d", got, want)
+func (s *StubDataStore) RecordAPITokenUse(ctx context.Context, userID int, ID int, usedAt time.Time) error {
+	for index, token := range s.apiTokens {
+		if token.ID == ID && token.UserID == userID {
+			s.apiTokens[index].LastUsedAt = &usedAt
+		}
 	}
+	return nil
 }
 
-func assertSubscriptions(t *testing.T, got, want []subscription.Subscription) {
-	t.Helper()
-	if !reflect.DeepEqual(got, want) {
-		t.Errorf("got %v want %v", got, want)
-	}
+// newUserRequest returns a request made by the web UI of the user logged in with testSessionToken, sending its CSRF token
+func newUserRequest(method string, path string, body io.Reader) *http.Request {
+	request := httptest.NewRequest(method, path, body)
+	request.AddCookie(&http.Cookie{Name: SessionCookie, Value: testSessionToken})
+	request.Header.Set(CSRFHeader, account.CSRFToken(testSessionToken))
+	return request
 }
 
-func assertContentType(t *testing.T, response *httptest.ResponseRecorder, want string) {
-	t.Helper()
-	if response.Result().Header.Get("content-type") != want {
-		t.Errorf("response did not have content-type of %s, got %v", want, response.Result().Header)
-	}
+type stubTransactionAPI struct {
+	transactionCount int
+	err              error
 }
 
-func getSubscriptionsFromResponse(t *testing.T, body io.Reader) (subscriptions []subscription.Subscription) {
-	t.Helper()
-	err := json.NewDecoder(body).Decode(&subscriptions)
-	if err != nil {
-		t.Fatalf("unable to parse response from server %q into slice of Subscription, '%v'", body, err)
+func (s *stubTransactionAPI) GetTransactions(ctx context.Context) (plaid.TransactionList, error) {
+	transactions := plaid.TransactionList{Transactions: []plaid.Transaction{{Amount: 9.99, Date: "2020-09-12", Name: "Netflix"}}}
+	s.transactionCount++
+	if s.err != nil {
+		return plaid.TransactionList{}, s.err
 	}
-	return
+	return transactions, nil
 }
 
-func TestDeleteSubscriptionAPI(t *testing.T) {
+// testSources returns a registry with the transaction API as its only source
+func testSources(api TransactionAPI) *Sources {
+	sources := NewSources()
+	_ = sources.Register("plaid", api)
+	return sources
+}
 
-	t.Run("deletes the specified subscription from the data store and returns 200", func(t *testing.T) {
-		subscriptions := []subscription.Subscription{{ID: 1}}
-		store := &StubDataStore{subscriptions: subscriptions}
+func TestSources(t *testing.T) {
+	t.Run("the first source registered is the default", func(t *testing.T) {
+		sources := NewSources()
+		plaidAPI, fileAPI := &stubTransactionAPI{}, &stubTransactionAPI{}
+		_ = sources.Register("plaid", plaidAPI)
+		_ = sources.Register("statement-file", fileAPI)
 
-		transactionAPI := &stubTransactionAPI{}
-		server := NewServer(store, &StubMailer{}, transactionAPI)
+		got, err := sources.Get("")
+		if err != nil || got != plaidAPI {
+			t.Errorf("got %v, %v want the plaid source", got, err)
+		}
+		got, err = sources.Get("statement-file")
+		if err != nil || got != fileAPI {
+			t.Errorf("got %v, %v want the statement-file source", got, err)
+		}
 
-		request := newDeleteSubscriptionRequest(t, 1)
-		response := httptest.NewRecorder()
+		want := []SourceInfo{{Name: "plaid", Default: true}, {Name: "statement-file"}}
+		if !reflect.DeepEqual(sources.List(), want) {
+			t.Errorf("got %v want %v", sources.List(), want)
+		}
+	})
 
-		server.ServeHTTP(response, request)
+	t.Run("rejects names that are taken or can't be used in a URL", func(t *testing.T) {
+		sources := NewSources()
+		_ = sources.Register("plaid", &stubTransactionAPI{})
 
-		if len(store.deleteCount) != 1 {
-			t.Errorf("got %d calls to DeleteSubscription want %d", len(store.deleteCount), 1)
+		for _, name := range []string{"plaid", "", "Plaid", "my/bank"} {
+			if sources.Register(name, &stubTransactionAPI{}) == nil {
+				t.Errorf("expected an error registering %q", name)
+			}
 		}
 	})
 
-	t.Run("returns 404 if given subscription ID doesn't exist", func(t *testing.T) {
-		subscriptions := []subscription.Subscription{{ID: 1}}
-		store := &StubDataStore{subscriptions: subscriptions}
+	t.Run("returns an error for an unknown source", func(t *testing.T) {
+		_, err := NewSources().Get("")
+		if !errors.Is(err, ErrUnknownSource) {
+			t.Errorf("got %v want %v", err, ErrUnknownSource)
+		}
+		_, err = testSources(&stubTransactionAPI{}).Get("monzo")
+		if !errors.Is(err, ErrUnknownSource) {
+			t.Errorf("got %v want %v", err, ErrUnknownSource)
+		}
+	})
+}
 
-		transactionAPI := &stubTransactionAPI{}
-		server := NewServer(store, &StubMailer{}, transactionAPI)
+func TestSourcesAPI(t *testing.T) {
+	newSources := func() (*Sources, *stubTransactionAPI, *stubTransactionAPI) {
+		sources := NewSources()
+		plaidAPI, fileAPI := &stubTransactionAPI{}, &stubTransactionAPI{}
+		_ = sources.Register("plaid", plaidAPI)
+		_ = sources.Register("statement-file", fileAPI)
+		return sources, plaidAPI, fileAPI
+	}
 
-		request := newDeleteSubscriptionRequest(t, 2)
+	t.Run("returns the sources in JSON format", func(t *testing.T) {
+		sources, _, _ := newSources()
+		server := NewServer(&StubDataStore{}, &StubMailer{}, sources)
 
+		request := newUserRequest(http.MethodGet, "/api/sources", nil)
 		response := httptest.NewRecorder()
 
 		server.ServeHTTP(response, request)
-		assertStatus(t, response.Code, http.StatusNotFound)
-	})
-}
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, JSONContentType)
 
-func TestUserHandler(t *testing.T) {
+		var got []SourceInfo
+		err := json.NewDecoder(response.Body).Decode(&got)
+		if err != nil {
+			t.Fatalf("unable to parse response from server %q into sources, '%v'", response.Body, err)
+		}
+		if !reflect.DeepEqual(got, sources.List()) {
+			t.Errorf("got %v want %v", got, sources.List())
+		}
+	})
 
-	t.Run("tests creation of a user", func(t *testing.T) {
+	t.Run("imports from the named source", func(t *testing.T) {
+		sources, plaidAPI, fileAPI := newSources()
 		store := &StubDataStore{}
-		transactionAPI := &stubTransactionAPI{}
-		server := NewServer(store, &StubMailer{}, transactionAPI)
+		server := NewServer(store, &StubMailer{}, sources)
 
-		request := newPostUserRequest(t, "Gary Gopher", "gary@gopher.com")
+		request := newUserRequest(http.MethodPost, "/api/sources/statement-file/import", nil)
 		response := httptest.NewRecorder()
 
 		server.ServeHTTP(response, request)
 		assertStatus(t, response.Code, http.StatusOK)
 
-		if store.userprofile.Name != "Gary Gopher" {
-			t.Errorf("incorrect name set got %v want %v", store.userprofile.Name, "Gary Gopher")
+		if plaidAPI.transactionCount != 0 || fileAPI.transactionCount != 1 {
+			t.Errorf("got %d calls to plaid and %d to statement-file want 1 to statement-file", plaidAPI.transactionCount, fileAPI.transactionCount)
+		}
+		if len(store.transactions) != 1 {
+			t.Errorf("got %d stored transactions want 1", len(store.transactions))
 		}
+	})
 
-		if store.userprofile.Email != "gary@gopher.com" {
-			t.Errorf("incorrect name set got %v want %v", store.userprofile.Email, "gary@gopher.com")
+	t.Run("loading subscriptions imports from the default source", func(t *testing.T) {
+		sources, plaidAPI, fileAPI := newSources()
+		server := NewServer(&StubDataStore{}, &StubMailer{}, sources)
+
+		request := newUserRequest(http.MethodPost, "/api/transactions/load-subscriptions", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if plaidAPI.transactionCount != 1 || fileAPI.transactionCount != 0 {
+			t.Errorf("got %d calls to plaid and %d to statement-file want 1 to plaid", plaidAPI.transactionCount, fileAPI.transactionCount)
 		}
 	})
 
-	t.Run("tests retrival of user", func(t *testing.T) {
-		userProfile := userprofile.Userprofile{
-			Name:  "Gary Gopher",
-			Email: "gary@gopher.com",
+	t.Run("returns 404 for an unknown source", func(t *testing.T) {
+		sources, _, _ := newSources()
+		server := NewServer(&StubDataStore{}, &StubMailer{}, sources)
+
+		for _, path := range []string{"/api/sources/monzo/import", "/api/sources/plaid"} {
+			request := newUserRequest(http.MethodPost, path, nil)
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, request)
+			assertStatus(t, response.Code, http.StatusNotFound)
 		}
+	})
+}
 
-		store := &StubDataStore{userprofile: userProfile}
+func TestGetTransactions(t *testing.T) {
+	t.Run("returns the stored transactions without calling the transactionAPI", func(t *testing.T) {
+		amount, _ := decimal.NewFromString("9.99")
+		store := &StubDataStore{transactions: []transaction.Transaction{{ID: 1, ExternalID: "tx-1", Name: "NETFLIX.COM", Merchant: "netflix", Amount: amount, Currency: "GBP", Date: time.Date(2020, time.October, 12, 0, 0, 0, 0, time.UTC)}}}
 		transactionAPI := &stubTransactionAPI{}
-		server := NewServer(store, &StubMailer{}, transactionAPI)
+		server := NewServer(store, &StubMailer{}, testSources(transactionAPI))
 
-		request := newGetUserRequest(t)
+		request := newUserRequest(http.MethodGet, "/api/transactions", nil)
 		response := httptest.NewRecorder()
 
 		server.ServeHTTP(response, request)
-		assertStatus(t, response.Code, http.StatusOK)
 
-		var retrievedUserProfile userprofile.Userprofile
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, JSONContentType)
 
-		err := json.NewDecoder(response.Body).Decode(&retrievedUserProfile)
+		var got []transaction.Transaction
+		err := json.NewDecoder(response.Body).Decode(&got)
 		if err != nil {
-			t.Fatalf("unable to parse response from server %q into user profile, '%v'", response.Body, err)
+			t.Fatalf("unable to parse response from server %q into transactions, '%v'", response.Body, err)
 		}
-
-		if retrievedUserProfile.Name != userProfile.Name {
-			t.Errorf("incorrect name retrieved got %v want %v", retrievedUserProfile.Name, userProfile.Name)
+		if !reflect.DeepEqual(got, store.transactions) {
+			t.Errorf("got %v want %v", got, store.transactions)
 		}
-
-		if retrievedUserProfile.Email != userProfile.Email {
-			t.Errorf("incorrect name retrieved got %v want %v", retrievedUserProfile.Email, userProfile.Email)
+		if transactionAPI.transactionCount != 0 {
+			t.Errorf("got %d calls to GetTransactions want none", transactionAPI.transactionCount)
 		}
-
-		assertContentType(t, response, JSONContentType)
 	})
-
 }
 
-func newGetSubscriptionRequest(t testing.TB) *http.Request {
-	t.Helper()
-	req, err := http.NewRequest(http.MethodGet, "/api/subscriptions", nil)
-	if err != nil {
-		t.Fatalf("failed to send request: %v", err)
+func TestGetTransactionsErrors(t *testing.T) {
+	cases := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{"bank login has expired", &plaid.Error{StatusCode: http.StatusBadRequest, Type: "ITEM_ERROR", Code: "ITEM_LOGIN_REQUIRED"}, http.StatusConflict},
+		{"no bank linked outside the sandbox", plaid.ErrLinkRequired, http.StatusConflict},
+		{"transactions not ready", fmt.Errorf("transactions were not ready after 30s: %w", &plaid.Error{StatusCode: http.StatusBadRequest, Type: "ITEM_ERROR", Code: "PRODUCT_NOT_READY"}), http.StatusServiceUnavailable},
+		{"bank is down", &plaid.Error{StatusCode: http.StatusBadRequest, Type: "INSTITUTION_ERROR", Code: "INSTITUTION_DOWN"}, http.StatusServiceUnavailable},
+		{"rate limited", &plaid.Error{StatusCode: http.StatusTooManyRequests, Type: "RATE_LIMIT_EXCEEDED", Code: "TRANSACTIONS_LIMIT"}, http.StatusTooManyRequests},
+		{"invalid credentials", &plaid.Error{StatusCode: http.StatusBadRequest, Type: "INVALID_INPUT", Code: "INVALID_API_KEYS"}, http.StatusBadGateway},
+		{"timed out", fmt.Errorf("unable to get transactions: %w", context.DeadlineExceeded), http.StatusGatewayTimeout},
+		{"unexpected failure", errors.New("connection reset"), http.StatusBadGateway},
 	}
-	return req
-}
 
-func newPostSubscriptionRequest(t *testing.T, subscription subscription.Subscription) *http.Request {
-	postBody, _ := json.Marshal(subscription)
-	req, err := http.NewRequest(http.MethodPost, "/api/subscriptions", bytes.NewBuffer(postBody))
-	if err != nil {
-		t.Errorf("failed to generate new POST subscription request")
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			store := &StubDataStore{}
+			server := NewServer(store, &StubMailer{}, testSources(&stubTransactionAPI{err: c.err}))
+
+			request := newUserRequest(http.MethodPost, "/api/transactions/load-subscriptions", nil)
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, c.status)
+			if len(store.candidates) != 0 || len(store.transactions) != 0 {
+				t.Errorf("got %d candidates and %d transactions want none", len(store.candidates), len(store.transactions))
+			}
+		})
 	}
-	return req
 }
 
-func newPostReminderRequest(t testing.TB, id int) *http.Request {
-	t.Helper()
-	subscription := subscription.Subscription{
+type stubTransactionSyncer struct {
+	stubTransactionAPI
+	changes   plaid.TransactionChanges
+	syncCount int
+	syncedFor []int
+	saved     []plaid.TransactionChanges
+	items     []string
+}
+
+func (s *stubTransactionSyncer) SyncTransactions(ctx context.Context) (plaid.TransactionChanges, error) {
+	s.syncCount++
+	userID, _ := account.UserID(ctx)
+	s.syncedFor = append(s.syncedFor, userID)
+	return s.changes, nil
+}
+
+func (s *stubTransactionSyncer) SyncItem(ctx context.Context, itemID string) (plaid.TransactionChanges, error) {
+	s.items = append(s.items, itemID)
+	return s.SyncTransactions(ctx)
+}
+
+func (s *stubTransactionSyncer) SaveCursors(ctx context.Context, changes plaid.TransactionChanges) error {
+	s.saved = append(s.saved, changes)
+	return nil
+}
+
+func TestLoadSubscriptions(t *testing.T) {
+	t.Run("Successfully calls the transactionAPI and loads Transactions", func(t *testing.T) {
+		store := &StubDataStore{}
+		transactionAPI := &stubTransactionAPI{}
+		server := NewServer(store, &StubMailer{}, testSources(transactionAPI))
+
+		request := newUserRequest(http.MethodPost, "/api/transactions/load-subscriptions", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		if transactionAPI.transactionCount != 1 {
+			t.Errorf("got %d calls to GetTransactions want %d", transactionAPI.transactionCount, 1)
+		}
+
+		assertStatus(t, response.Code, http.StatusOK)
+	})
+
+	t.Run("queues subscriptions to merchants in the catalogue for review with their category", func(t *testing.T) {
+		store := &StubDataStore{}
+		merchants := catalogue.New([]catalogue.Entry{{Merchant: "Netflix", Category: "Entertainment", Frequency: "monthly"}})
+		server := NewServer(store, &StubMailer{}, testSources(&stubTransactionAPI{}), WithCatalogue(merchants))
+
+		request := newUserRequest(http.MethodPost, "/api/transactions/load-subscriptions", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, JSONContentType)
+
+		if len(store.subscriptions) != 0 {
+			t.Errorf("got %d stored subscriptions want none before review", len(store.subscriptions))
+		}
+		if len(store.candidates) != 1 {
+			t.Fatalf("got %d candidates want 1", len(store.candidates))
+		}
+		got := store.candidates[0]
+		if got.Merchant != "netflix" || got.Subscription.Category != "Entertainment" || len(got.Transactions) != 1 {
+			t.Errorf("got candidate %v want netflix in Entertainment with its transaction", got)
+		}
+
+		var candidates []subscription.Candidate
+		err := json.NewDecoder(response.Body).Decode(&candidates)
+		if err != nil {
+			t.Fatalf("unable to parse response from server %q into candidates, '%v'", response.Body, err)
+		}
+		if len(candidates) != 1 {
+			t.Errorf("got %d candidates in the response want 1", len(candidates))
+		}
+	})
+
+	t.Run("detects subscriptions only for merchants with new and changed transactions", func(t *testing.T) {
+		store := &StubDataStore{}
+		merchants := catalogue.New([]catalogue.Entry{{Merchant: "Netflix"}, {Merchant: "Spotify"}, {Merchant: "PureGym"}})
+		transactionAPI := &stubTransactionSyncer{changes: plaid.TransactionChanges{
+			Added:    []plaid.Transaction{{TransactionID: "tx-2", Amount: 9.99, Date: "2020-10-14", Name: "Spotify"}},
+			Modified: []plaid.Transaction{{TransactionID: "tx-3", Amount: 34.99, Date: "2020-11-01", Name: "PureGym"}},
+			Removed:  []string{"tx-1"},
+		}}
+		server := NewServer(store, &StubMailer{}, testSources(transactionAPI), WithCatalogue(merchants))
+
+		request := newUserRequest(http.MethodPost, "/api/transactions/load-subscriptions", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if transactionAPI.syncCount != 1 || transactionAPI.transactionCount != 0 {
+			t.Errorf("got %d syncs and %d calls to GetTransactions want 1 sync", transactionAPI.syncCount, transactionAPI.transactionCount)
+		}
+		var got []string
+		for _, candidate := range store.candidates {
+			got = append(got, candidate.Merchant)
+		}
+		if !reflect.DeepEqual(got, []string{"spotify", "puregym"}) {
+			t.Errorf("got candidates for %v want %v", got, []string{"spotify", "puregym"})
+		}
+	})
+
+	t.Run("detects subscriptions over the stored history of merchants with new payments", func(t *testing.T) {
+		daysAgo := func(days int) string { return time.Now().AddDate(0, 0, -days).Format("2006-01-02") }
+		store := &StubDataStore{}
+		transactionAPI := &stubTransactionSyncer{changes: plaid.TransactionChanges{
+			Added: []plaid.Transaction{
+				{TransactionID: "tx-1", Amount: 9.99, Date: daysAgo(60), Name: "Spotify"},
+				{TransactionID: "tx-2", Amount: 9.99, Date: daysAgo(30), Name: "Spotify"},
+			},
+		}}
+		server := NewServer(store, &StubMailer{}, testSources(transactionAPI))
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newUserRequest(http.MethodPost, "/api/transactions/load-subscriptions", nil))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if len(store.candidates) != 1 {
+			t.Fatalf("got %d candidates after the first import want 1", len(store.candidates))
+		}
+		first := store.candidates[0]
+
+		transactionAPI.changes = plaid.TransactionChanges{
+			Added: []plaid.Transaction{{TransactionID: "tx-3", Amount: 9.99, Date: daysAgo(0), Name: "Spotify"}},
+		}
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newUserRequest(http.MethodPost, "/api/transactions/load-subscriptions", nil))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if len(store.candidates) != 2 {
+			t.Fatalf("got %d candidates recorded want the spotify candidate recorded again", len(store.candidates))
+		}
+		got := store.candidates[1]
+		if got.Merchant != "spotify" || len(got.Transactions) != 3 {
+			t.Errorf("got candidate for %q from %d payments want spotify from 3", got.Merchant, len(got.Transactions))
+		}
+		if got.Confidence <= first.Confidence {
+			t.Errorf("got confidence %v want more than %v", got.Confidence, first.Confidence)
+		}
+		if got.Subscription.Frequency != subscription.Monthly {
+			t.Errorf("got frequency %v want %v", got.Subscription.Frequency, subscription.Monthly)
+		}
+	})
+
+	t.Run("stores the imported transactions and deletes the removed ones", func(t *testing.T) {
+		store := &StubDataStore{}
+		merchants := catalogue.New([]catalogue.Entry{{Merchant: "Netflix"}})
+		transactionAPI := &stubTransactionSyncer{changes: plaid.TransactionChanges{
+			Added:    []plaid.Transaction{{TransactionID: "tx-2", Amount: 9.99, ISOCurrencyCode: "GBP", Date: "2020-10-12", Name: "NETFLIX.COM"}},
+			Modified: []plaid.Transaction{{TransactionID: "tx-3", Amount: 34.99, Date: "2020-11-01", Name: "PureGym"}},
+			Removed:  []string{"tx-1"},
+		}}
+		server := NewServer(store, &StubMailer{}, testSources(transactionAPI), WithCatalogue(merchants))
+
+		request := newUserRequest(http.MethodPost, "/api/transactions/load-subscriptions", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if len(store.transactions) != 2 {
+			t.Fatalf("got %d stored transactions want 2", len(store.transactions))
+		}
+		if got := store.transactions[0]; got.ExternalID != "tx-2" || got.Merchant != "netflix" || got.Currency != "GBP" {
+			t.Errorf("got stored transaction %v want tx-2 paid to netflix", got)
+		}
+		if !reflect.DeepEqual(store.removed, []string{"tx-1"}) {
+			t.Errorf("got removed transactions %v want %v", store.removed, []string{"tx-1"})
+		}
+	})
+
+	t.Run("only saves the sync cursors once the changes are stored", func(t *testing.T) {
+		store := &StubDataStore{recordErr: errors.New("connection reset")}
+		transactionAPI := &stubTransactionSyncer{changes: plaid.TransactionChanges{
+			Added:   []plaid.Transaction{{TransactionID: "tx-1", Amount: 9.99, Date: "2020-10-12", Name: "NETFLIX.COM"}},
+			Cursors: []plaid.SyncCursor{{UserID: testUserID, ID: 1, Cursor: "cursor-1"}},
+		}}
+		server := NewServer(store, &StubMailer{}, testSources(transactionAPI))
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newUserRequest(http.MethodPost, "/api/transactions/load-subscriptions", nil))
+		assertStatus(t, response.Code, http.StatusInternalServerError)
+
+		if len(transactionAPI.saved) != 0 {
+			t.Fatalf("got %d saves of the sync cursors want none when storing failed", len(transactionAPI.saved))
+		}
+
+		store.recordErr = nil
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newUserRequest(http.MethodPost, "/api/transactions/load-subscriptions", nil))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if len(store.transactions) != 1 || len(transactionAPI.saved) != 1 || !reflect.DeepEqual(transactionAPI.saved[0].Cursors, transactionAPI.changes.Cursors) {
+			t.Errorf("got %d stored transactions and cursors saved %v want the change stored and its cursor saved", len(store.transactions), transactionAPI.saved)
+		}
+	})
+
+	t.Run("matches imported payments to existing subscriptions", func(t *testing.T) {
+		amount, _ := decimal.NewFromString("9.99")
+		store := &StubDataStore{subscriptions: []subscription.Subscription{{ID: 1, Name: "Netflix", Merchant: "netflix", Amount: amount}}}
+		server := NewServer(store, &StubMailer{}, testSources(&stubTransactionAPI{}))
+
+		request := newUserRequest(http.MethodPost, "/api/transactions/load-subscriptions", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if len(store.transactions) != 1 || store.transactions[0].SubscriptionID != 1 {
+			t.Errorf("got stored transactions %v want the Netflix payment matched to subscription 1", store.transactions)
+		}
+		if len(store.candidates) != 0 {
+			t.Errorf("got %d candidates want none for a merchant with a subscription", len(store.candidates))
+		}
+	})
+
+	t.Run("does not queue merchants that were rejected", func(t *testing.T) {
+		store := &StubDataStore{rejected: []string{"netflix"}}
+		merchants := catalogue.New([]catalogue.Entry{{Merchant: "Netflix"}})
+		server := NewServer(store, &StubMailer{}, testSources(&stubTransactionAPI{}), WithCatalogue(merchants))
+
+		request := newUserRequest(http.MethodPost, "/api/transactions/load-subscriptions", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if len(store.candidates) != 0 {
+			t.Errorf("got %d candidates want none: %v", len(store.candidates), store.candidates)
+		}
+	})
+}
+
+func newStatementRequest(t testing.TB, path string, fields map[string]string, contents string) *http.Request {
+	t.Helper()
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	for name, value := range fields {
+		err := form.WriteField(name, value)
+		if err != nil {
+			t.Fatalf("unable to write form field %q: %v", name, err)
+		}
+	}
+	file, err := form.CreateFormFile("statement", "statement.csv")
+	if err != nil {
+		t.Fatalf("unable to create form file: %v", err)
+	}
+	_, err = io.WriteString(file, contents)
+	if err != nil {
+		t.Fatalf("unable to write statement: %v", err)
+	}
+	err = form.Close()
+	if err != nil {
+		t.Fatalf("unable to close form: %v", err)
+	}
+
+	request := newUserRequest(http.MethodPost, path, body)
+	request.Header.Set("Content-Type", form.FormDataContentType())
+	return request
+}
+
+func TestCSVStatementAPI(t *testing.T) {
+	paid := func(monthsAgo int) string {
+		return time.Now().AddDate(0, -monthsAgo, 0).Format("02/01/2006")
+	}
+	csvFile := "Date,Counter Party,Reference,Type,Amount (GBP),Balance (GBP)\n" +
+		paid(2) + ",Spotify,SPOTIFY P0B1,CARD,-9.99,990.01\n" +
+		paid(1) + ",Spotify,SPOTIFY P0C2,CARD,-9.99,980.02\n" +
+		paid(0) + ",Spotify,SPOTIFY P0D3,CARD,-9.99,970.03\n" +
+		paid(0) + ",Employer,SALARY,FASTER PAYMENT,1500.00,2470.03\n"
+
+	t.Run("waits for an import from a bank to finish before storing the statement", func(t *testing.T) {
+		store := &StubDataStore{}
+		server := NewServer(store, &StubMailer{}, testSources(&stubTransactionAPI{}))
+		lock := server.syncLock(testUserID)
+		lock.Lock()
+
+		request := newStatementRequest(t, "/api/statements/csv", map[string]string{"bank": "starling"}, csvFile)
+		done := make(chan int)
+		go func() {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, request)
+			done <- response.Code
+		}()
+
+		select {
+		case <-done:
+			t.Fatalf("statement was imported while the user's transactions were being imported")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		lock.Unlock()
+		assertStatus(t, <-done, http.StatusOK)
+		if len(store.transactions) != 4 {
+			t.Errorf("got %d stored transactions want 4", len(store.transactions))
+		}
+	})
+
+	t.Run("imports the statement and queues the subscriptions detected in it for review", func(t *testing.T) {
+		store := &StubDataStore{}
+		transactionAPI := &stubTransactionAPI{}
+		server := NewServer(store, &StubMailer{}, testSources(transactionAPI))
+
+		request := newStatementRequest(t, "/api/statements/csv", map[string]string{"bank": "starling"}, csvFile)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, JSONContentType)
+
+		if transactionAPI.transactionCount != 0 {
+			t.Errorf("got %d calls to GetTransactions want none", transactionAPI.transactionCount)
+		}
+		if len(store.transactions) != 4 {
+			t.Errorf("got %d stored transactions want 4", len(store.transactions))
+		}
+		if len(store.candidates) != 1 || store.candidates[0].Merchant != "spotify" {
+			t.Fatalf("got candidates %v want one for spotify", store.candidates)
+		}
+		if got := store.candidates[0].Subscription; got.Frequency != subscription.Monthly || got.Amount.String() != "9.99" {
+			t.Errorf("got subscription %v want a monthly payment of 9.99", got)
+		}
+	})
+
+	t.Run("reads the columns named in the form", func(t *testing.T) {
+		store := &StubDataStore{}
+		server := NewServer(store, &StubMailer{}, testSources(&stubTransactionAPI{}))
+
+		fields := map[string]string{"date": "When", "description": "Payee", "amount": "Value", "sign": "debit-positive", "dateFormat": "2006-01-02"}
+		request := newStatementRequest(t, "/api/statements/csv", fields, "When,Payee,Value\n2020-10-12,PureGym,34.99\n")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if len(store.transactions) != 1 || store.transactions[0].Amount.String() != "34.99" || store.transactions[0].Name != "PureGym" {
+			t.Errorf("got stored transactions %v want a payment of 34.99 to PureGym", store.transactions)
+		}
+	})
+
+	t.Run("rejects statements that can't be read", func(t *testing.T) {
+		cases := []struct {
+			name      string
+			fields    map[string]string
+			statement string
+		}{
+			{"unknown bank", map[string]string{"bank": "piggybank"}, csvFile},
+			{"no mapping", map[string]string{}, csvFile},
+			{"wrong columns", map[string]string{"bank": "monzo"}, csvFile},
+			{"invalid row", map[string]string{"bank": "starling"}, csvFile + "yesterday,Netflix,,,-9.99,\n"},
+		}
+
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				store := &StubDataStore{}
+				server := NewServer(store, &StubMailer{}, testSources(&stubTransactionAPI{}))
+
+				response := httptest.NewRecorder()
+				server.ServeHTTP(response, newStatementRequest(t, "/api/statements/csv", c.fields, c.statement))
+
+				assertStatus(t, response.Code, http.StatusBadRequest)
+				if len(store.transactions) != 0 {
+					t.Errorf("got %d stored transactions want none", len(store.transactions))
+				}
+			})
+		}
+	})
+}
+
+func ofxStatement(dates ...time.Time) string {
+	var transactions strings.Builder
+	for i, date := range dates {
+		fmt.Fprintf(&transactions, "<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>%s<TRNAMT>-9.99<FITID>%d<NAME>SPOTIFY</STMTTRN>\n", date.Format("20060102"), i)
+	}
+	return "OFXHEADER:100\nDATA:OFXSGML\nVERSION:102\n\n<OFX><BANKMSGSRSV1><STMTTRNRS><STMTRS><CURDEF>GBP\n" +
+		"<BANKACCTFROM><ACCTID>12345678</BANKACCTFROM><BANKTRANLIST>\n" + transactions.String() +
+		"</BANKTRANLIST></STMTRS></STMTTRNRS></BANKMSGSRSV1></OFX>\n"
+}
+
+func TestOFXStatementAPI(t *testing.T) {
+	today := time.Now()
+	ofxFile := ofxStatement(today.AddDate(0, -2, 0), today.AddDate(0, -1, 0), today)
+
+	t.Run("imports the statement and queues the subscriptions detected in it for review", func(t *testing.T) {
+		store := &StubDataStore{}
+		server := NewServer(store, &StubMailer{}, testSources(&stubTransactionAPI{}))
+
+		request := newStatementRequest(t, "/api/statements/ofx", nil, ofxFile)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, JSONContentType)
+
+		if len(store.transactions) != 3 || store.transactions[0].ExternalID != "12345678/0" || store.transactions[0].Currency != "GBP" {
+			t.Errorf("got stored transactions %v want the 3 payments in the statement", store.transactions)
+		}
+		if len(store.candidates) != 1 || store.candidates[0].Merchant != "spotify" {
+			t.Errorf("got candidates %v want one for spotify", store.candidates)
+		}
+	})
+
+	t.Run("rejects a file that isn't OFX", func(t *testing.T) {
+		store := &StubDataStore{}
+		server := NewServer(store, &StubMailer{}, testSources(&stubTransactionAPI{}))
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newStatementRequest(t, "/api/statements/ofx", nil, "Date,Description,Amount\n"))
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+	})
+
+	t.Run("loads subscriptions from a statement used as the transaction API", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "statement.ofx")
+		err := ioutil.WriteFile(path, []byte(ofxFile), 0600)
+		if err != nil {
+			t.Fatalf("unable to write statement: %v", err)
+		}
+
+		store := &StubDataStore{}
+		server := NewServer(store, &StubMailer{}, testSources(statement.File{Path: path, Parse: statement.ParseOFX}))
+
+		request := newUserRequest(http.MethodPost, "/api/transactions/load-subscriptions", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if len(store.candidates) != 1 || store.candidates[0].Merchant != "spotify" {
+			t.Errorf("got candidates %v want one for spotify", store.candidates)
+		}
+	})
+}
+
+func TestCorporateStatementAPI(t *testing.T) {
+	cases := []struct {
+		name      string
+		path      string
+		statement string
+	}{
+		{
+			"camt.053",
+			"/api/statements/camt053",
+			`<Document><BkToCstmrStmt><Stmt><Acct><Id><IBAN>GB33BUKB20201555555555</IBAN></Id><Ccy>GBP</Ccy></Acct>
+				<Ntry><Amt Ccy="GBP">9.99</Amt><CdtDbtInd>DBIT</CdtDbtInd><Sts>BOOK</Sts><BookgDt><Dt>2020-10-12</Dt></BookgDt>
+				<AcctSvcrRef>E1</AcctSvcrRef><NtryDtls><TxDtls><RltdPties><Cdtr><Nm>NETFLIX.COM</Nm></Cdtr></RltdPties></TxDtls></NtryDtls></Ntry>
+			</Stmt></BkToCstmrStmt></Document>`,
+		},
+		{
+			"MT940",
+			"/api/statements/mt940",
+			":20:STMT\n:25:GB33BUKB20201555555555\n:60F:C201001GBP1000,00\n:61:201012D9,99NDDTNONREF//E1\n:86:NETFLIX.COM\n:62F:C201031GBP990,01\n-\n",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			store := &StubDataStore{}
+			server := NewServer(store, &StubMailer{}, testSources(&stubTransactionAPI{}))
+
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newStatementRequest(t, c.path, nil, c.statement))
+			assertStatus(t, response.Code, http.StatusOK)
+
+			if len(store.transactions) != 1 {
+				t.Fatalf("got %d stored transactions want 1", len(store.transactions))
+			}
+			got := store.transactions[0]
+			if got.ExternalID != "GB33BUKB20201555555555/E1" || got.Name != "NETFLIX.COM" || got.Amount.String() != "9.99" {
+				t.Errorf("got stored transaction %v want a payment of 9.99 to NETFLIX.COM", got)
+			}
+		})
+
+		t.Run(c.name+" rejects a CSV statement", func(t *testing.T) {
+			server := NewServer(&StubDataStore{}, &StubMailer{}, testSources(&stubTransactionAPI{}))
+
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newStatementRequest(t, c.path, nil, "Date,Description,Amount\n"))
+			assertStatus(t, response.Code, http.StatusBadRequest)
+		})
+	}
+}
+
+func TestCandidatesAPI(t *testing.T) {
+	amount, _ := decimal.NewFromString("9.99")
+	newStore := func() *StubDataStore {
+		return &StubDataStore{candidates: []subscription.Candidate{{
+			ID:           1,
+			Merchant:     "netflix",
+			Confidence:   0.5,
+			Transactions: []plaid.Transaction{{Amount: 9.99, Date: "2020-09-12", Name: "Netflix"}},
+			Subscription: subscription.Subscription{
+				Name:      "NETFLIX.COM",
+				Merchant:  "netflix",
+				Amount:    amount,
+				DateDue:   time.Date(2020, time.December, 12, 0, 0, 0, 0, time.UTC),
+				Frequency: subscription.Monthly,
+				Interval:  1,
+			},
+		}}}
+	}
+
+	t.Run("returns the candidates in JSON format", func(t *testing.T) {
+		store := newStore()
+		server := NewServer(store, &StubMailer{}, testSources(&stubTransactionAPI{}))
+
+		request := newUserRequest(http.MethodGet, "/api/candidates", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, JSONContentType)
+
+		var got []subscription.Candidate
+		err := json.NewDecoder(response.Body).Decode(&got)
+		if err != nil {
+			t.Fatalf("unable to parse response from server %q into candidates, '%v'", response.Body, err)
+		}
+		if len(got) != 1 || got[0].Merchant != "netflix" || len(got[0].Transactions) != 1 {
+			t.Errorf("got %v want the netflix candidate", got)
+		}
+	})
+
+	t.Run("accepting a candidate stores it as a subscription", func(t *testing.T) {
+		store := newStore()
+		server := NewServer(store, &StubMailer{}, testSources(&stubTransactionAPI{}))
+
+		request := newUserRequest(http.MethodPost, "/api/candidates/1/accept", http.NoBody)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		want := []subscription.Subscription{newStore().candidates[0].Subscription}
+		assertSubscriptions(t, store.subscriptions, want)
+		if len(store.candidates) != 0 {
+			t.Errorf("accepted candidate is still waiting for review")
+		}
+	})
+
+	t.Run("accepts a candidate with the edits in the post body", func(t *testing.T) {
+		store := newStore()
+		server := NewServer(store, &StubMailer{}, testSources(&stubTransactionAPI{}))
+
+		body := bytes.NewBufferString(`{"name": "Netflix", "frequency": "annually"}`)
+		request := newUserRequest(http.MethodPost, "/api/candidates/1/accept", body)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if len(store.subscriptions) != 1 {
+			t.Fatalf("got %d stored subscriptions want 1", len(store.subscriptions))
+		}
+		got := store.subscriptions[0]
+		if got.Name != "Netflix" || got.Frequency != subscription.Annually || got.Merchant != "netflix" || !got.Amount.Equal(amount) {
+			t.Errorf("got %v want the edited candidate", got)
+		}
+	})
+
+	t.Run("rejects edits with an unknown frequency", func(t *testing.T) {
+		store := newStore()
+		server := NewServer(store, &StubMailer{}, testSources(&stubTransactionAPI{}))
+
+		body := bytes.NewBufferString(`{"frequency": "hourly"}`)
+		request := newUserRequest(http.MethodPost, "/api/candidates/1/accept", body)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusBadRequest)
+
+		if len(store.candidates) != 1 {
+			t.Errorf("candidate was removed from the review queue")
+		}
+	})
+
+	t.Run("rejecting a candidate remembers the merchant", func(t *testing.T) {
+		store := newStore()
+		server := NewServer(store, &StubMailer{}, testSources(&stubTransactionAPI{}))
+
+		request := newUserRequest(http.MethodPost, "/api/candidates/1/reject", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if len(store.subscriptions) != 0 || len(store.candidates) != 0 {
+			t.Errorf("got %d subscriptions and %d candidates want none", len(store.subscriptions), len(store.candidates))
+		}
+		if !reflect.DeepEqual(store.rejected, []string{"netflix"}) {
+			t.Errorf("got rejected merchants %v want %v", store.rejected, []string{"netflix"})
+		}
+	})
+
+	t.Run("returns a 404 for a candidate that doesn't exist", func(t *testing.T) {
+		server := NewServer(newStore(), &StubMailer{}, testSources(&stubTransactionAPI{}))
+
+		request := newUserRequest(http.MethodPost, "/api/candidates/7/accept", http.NoBody)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+
+	t.Run("forgets a rejected merchant", func(t *testing.T) {
+		store := &StubDataStore{rejected: []string{"netflix"}}
+		server := NewServer(store, &StubMailer{}, testSources(&stubTransactionAPI{}))
+
+		request := newUserRequest(http.MethodDelete, "/api/rejected-merchants/netflix", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if len(store.rejected) != 0 {
+			t.Errorf("got rejected merchants %v want none", store.rejected)
+		}
+	})
+}
+
+func TestGETSubscriptions(t *testing.T) {
+
+	t.Run("return subscriptions in JSON format", func(t *testing.T) {
+		amount, _ := decimal.NewFromString("100.99")
+		wantedSubscriptions := []subscription.Subscription{
+			{ID: 1, Name: "Netflix", Amount: amount, DateDue: time.Date(2020, time.November, 11, 0, 0, 0, 0, time.UTC)},
+		}
+
+		store := &StubDataStore{subscriptions: wantedSubscriptions}
+
+		transactionAPI := &stubTransactionAPI{}
+		server := NewServer(store, &StubMailer{}, testSources(transactionAPI))
+
+		request := newGetSubscriptionRequest(t)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		got := getSubscriptionsFromResponse(t, response.Body)
+		assertSubscriptions(t, got, wantedSubscriptions)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, JSONContentType)
+	})
+}
+
+func TestStoreSubscription(t *testing.T) {
+
+	t.Run("stores a subscription we POST to the server", func(t *testing.T) {
+		amount, _ := decimal.NewFromString("100.99")
+		subscription := subscription.Subscription{Name: "Netflix", Merchant: "netflix", Amount: amount, DateDue: time.Date(2020, time.November, 11, 0, 0, 0, 0, time.UTC), Frequency: subscription.Monthly}
+
+		store := &StubDataStore{}
+		transactionAPI := &stubTransactionAPI{}
+		server := NewServer(store, &StubMailer{}, testSources(transactionAPI))
+
+		request := newPostSubscriptionRequest(t, subscription)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if len(store.subscriptions) != 1 {
+			t.Errorf("got %d calls to RecordSubscription want %d", len(store.subscriptions), 1)
+		}
+
+		if !reflect.DeepEqual(store.subscriptions[0], subscription) {
+			t.Errorf("did not store correct subscription got %v want %v", store.subscriptions[0], subscription)
+		}
+	})
+
+	t.Run("stores the frequency of a subscription", func(t *testing.T) {
+		amount, _ := decimal.NewFromString("59.00")
+		newSubscription := subscription.Subscription{Name: "Amazon Prime", Amount: amount, DateDue: time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC), Frequency: subscription.Annually}
+
+		store := &StubDataStore{}
+		server := NewServer(store, &StubMailer{}, testSources(&stubTransactionAPI{}))
+
+		request := newPostSubscriptionRequest(t, newSubscription)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if store.subscriptions[0].Frequency != subscription.Annually {
+			t.Errorf("did not store frequency got %v want %v", store.subscriptions[0].Frequency, subscription.Annually)
+		}
+	})
+
+	t.Run("stores the canonical merchant of a subscription", func(t *testing.T) {
+		newSubscription := subscription.Subscription{Name: "AMZN Mktp UK*1A2B3C", DateDue: time.Date(2020, time.November, 11, 0, 0, 0, 0, time.UTC)}
+
+		store := &StubDataStore{aliases: []merchant.Alias{{ID: 1, Pattern: "amzn mktp", Merchant: "Amazon"}}}
+		server := NewServer(store, &StubMailer{}, testSources(&stubTransactionAPI{}))
+
+		request := newPostSubscriptionRequest(t, newSubscription)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if store.subscriptions[0].Merchant != "amazon" {
+			t.Errorf("did not store canonical merchant got %q want %q", store.subscriptions[0].Merchant, "amazon")
+		}
+	})
+
+	t.Run("rejects a subscription with no due date", func(t *testing.T) {
+		newSubscription := subscription.Subscription{Name: "Netflix", Frequency: subscription.Monthly}
+
+		store := &StubDataStore{}
+		server := NewServer(store, &StubMailer{}, testSources(&stubTransactionAPI{}))
+
+		request := newPostSubscriptionRequest(t, newSubscription)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusBadRequest)
+
+		if len(store.subscriptions) != 0 {
+			t.Errorf("got %d calls to RecordSubscription want %d", len(store.subscriptions), 0)
+		}
+	})
+
+	dateDue := time.Date(2020, time.November, 11, 0, 0, 0, 0, time.UTC)
+	invalid := map[string]subscription.Subscription{
+		"an empty name":                       {Name: "  ", DateDue: dateDue},
+		"a negative amount":                   {Name: "Netflix", Amount: decimal.RequireFromString("-1"), DateDue: dateDue},
+		"an unknown frequency":                {Name: "Netflix", DateDue: dateDue, Frequency: "hourly"},
+		"a custom frequency with no interval": {Name: "Netflix", DateDue: dateDue, Frequency: subscription.EveryNDays},
+	}
+	for name, newSubscription := range invalid {
+		t.Run("rejects a subscription with "+name, func(t *testing.T) {
+			store := &StubDataStore{}
+			server := NewServer(store, &StubMailer{}, testSources(&stubTransactionAPI{}))
+
+			request := newPostSubscriptionRequest(t, newSubscription)
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, request)
+			assertStatus(t, response.Code, http.StatusBadRequest)
+
+			if len(store.subscriptions) != 0 {
+				t.Errorf("got %d calls to RecordSubscription want %d", len(store.subscriptions), 0)
+			}
+		})
+	}
+}
+
+func TestCreateReminder(t *testing.T) {
+
+	t.Run("creates a reminder for subscription and returns a confirmation that a reminder invite has been sent", func(t *testing.T) {
+		amount, _ := decimal.NewFromString("100.99")
+		subscriptions := []subscription.Subscription{
+			{ID: 1, Name: "Netflix", Amount: amount, DateDue: time.Date(2020, time.November, 11, 0, 0, 0, 0, time.UTC)},
+		}
+
+		store := &StubDataStore{subscriptions: subscriptions}
+		transactionAPI := &stubTransactionAPI{}
+		server := NewServer(store, &StubMailer{}, testSources(transactionAPI))
+
+		request := newPostReminderRequest(t, subscriptions[0].ID)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+	})
+
+}
+
+func assertStatus(t *testing.T, got, want int) {
+	t.Helper()
+	if got != want {
+		t.Errorf("did not get correct status, got %d, want %d", got, want)
+	}
+}
+
+func assertSubscriptions(t *testing.T, got, want []subscription.Subscription) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+}
+
+func assertContentType(t *testing.T, response *httptest.ResponseRecorder, want string) {
+	t.Helper()
+	if response.Result().Header.Get("content-type") != want {
+		t.Errorf("response did not have content-type of %s, got %v", want, response.Result().Header)
+	}
+}
+
+func getSubscriptionsFromResponse(t *testing.T, body io.Reader) (subscriptions []subscription.Subscription) {
+	t.Helper()
+	err := json.NewDecoder(body).Decode(&subscriptions)
+	if err != nil {
+		t.Fatalf("unable to parse response from server %q into slice of Subscription, '%v'", body, err)
+	}
+	return
+}
+
+func TestDeleteSubscriptionAPI(t *testing.T) {
+
+	t.Run("deletes the specified subscription from the data store and returns 200", func(t *testing.T) {
+		subscriptions := []subscription.Subscription{{ID: 1}}
+		store := &StubDataStore{subscriptions: subscriptions}
+
+		transactionAPI := &stubTransactionAPI{}
+		server := NewServer(store, &StubMailer{}, testSources(transactionAPI))
+
+		request := newDeleteSubscriptionRequest(t, 1)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		if len(store.deleteCount) != 1 {
+			t.Errorf("got %d calls to DeleteSubscription want %d", len(store.deleteCount), 1)
+		}
+	})
+
+	t.Run("returns 404 if given subscription ID doesn't exist", func(t *testing.T) {
+		subscriptions := []subscription.Subscription{{ID: 1}}
+		store := &StubDataStore{subscriptions: subscriptions}
+
+		transactionAPI := &stubTransactionAPI{}
+		server := NewServer(store, &StubMailer{}, testSources(transactionAPI))
+
+		request := newDeleteSubscriptionRequest(t, 2)
+
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+}
+
+func TestUpdateSubscriptionAPI(t *testing.T) {
+	serve := func(store *StubDataStore, method string, body string) *httptest.ResponseRecorder {
+		server := NewServer(store, &StubMailer{}, testSources(&stubTransactionAPI{}))
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newUserRequest(method, "/api/subscriptions/1", strings.NewReader(body)))
+		return response
+	}
+
+	decodeSubscription := func(t *testing.T, response *httptest.ResponseRecorder) subscription.Subscription {
+		t.Helper()
+		var got subscription.Subscription
+		err := json.NewDecoder(response.Body).Decode(&got)
+		if err != nil {
+			t.Fatalf("unable to parse response from server %q into subscription, '%v'", response.Body, err)
+		}
+		return got
+	}
+
+	t.Run("returns a subscription on GET", func(t *testing.T) {
+		response := serve(&StubDataStore{}, http.MethodGet, "")
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, JSONContentType)
+
+		if got := decodeSubscription(t, response); got.ID != 1 || got.Name != "Netflix" {
+			t.Errorf("got %+v want subscription 1", got)
+		}
+	})
+
+	t.Run("replaces a subscription on PUT", func(t *testing.T) {
+		store := &StubDataStore{}
+		response := serve(store, http.MethodPut, `{"name": " Netflix Premium ", "merchant": "netflix", "amount": "15.99", "dateDue": "2020-12-11T00:00:00Z", "frequency": "months", "interval": 2}`)
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, JSONContentType)
+
+		want := subscription.Subscription{
+			ID:        1,
+			Name:      "Netflix Premium",
+			Merchant:  "netflix",
+			Amount:    decimal.RequireFromString("15.99"),
+			DateDue:   time.Date(2020, time.December, 11, 0, 0, 0, 0, time.UTC),
+			Frequency: subscription.EveryNMonths,
+			Interval:  2,
+		}
+		if len(store.updated) != 1 || !reflect.DeepEqual(store.updated[0], want) {
+			t.Fatalf("got updates %+v want %+v", store.updated, want)
+		}
+		if got := decodeSubscription(t, response); got.Name != want.Name || !got.Amount.Equal(want.Amount) {
+			t.Errorf("got %+v want %+v", got, want)
+		}
+	})
+
+	t.Run("changes only the fields given on PATCH", func(t *testing.T) {
+		store := &StubDataStore{}
+		response := serve(store, http.MethodPatch, `{"amount": "12.99"}`)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if len(store.updated) != 1 {
+			t.Fatalf("got %d calls to UpdateSubscription want 1", len(store.updated))
+		}
+		got := store.updated[0]
+		if got.ID != 1 || got.Name != "Netflix" || !got.Amount.Equal(decimal.RequireFromString("12.99")) {
+			t.Errorf("got %+v want Netflix at 12.99", got)
+		}
+		if got.Frequency != subscription.Monthly || got.Interval != 1 {
+			t.Errorf("got cadence %s every %d want the default", got.Frequency, got.Interval)
+		}
+		if !got.DateDue.Equal(time.Date(2020, time.November, 11, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("got date due %v want it unchanged", got.DateDue)
+		}
+	})
+
+	t.Run("uses the catalogue's merchant for a known merchant on PUT", func(t *testing.T) {
+		store := &StubDataStore{}
+		merchants := catalogue.New([]catalogue.Entry{{Merchant: "Amazon Prime", Patterns: []string{"prime video"}}})
+		server := NewServer(store, &StubMailer{}, testSources(&stubTransactionAPI{}), WithCatalogue(merchants))
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newUserRequest(http.MethodPut, "/api/subscriptions/1", strings.NewReader(`{"name": "Prime Video", "amount": "9.99", "dateDue": "2020-12-11T00:00:00Z"}`)))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if len(store.updated) != 1 || store.updated[0].Merchant != "amazon prime" {
+			t.Errorf("got updates %+v want the merchant amazon prime", store.updated)
+		}
+	})
+
+	t.Run("rematches payments when the merchant changes", func(t *testing.T) {
+		amount := decimal.RequireFromString("9.99")
+		store := &StubDataStore{
+			subscriptions: []subscription.Subscription{{ID: 1, Name: "Netflix", Merchant: "netflix", Amount: amount}},
+			transactions: []transaction.Transaction{
+				{ExternalID: "tx-1", Merchant: "netflix", Amount: amount, SubscriptionID: 1},
+				{ExternalID: "tx-2", Merchant: "spotify", Amount: amount},
+			},
+		}
+		response := serve(store, http.MethodPatch, `{"merchant": "spotify"}`)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		matched := map[string]int{}
+		for _, t := range store.transactions {
+			matched[t.ExternalID] = t.SubscriptionID
+		}
+		want := map[string]int{"tx-1": 0, "tx-2": 1}
+		if !reflect.DeepEqual(matched, want) {
+			t.Errorf("got payments matched %v want %v", matched, want)
+		}
+	})
+
+	invalid := map[string]struct {
+		method string
+		body   string
+	}{
+		"an empty name":                       {http.MethodPatch, `{"name": "  "}`},
+		"a negative amount":                   {http.MethodPatch, `{"amount": "-1"}`},
+		"an unknown frequency":                {http.MethodPatch, `{"frequency": "hourly"}`},
+		"a custom frequency with no interval": {http.MethodPatch, `{"frequency": "days"}`},
+		"an unknown field":                    {http.MethodPatch, `{"price": "1"}`},
+		"a subscription with no due date":     {http.MethodPut, `{"name": "Netflix", "amount": "9.99"}`},
+		"a different ID":                      {http.MethodPut, `{"id": 2, "name": "Netflix", "amount": "9.99", "dateDue": "2020-12-11T00:00:00Z"}`},
+		"a body that isn't json":              {http.MethodPut, `netflix`},
+	}
+	for name, c := range invalid {
+		t.Run("returns 400 for "+name, func(t *testing.T) {
+			store := &StubDataStore{}
+			response := serve(store, c.method, c.body)
+			assertStatus(t, response.Code, http.StatusBadRequest)
+
+			if len(store.updated) != 0 {
+				t.Errorf("got %d calls to UpdateSubscription want none", len(store.updated))
+			}
+		})
+	}
+
+	t.Run("returns 404 if given subscription ID doesn't exist", func(t *testing.T) {
+		server := NewServer(&StubDataStore{}, &StubMailer{}, testSources(&stubTransactionAPI{}))
+
+		for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodPatch} {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newUserRequest(method, "/api/subscriptions/2", strings.NewReader(`{"name": "Netflix", "amount": "9.99", "dateDue": "2020-12-11T00:00:00Z"}`)))
+			assertStatus(t, response.Code, http.StatusNotFound)
+		}
+	})
+}
+
+func TestGetRenewalsAPI(t *testing.T) {
+
+	t.Run("returns the past due dates of a subscription", func(t *testing.T) {
+		amount, _ := decimal.NewFromString("100.99")
+		renewals := []subscription.Renewal{
+			{SubscriptionID: 1, DateDue: time.Date(2020, time.October, 11, 0, 0, 0, 0, time.UTC), Amount: amount},
+		}
+		store := &StubDataStore{renewals: renewals}
+		server := NewServer(store, &StubMailer{}, testSources(&stubTransactionAPI{}))
+
+		request := newUserRequest(http.MethodGet, "/api/subscriptions/1/renewals", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, JSONContentType)
+
+		var got []subscription.Renewal
+		err := json.NewDecoder(response.Body).Decode(&got)
+		if err != nil {
+			t.Fatalf("unable to parse response from server %q into renewals, '%v'", response.Body, err)
+		}
+
+		if len(got) != 1 || !got[0].DateDue.Equal(renewals[0].DateDue) {
+			t.Errorf("got %v want %v", got, renewals)
+		}
+	})
+
+	t.Run("returns 404 if given subscription ID doesn't exist", func(t *testing.T) {
+		server := NewServer(&StubDataStore{}, &StubMailer{}, testSources(&stubTransactionAPI{}))
+
+		request := newUserRequest(http.MethodGet, "/api/subscriptions/2/renewals", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+}
+
+func TestGetPaymentsAPI(t *testing.T) {
+
+	t.Run("returns the payments matched to a subscription", func(t *testing.T) {
+		amount, _ := decimal.NewFromString("9.99")
+		store := &StubDataStore{transactions: []transaction.Transaction{
+			{ExternalID: "tx-1", Name: "AMAZON PRIME", Merchant: "amazon prime", Amount: amount, SubscriptionID: 1},
+			{ExternalID: "tx-2", Name: "SPOTIFY", Merchant: "spotify", Amount: amount},
+		}}
+		server := NewServer(store, &StubMailer{}, testSources(&stubTransactionAPI{}))
+
+		request := newUserRequest(http.MethodGet, "/api/subscriptions/1/payments", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, JSONContentType)
+
+		var got []transaction.Transaction
+		err := json.NewDecoder(response.Body).Decode(&got)
+		if err != nil {
+			t.Fatalf("unable to parse response from server %q into payments, '%v'", response.Body, err)
+		}
+
+		if len(got) != 1 || got[0].ExternalID != "tx-1" {
+			t.Errorf("got %v want the Netflix payment", got)
+		}
+	})
+
+	t.Run("returns 404 if given subscription ID doesn't exist", func(t *testing.T) {
+		server := NewServer(&StubDataStore{}, &StubMailer{}, testSources(&stubTransactionAPI{}))
+
+		request := newUserRequest(http.MethodGet, "/api/subscriptions/2/payments", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+}
+
+func TestMerchantAliasesAPI(t *testing.T) {
+
+	t.Run("stores an alias rule we POST to the server", func(t *testing.T) {
+		store := &StubDataStore{}
+		server := NewServer(store, &StubMailer{}, testSources(&stubTransactionAPI{}))
+
+		body, _ := json.Marshal(merchant.Alias{Pattern: "AMZN Mktp", Merchant: "Amazon"})
+		request := newUserRequest(http.MethodPost, "/api/merchant-aliases", bytes.NewBuffer(body))
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, JSONContentType)
+
+		if len(store.aliases) != 1 || store.aliases[0].Merchant != "Amazon" {
+			t.Errorf("did not store alias got %v", store.aliases)
+		}
+		if !reflect.DeepEqual(store.recordedFor, []int{testUserID}) {
+			t.Errorf("got aliases recorded for users %v want %v", store.recordedFor, []int{testUserID})
+		}
+	})
+
+	t.Run("rejects an alias rule without a pattern", func(t *testing.T) {
+		store := &StubDataStore{}
+		server := NewServer(store, &StubMailer{}, testSources(&stubTransactionAPI{}))
+
+		body, _ := json.Marshal(merchant.Alias{Pattern: " ", Merchant: "Amazon"})
+		request := newUserRequest(http.MethodPost, "/api/merchant-aliases", bytes.NewBuffer(body))
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusBadRequest)
+	})
+
+	t.Run("returns the alias rules in JSON format", func(t *testing.T) {
+		store := &StubDataStore{aliases: []merchant.Alias{{ID: 1, Pattern: "amzn", Merchant: "Amazon"}}}
+		server := NewServer(store, &StubMailer{}, testSources(&stubTransactionAPI{}))
+
+		request := newUserRequest(http.MethodGet, "/api/merchant-aliases", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		var got []merchant.Alias
+		err := json.NewDecoder(response.Body).Decode(&got)
+		if err != nil {
+			t.Fatalf("unable to parse response from server %q into aliases, '%v'", response.Body, err)
+		}
+
+		if !reflect.DeepEqual(got, store.aliases) {
+			t.Errorf("got %v want %v", got, store.aliases)
+		}
+	})
+
+	t.Run("deletes an alias rule", func(t *testing.T) {
+		store := &StubDataStore{}
+		server := NewServer(store, &StubMailer{}, testSources(&stubTransactionAPI{}))
+
+		request := newUserRequest(http.MethodDelete, "/api/merchant-aliases/3", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if len(store.deleteCount) != 1 || store.deleteCount[0] != 3 {
+			t.Errorf("got calls to DeleteMerchantAlias %v want %v", store.deleteCount, []int{3})
+		}
+	})
+}
+
+type stubBankLinks struct {
+	stubTransactionAPI
+	items    []plaid.Item
+	unlinked []int
+}
+
+func (s *stubBankLinks) Items(ctx context.Context) ([]plaid.Item, error) {
+	return s.items, nil
+}
+
+func (s *stubBankLinks) Unlink(ctx context.Context, ID int) error {
+	for _, item := range s.items {
+		if item.ID == ID {
+			s.unlinked = append(s.unlinked, ID)
+			return nil
+		}
+	}
+	return plaid.ErrItemNotFound
+}
+
+func TestLinkedBanksAPI(t *testing.T) {
+
+	t.Run("returns the linked banks in JSON format", func(t *testing.T) {
+		bankLinks := &stubBankLinks{items: []plaid.Item{{ID: 1, ItemID: "item-sandbox", InstitutionID: "ins_3"}}}
+		server := NewServer(&StubDataStore{}, &StubMailer{}, testSources(bankLinks))
+
+		request := newUserRequest(http.MethodGet, "/api/linked-banks", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, JSONContentType)
+
+		var got []plaid.Item
+		err := json.NewDecoder(response.Body).Decode(&got)
+		if err != nil {
+			t.Fatalf("unable to parse response from server %q into linked banks, '%v'", response.Body, err)
+		}
+
+		if !reflect.DeepEqual(got, bankLinks.items) {
+			t.Errorf("got %v want %v", got, bankLinks.items)
+		}
+	})
+
+	t.Run("lists and unlinks the banks of every source", func(t *testing.T) {
+		sandbox := &stubBankLinks{items: []plaid.Item{{ID: 1, Source: "plaid", ItemID: "item-sandbox"}}}
+		monzo := &stubBankLinks{items: []plaid.Item{{ID: 2, Source: "monzo", ItemID: "item-monzo"}}}
+		sources := NewSources()
+		_ = sources.Register("plaid", sandbox)
+		_ = sources.Register("monzo", monzo)
+		server := NewServer(&StubDataStore{}, &StubMailer{}, sources)
+
+		request := newUserRequest(http.MethodGet, "/api/linked-banks", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		var got []plaid.Item
+		err := json.NewDecoder(response.Body).Decode(&got)
+		if err != nil {
+			t.Fatalf("unable to parse response from server %q into linked banks, '%v'", response.Body, err)
+		}
+		if len(got) != 2 || got[0].Source != "plaid" || got[1].Source != "monzo" {
+			t.Errorf("got %v want the banks linked by plaid and monzo", got)
+		}
+
+		request = newUserRequest(http.MethodDelete, "/api/linked-banks/2", nil)
+		response = httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if len(sandbox.unlinked) != 0 || !reflect.DeepEqual(monzo.unlinked, []int{2}) {
+			t.Errorf("got unlinked %v from plaid and %v from monzo want 2 from monzo", sandbox.unlinked, monzo.unlinked)
+		}
+	})
+
+	t.Run("returns no linked banks when banks aren't stored", func(t *testing.T) {
+		server := NewServer(&StubDataStore{}, &StubMailer{}, testSources(&stubTransactionAPI{}))
+
+		request := newUserRequest(http.MethodGet, "/api/linked-banks", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if got := strings.TrimSpace(response.Body.String()); got != "[]" {
+			t.Errorf("got %s want []", got)
+		}
+	})
+
+	t.Run("unlinks a bank", func(t *testing.T) {
+		bankLinks := &stubBankLinks{items: []plaid.Item{{ID: 1, ItemID: "item-sandbox"}}}
+		server := NewServer(&StubDataStore{}, &StubMailer{}, testSources(bankLinks))
+
+		request := newUserRequest(http.MethodDelete, "/api/linked-banks/1", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if !reflect.DeepEqual(bankLinks.unlinked, []int{1}) {
+			t.Errorf("got calls to Unlink %v want %v", bankLinks.unlinked, []int{1})
+		}
+	})
+
+	t.Run("returns 404 for a bank that isn't linked", func(t *testing.T) {
+		server := NewServer(&StubDataStore{}, &StubMailer{}, testSources(&stubBankLinks{}))
+
+		request := newUserRequest(http.MethodDelete, "/api/linked-banks/7", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+}
+
+type stubPlaidWebhooks struct {
+	statuses map[string]string
+}
+
+func (s *stubPlaidWebhooks) VerifyWebhook(ctx context.Context, body []byte, token string) error {
+	if token != "valid-signature" {
+		return plaid.ErrWebhookSignature
+	}
+	return nil
+}
+
+func (s *stubPlaidWebhooks) SetItemStatus(ctx context.Context, itemID string, status string) error {
+	if itemID != "item-sandbox" {
+		return plaid.ErrItemNotFound
+	}
+	s.statuses[itemID] = status
+	return nil
+}
+
+func (s *stubPlaidWebhooks) LinkedItem(ctx context.Context, itemID string) (*plaid.Item, error) {
+	if itemID != "item-sandbox" {
+		return nil, plaid.ErrItemNotFound
+	}
+	return &plaid.Item{ID: 1, UserID: testUserID, Source: "plaid", ItemID: itemID}, nil
+}
+
+// stubPlaidSource is a Plaid transaction source registered as monzo, which syncs and records the errors reported
+// for the bank it linked
+type stubPlaidSource struct {
+	stubTransactionSyncer
+	statuses map[string]string
+}
+
+func (s *stubPlaidSource) VerifyWebhook(ctx context.Context, body []byte, token string) error {
+	return nil
+}
+
+func (s *stubPlaidSource) SetItemStatus(ctx context.Context, itemID string, status string) error {
+	if itemID != "item-monzo" {
+		return plaid.ErrItemNotFound
+	}
+	s.statuses[itemID] = status
+	return nil
+}
+
+func (s *stubPlaidSource) LinkedItem(ctx context.Context, itemID string) (*plaid.Item, error) {
+	if itemID != "item-monzo" {
+		return nil, plaid.ErrItemNotFound
+	}
+	return &plaid.Item{ID: 2, UserID: 2, Source: "monzo", ItemID: itemID}, nil
+}
+
+// blockingTransactionSyncer doesn't return its changes until it is released
+type blockingTransactionSyncer struct {
+	stubTransactionSyncer
+	release chan struct{}
+}
+
+func (s *blockingTransactionSyncer) SyncTransactions(ctx context.Context) (plaid.TransactionChanges, error) {
+	<-s.release
+	return s.stubTransactionSyncer.SyncTransactions(ctx)
+}
+
+func newPlaidWebhookRequest(body string, signature string) *http.Request {
+	request, _ := http.NewRequest(http.MethodPost, "/api/webhooks/plaid", strings.NewReader(body))
+	request.Header.Set("Plaid-Verification", signature)
+	return request
+}
+
+func TestPlaidWebhookAPI(t *testing.T) {
+
+	t.Run("imports transactions when plaid reports updates", func(t *testing.T) {
+		for _, code := range []string{"SYNC_UPDATES_AVAILABLE", "DEFAULT_UPDATE", "HISTORICAL_UPDATE", "TRANSACTIONS_REMOVED"} {
+			store := &StubDataStore{}
+			merchants := catalogue.New([]catalogue.Entry{{Merchant: "Netflix"}})
+			transactionAPI := &stubTransactionSyncer{changes: plaid.TransactionChanges{
+				Added: []plaid.Transaction{{TransactionID: "tx-1", Amount: 9.99, Date: "2020-10-12", Name: "NETFLIX.COM"}},
+			}}
+			server := NewServer(store, &StubMailer{}, testSources(transactionAPI), WithCatalogue(merchants), WithPlaidWebhooks(&stubPlaidWebhooks{}))
+
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newPlaidWebhookRequest(`{"webhook_type": "TRANSACTIONS", "webhook_code": "`+code+`", "item_id": "item-sandbox"}`, "valid-signature"))
+			server.webhookSyncs.Wait()
+
+			assertStatus(t, response.Code, http.StatusOK)
+			if transactionAPI.syncCount != 1 || len(store.transactions) != 1 || len(store.candidates) != 1 {
+				t.Errorf("%s: got %d syncs, %d transactions and %d candidates want 1 of each", code, transactionAPI.syncCount, len(store.transactions), len(store.candidates))
+			}
+		}
+	})
+
+	t.Run("imports only the bank's changes from the source that linked it for the user who linked it", func(t *testing.T) {
+		store := &StubDataStore{}
+		transactionAPI := &stubTransactionSyncer{}
+		monzo := &stubPlaidSource{}
+		monzo.changes = plaid.TransactionChanges{
+			Added: []plaid.Transaction{{TransactionID: "tx-1", Amount: 9.99, Date: "2020-10-12", Name: "NETFLIX.COM"}},
+		}
+		sources := testSources(transactionAPI)
+		_ = sources.Register("monzo", monzo)
+		server := NewServer(store, &StubMailer{}, sources, WithPlaidWebhooks(&stubPlaidWebhooks{}))
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPlaidWebhookRequest(`{"webhook_type": "TRANSACTIONS", "webhook_code": "SYNC_UPDATES_AVAILABLE", "item_id": "item-monzo"}`, "valid-signature"))
+		server.webhookSyncs.Wait()
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if transactionAPI.syncCount != 0 {
+			t.Errorf("got %d syncs of the default source want none", transactionAPI.syncCount)
+		}
+		if !reflect.DeepEqual(monzo.items, []string{"item-monzo"}) || !reflect.DeepEqual(monzo.syncedFor, []int{2}) {
+			t.Errorf("got syncs of items %v for users %v want item-monzo for user 2", monzo.items, monzo.syncedFor)
+		}
+		if len(store.transactions) != 1 || len(monzo.saved) != 1 {
+			t.Errorf("got %d transactions stored and %d cursor saves want the change stored and saved", len(store.transactions), len(monzo.saved))
+		}
+		for _, userID := range store.recordedFor {
+			if userID != 2 {
+				t.Errorf("got changes recorded for user %d want user 2", userID)
+			}
+		}
+	})
+
+	t.Run("responds to plaid before importing the changes", func(t *testing.T) {
+		store := &StubDataStore{}
+		transactionAPI := &blockingTransactionSyncer{release: make(chan struct{})}
+		transactionAPI.changes = plaid.TransactionChanges{
+			Added: []plaid.Transaction{{TransactionID: "tx-1", Amount: 9.99, Date: "2020-10-12", Name: "NETFLIX.COM"}},
+		}
+		server := NewServer(store, &StubMailer{}, testSources(transactionAPI), WithPlaidWebhooks(&stubPlaidWebhooks{}))
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPlaidWebhookRequest(`{"webhook_type": "TRANSACTIONS", "webhook_code": "SYNC_UPDATES_AVAILABLE", "item_id": "item-sandbox"}`, "valid-signature"))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		close(transactionAPI.release)
+		server.webhookSyncs.Wait()
+		if len(store.transactions) != 1 {
+			t.Errorf("got %d transactions want the change imported after responding", len(store.transactions))
+		}
+	})
+
+	t.Run("rejects a webhook without a valid signature", func(t *testing.T) {
+		transactionAPI := &stubTransactionSyncer{}
+		server := NewServer(&StubDataStore{}, &StubMailer{}, testSources(transactionAPI), WithPlaidWebhooks(&stubPlaidWebhooks{}))
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPlaidWebhookRequest(`{"webhook_type": "TRANSACTIONS", "webhook_code": "SYNC_UPDATES_AVAILABLE"}`, "forged"))
+
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+		if transactionAPI.syncCount != 0 {
+			t.Errorf("got %d syncs want none", transactionAPI.syncCount)
+		}
+	})
+
+	t.Run("records the error plaid reports for a linked bank", func(t *testing.T) {
+		webhooks := &stubPlaidWebhooks{statuses: map[string]string{}}
+		server := NewServer(&StubDataStore{}, &StubMailer{}, testSources(&stubTransactionSyncer{}), WithPlaidWebhooks(webhooks))
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPlaidWebhookRequest(`{"webhook_type": "ITEM", "webhook_code": "ERROR", "item_id": "item-sandbox", "error": {"error_type": "ITEM_ERROR", "error_code": "ITEM_LOGIN_REQUIRED"}}`, "valid-signature"))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if webhooks.statuses["item-sandbox"] != "ITEM_LOGIN_REQUIRED" {
+			t.Errorf("got status %q want %q", webhooks.statuses["item-sandbox"], "ITEM_LOGIN_REQUIRED")
+		}
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newPlaidWebhookRequest(`{"webhook_type": "ITEM", "webhook_code": "LOGIN_REPAIRED", "item_id": "item-sandbox"}`, "valid-signature"))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if webhooks.statuses["item-sandbox"] != "" {
+			t.Errorf("got status %q want it cleared", webhooks.statuses["item-sandbox"])
+		}
+	})
+
+	t.Run("records the error for a bank linked by another plaid source", func(t *testing.T) {
+		webhooks := &stubPlaidWebhooks{statuses: map[string]string{}}
+		monzo := &stubPlaidSource{statuses: map[string]string{}}
+		sources := testSources(&stubTransactionSyncer{})
+		_ = sources.Register("monzo", monzo)
+		server := NewServer(&StubDataStore{}, &StubMailer{}, sources, WithPlaidWebhooks(webhooks))
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPlaidWebhookRequest(`{"webhook_type": "ITEM", "webhook_code": "PENDING_EXPIRATION", "item_id": "item-monzo"}`, "valid-signature"))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if monzo.statuses["item-monzo"] != "PENDING_EXPIRATION" {
+			t.Errorf("got status %q want %q", monzo.statuses["item-monzo"], "PENDING_EXPIRATION")
+		}
+	})
+
+	t.Run("ignores webhooks for banks that aren't linked and codes it doesn't handle", func(t *testing.T) {
+		transactionAPI := &stubTransactionSyncer{}
+		server := NewServer(&StubDataStore{}, &StubMailer{}, testSources(transactionAPI), WithPlaidWebhooks(&stubPlaidWebhooks{statuses: map[string]string{}}))
+
+		for _, body := range []string{
+			`{"webhook_type": "ITEM", "webhook_code": "PENDING_EXPIRATION", "item_id": "item-unknown"}`,
+			`{"webhook_type": "TRANSACTIONS", "webhook_code": "RECURRING_TRANSACTIONS_UPDATE", "item_id": "item-sandbox"}`,
+			`{"webhook_type": "AUTH", "webhook_code": "AUTOMATICALLY_VERIFIED", "item_id": "item-sandbox"}`,
+		} {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newPlaidWebhookRequest(body, "valid-signature"))
+			assertStatus(t, response.Code, http.StatusOK)
+		}
+
+		if transactionAPI.syncCount != 0 {
+			t.Errorf("got %d syncs want none", transactionAPI.syncCount)
+		}
+	})
+
+	t.Run("returns 404 when webhooks aren't enabled", func(t *testing.T) {
+		server := NewServer(&StubDataStore{}, &StubMailer{}, testSources(&stubTransactionSyncer{}))
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPlaidWebhookRequest(`{"webhook_type": "TRANSACTIONS", "webhook_code": "SYNC_UPDATES_AVAILABLE"}`, "valid-signature"))
+
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+}
+
+func TestMerchantCatalogueAPI(t *testing.T) {
+	newCatalogue := func() *catalogue.Catalogue {
+		return catalogue.New([]catalogue.Entry{{Merchant: "Netflix", Category: "Entertainment", CancellationURL: "https://www.netflix.com/cancelplan"}})
+	}
+
+	newAdminRequest := func(method string, path string, body interface{}, token string) *http.Request {
+		var buffer bytes.Buffer
+		if body != nil {
+			_ = json.NewEncoder(&buffer).Encode(body)
+		}
+		request, _ := http.NewRequest(method, path, &buffer)
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		return request
+	}
+
+	t.Run("returns the catalogue in JSON format", func(t *testing.T) {
+		server := NewServer(&StubDataStore{}, &StubMailer{}, testSources(&stubTransactionAPI{}), WithCatalogue(newCatalogue()))
+
+		request, _ := http.NewRequest(http.MethodGet, "/api/merchant-catalogue", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, JSONContentType)
+
+		var got []catalogue.Entry
+		err := json.NewDecoder(response.Body).Decode(&got)
+		if err != nil {
+			t.Fatalf("unable to parse response from server %q into catalogue entries, '%v'", response.Body, err)
+		}
+		if len(got) != 1 || got[0].CancellationURL != "https://www.netflix.com/cancelplan" {
+			t.Errorf("got %v want the netflix entry", got)
+		}
+	})
+
+	t.Run("the admin API is disabled without an admin token", func(t *testing.T) {
+		server := NewServer(&StubDataStore{}, &StubMailer{}, testSources(&stubTransactionAPI{}), WithCatalogue(newCatalogue()))
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newAdminRequest(http.MethodGet, "/api/admin/merchant-catalogue", nil, ""))
+
+		assertStatus(t, response.Code, http.StatusForbidden)
+	})
+
+	t.Run("rejects requests with the wrong admin token", func(t *testing.T) {
+		merchants := newCatalogue()
+		server := NewServer(&StubDataStore{}, &StubMailer{}, testSources(&stubTransactionAPI{}), WithCatalogue(merchants), WithAdminToken("secret"))
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newAdminRequest(http.MethodDelete, "/api/admin/merchant-catalogue/netflix", nil, "guess"))
+
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+		if len(merchants.Entries()) != 1 {
+			t.Errorf("catalogue was changed without the admin token")
+		}
+	})
+
+	t.Run("adds an entry we POST with the admin token", func(t *testing.T) {
+		merchants := newCatalogue()
+		server := NewServer(&StubDataStore{}, &StubMailer{}, testSources(&stubTransactionAPI{}), WithCatalogue(merchants), WithAdminToken("secret"))
+
+		entry := catalogue.Entry{Merchant: "Local Gym", Category: "Fitness", Frequency: "monthly"}
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newAdminRequest(http.MethodPost, "/api/admin/merchant-catalogue", entry, "secret"))
+
+		assertStatus(t, response.Code, http.StatusOK)
+		if _, ok := merchants.Match("local gym"); !ok {
+			t.Errorf("entry was not added to the catalogue")
+		}
+	})
+
+	t.Run("rejects an entry with an unknown frequency", func(t *testing.T) {
+		server := NewServer(&StubDataStore{}, &StubMailer{}, testSources(&stubTransactionAPI{}), WithCatalogue(newCatalogue()), WithAdminToken("secret"))
+
+		entry := catalogue.Entry{Merchant: "Local Gym", Frequency: "hourly"}
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newAdminRequest(http.MethodPost, "/api/admin/merchant-catalogue", entry, "secret"))
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+	})
+
+	t.Run("removes an entry with the admin token", func(t *testing.T) {
+		merchants := newCatalogue()
+		server := NewServer(&StubDataStore{}, &StubMailer{}, testSources(&stubTransactionAPI{}), WithCatalogue(merchants), WithAdminToken("secret"))
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newAdminRequest(http.MethodDelete, "/api/admin/merchant-catalogue/netflix", nil, "secret"))
+
+		assertStatus(t, response.Code, http.StatusOK)
+		if len(merchants.Entries()) != 0 {
+			t.Errorf("entry was not removed from the catalogue")
+		}
+	})
+
+	t.Run("returns a 404 removing a merchant that is not in the catalogue", func(t *testing.T) {
+		server := NewServer(&StubDataStore{}, &StubMailer{}, testSources(&stubTransactionAPI{}), WithCatalogue(newCatalogue()), WithAdminToken("secret"))
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newAdminRequest(http.MethodDelete, "/api/admin/merchant-catalogue/hulu", nil, "secret"))
+
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+}
+
+func TestUserHandler(t *testing.T) {
+
+	t.Run("tests creation of a user", func(t *testing.T) {
+		store := &StubDataStore{}
+		transactionAPI := &stubTransactionAPI{}
+		server := NewServer(store, &StubMailer{}, testSources(transactionAPI))
+
+		request := newPostUserRequest(t, "Gary Gopher", "gary@gopher.com")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if store.userprofile.Name != "Gary Gopher" {
+			t.Errorf("incorrect name set got %v want %v", store.userprofile.Name, "Gary Gopher")
+		}
+
+		if store.userprofile.Email != "gary@gopher.com" {
+			t.Errorf("incorrect name set got %v want %v", store.userprofile.Email, "gary@gopher.com")
+		}
+	})
+
+	t.Run("rejects an email another user has", func(t *testing.T) {
+		store := &StubDataStore{users: []userprofile.Userprofile{{ID: 2, Email: "gina@gopher.com"}}}
+		server := NewServer(store, &StubMailer{}, nil)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPostUserRequest(t, "Gary Gopher", "gina@gopher.com"))
+		assertStatus(t, response.Code, http.StatusConflict)
+	})
+
+	t.Run("tests retrival of user", func(t *testing.T) {
+		userProfile := userprofile.Userprofile{
+			Name:  "Gary Gopher",
+			Email: "gary@gopher.com",
+		}
+
+		store := &StubDataStore{userprofile: userProfile}
+		transactionAPI := &stubTransactionAPI{}
+		server := NewServer(store, &StubMailer{}, testSources(transactionAPI))
+
+		request := newGetUserRequest(t)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		var retrievedUserProfile userprofile.Userprofile
+
+		err := json.NewDecoder(response.Body).Decode(&retrievedUserProfile)
+		if err != nil {
+			t.Fatalf("unable to parse response from server %q into user profile, '%v'", response.Body, err)
+		}
+
+		if retrievedUserProfile.Name != userProfile.Name {
+			t.Errorf("incorrect name retrieved got %v want %v", retrievedUserProfile.Name, userProfile.Name)
+		}
+
+		if retrievedUserProfile.Email != userProfile.Email {
+			t.Errorf("incorrect name retrieved got %v want %v", retrievedUserProfile.Email, userProfile.Email)
+		}
+
+		assertContentType(t, response, JSONContentType)
+	})
+
+}
+
+func TestAccountsAPI(t *testing.T) {
+	newAccountRequest := func(path string, details credentials) *http.Request {
+		body, _ := json.Marshal(details)
+		return httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	}
+
+	sessionCookie := func(t *testing.T, response *httptest.ResponseRecorder) *http.Cookie {
+		t.Helper()
+		for _, cookie := range response.Result().Cookies() {
+			if cookie.Name == SessionCookie {
+				return cookie
+			}
+		}
+		t.Fatalf("got no %s cookie", SessionCookie)
+		return nil
+	}
+
+	t.Run("signs up and logs in to the new account", func(t *testing.T) {
+		store := &StubDataStore{}
+		server := NewServer(store, &StubMailer{}, nil)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newAccountRequest("/api/signup", credentials{Name: "Gary Gopher", Email: " Gary@Gopher.com ", Password: "gophers rule"}))
+		assertStatus(t, response.Code, http.StatusCreated)
+		assertContentType(t, response, JSONContentType)
+
+		if strings.Contains(response.Body.String(), "gophers rule") || strings.Contains(response.Body.String(), "PasswordHash") {
+			t.Errorf("got response %q showing the password", response.Body)
+		}
+		if len(store.users) != 1 || store.users[0].Email != "gary@gopher.com" {
+			t.Fatalf("got users %v want gary@gopher.com", store.users)
+		}
+		if !account.CheckPassword(store.users[0].PasswordHash, "gophers rule") {
+			t.Errorf("got password hash %q that doesn't match the password", store.users[0].PasswordHash)
+		}
+
+		cookie := sessionCookie(t, response)
+		if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.Path != "/" {
+			t.Errorf("got cookie %v want an HttpOnly, SameSite=Lax cookie for the whole site", cookie)
+		}
+		session, _ := store.GetSession(context.Background(), account.HashToken(cookie.Value))
+		if session == nil || session.UserID != store.users[0].ID {
+			t.Errorf("got session %v want one for user %d", session, store.users[0].ID)
+		}
+	})
+
+	t.Run("rejects sign ups that are incomplete or use a taken email", func(t *testing.T) {
+		store := &StubDataStore{users: []userprofile.Userprofile{{ID: 2, Name: "Gary Gopher", Email: "gary@gopher.com"}}}
+		server := NewServer(store, &StubMailer{}, nil)
+
+		cases := []struct {
+			details credentials
+			status  int
+		}{
+			{credentials{Name: "Gary", Email: "GARY@gopher.com", Password: "gophers rule"}, http.StatusConflict},
+			{credentials{Name: "Gina", Email: "gina@gopher.com", Password: "short"}, http.StatusBadRequest},
+			{credentials{Email: "gina@gopher.com", Password: "gophers rule"}, http.StatusBadRequest},
+			{credentials{Name: "Gina", Password: "gophers rule"}, http.StatusBadRequest},
+		}
+		for _, c := range cases {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newAccountRequest("/api/signup", c.details))
+			assertStatus(t, response.Code, c.status)
+		}
+		if len(store.users) != 1 || len(store.sessions) != 0 {
+			t.Errorf("got users %v and sessions %v want no new ones", store.users, store.sessions)
+		}
+	})
+
+	t.Run("logs in with the right password only", func(t *testing.T) {
+		hash, _ := account.HashPassword("gophers rule")
+		store := &StubDataStore{users: []userprofile.Userprofile{{ID: 2, Name: "Gary Gopher", Email: "gary@gopher.com", PasswordHash: hash}}}
+		server := NewServer(store, &StubMailer{}, nil)
+
+		for _, details := range []credentials{
+			{Email: "gary@gopher.com", Password: "gophers drool"},
+			{Email: "gina@gopher.com", Password: "gophers rule"},
+		} {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newAccountRequest("/api/login", details))
+			assertStatus(t, response.Code, http.StatusUnauthorized)
+		}
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newAccountRequest("/api/login", credentials{Email: "Gary@Gopher.com", Password: "gophers rule"}))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		var user userprofile.Userprofile
+		err := json.NewDecoder(response.Body).Decode(&user)
+		if err != nil {
+			t.Fatalf("unable to parse response from server %q into user profile, '%v'", response.Body, err)
+		}
+		if user.ID != 2 || user.Name != "Gary Gopher" {
+			t.Errorf("got user %v want Gary Gopher", user)
+		}
+
+		cookie := sessionCookie(t, response)
+		request := httptest.NewRequest(http.MethodGet, "/api/transactions", nil)
+		request.AddCookie(cookie)
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+	})
+
+	t.Run("ends the request's old session when logging in", func(t *testing.T) {
+		hash, _ := account.HashPassword("gophers rule")
+		store := &StubDataStore{users: []userprofile.Userprofile{{ID: 2, Name: "Gary Gopher", Email: "gary@gopher.com", PasswordHash: hash}}}
+		server := NewServer(store, &StubMailer{}, nil)
+
+		body, _ := json.Marshal(credentials{Email: "gary@gopher.com", Password: "gophers rule"})
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newUserRequest(http.MethodPost, "/api/login", bytes.NewReader(body)))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if !reflect.DeepEqual(store.deletedSessions, []string{account.HashToken(testSessionToken)}) {
+			t.Errorf("got deleted sessions %v want the old session", store.deletedSessions)
+		}
+		if cookie := sessionCookie(t, response); cookie.Value == "" || cookie.Value == testSessionToken {
+			t.Errorf("got cookie %v want it replaced by the new session", cookie)
+		}
+	})
+
+	t.Run("logs out by ending the session", func(t *testing.T) {
+		store := &StubDataStore{}
+		server := NewServer(store, &StubMailer{}, nil)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newUserRequest(http.MethodPost, "/api/logout", nil))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if !reflect.DeepEqual(store.deletedSessions, []string{account.HashToken(testSessionToken)}) {
+			t.Errorf("got deleted sessions %v want the logged in session", store.deletedSessions)
+		}
+		if cookie := sessionCookie(t, response); cookie.Value != "" || cookie.MaxAge >= 0 {
+			t.Errorf("got cookie %v want it cleared", cookie)
+		}
+	})
+
+	t.Run("returns 401 for the user APIs without a session", func(t *testing.T) {
+		expired := account.Session{TokenHash: account.HashToken("expired"), UserID: testUserID, ExpiresAt: time.Now().Add(-time.Minute)}
+		store := &StubDataStore{sessions: map[string]account.Session{expired.TokenHash: expired}}
+		server := NewServer(store, &StubMailer{}, testSources(&stubTransactionAPI{}))
+
+		paths := []string{"/api/subscriptions", "/api/subscriptions/1/payments", "/api/users", "/api/transactions", "/api/candidates", "/api/linked-banks", "/api/sources"}
+		for _, token := range []string{"", "guess", "expired"} {
+			for _, path := range paths {
+				request := httptest.NewRequest(http.MethodGet, path, nil)
+				if token != "" {
+					request.AddCookie(&http.Cookie{Name: SessionCookie, Value: token})
+				}
+				response := httptest.NewRecorder()
+
+				server.ServeHTTP(response, request)
+				if response.Code != http.StatusUnauthorized {
+					t.Errorf("%s with session %q: got status %d want %d", path, token, response.Code, http.StatusUnauthorized)
+				}
+			}
+		}
+
+		if _, ok := store.sessions[expired.TokenHash]; ok {
+			t.Errorf("the expired session was not deleted")
+		}
+	})
+
+	t.Run("scopes the user APIs to the logged in user", func(t *testing.T) {
+		store := &StubDataStore{}
+		server := NewServer(store, &StubMailer{}, nil)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPostSubscriptionRequest(t, subscription.Subscription{Name: "Netflix", DateDue: time.Date(2020, time.November, 11, 0, 0, 0, 0, time.UTC)}))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if !reflect.DeepEqual(store.recordedFor, []int{testUserID}) {
+			t.Errorf("got subscriptions recorded for users %v want %v", store.recordedFor, []int{testUserID})
+		}
+	})
+}
+
+func newGetSubscriptionRequest(t testing.TB) *http.Request {
+	t.Helper()
+	return newUserRequest(http.MethodGet, "/api/subscriptions", nil)
+}
+
+func newPostSubscriptionRequest(t *testing.T, subscription subscription.Subscription) *http.Request {
+	postBody, _ := json.Marshal(subscription)
+	return newUserRequest(http.MethodPost, "/api/subscriptions", bytes.NewBuffer(postBody))
+}
+
+func newPostReminderRequest(t testing.TB, id int) *http.Request {
+	t.Helper()
+	subscription := subscription.Subscription{
 		ID: id,
 	}
 	bodyStr, err := json.Marshal(&subscription)
@@ -337,22 +2404,14 @@ func newPostReminderRequest(t testing.TB, id int) *http.Request {
 		t.Fatalf("fail to marshal subscription: %v", err)
 	}
 
-	req, err := http.NewRequest(http.MethodPost, "/api/reminders", bytes.NewBuffer(bodyStr))
-	if err != nil {
-		t.Fatalf("failed to send request: %v", err)
-	}
-
+	req := newUserRequest(http.MethodPost, "/api/reminders", bytes.NewBuffer(bodyStr))
 	req.Header.Add("Content-Type", "application/json")
 	return req
 }
 
 func newDeleteSubscriptionRequest(t testing.TB, ID int) *http.Request {
 	url := fmt.Sprintf("/api/subscriptions/%v", ID)
-	req, err := http.NewRequest(http.MethodDelete, url, nil)
-	if err != nil {
-		t.Fatalf("failed to send request: %v", err)
-	}
-	return req
+	return newUserRequest(http.MethodDelete, url, nil)
 }
 
 func newPostUserRequest(t testing.TB, name string, email string) *http.Request {
@@ -367,20 +2426,451 @@ func newPostUserRequest(t testing.TB, name string, email string) *http.Request {
 		t.Fatalf("fail to marshal user information: %v", err)
 	}
 
-	req, err := http.NewRequest(http.MethodPost, "/api/users", bytes.NewBuffer(bodyStr))
-	if err != nil {
-		t.Fatalf("failed to send request: %v", err)
-	}
-
+	req := newUserRequest(http.MethodPost, "/api/users", bytes.NewBuffer(bodyStr))
 	req.Header.Add("Content-Type", "application/json")
 	return req
 }
 
 func newGetUserRequest(t testing.TB) *http.Request {
 	t.Helper()
-	req, err := http.NewRequest(http.MethodGet, "/api/users", nil)
+	return newUserRequest(http.MethodGet, "/api/users", nil)
+}
+
+func TestAPITokensAPI(t *testing.T) {
+	newTokenRequest := func(token string, method string, path string, body io.Reader) *http.Request {
+		request := httptest.NewRequest(method, path, body)
+		request.Header.Set("Authorization", "Bearer "+token)
+		return request
+	}
+
+	createToken := func(t *testing.T, server *Server, scope account.Scope) string {
+		t.Helper()
+		body, _ := json.Marshal(newAPIToken{Name: "deploy script", Scope: scope})
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newUserRequest(http.MethodPost, "/api/tokens", bytes.NewReader(body)))
+		assertStatus(t, response.Code, http.StatusCreated)
+
+		var created createdAPIToken
+		err := json.NewDecoder(response.Body).Decode(&created)
+		if err != nil {
+			t.Fatalf("unable to parse created token %q: %v", response.Body, err)
+		}
+		return created.Token
+	}
+
+	t.Run("creates a token that is only shown once and stored hashed", func(t *testing.T) {
+		store := &StubDataStore{}
+		server := NewServer(store, &StubMailer{}, nil)
+
+		token := createToken(t, server, account.ReadOnly)
+
+		if len(store.apiTokens) != 1 {
+			t.Fatalf("got %d stored tokens want 1", len(store.apiTokens))
+		}
+		stored := store.apiTokens[0]
+		if stored.TokenHash != account.HashToken(token) || stored.UserID != testUserID || stored.Name != "deploy script" || stored.Scope != account.ReadOnly {
+			t.Errorf("got stored token %+v", stored)
+		}
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newUserRequest(http.MethodGet, "/api/tokens", nil))
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, JSONContentType)
+		if strings.Contains(response.Body.String(), token) || strings.Contains(response.Body.String(), stored.TokenHash) {
+			t.Errorf("got token list %q showing the token", response.Body)
+		}
+	})
+
+	t.Run("rejects tokens without a name or with an unknown scope", func(t *testing.T) {
+		server := NewServer(&StubDataStore{}, &StubMailer{}, nil)
+
+		for _, details := range []newAPIToken{{Scope: account.ReadOnly}, {Name: "deploy script", Scope: "admin"}} {
+			body, _ := json.Marshal(details)
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newUserRequest(http.MethodPost, "/api/tokens", bytes.NewReader(body)))
+			assertStatus(t, response.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("accepts a token as a bearer token and records when it was used", func(t *testing.T) {
+		store := &StubDataStore{subscriptions: []subscription.Subscription{{ID: 1, Name: "Netflix"}}}
+		server := NewServer(store, &StubMailer{}, nil)
+		token := createToken(t, server, account.ReadWrite)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newTokenRequest(token, http.MethodGet, "/api/subscriptions", nil))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		body, _ := json.Marshal(subscription.Subscription{Name: "Spotify", DateDue: time.Date(2020, time.December, 1, 0, 0, 0, 0, time.UTC)})
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newTokenRequest(token, http.MethodPost, "/api/subscriptions", bytes.NewReader(body)))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if !reflect.DeepEqual(store.recordedFor, []int{testUserID}) {
+			t.Errorf("got subscriptions recorded for users %v want %v", store.recordedFor, []int{testUserID})
+		}
+		if store.apiTokens[0].LastUsedAt == nil {
+			t.Errorf("did not record when the token was used")
+		}
+	})
+
+	t.Run("only lets read-only tokens read", func(t *testing.T) {
+		store := &StubDataStore{subscriptions: []subscription.Subscription{{ID: 1, Name: "Netflix"}}}
+		server := NewServer(store, &StubMailer{}, nil)
+		token := createToken(t, server, account.ReadOnly)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newTokenRequest(token, http.MethodGet, "/api/subscriptions", nil))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newTokenRequest(token, http.MethodDelete, "/api/subscriptions/1", nil))
+		assertStatus(t, response.Code, http.StatusForbidden)
+
+		if len(store.deleteCount) != 0 {
+			t.Errorf("a read-only token deleted subscriptions %v", store.deleteCount)
+		}
+	})
+
+	t.Run("rejects unknown and revoked tokens", func(t *testing.T) {
+		store := &StubDataStore{}
+		server := NewServer(store, &StubMailer{}, nil)
+		token := createToken(t, server, account.ReadWrite)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newTokenRequest("sct_guessed", http.MethodGet, "/api/subscriptions", nil))
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newUserRequest(http.MethodDelete, fmt.Sprintf("/api/tokens/%d", store.apiTokens[0].ID), nil))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newTokenRequest(token, http.MethodGet, "/api/subscriptions", nil))
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("does not let a token manage tokens", func(t *testing.T) {
+		store := &StubDataStore{}
+		server := NewServer(store, &StubMailer{}, nil)
+		token := createToken(t, server, account.ReadWrite)
+
+		body, _ := json.Marshal(newAPIToken{Name: "another", Scope: account.ReadWrite})
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newTokenRequest(token, http.MethodPost, "/api/tokens", bytes.NewReader(body)))
+		assertStatus(t, response.Code, http.StatusForbidden)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newTokenRequest(token, http.MethodDelete, fmt.Sprintf("/api/tokens/%d", store.apiTokens[0].ID), nil))
+		assertStatus(t, response.Code, http.StatusForbidden)
+
+		if len(store.apiTokens) != 1 {
+			t.Errorf("got %d tokens want 1", len(store.apiTokens))
+		}
+	})
+
+	t.Run("does not revoke another user's token", func(t *testing.T) {
+		store := &StubDataStore{apiTokens: []account.APIToken{{ID: 1, UserID: 2, Name: "theirs", Scope: account.ReadWrite}}}
+		server := NewServer(store, &StubMailer{}, nil)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newUserRequest(http.MethodDelete, "/api/tokens/1", nil))
+		assertStatus(t, response.Code, http.StatusNotFound)
+
+		if len(store.apiTokens) != 1 {
+			t.Errorf("revoked another user's token")
+		}
+	})
+}
+
+func TestSingleSignOn(t *testing.T) {
+	idp, err := fakeidp.New(fakeidp.Issuer, fakeidp.DefaultUser)
 	if err != nil {
-		t.Fatalf("failed to send request: %v", err)
+		t.Fatalf("unable to create identity provider: %v", err)
 	}
-	return req
+	provider, err := oidc.NewProvider(context.Background(), idp.Config("http://subscrypt/api/sso/callback"))
+	if err != nil {
+		t.Fatalf("unable to create provider: %v", err)
+	}
+
+	findCookie := func(response *httptest.ResponseRecorder, name string) *http.Cookie {
+		for _, cookie := range response.Result().Cookies() {
+			if cookie.Name == name {
+				return cookie
+			}
+		}
+		return nil
+	}
+
+	// startSignIn starts a sign in and returns the cookie that remembers it and the callback the identity provider sends the browser back to
+	startSignIn := func(t *testing.T, server *Server) (*http.Cookie, string) {
+		t.Helper()
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/api/sso/login", nil))
+		assertStatus(t, response.Code, http.StatusFound)
+
+		cookie := findCookie(response, SSOCookie)
+		if cookie == nil || !cookie.HttpOnly || cookie.Path != "/api/sso/" {
+			t.Fatalf("got cookie %v want an HttpOnly %s cookie for /api/sso/", cookie, SSOCookie)
+		}
+		callback, err := idp.Authorize(response.Header().Get("Location"))
+		if err != nil {
+			t.Fatalf("unable to sign in: %v", err)
+		}
+		return cookie, callback.RequestURI()
+	}
+
+	finishSignIn := func(server *Server, cookie *http.Cookie, callback string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, callback, nil)
+		if cookie != nil {
+			request.AddCookie(cookie)
+		}
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("creates an account the first time a user signs in and logs in to it after", func(t *testing.T) {
+		store := &StubDataStore{}
+		server := NewServer(store, &StubMailer{}, nil, WithSingleSignOn(provider))
+
+		for i := 0; i < 2; i++ {
+			cookie, callback := startSignIn(t, server)
+			response := finishSignIn(server, cookie, callback)
+			assertStatus(t, response.Code, http.StatusFound)
+			if response.Header().Get("Location") != "/" {
+				t.Errorf("got redirected to %q want /", response.Header().Get("Location"))
+			}
+
+			session := findCookie(response, SessionCookie)
+			if session == nil {
+				t.Fatalf("got no %s cookie", SessionCookie)
+			}
+			stored, _ := store.GetSession(context.Background(), account.HashToken(session.Value))
+			if stored == nil || len(store.users) != 1 || stored.UserID != store.users[0].ID {
+				t.Errorf("got session %v for users %v want one for the only user", stored, store.users)
+			}
+		}
+
+		want := userprofile.Userprofile{ID: store.users[0].ID, Name: fakeidp.DefaultUser.Name, Email: fakeidp.DefaultUser.Email}
+		if store.users[0] != want {
+			t.Errorf("got user %+v want %+v", store.users[0], want)
+		}
+	})
+
+	t.Run("rejects a callback without the sign in cookie or with another state", func(t *testing.T) {
+		store := &StubDataStore{}
+		server := NewServer(store, &StubMailer{}, nil, WithSingleSignOn(provider))
+
+		_, callback := startSignIn(t, server)
+		response := finishSignIn(server, nil, callback)
+		assertStatus(t, response.Code, http.StatusBadRequest)
+
+		otherCookie, _ := startSignIn(t, server)
+		response = finishSignIn(server, otherCookie, callback)
+		assertStatus(t, response.Code, http.StatusBadRequest)
+
+		if len(store.users) != 0 || len(store.sessions) != 0 {
+			t.Errorf("got users %v and sessions %v want none", store.users, store.sessions)
+		}
+	})
+
+	t.Run("rejects a callback with a code the identity provider didn't issue", func(t *testing.T) {
+		server := NewServer(&StubDataStore{}, &StubMailer{}, nil, WithSingleSignOn(provider))
+
+		cookie, callback := startSignIn(t, server)
+		forged := strings.Replace(callback, "code=", "code=forged", 1)
+		response := finishSignIn(server, cookie, forged)
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("does not take over a password account with the same email", func(t *testing.T) {
+		store := &StubDataStore{users: []userprofile.Userprofile{{ID: 2, Name: "Gary Gopher", Email: fakeidp.DefaultUser.Email, PasswordHash: "hash"}}}
+		server := NewServer(store, &StubMailer{}, nil, WithSingleSignOn(provider))
+
+		cookie, callback := startSignIn(t, server)
+		response := finishSignIn(server, cookie, callback)
+		assertStatus(t, response.Code, http.StatusConflict)
+
+		if len(store.sessions) != 0 {
+			t.Errorf("got sessions %v want none", store.sessions)
+		}
+	})
+
+	t.Run("needs an email to create an account", func(t *testing.T) {
+		idp.SignIn(fakeidp.User{Subject: "no-email"})
+		defer idp.SignIn(fakeidp.DefaultUser)
+		store := &StubDataStore{}
+		server := NewServer(store, &StubMailer{}, nil, WithSingleSignOn(provider))
+
+		cookie, callback := startSignIn(t, server)
+		response := finishSignIn(server, cookie, callback)
+		assertStatus(t, response.Code, http.StatusForbidden)
+	})
+
+	t.Run("needs a verified email to create an account", func(t *testing.T) {
+		idp.SignIn(fakeidp.User{Subject: "unverified", Email: "gwen@gopher.com", Name: "Gwen Gopher", UnverifiedEmail: true})
+		defer idp.SignIn(fakeidp.DefaultUser)
+		store := &StubDataStore{}
+		server := NewServer(store, &StubMailer{}, nil, WithSingleSignOn(provider))
+
+		cookie, callback := startSignIn(t, server)
+		response := finishSignIn(server, cookie, callback)
+		assertStatus(t, response.Code, http.StatusForbidden)
+
+		if len(store.users) != 0 || len(store.sessions) != 0 {
+			t.Errorf("got users %v and sessions %v want none", store.users, store.sessions)
+		}
+	})
+
+	t.Run("is not found without an identity provider", func(t *testing.T) {
+		server := NewServer(&StubDataStore{}, &StubMailer{}, nil)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/api/sso/login", nil))
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+
+	t.Run("lists the ways to log in and can turn off passwords", func(t *testing.T) {
+		server := NewServer(&StubDataStore{}, &StubMailer{}, nil, WithSingleSignOn(provider), WithoutPasswordLogin())
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/api/login", nil))
+		assertStatus(t, response.Code, http.StatusOK)
+		var methods loginMethods
+		_ = json.NewDecoder(response.Body).Decode(&methods)
+		if methods != (loginMethods{Password: false, SingleSignOn: true}) {
+			t.Errorf("got login methods %+v", methods)
+		}
+
+		for _, path := range []string{"/api/signup", "/api/login"} {
+			body, _ := json.Marshal(credentials{Name: "Gary Gopher", Email: "gary@gopher.com", Password: "gophers rule"})
+			response = httptest.NewRecorder()
+			server.ServeHTTP(response, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body)))
+			assertStatus(t, response.Code, http.StatusForbidden)
+		}
+	})
+}
+
+func TestCSRFProtection(t *testing.T) {
+	protected := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodPost, "/api/users"},
+		{http.MethodPost, "/api/subscriptions"},
+		{http.MethodPut, "/api/subscriptions/1"},
+		{http.MethodPatch, "/api/subscriptions/1"},
+		{http.MethodDelete, "/api/subscriptions/1"},
+		{http.MethodPost, "/api/reminders"},
+		{http.MethodPost, "/api/tokens"},
+		{http.MethodDelete, "/api/tokens/1"},
+		{http.MethodPost, "/api/transactions/load-subscriptions"},
+		{http.MethodPost, "/api/statements/csv"},
+		{http.MethodPost, "/api/statements/ofx"},
+		{http.MethodPost, "/api/statements/camt053"},
+		{http.MethodPost, "/api/statements/mt940"},
+		{http.MethodPost, "/api/merchant-aliases"},
+		{http.MethodDelete, "/api/merchant-aliases/1"},
+		{http.MethodPost, "/api/candidates/1/accept"},
+		{http.MethodPost, "/api/candidates/1/reject"},
+		{http.MethodDelete, "/api/rejected-merchants/Netflix"},
+		{http.MethodPost, "/api/sources/plaid/import"},
+		{http.MethodDelete, "/api/linked-banks/1"},
+	}
+
+	serve := func(request *http.Request) *httptest.ResponseRecorder {
+		store := &StubDataStore{subscriptions: []subscription.Subscription{{ID: 1, Name: "Netflix"}}}
+		server := NewServer(store, &StubMailer{}, nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		return response
+	}
+
+	for _, route := range protected {
+		route := route
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			request := newUserRequest(route.method, route.path, strings.NewReader("{}"))
+			request.Header.Del(CSRFHeader)
+			response := serve(request)
+			assertStatus(t, response.Code, http.StatusForbidden)
+			if !strings.Contains(response.Body.String(), "CSRF") {
+				t.Errorf("got %q want it to be refused for its missing CSRF token", response.Body)
+			}
+
+			request = newUserRequest(route.method, route.path, strings.NewReader("{}"))
+			request.Header.Set(CSRFHeader, account.CSRFToken("another-session-token"))
+			response = serve(request)
+			assertStatus(t, response.Code, http.StatusForbidden)
+
+			request = newUserRequest(route.method, route.path, strings.NewReader("{}"))
+			request.Header.Set("Origin", "https://evil.example.org")
+			response = serve(request)
+			assertStatus(t, response.Code, http.StatusForbidden)
+
+			request = newUserRequest(route.method, route.path, strings.NewReader("{}"))
+			request.Header.Set("Origin", "http://example.com")
+			response = serve(request)
+			if response.Code == http.StatusForbidden {
+				t.Errorf("got %d %q for a request from this site with its CSRF token", response.Code, response.Body)
+			}
+		})
+	}
+
+	t.Run("lets reads through without a CSRF token and gives the web UI one", func(t *testing.T) {
+		request := newUserRequest(http.MethodGet, "/api/subscriptions", nil)
+		request.Header.Del(CSRFHeader)
+		request.Header.Set("Origin", "https://evil.example.org")
+		response := serve(request)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		var csrf *http.Cookie
+		for _, cookie := range response.Result().Cookies() {
+			if cookie.Name == CSRFCookie {
+				csrf = cookie
+			}
+		}
+		if csrf == nil || csrf.Value != account.CSRFToken(testSessionToken) || csrf.HttpOnly {
+			t.Errorf("got CSRF cookie %v want one the web UI can read with the session's token", csrf)
+		}
+	})
+
+	t.Run("refuses logging in, signing up and out from other sites", func(t *testing.T) {
+		for _, path := range []string{"/api/signup", "/api/login", "/api/logout"} {
+			request := httptest.NewRequest(http.MethodPost, path, strings.NewReader("{}"))
+			request.Header.Set("Referer", "https://evil.example.org/login.html")
+			response := serve(request)
+			assertStatus(t, response.Code, http.StatusForbidden)
+		}
+
+		request := httptest.NewRequest(http.MethodPost, "/api/logout", nil)
+		request.Header.Set("Origin", "http://example.com")
+		response := serve(request)
+		assertStatus(t, response.Code, http.StatusOK)
+	})
+
+	t.Run("logs in with HttpOnly session and readable CSRF cookies, secure behind HTTPS", func(t *testing.T) {
+		passwordHash, _ := account.HashPassword("gophers rule")
+		store := &StubDataStore{users: []userprofile.Userprofile{{ID: 2, Email: "gary@gopher.com", PasswordHash: passwordHash}}}
+		server := NewServer(store, &StubMailer{}, nil)
+
+		body, _ := json.Marshal(credentials{Email: "gary@gopher.com", Password: "gophers rule"})
+		request := httptest.NewRequest(http.MethodPost, "/api/login", bytes.NewReader(body))
+		request.Header.Set("X-Forwarded-Proto", "https")
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		cookies := map[string]*http.Cookie{}
+		for _, cookie := range response.Result().Cookies() {
+			cookies[cookie.Name] = cookie
+		}
+		session, csrf := cookies[SessionCookie], cookies[CSRFCookie]
+		if session == nil || !session.HttpOnly || !session.Secure || session.SameSite != http.SameSiteLaxMode {
+			t.Errorf("got session cookie %v want a secure HttpOnly SameSite=Lax cookie", session)
+		}
+		if csrf == nil || csrf.HttpOnly || !csrf.Secure || csrf.Value != account.CSRFToken(session.Value) {
+			t.Errorf("got CSRF cookie %v want a secure cookie the web UI can read with the session's token", csrf)
+		}
+	})
 }
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// ErrUnknownSource is returned when no transaction source is registered with a name
+var ErrUnknownSource = errors.New("unknown transaction source")
+
+// sourceName matches the names sources can be registered with, which are used in URLs
+var sourceName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Sources is the registry of the named transaction sources subscriptions can be imported from,
+// such as a Plaid environment and institution or a statement file, each configured separately.
+// The first source registered is the default. Sources are registered before the server is created.
+type Sources struct {
+	names []string
+	apis  map[string]TransactionAPI
+}
+
+// SourceInfo describes a registered transaction source
+type SourceInfo struct {
+	Name    string `json:"name"`
+	Default bool   `json:"default"`
+}
+
+// NewSources returns an empty registry of transaction sources
+func NewSources() *Sources {
+	return &Sources{apis: map[string]TransactionAPI{}}
+}
+
+// Register adds a transaction source with the given name, which is lower case letters, digits, dashes and underscores
+func (s *Sources) Register(name string, api TransactionAPI) error {
+	if !sourceName.MatchString(name) {
+		return fmt.Errorf("invalid transaction source name %q", name)
+	}
+	if _, ok := s.apis[name]; ok {
+		return fmt.Errorf("transaction source %q is already registered", name)
+	}
+
+	s.names = append(s.names, name)
+	s.apis[name] = api
+	return nil
+}
+
+// Get returns the source with the given name, or the default source if the name is empty
+func (s *Sources) Get(name string) (TransactionAPI, error) {
+	if name == "" {
+		if len(s.names) == 0 {
+			return nil, ErrUnknownSource
+		}
+		name = s.names[0]
+	}
+
+	api, ok := s.apis[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownSource, name)
+	}
+	return api, nil
+}
+
+// List returns the registered sources in the order they were registered
+func (s *Sources) List() []SourceInfo {
+	sources := []SourceInfo{}
+	for i, name := range s.names {
+		sources = append(sources, SourceInfo{Name: name, Default: i == 0})
+	}
+	return sources
+}
+
+// all returns the registered sources in the order they were registered
+func (s *Sources) all() []TransactionAPI {
+	var apis []TransactionAPI
+	for _, name := range s.names {
+		apis = append(apis, s.apis[name])
+	}
+	return apis
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Catzkorn/subscrypt/internal/account"
+	"github.com/Catzkorn/subscrypt/internal/oidc"
+)
+
+// SSOCookie is the name of the cookie that holds a sign in with the identity provider until it comes back
+const SSOCookie = "subscrypt_sso"
+
+// ssoCookieMaxAge is how many seconds a user has to sign in with the identity provider
+const ssoCookieMaxAge = 10 * 60
+
+// SingleSignOn signs users in with an OpenID Connect identity provider
+type SingleSignOn interface {
+	AuthCodeURL(request oidc.AuthRequest) string
+	Authenticate(ctx context.Context, code string, request oidc.AuthRequest) (*oidc.Identity, error)
+}
+
+// WithSingleSignOn lets users sign in with the identity provider.
+// Users signing in for the first time get an account with the name and email the provider shares,
+// found again by their subject when they next sign in.
+func WithSingleSignOn(sso SingleSignOn) Option {
+	return func(s *Server) {
+		s.sso = sso
+	}
+}
+
+// WithoutPasswordLogin stops users signing up and logging in with a password, so they have to use single sign on
+func WithoutPasswordLogin() Option {
+	return func(s *Server) {
+		s.noPasswords = true
+	}
+}
+
+// loginMethods are the ways a user can log in
+type loginMethods struct {
+	Password     bool `json:"password"`
+	SingleSignOn bool `json:"singleSignOn"`
+}
+
+// ssoLoginHandler handles the routing logic for the '/api/sso/login' path
+// It sends the browser to the identity provider's sign in page, remembering the sign in in a cookie.
+func (s *Server) ssoLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if s.sso == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		return
+	}
+
+	request, err := oidc.NewAuthRequest()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     SSOCookie,
+		Value:    strings.Join([]string{request.State, request.Nonce, request.Verifier}, "."),
+		Path:     "/api/sso/",
+		MaxAge:   ssoCookieMaxAge,
+		Secure:   secureRequest(r),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, s.sso.AuthCodeURL(request), http.StatusFound)
+}
+
+// ssoCallbackHandler handles the routing logic for the '/api/sso/callback' path
+// The identity provider sends the browser back here with an authorization code, which is exchanged for the
+// user's identity. The user is logged in to the account for their subject, created the first time they sign in.
+func (s *Server) ssoCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if s.sso == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		return
+	}
+
+	cookie, err := r.Cookie(SSOCookie)
+	http.SetCookie(w, &http.Cookie{Name: SSOCookie, Value: "", Path: "/api/sso/", MaxAge: -1, Secure: secureRequest(r), HttpOnly: true, SameSite: http.SameSiteLaxMode})
+	if err != nil {
+		http.Error(w, "sign in was not started from this browser or took too long", http.StatusBadRequest)
+		return
+	}
+	parts := strings.Split(cookie.Value, ".")
+	if len(parts) != 3 || subtle.ConstantTimeCompare([]byte(parts[0]), []byte(r.URL.Query().Get("state"))) != 1 {
+		http.Error(w, "sign in was not started from this browser or took too long", http.StatusBadRequest)
+		return
+	}
+	request := oidc.AuthRequest{State: parts[0], Nonce: parts[1], Verifier: parts[2]}
+
+	if reason := r.URL.Query().Get("error"); reason != "" {
+		http.Error(w, "the identity provider did not sign you in: "+reason, http.StatusUnauthorized)
+		return
+	}
+
+	identity, err := s.sso.Authenticate(r.Context(), r.URL.Query().Get("code"), request)
+	switch {
+	case errors.Is(err, oidc.ErrCodeRejected), errors.Is(err, oidc.ErrInvalidIDToken):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	userID, err := s.ssoUser(r.Context(), *identity)
+	switch {
+	case errors.Is(err, errNoSSOEmail), errors.Is(err, errUnverifiedSSOEmail):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case errors.Is(err, account.ErrEmailTaken):
+		http.Error(w, "an account already exists with that email, log in with its password", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = s.startSession(w, r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// errNoSSOEmail is returned when the identity provider doesn't share the email of a user signing in for the first time
+var errNoSSOEmail = errors.New("the identity provider did not share your email, which reminders are sent to")
+
+// errUnverifiedSSOEmail is returned when the identity provider hasn't verified the email of a user signing in for the first time
+var errUnverifiedSSOEmail = errors.New("the identity provider has not verified your email, verify it with them and sign in again")
+
+// ssoUser returns the ID of the user with the identity, creating them with the identity's name and email if they are new.
+// An account is only created for an email the identity provider has verified, so nobody can claim someone else's address.
+func (s *Server) ssoUser(ctx context.Context, identity oidc.Identity) (int, error) {
+	user, err := s.dataStore.GetUserByIdentity(ctx, identity.Issuer, identity.Subject)
+	if err != nil {
+		return 0, err
+	}
+	if user != nil {
+		return user.ID, nil
+	}
+
+	email := normalizeEmail(identity.Email)
+	if email == "" {
+		return 0, errNoSSOEmail
+	}
+	if !identity.EmailVerified {
+		return 0, errUnverifiedSSOEmail
+	}
+	name := strings.TrimSpace(identity.Name)
+	if name == "" {
+		name = email
+	}
+
+	user, err = s.dataStore.CreateUserWithIdentity(ctx, name, email, identity.Issuer, identity.Subject)
+	if err != nil {
+		return 0, err
+	}
+	return user.ID, nil
+}
+
+// processGetLoginMethods processes the GET /api/login request and returns the ways a user can log in as json
+func (s *Server) processGetLoginMethods(w http.ResponseWriter) {
+	w.Header().Set("content-type", JSONContentType)
+	err := json.NewEncoder(w).Encode(loginMethods{Password: !s.noPasswords, SingleSignOn: s.sso != nil})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Catzkorn/subscrypt/internal/account"
+)
+
+// newAPIToken is the name and scope posted to create an API token
+type newAPIToken struct {
+	Name  string        `json:"name"`
+	Scope account.Scope `json:"scope"`
+}
+
+// createdAPIToken is the response to creating an API token, the only time the token itself is shown
+type createdAPIToken struct {
+	account.APIToken
+	Token string `json:"token"`
+}
+
+// bearerToken returns the token a request sent in its Authorization header, if it sent one
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return "", false
+	}
+	return strings.TrimPrefix(header, "Bearer "), true
+}
+
+// serveWithAPIToken lets a request authenticated by an API token through to the handler as the token's user,
+// if the token's scope allows the request's method, and records that the token was used.
+func (s *Server) serveWithAPIToken(w http.ResponseWriter, r *http.Request, token string, handler http.Handler) {
+	apiToken, err := s.dataStore.GetAPITokenByHash(r.Context(), account.HashToken(token))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if apiToken == nil {
+		http.Error(w, "invalid API token", http.StatusUnauthorized)
+		return
+	}
+	if !apiToken.Allows(r.Method) {
+		http.Error(w, "this API token can only read", http.StatusForbidden)
+		return
+	}
+
+	err = s.dataStore.RecordAPITokenUse(r.Context(), apiToken.UserID, apiToken.ID, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	handler.ServeHTTP(w, r.WithContext(account.WithUser(r.Context(), apiToken.UserID)))
+}
+
+// tokensAPIHandler handles the routing logic for the '/api/tokens' path
+// API tokens can only be created and listed by a logged in user, not with another API token.
+func (s *Server) tokensAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := bearerToken(r); ok {
+		http.Error(w, "API tokens can only be managed by a logged in user", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.processGetAPITokens(w, r)
+	case http.MethodPost:
+		s.processPostAPIToken(w, r)
+	}
+}
+
+// tokenIDAPIHandler handles the routing logic for the '/api/tokens/:id' path
+// Deleting a token revokes it straight away.
+func (s *Server) tokenIDAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := bearerToken(r); ok {
+		http.Error(w, "API tokens can only be managed by a logged in user", http.StatusForbidden)
+		return
+	}
+
+	ID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/tokens/"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		err = s.dataStore.DeleteAPIToken(r.Context(), currentUser(r), ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// processGetAPITokens processes the GET /api/tokens request and returns the user's API tokens as json, without the tokens themselves
+func (s *Server) processGetAPITokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := s.dataStore.GetAPITokens(r.Context(), currentUser(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tokens == nil {
+		tokens = []account.APIToken{}
+	}
+
+	w.Header().Set("content-type", JSONContentType)
+	err = json.NewEncoder(w).Encode(tokens)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// processPostAPIToken processes the POST /api/tokens request, creating a token with the posted name and scope
+// It responds with the token, which can't be retrieved again.
+func (s *Server) processPostAPIToken(w http.ResponseWriter, r *http.Request) {
+	var details newAPIToken
+	err := json.NewDecoder(r.Body).Decode(&details)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	token, apiToken, err := account.NewAPIToken(currentUser(r), details.Name, details.Scope, time.Now())
+	switch {
+	case errors.Is(err, account.ErrTokenNameMissing), errors.Is(err, account.ErrInvalidScope):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	created, err := s.dataStore.CreateAPIToken(r.Context(), apiToken)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("content-type", JSONContentType)
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(createdAPIToken{APIToken: *created, Token: token})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
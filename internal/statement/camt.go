@@ -0,0 +1,260 @@
+package statement
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Catzkorn/subscrypt/internal/plaid"
+
+	"github.com/shopspring/decimal"
+)
+
+// ErrNotCAMT053 is returned when a statement isn't a camt.053 bank to customer statement
+var ErrNotCAMT053 = errors.New("statement is not a camt.053 file")
+
+// camtDocument is a camt.053 file. Elements are matched by name in every version of the message.
+type camtDocument struct {
+	Statements []camtStatement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtStatement struct {
+	Account camtAccount `xml:"Acct"`
+	Entries []camtEntry `xml:"Ntry"`
+}
+
+type camtAccount struct {
+	IBAN     string `xml:"Id>IBAN"`
+	Other    string `xml:"Id>Othr>Id"`
+	Currency string `xml:"Ccy"`
+}
+
+type camtAmount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"Ccy,attr"`
+}
+
+type camtDate struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+// camtStatus is the status of an entry, which is the text of the element before version 8 and its Cd element since
+type camtStatus struct {
+	Value string `xml:",chardata"`
+	Code  string `xml:"Cd"`
+}
+
+type camtEntry struct {
+	Reference         string            `xml:"NtryRef"`
+	Amount            camtAmount        `xml:"Amt"`
+	Indicator         string            `xml:"CdtDbtInd"`
+	Status            camtStatus        `xml:"Sts"`
+	BookingDate       camtDate          `xml:"BookgDt"`
+	ValueDate         camtDate          `xml:"ValDt"`
+	ServicerReference string            `xml:"AcctSvcrRef"`
+	Details           []camtTransaction `xml:"NtryDtls>TxDtls"`
+	Info              string            `xml:"AddtlNtryInf"`
+}
+
+// camtParty is a related party, whose name is in a Pty element since version 8
+type camtParty struct {
+	Name      string `xml:"Nm"`
+	PartyName string `xml:"Pty>Nm"`
+}
+
+type camtTransaction struct {
+	ServicerReference string     `xml:"Refs>AcctSvcrRef"`
+	EndToEndID        string     `xml:"Refs>EndToEndId"`
+	Amount            camtAmount `xml:"Amt"`
+	TransactionAmount camtAmount `xml:"AmtDtls>TxAmt>Amt"`
+	Indicator         string     `xml:"CdtDbtInd"`
+	Creditor          camtParty  `xml:"RltdPties>Cdtr"`
+	Debtor            camtParty  `xml:"RltdPties>Dbtr"`
+	Unstructured      []string   `xml:"RmtInf>Ustrd"`
+	CreditorReference string     `xml:"RmtInf>Strd>CdtrRefInf>Ref"`
+	Info              string     `xml:"AddtlTxInf"`
+}
+
+// ParseCAMT053 reads the booked entries of the statements in an ISO 20022 camt.053 file.
+// Entries are dated by their value date, or their booking date if they don't have one, and are described by the
+// party that was paid, or that paid the account for credits, falling back to the remittance information.
+// Batch entries with the details of more than one transaction are split into a transaction for each.
+// The amounts of the transactions returned follow Plaid's convention, positive amounts are money paid out.
+func ParseCAMT053(r io.Reader) (plaid.TransactionList, error) {
+	var document camtDocument
+	err := xml.NewDecoder(r).Decode(&document)
+	if err != nil {
+		return plaid.TransactionList{}, fmt.Errorf("unable to read statement: %w", err)
+	}
+	if document.Statements == nil {
+		return plaid.TransactionList{}, ErrNotCAMT053
+	}
+
+	list := plaid.TransactionList{Transactions: []plaid.Transaction{}}
+	for _, statement := range document.Statements {
+		account := statement.Account.IBAN
+		if account == "" {
+			account = statement.Account.Other
+		}
+
+		for _, entry := range statement.Entries {
+			status := strings.TrimSpace(entry.Status.Value)
+			if entry.Status.Code != "" {
+				status = entry.Status.Code
+			}
+			if status != "" && status != "BOOK" {
+				continue
+			}
+
+			transactions, err := camtTransactions(entry, account, statement.Account.Currency)
+			if err != nil {
+				return plaid.TransactionList{}, err
+			}
+			list.Transactions = append(list.Transactions, transactions...)
+		}
+	}
+	return list, nil
+}
+
+// camtTransactions converts a booked entry to its transactions
+func camtTransactions(entry camtEntry, account string, currency string) ([]plaid.Transaction, error) {
+	date := entry.ValueDate
+	if date.Date == "" && date.DateTime == "" {
+		date = entry.BookingDate
+	}
+	parsedDate, err := parseCAMTDate(date)
+	if err != nil {
+		return nil, fmt.Errorf("entry %q has an %w", entry.ServicerReference, err)
+	}
+
+	reference := entry.ServicerReference
+	if reference == "" {
+		reference = entry.Reference
+	}
+
+	details := entry.Details
+	split := len(details) > 1
+	for _, detail := range details {
+		if detail.amount().Value == "" {
+			split = false
+		}
+	}
+	if !split {
+		var detail camtTransaction
+		if len(details) == 1 {
+			detail = details[0]
+		}
+		detail.Amount, detail.Indicator = entry.Amount, entry.Indicator
+		if reference != "" {
+			detail.ServicerReference = reference
+		}
+		if detail.Info == "" {
+			detail.Info = entry.Info
+		}
+		details = []camtTransaction{detail}
+	}
+
+	var transactions []plaid.Transaction
+	for i, detail := range details {
+		id := detail.reference()
+		if id == "" && reference != "" {
+			id = reference
+			if split {
+				id = fmt.Sprintf("%s/%d", reference, i+1)
+			}
+		}
+		if id != "" && account != "" {
+			id = account + "/" + id
+		}
+
+		indicator := detail.Indicator
+		if indicator == "" {
+			indicator = entry.Indicator
+		}
+		amount, err := signedAmount(detail.amount().Value, indicator == "DBIT")
+		if err != nil {
+			return nil, fmt.Errorf("entry %q has an %w", entry.ServicerReference, err)
+		}
+
+		transactionCurrency := detail.amount().Currency
+		if transactionCurrency == "" {
+			transactionCurrency = currency
+		}
+
+		transactions = append(transactions, plaid.Transaction{
+			TransactionID:   id,
+			AccountID:       account,
+			Amount:          amount,
+			ISOCurrencyCode: transactionCurrency,
+			Date:            parsedDate,
+			Name:            detail.description(indicator == "DBIT"),
+		})
+	}
+	return transactions, nil
+}
+
+// amount returns the amount of the transaction in the currency of the account
+func (t camtTransaction) amount() camtAmount {
+	if t.Amount.Value != "" {
+		return t.Amount
+	}
+	return t.TransactionAmount
+}
+
+// reference returns the bank's reference for the transaction, or the payer's if the bank didn't give one
+func (t camtTransaction) reference() string {
+	if t.ServicerReference != "" {
+		return t.ServicerReference
+	}
+	if t.EndToEndID != "NOTPROVIDED" {
+		return t.EndToEndID
+	}
+	return ""
+}
+
+// description returns the name of the other party of the transaction, or its remittance information if it has no name
+func (t camtTransaction) description(debit bool) string {
+	party := t.Debtor
+	if debit {
+		party = t.Creditor
+	}
+	for _, name := range []string{party.Name, party.PartyName, strings.Join(t.Unstructured, " "), t.CreditorReference, t.Info} {
+		if name = strings.Join(strings.Fields(name), " "); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// parseCAMTDate returns the date of a camt date or date and time in the format of Plaid dates
+func parseCAMTDate(date camtDate) (string, error) {
+	value := date.Date
+	if value == "" {
+		value = date.DateTime
+	}
+	if len(value) < len(dateLayout) {
+		return "", fmt.Errorf("invalid date %q", value)
+	}
+	parsed, err := time.Parse(dateLayout, value[:len(dateLayout)])
+	if err != nil {
+		return "", fmt.Errorf("invalid date %q", value)
+	}
+	return parsed.Format(dateLayout), nil
+}
+
+// signedAmount converts an unsigned amount to Plaid's convention, positive if the money was paid out
+func signedAmount(value string, debit bool) (float32, error) {
+	amount, err := decimal.NewFromString(strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+	if !debit {
+		amount = amount.Neg()
+	}
+	converted, _ := amount.Float64()
+	return float32(converted), nil
+}
@@ -0,0 +1,132 @@
+package statement
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Catzkorn/subscrypt/internal/plaid"
+)
+
+const camtFile = `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02">
+  <BkToCstmrStmt>
+    <GrpHdr><MsgId>STMT-2020-10</MsgId><CreDtTm>2020-11-01T06:00:00</CreDtTm></GrpHdr>
+    <Stmt>
+      <Id>2020-10</Id>
+      <Acct><Id><IBAN>GB33BUKB20201555555555</IBAN></Id><Ccy>GBP</Ccy></Acct>
+      <Ntry>
+        <Amt Ccy="GBP">9.99</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <Sts>BOOK</Sts>
+        <BookgDt><Dt>2020-10-13</Dt></BookgDt>
+        <ValDt><Dt>2020-10-12</Dt></ValDt>
+        <AcctSvcrRef>E1</AcctSvcrRef>
+        <NtryDtls><TxDtls>
+          <Refs><EndToEndId>NOTPROVIDED</EndToEndId></Refs>
+          <RltdPties><Cdtr><Nm>NETFLIX INTERNATIONAL B.V.</Nm></Cdtr></RltdPties>
+          <RmtInf><Ustrd>Netflix monthly</Ustrd></RmtInf>
+        </TxDtls></NtryDtls>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="GBP">1500.00</Amt>
+        <CdtDbtInd>CRDT</CdtDbtInd>
+        <Sts>BOOK</Sts>
+        <BookgDt><DtTm>2020-10-28T09:30:00</DtTm></BookgDt>
+        <AcctSvcrRef>E2</AcctSvcrRef>
+        <NtryDtls><TxDtls>
+          <RmtInf><Ustrd>SALARY</Ustrd><Ustrd>OCTOBER</Ustrd></RmtInf>
+        </TxDtls></NtryDtls>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="GBP">44.98</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <Sts>BOOK</Sts>
+        <BookgDt><Dt>2020-10-30</Dt></BookgDt>
+        <AcctSvcrRef>E3</AcctSvcrRef>
+        <NtryDtls>
+          <TxDtls>
+            <Refs><AcctSvcrRef>E3-A</AcctSvcrRef></Refs>
+            <AmtDtls><TxAmt><Amt Ccy="GBP">34.99</Amt></TxAmt></AmtDtls>
+            <RltdPties><Cdtr><Nm>PureGym</Nm></Cdtr></RltdPties>
+          </TxDtls>
+          <TxDtls>
+            <AmtDtls><TxAmt><Amt Ccy="GBP">9.99</Amt></TxAmt></AmtDtls>
+            <RltdPties><Cdtr><Nm>Spotify</Nm></Cdtr></RltdPties>
+          </TxDtls>
+        </NtryDtls>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="GBP">5.00</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <Sts>PDNG</Sts>
+        <BookgDt><Dt>2020-10-31</Dt></BookgDt>
+        <AddtlNtryInf>Pending card payment</AddtlNtryInf>
+      </Ntry>
+    </Stmt>
+  </BkToCstmrStmt>
+</Document>
+`
+
+func TestParseCAMT053(t *testing.T) {
+	t.Run("reads the booked entries of a statement", func(t *testing.T) {
+		got, err := ParseCAMT053(strings.NewReader(camtFile))
+		if err != nil {
+			t.Fatalf("unexpected error parsing statement: %v", err)
+		}
+
+		account := "GB33BUKB20201555555555"
+		want := []plaid.Transaction{
+			{TransactionID: account + "/E1", AccountID: account, Amount: 9.99, ISOCurrencyCode: "GBP", Date: "2020-10-12", Name: "NETFLIX INTERNATIONAL B.V."},
+			{TransactionID: account + "/E2", AccountID: account, Amount: -1500, ISOCurrencyCode: "GBP", Date: "2020-10-28", Name: "SALARY OCTOBER"},
+			{TransactionID: account + "/E3-A", AccountID: account, Amount: 34.99, ISOCurrencyCode: "GBP", Date: "2020-10-30", Name: "PureGym"},
+			{TransactionID: account + "/E3/2", AccountID: account, Amount: 9.99, ISOCurrencyCode: "GBP", Date: "2020-10-30", Name: "Spotify"},
+		}
+		if !reflect.DeepEqual(got.Transactions, want) {
+			t.Errorf("got %v want %v", got.Transactions, want)
+		}
+	})
+
+	t.Run("reads the status and party names of later versions", func(t *testing.T) {
+		statement := `<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.08"><BkToCstmrStmt><Stmt>
+			<Acct><Id><Othr><Id>12345678</Id></Othr></Id></Acct>
+			<Ntry><Amt Ccy="EUR">12.99</Amt><CdtDbtInd>DBIT</CdtDbtInd><Sts><Cd>BOOK</Cd></Sts>
+				<BookgDt><Dt>2020-10-14</Dt></BookgDt>
+				<NtryDtls><TxDtls><RltdPties><Cdtr><Pty><Nm>Disney Plus</Nm></Pty></Cdtr></RltdPties></TxDtls></NtryDtls>
+			</Ntry>
+		</Stmt></BkToCstmrStmt></Document>`
+
+		got, err := ParseCAMT053(strings.NewReader(statement))
+		if err != nil {
+			t.Fatalf("unexpected error parsing statement: %v", err)
+		}
+
+		want := []plaid.Transaction{{AccountID: "12345678", Amount: 12.99, ISOCurrencyCode: "EUR", Date: "2020-10-14", Name: "Disney Plus"}}
+		if !reflect.DeepEqual(got.Transactions, want) {
+			t.Errorf("got %v want %v", got.Transactions, want)
+		}
+	})
+
+	t.Run("returns an error for a file that isn't camt.053", func(t *testing.T) {
+		_, err := ParseCAMT053(strings.NewReader(`<Document><BkToCstmrDbtCdtNtfctn/></Document>`))
+		if !errors.Is(err, ErrNotCAMT053) {
+			t.Errorf("got %v want %v", err, ErrNotCAMT053)
+		}
+
+		_, err = ParseCAMT053(strings.NewReader("Date,Description,Amount\n"))
+		if err == nil {
+			t.Errorf("expected an error parsing a CSV statement")
+		}
+	})
+
+	t.Run("returns an error for an entry that can't be read", func(t *testing.T) {
+		statement := `<Document><BkToCstmrStmt><Stmt><Ntry><Amt>nine</Amt><CdtDbtInd>DBIT</CdtDbtInd>
+			<BookgDt><Dt>2020-10-14</Dt></BookgDt></Ntry></Stmt></BkToCstmrStmt></Document>`
+
+		_, err := ParseCAMT053(strings.NewReader(statement))
+		if err == nil || !strings.Contains(err.Error(), "invalid amount") {
+			t.Errorf("got %v want an error for the invalid amount", err)
+		}
+	})
+}
@@ -0,0 +1,336 @@
+package statement
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Catzkorn/subscrypt/internal/plaid"
+
+	"github.com/shopspring/decimal"
+)
+
+// dateLayout is the format of the dates of the transactions returned
+const dateLayout = "2006-01-02"
+
+// DefaultDateFormat is the format of the dates in a statement when the mapping doesn't give one
+const DefaultDateFormat = "02/01/2006"
+
+// ErrHeaderNotFound is returned when no row of the statement has every column of the mapping
+var ErrHeaderNotFound = errors.New("statement has no header row with the mapped columns")
+
+// Sign is the convention a statement uses for the sign of its amounts
+type Sign string
+
+// The sign conventions of statements with a single amount column.
+// DebitNegative statements show money paid out as a negative amount, as most UK banks do,
+// and DebitPositive statements show it as a positive amount, as Plaid does.
+const (
+	DebitNegative Sign = "debit-negative"
+	DebitPositive Sign = "debit-positive"
+)
+
+// Mapping describes where the parts of a transaction are in the rows of a CSV statement.
+// Columns are named by their header, compared ignoring case and surrounding spaces, or by their position
+// counting from 1 when NoHeader is set.
+// Date and Description are required. The amount is either in a single Amount column, signed following Sign
+// or DebitNegative if it is empty, or split into Debit and Credit columns for money paid out and in.
+// ID, Account and Currency are optional columns of the bank's transaction ID, the account and the currency code,
+// and DefaultCurrency is used for rows without a currency.
+// DateFormat is the Go time layout of the dates, DefaultDateFormat if empty.
+type Mapping struct {
+	Date            string `json:"date"`
+	Description     string `json:"description"`
+	Amount          string `json:"amount,omitempty"`
+	Debit           string `json:"debit,omitempty"`
+	Credit          string `json:"credit,omitempty"`
+	Sign            Sign   `json:"sign,omitempty"`
+	DateFormat      string `json:"dateFormat,omitempty"`
+	ID              string `json:"id,omitempty"`
+	Account         string `json:"account,omitempty"`
+	Currency        string `json:"currency,omitempty"`
+	DefaultCurrency string `json:"defaultCurrency,omitempty"`
+	NoHeader        bool   `json:"noHeader,omitempty"`
+}
+
+// Presets are the mappings of the CSV statements exported by common UK banks
+var Presets = map[string]Mapping{
+	"monzo": {
+		ID: "Transaction ID", Date: "Date", Description: "Name", Amount: "Amount",
+		Currency: "Currency", Sign: DebitNegative, DateFormat: "02/01/2006", DefaultCurrency: "GBP",
+	},
+	"starling": {
+		Date: "Date", Description: "Counter Party", Amount: "Amount (GBP)",
+		Sign: DebitNegative, DateFormat: "02/01/2006", DefaultCurrency: "GBP",
+	},
+	"barclays": {
+		Date: "Date", Description: "Memo", Amount: "Amount", Account: "Account",
+		Sign: DebitNegative, DateFormat: "02/01/2006", DefaultCurrency: "GBP",
+	},
+	"natwest": {
+		Date: "Date", Description: "Description", Amount: "Value", Account: "Account Number",
+		Sign: DebitNegative, DateFormat: "02/01/2006", DefaultCurrency: "GBP",
+	},
+	"lloyds": {
+		Date: "Transaction Date", Description: "Transaction Description", Debit: "Debit Amount", Credit: "Credit Amount",
+		Account: "Account Number", DateFormat: "02/01/2006", DefaultCurrency: "GBP",
+	},
+	"halifax": {
+		Date: "Transaction Date", Description: "Transaction Description", Debit: "Debit Amount", Credit: "Credit Amount",
+		Account: "Account Number", DateFormat: "02/01/2006", DefaultCurrency: "GBP",
+	},
+	"nationwide": {
+		Date: "Date", Description: "Description", Debit: "Paid out", Credit: "Paid in",
+		DateFormat: "02 Jan 2006", DefaultCurrency: "GBP",
+	},
+	"hsbc": {
+		Date: "1", Description: "2", Amount: "3", NoHeader: true,
+		Sign: DebitNegative, DateFormat: "02/01/2006", DefaultCurrency: "GBP",
+	},
+}
+
+// PresetNames returns the names of the presets in alphabetical order
+func PresetNames() []string {
+	var names []string
+	for name := range Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate checks that the mapping has a date, a description and either an amount column or debit and credit columns
+func (m Mapping) Validate() error {
+	switch {
+	case m.Date == "":
+		return errors.New("mapping needs a date column")
+	case m.Description == "":
+		return errors.New("mapping needs a description column")
+	case m.Amount == "" && m.Debit == "" && m.Credit == "":
+		return errors.New("mapping needs an amount column or debit and credit columns")
+	case m.Amount != "" && (m.Debit != "" || m.Credit != ""):
+		return errors.New("mapping can't have both an amount column and debit and credit columns")
+	}
+
+	switch m.Sign {
+	case "", DebitNegative, DebitPositive:
+	default:
+		return fmt.Errorf("unknown sign convention %q", m.Sign)
+	}
+
+	if m.NoHeader {
+		for _, column := range m.columns() {
+			position, err := strconv.Atoi(column)
+			if err != nil || position < 1 {
+				return fmt.Errorf("column %q is not a position counting from 1", column)
+			}
+		}
+	}
+	return nil
+}
+
+// columns returns the columns named by the mapping
+func (m Mapping) columns() []string {
+	var columns []string
+	for _, column := range []string{m.Date, m.Description, m.Amount, m.Debit, m.Credit, m.ID, m.Account, m.Currency} {
+		if column != "" {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// ParseCSV reads the transactions from a CSV statement using the mapping.
+// Rows before the header, such as the account details some banks put at the top, and blank rows are skipped.
+// The amounts of the transactions returned follow Plaid's convention, positive amounts are money paid out.
+func ParseCSV(r io.Reader, mapping Mapping) (plaid.TransactionList, error) {
+	err := mapping.Validate()
+	if err != nil {
+		return plaid.TransactionList{}, err
+	}
+	if mapping.DateFormat == "" {
+		mapping.DateFormat = DefaultDateFormat
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	var index map[string]int
+	if mapping.NoHeader {
+		index = map[string]int{}
+		for _, column := range mapping.columns() {
+			position, _ := strconv.Atoi(column)
+			index[column] = position - 1
+		}
+	}
+
+	list := plaid.TransactionList{Transactions: []plaid.Transaction{}}
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return plaid.TransactionList{}, fmt.Errorf("unable to read statement: %w", err)
+		}
+		if row == 1 && len(record) > 0 {
+			record[0] = strings.TrimPrefix(record[0], "\ufeff")
+		}
+		if blank(record) {
+			continue
+		}
+
+		if index == nil {
+			index = headerIndex(record, mapping.columns())
+			continue
+		}
+
+		transaction, err := parseRow(record, index, mapping)
+		if err != nil {
+			return plaid.TransactionList{}, fmt.Errorf("row %d: %w", row, err)
+		}
+		list.Transactions = append(list.Transactions, transaction)
+	}
+
+	if index == nil {
+		return plaid.TransactionList{}, ErrHeaderNotFound
+	}
+	return list, nil
+}
+
+// headerIndex returns the position of each column in the row, or nil if the row doesn't have all of them
+func headerIndex(record []string, columns []string) map[string]int {
+	positions := map[string]int{}
+	for i, field := range record {
+		positions[normalize(field)] = i
+	}
+
+	index := map[string]int{}
+	for _, column := range columns {
+		position, ok := positions[normalize(column)]
+		if !ok {
+			return nil
+		}
+		index[column] = position
+	}
+	return index
+}
+
+// parseRow converts a row of the statement to a transaction
+func parseRow(record []string, index map[string]int, mapping Mapping) (plaid.Transaction, error) {
+	field := func(column string) string {
+		if column == "" || index[column] >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[index[column]])
+	}
+
+	date, err := time.Parse(mapping.DateFormat, field(mapping.Date))
+	if err != nil {
+		return plaid.Transaction{}, fmt.Errorf("invalid date %q: %w", field(mapping.Date), err)
+	}
+
+	description := field(mapping.Description)
+	if description == "" {
+		return plaid.Transaction{}, errors.New("missing description")
+	}
+
+	amount, err := rowAmount(field, mapping)
+	if err != nil {
+		return plaid.Transaction{}, err
+	}
+
+	currency := strings.ToUpper(field(mapping.Currency))
+	if currency == "" {
+		currency = mapping.DefaultCurrency
+	}
+
+	value, _ := amount.Float64()
+	return plaid.Transaction{
+		TransactionID:   field(mapping.ID),
+		AccountID:       field(mapping.Account),
+		Amount:          float32(value),
+		ISOCurrencyCode: currency,
+		Date:            date.Format(dateLayout),
+		Name:            description,
+	}, nil
+}
+
+// rowAmount returns the amount of a row, positive if the money was paid out
+func rowAmount(field func(string) string, mapping Mapping) (decimal.Decimal, error) {
+	if mapping.Amount != "" {
+		amount, err := parseAmount(field(mapping.Amount))
+		if err != nil {
+			return decimal.Decimal{}, err
+		}
+		if mapping.Sign == DebitPositive {
+			return amount, nil
+		}
+		return amount.Neg(), nil
+	}
+
+	debit, credit := field(mapping.Debit), field(mapping.Credit)
+	if debit == "" && credit == "" {
+		return decimal.Decimal{}, errors.New("missing amount")
+	}
+
+	amount := decimal.Zero
+	if debit != "" {
+		paidOut, err := parseAmount(debit)
+		if err != nil {
+			return decimal.Decimal{}, err
+		}
+		amount = amount.Add(paidOut.Abs())
+	}
+	if credit != "" {
+		paidIn, err := parseAmount(credit)
+		if err != nil {
+			return decimal.Decimal{}, err
+		}
+		amount = amount.Sub(paidIn.Abs())
+	}
+	return amount, nil
+}
+
+// parseAmount reads an amount written with an optional currency symbol, thousands separators,
+// and a minus sign or brackets for negative amounts
+func parseAmount(value string) (decimal.Decimal, error) {
+	cleaned := strings.NewReplacer("£", "", "$", "", "€", "", ",", "", " ", "").Replace(value)
+
+	negative := false
+	if strings.HasPrefix(cleaned, "(") && strings.HasSuffix(cleaned, ")") {
+		negative = true
+		cleaned = strings.TrimSuffix(strings.TrimPrefix(cleaned, "("), ")")
+	}
+
+	amount, err := decimal.NewFromString(cleaned)
+	if err != nil {
+		return decimal.Decimal{}, fmt.Errorf("invalid amount %q", value)
+	}
+	if negative {
+		amount = amount.Neg()
+	}
+	return amount, nil
+}
+
+// blank reports whether every field of the row is empty
+func blank(record []string) bool {
+	for _, field := range record {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// normalize returns a column name in the form headers are compared in
+func normalize(column string) string {
+	return strings.ToLower(strings.TrimSpace(column))
+}
@@ -0,0 +1,161 @@
+package statement
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Catzkorn/subscrypt/internal/plaid"
+)
+
+func TestParseCSV(t *testing.T) {
+	t.Run("reads a statement with a signed amount column", func(t *testing.T) {
+		statement := "Date,Description,Amount\n" +
+			"03/10/2020,NETFLIX.COM,-9.99\n" +
+			"05/10/2020,SALARY,\"1,500.00\"\n"
+
+		got, err := ParseCSV(strings.NewReader(statement), Mapping{Date: "date", Description: "description", Amount: "amount"})
+		if err != nil {
+			t.Fatalf("unexpected error parsing statement: %v", err)
+		}
+
+		want := []plaid.Transaction{
+			{Date: "2020-10-03", Name: "NETFLIX.COM", Amount: 9.99},
+			{Date: "2020-10-05", Name: "SALARY", Amount: -1500},
+		}
+		if !reflect.DeepEqual(got.Transactions, want) {
+			t.Errorf("got %v want %v", got.Transactions, want)
+		}
+	})
+
+	t.Run("keeps positive amounts as money paid out when debits are positive", func(t *testing.T) {
+		statement := "Date,Description,Amount\n2020-10-03,Spotify,9.99\n"
+		mapping := Mapping{Date: "Date", Description: "Description", Amount: "Amount", Sign: DebitPositive, DateFormat: "2006-01-02"}
+
+		got, err := ParseCSV(strings.NewReader(statement), mapping)
+		if err != nil {
+			t.Fatalf("unexpected error parsing statement: %v", err)
+		}
+		if len(got.Transactions) != 1 || got.Transactions[0].Amount != 9.99 {
+			t.Errorf("got %v want a payment of 9.99", got.Transactions)
+		}
+	})
+
+	t.Run("reads debit and credit columns", func(t *testing.T) {
+		statement := "Transaction Date,Transaction Type,Sort Code,Account Number,Transaction Description,Debit Amount,Credit Amount,Balance\n" +
+			"03/10/2020,DEB,'11-22-33,12345678,NETFLIX.COM,9.99,,990.01\n" +
+			"04/10/2020,FPI,'11-22-33,12345678,REFUND,,5.00,995.01\n"
+
+		got, err := ParseCSV(strings.NewReader(statement), Presets["lloyds"])
+		if err != nil {
+			t.Fatalf("unexpected error parsing statement: %v", err)
+		}
+
+		want := []plaid.Transaction{
+			{AccountID: "12345678", Date: "2020-10-03", Name: "NETFLIX.COM", Amount: 9.99, ISOCurrencyCode: "GBP"},
+			{AccountID: "12345678", Date: "2020-10-04", Name: "REFUND", Amount: -5, ISOCurrencyCode: "GBP"},
+		}
+		if !reflect.DeepEqual(got.Transactions, want) {
+			t.Errorf("got %v want %v", got.Transactions, want)
+		}
+	})
+
+	t.Run("skips the rows before the header", func(t *testing.T) {
+		statement := "\"Account Name:\",\"FlexAccount ****1234\"\n" +
+			"\"Account Balance:\",\"£990.01\"\n" +
+			"\n" +
+			"\"Date\",\"Transaction type\",\"Description\",\"Paid out\",\"Paid in\",\"Balance\"\n" +
+			"\"03 Oct 2020\",\"Visa purchase\",\"NETFLIX.COM\",\"£9.99\",\"\",\"£990.01\"\n"
+
+		got, err := ParseCSV(strings.NewReader(statement), Presets["nationwide"])
+		if err != nil {
+			t.Fatalf("unexpected error parsing statement: %v", err)
+		}
+
+		want := []plaid.Transaction{{Date: "2020-10-03", Name: "NETFLIX.COM", Amount: 9.99, ISOCurrencyCode: "GBP"}}
+		if !reflect.DeepEqual(got.Transactions, want) {
+			t.Errorf("got %v want %v", got.Transactions, want)
+		}
+	})
+
+	t.Run("reads the transaction ID and currency", func(t *testing.T) {
+		statement := "\ufeffTransaction ID,Date,Time,Type,Name,Emoji,Category,Amount,Currency\n" +
+			"tx_0001,03/10/2020,09:00:00,Card payment,Netflix,,Entertainment,-9.99,gbp\n"
+
+		got, err := ParseCSV(strings.NewReader(statement), Presets["monzo"])
+		if err != nil {
+			t.Fatalf("unexpected error parsing statement: %v", err)
+		}
+
+		want := []plaid.Transaction{{TransactionID: "tx_0001", Date: "2020-10-03", Name: "Netflix", Amount: 9.99, ISOCurrencyCode: "GBP"}}
+		if !reflect.DeepEqual(got.Transactions, want) {
+			t.Errorf("got %v want %v", got.Transactions, want)
+		}
+	})
+
+	t.Run("reads columns by position without a header", func(t *testing.T) {
+		statement := "03/10/2020,NETFLIX.COM,(9.99)\n"
+
+		got, err := ParseCSV(strings.NewReader(statement), Presets["hsbc"])
+		if err != nil {
+			t.Fatalf("unexpected error parsing statement: %v", err)
+		}
+
+		want := []plaid.Transaction{{Date: "2020-10-03", Name: "NETFLIX.COM", Amount: 9.99, ISOCurrencyCode: "GBP"}}
+		if !reflect.DeepEqual(got.Transactions, want) {
+			t.Errorf("got %v want %v", got.Transactions, want)
+		}
+	})
+
+	t.Run("returns an error when the header is missing", func(t *testing.T) {
+		statement := "When,What,How much\n03/10/2020,NETFLIX.COM,-9.99\n"
+
+		_, err := ParseCSV(strings.NewReader(statement), Mapping{Date: "Date", Description: "Description", Amount: "Amount"})
+		if !errors.Is(err, ErrHeaderNotFound) {
+			t.Errorf("got %v want %v", err, ErrHeaderNotFound)
+		}
+	})
+
+	t.Run("returns an error for a row that can't be read", func(t *testing.T) {
+		cases := map[string]string{
+			"date":   "Date,Description,Amount\n2020-10-03,NETFLIX.COM,-9.99\n",
+			"amount": "Date,Description,Amount\n03/10/2020,NETFLIX.COM,nine\n",
+		}
+
+		for name, statement := range cases {
+			_, err := ParseCSV(strings.NewReader(statement), Mapping{Date: "Date", Description: "Description", Amount: "Amount"})
+			if err == nil || !strings.Contains(err.Error(), "row 2") {
+				t.Errorf("got %v want an error for row 2 with an invalid %s", err, name)
+			}
+		}
+	})
+}
+
+func TestValidate(t *testing.T) {
+	cases := map[string]Mapping{
+		"no date":             {Description: "Description", Amount: "Amount"},
+		"no description":      {Date: "Date", Amount: "Amount"},
+		"no amount":           {Date: "Date", Description: "Description"},
+		"amount and debit":    {Date: "Date", Description: "Description", Amount: "Amount", Debit: "Paid out"},
+		"unknown sign":        {Date: "Date", Description: "Description", Amount: "Amount", Sign: "upside-down"},
+		"name without header": {Date: "Date", Description: "2", Amount: "3", NoHeader: true},
+	}
+
+	for name, mapping := range cases {
+		t.Run(name, func(t *testing.T) {
+			if mapping.Validate() == nil {
+				t.Errorf("expected an error validating %v", mapping)
+			}
+		})
+	}
+
+	for _, name := range PresetNames() {
+		t.Run(name, func(t *testing.T) {
+			err := Presets[name].Validate()
+			if err != nil {
+				t.Errorf("unexpected error validating preset: %v", err)
+			}
+		})
+	}
+}
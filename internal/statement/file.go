@@ -0,0 +1,31 @@
+package statement
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Catzkorn/subscrypt/internal/plaid"
+)
+
+// Parser reads the transactions from a statement
+type Parser func(r io.Reader) (plaid.TransactionList, error)
+
+// File is a statement saved on disk, read with Parse every time its transactions are requested.
+// It can be used in place of a bank as the server's TransactionAPI, to import a fixed set of transactions.
+type File struct {
+	Path  string
+	Parse Parser
+}
+
+// GetTransactions reads the transactions from the statement
+func (f File) GetTransactions(ctx context.Context) (plaid.TransactionList, error) {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return plaid.TransactionList{}, fmt.Errorf("unable to open statement: %w", err)
+	}
+	defer file.Close()
+
+	return f.Parse(file)
+}
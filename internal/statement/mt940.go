@@ -0,0 +1,215 @@
+package statement
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Catzkorn/subscrypt/internal/plaid"
+)
+
+// mt940DateLayout is the format of the value dates of MT940 statement lines
+const mt940DateLayout = "060102"
+
+// ErrNotMT940 is returned when a statement has no MT940 statement lines or balances
+var ErrNotMT940 = errors.New("statement is not an MT940 file")
+
+// mt940Tag matches the tag at the start of an MT940 field
+var mt940Tag = regexp.MustCompile(`^:(\d{2}[A-Z]?):`)
+
+// mt940StatementLine matches the value of a :61: statement line field: the value date, an optional entry date,
+// the debit or credit mark, an optional funds code, the amount and the transaction type, followed by the references
+var mt940StatementLine = regexp.MustCompile(`^(\d{6})(\d{4})?(RC|RD|C|D)([A-Z])?(\d+,\d*)([NFS][A-Z0-9]{3})(.*)$`)
+
+// mt940Balance matches the value of an opening balance field: the debit or credit mark, the date and the currency
+var mt940Balance = regexp.MustCompile(`^[CD]\d{6}([A-Z]{3})`)
+
+// mt940Structured matches the start of structured information to the account owner
+var mt940Structured = regexp.MustCompile(`^\d{3}\?`)
+
+// mt940Field is a field of an MT940 message
+type mt940Field struct {
+	tag   string
+	value string
+}
+
+// ParseMT940 reads the transactions from the statement lines of a SWIFT MT940 file, which can hold several statements.
+// Transactions are dated by their value date and are described by their :86: information to the account owner,
+// using the name of the other party and the remittance information when it is structured with ?NN subfields.
+// Reversals of credits are treated as payments out and reversals of debits as payments in.
+// The amounts of the transactions returned follow Plaid's convention, positive amounts are money paid out.
+func ParseMT940(r io.Reader) (plaid.TransactionList, error) {
+	fields, err := mt940Fields(r)
+	if err != nil {
+		return plaid.TransactionList{}, err
+	}
+
+	list := plaid.TransactionList{Transactions: []plaid.Transaction{}}
+	found := false
+	var account, currency string
+	var transaction *plaid.Transaction
+	var supplementary string
+	finish := func() {
+		if transaction == nil {
+			return
+		}
+		if transaction.Name == "" {
+			transaction.Name = supplementary
+		}
+		list.Transactions = append(list.Transactions, *transaction)
+		transaction = nil
+	}
+
+	for _, field := range fields {
+		switch field.tag {
+		case "20":
+			finish()
+			account, currency = "", ""
+		case "25":
+			account = strings.TrimSpace(field.value)
+		case "60F", "60M":
+			found = true
+			if match := mt940Balance.FindStringSubmatch(field.value); match != nil {
+				currency = match[1]
+			}
+		case "61":
+			finish()
+			found = true
+			var parsed plaid.Transaction
+			parsed, supplementary, err = mt940Transaction(field.value, account, currency)
+			if err != nil {
+				return plaid.TransactionList{}, err
+			}
+			transaction = &parsed
+		case "86":
+			if transaction != nil {
+				transaction.Name = mt940Description(field.value)
+			}
+		default:
+			finish()
+		}
+	}
+	finish()
+
+	if !found {
+		return plaid.TransactionList{}, ErrNotMT940
+	}
+	return list, nil
+}
+
+// mt940Fields splits an MT940 file into its fields, joining the lines of fields that continue over several lines.
+// SWIFT block headers and the lines that end each message are skipped.
+func mt940Fields(r io.Reader) ([]mt940Field, error) {
+	var fields []mt940Field
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r ")
+		if strings.HasPrefix(line, "{") {
+			block := strings.Index(line, "{4:")
+			if block < 0 {
+				continue
+			}
+			line = line[block+3:]
+		}
+		if line == "" || line == "-" || line == "-}" {
+			continue
+		}
+
+		if tag := mt940Tag.FindStringSubmatch(line); tag != nil {
+			fields = append(fields, mt940Field{tag: tag[1], value: line[len(tag[0]):]})
+		} else if len(fields) > 0 {
+			fields[len(fields)-1].value += "\n" + line
+		}
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read statement: %w", err)
+	}
+	return fields, nil
+}
+
+// mt940Transaction converts a :61: statement line to a transaction without a name,
+// returning the supplementary details of the line to describe it by if it has no :86: field
+func mt940Transaction(value string, account string, currency string) (plaid.Transaction, string, error) {
+	lines := strings.SplitN(value, "\n", 2)
+	match := mt940StatementLine.FindStringSubmatch(lines[0])
+	if match == nil {
+		return plaid.Transaction{}, "", fmt.Errorf("invalid statement line %q", lines[0])
+	}
+
+	date, err := time.Parse(mt940DateLayout, match[1])
+	if err != nil {
+		return plaid.Transaction{}, "", fmt.Errorf("statement line %q has an invalid date: %w", lines[0], err)
+	}
+
+	mark := match[3]
+	amount, err := signedAmount(strings.Replace(match[5], ",", ".", 1), mark == "D" || mark == "RC")
+	if err != nil {
+		return plaid.Transaction{}, "", fmt.Errorf("statement line %q has an %w", lines[0], err)
+	}
+
+	ownerReference, servicerReference := match[7], ""
+	if i := strings.Index(ownerReference, "//"); i >= 0 {
+		ownerReference, servicerReference = ownerReference[:i], ownerReference[i+2:]
+	}
+	id := strings.TrimSpace(servicerReference)
+	if id == "" && ownerReference != "NONREF" {
+		id = strings.TrimSpace(ownerReference)
+	}
+	if id != "" && account != "" {
+		id = account + "/" + id
+	}
+
+	var supplementary string
+	if len(lines) > 1 {
+		supplementary = strings.TrimSpace(lines[1])
+	}
+
+	return plaid.Transaction{
+		TransactionID:   id,
+		AccountID:       account,
+		Amount:          amount,
+		ISOCurrencyCode: currency,
+		Date:            date.Format(dateLayout),
+	}, supplementary, nil
+}
+
+// mt940Description returns the description of a transaction from its :86: information to the account owner.
+// Structured information, which starts with a transaction code and ?00, is described by the name of the other party
+// in subfields ?32 and ?33, or by the remittance information in subfields ?20 to ?29 if there is no name.
+func mt940Description(value string) string {
+	if !mt940Structured.MatchString(value) {
+		return strings.Join(strings.Fields(value), " ")
+	}
+	value = strings.Replace(value, "\n", "", -1)
+
+	subfields := map[string]string{}
+	for _, part := range strings.Split(value, "?")[1:] {
+		if len(part) >= 2 {
+			subfields[part[:2]] += part[2:]
+		}
+	}
+
+	var name, remittance []string
+	for _, code := range []string{"32", "33"} {
+		if subfields[code] != "" {
+			name = append(name, subfields[code])
+		}
+	}
+	for code := 20; code <= 29; code++ {
+		if text := subfields[fmt.Sprint(code)]; text != "" {
+			remittance = append(remittance, text)
+		}
+	}
+
+	description := strings.Join(name, "")
+	if description == "" {
+		description = strings.Join(remittance, " ")
+	}
+	return strings.Join(strings.Fields(description), " ")
+}
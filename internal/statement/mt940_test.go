@@ -0,0 +1,63 @@
+package statement
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Catzkorn/subscrypt/internal/plaid"
+)
+
+const mt940Statement = `{1:F01BANKGB2LAXXX0000000000}{2:O9400000000000BANKGB2LAXXX00000000000000000000N}{4:
+:20:STMT2010
+:25:20201512345678
+:28C:00010/001
+:60F:C201001GBP1000,00
+:61:2010121013D9,99NDDTNONREF//B0A12345
+:86:NETFLIX.COM MONTHLY
+SUBSCRIPTION
+:61:2010281028C1500,00NTRFSALARY//B0A23456
+:86:166?00GUTSCHRIFT?20LOHN OKTOBER?32ACME
+ LTD
+:61:201030RC34,99NDDTNONREF//B0A34567
+/CARD PAYMENT REVERSED
+:61:201031D44,98NDDTPG-1031
+:86:005?00LASTSCHRIFT?20PUREGYM MEMBERSHIP?21OCTOBER
+:62F:C201031GBP2420,05
+-}
+`
+
+func TestParseMT940(t *testing.T) {
+	t.Run("reads the statement lines of a statement", func(t *testing.T) {
+		got, err := ParseMT940(strings.NewReader(mt940Statement))
+		if err != nil {
+			t.Fatalf("unexpected error parsing statement: %v", err)
+		}
+
+		account := "20201512345678"
+		want := []plaid.Transaction{
+			{TransactionID: account + "/B0A12345", AccountID: account, Amount: 9.99, ISOCurrencyCode: "GBP", Date: "2020-10-12", Name: "NETFLIX.COM MONTHLY SUBSCRIPTION"},
+			{TransactionID: account + "/B0A23456", AccountID: account, Amount: -1500, ISOCurrencyCode: "GBP", Date: "2020-10-28", Name: "ACME LTD"},
+			{TransactionID: account + "/B0A34567", AccountID: account, Amount: 34.99, ISOCurrencyCode: "GBP", Date: "2020-10-30", Name: "/CARD PAYMENT REVERSED"},
+			{TransactionID: account + "/PG-1031", AccountID: account, Amount: 44.98, ISOCurrencyCode: "GBP", Date: "2020-10-31", Name: "PUREGYM MEMBERSHIP OCTOBER"},
+		}
+		if !reflect.DeepEqual(got.Transactions, want) {
+			t.Errorf("got %v want %v", got.Transactions, want)
+		}
+	})
+
+	t.Run("returns an error for a file that isn't MT940", func(t *testing.T) {
+		_, err := ParseMT940(strings.NewReader("Date,Description,Amount\n"))
+		if !errors.Is(err, ErrNotMT940) {
+			t.Errorf("got %v want %v", err, ErrNotMT940)
+		}
+	})
+
+	t.Run("returns an error for a statement line that can't be read", func(t *testing.T) {
+		_, err := ParseMT940(strings.NewReader(":20:STMT\n:60F:C201001GBP0,00\n:61:yesterday D9,99\n"))
+		if err == nil || !strings.Contains(err.Error(), "invalid statement line") {
+			t.Errorf("got %v want an error for the invalid statement line", err)
+		}
+	})
+}
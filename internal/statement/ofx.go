@@ -0,0 +1,161 @@
+package statement
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/Catzkorn/subscrypt/internal/plaid"
+)
+
+// ofxDateLayout is the format of the date at the start of OFX date and time values
+const ofxDateLayout = "20060102"
+
+// ErrNotOFX is returned when a statement doesn't have an OFX element
+var ErrNotOFX = errors.New("statement is not an OFX file")
+
+// ofxElement is a start or end tag of an OFX file. Start tags of elements that hold a value have its text.
+type ofxElement struct {
+	name string
+	end  bool
+	text string
+}
+
+// ParseOFX reads the transactions from the bank and credit card statements of an OFX or QFX file.
+// Both OFX 1.x files, which are SGML and don't close the elements that hold values, and OFX 2.x XML files are read.
+// Transactions are described by their name, or by their memo if they don't have one, take the account and currency
+// of the statement they are in, and are identified by the bank's FITID prefixed by the account.
+// The amounts of the transactions returned follow Plaid's convention, positive amounts are money paid out.
+func ParseOFX(r io.Reader) (plaid.TransactionList, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return plaid.TransactionList{}, fmt.Errorf("unable to read statement: %w", err)
+	}
+
+	elements, err := ofxElements(string(data))
+	if err != nil {
+		return plaid.TransactionList{}, err
+	}
+
+	list := plaid.TransactionList{Transactions: []plaid.Transaction{}}
+	var account, currency string
+	var fields map[string]string
+	for _, element := range elements {
+		switch {
+		case element.name == "STMTTRN" && !element.end:
+			fields = map[string]string{}
+		case element.name == "STMTTRN" && element.end && fields != nil:
+			transaction, err := ofxTransaction(fields, account, currency)
+			if err != nil {
+				return plaid.TransactionList{}, err
+			}
+			list.Transactions = append(list.Transactions, transaction)
+			fields = nil
+		case element.end || element.text == "":
+		case fields != nil:
+			if _, ok := fields[element.name]; !ok {
+				fields[element.name] = element.text
+			}
+		case element.name == "ACCTID":
+			account = element.text
+		case element.name == "CURDEF":
+			currency = element.text
+		}
+	}
+	return list, nil
+}
+
+// ofxElements splits the body of an OFX file, from its OFX element onwards, into its tags.
+// Processing instructions and comments are skipped.
+func ofxElements(data string) ([]ofxElement, error) {
+	start := strings.Index(strings.ToUpper(data), "<OFX>")
+	if start < 0 {
+		return nil, ErrNotOFX
+	}
+	rest := data[start:]
+
+	var elements []ofxElement
+	for {
+		open := strings.IndexByte(rest, '<')
+		if open < 0 {
+			return elements, nil
+		}
+		rest = rest[open+1:]
+
+		if strings.HasPrefix(rest, "!--") {
+			end := strings.Index(rest, "-->")
+			if end < 0 {
+				return nil, errors.New("statement has an unclosed comment")
+			}
+			rest = rest[end+3:]
+			continue
+		}
+
+		closing := strings.IndexByte(rest, '>')
+		if closing < 0 {
+			return nil, errors.New("statement has an unclosed tag")
+		}
+		tag := strings.TrimSpace(rest[:closing])
+		rest = rest[closing+1:]
+		if strings.HasPrefix(tag, "?") || strings.HasPrefix(tag, "!") {
+			continue
+		}
+
+		text := rest
+		if next := strings.IndexByte(rest, '<'); next >= 0 {
+			text = rest[:next]
+		}
+
+		if strings.HasPrefix(tag, "/") {
+			elements = append(elements, ofxElement{name: strings.ToUpper(strings.TrimPrefix(tag, "/")), end: true})
+		} else {
+			elements = append(elements, ofxElement{name: strings.ToUpper(tag), text: strings.TrimSpace(html.UnescapeString(text))})
+		}
+	}
+}
+
+// ofxTransaction converts the fields of a STMTTRN element to a transaction
+func ofxTransaction(fields map[string]string, account string, currency string) (plaid.Transaction, error) {
+	name := fields["NAME"]
+	if name == "" {
+		name = fields["MEMO"]
+	}
+
+	posted := fields["DTPOSTED"]
+	if len(posted) < len(ofxDateLayout) {
+		return plaid.Transaction{}, fmt.Errorf("transaction %q has an invalid date %q", name, posted)
+	}
+	date, err := time.Parse(ofxDateLayout, posted[:len(ofxDateLayout)])
+	if err != nil {
+		return plaid.Transaction{}, fmt.Errorf("transaction %q has an invalid date %q: %w", name, posted, err)
+	}
+
+	value := fields["TRNAMT"]
+	if !strings.Contains(value, ".") {
+		value = strings.Replace(value, ",", ".", 1)
+	}
+	amount, err := parseAmount(value)
+	if err != nil {
+		return plaid.Transaction{}, fmt.Errorf("transaction %q has an %w", name, err)
+	}
+
+	// FITIDs are only unique within an account
+	id := fields["FITID"]
+	if id != "" && account != "" {
+		id = account + "/" + id
+	}
+
+	floatAmount, _ := amount.Neg().Float64()
+	return plaid.Transaction{
+		TransactionID:   id,
+		AccountID:       account,
+		Amount:          float32(floatAmount),
+		ISOCurrencyCode: currency,
+		Date:            date.Format(dateLayout),
+		Name:            name,
+	}, nil
+}
@@ -0,0 +1,171 @@
+package statement
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Catzkorn/subscrypt/internal/plaid"
+)
+
+const sgmlStatement = `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+SECURITY:NONE
+ENCODING:USASCII
+CHARSET:1252
+COMPRESSION:NONE
+OLDFILEUID:NONE
+NEWFILEUID:NONE
+
+<OFX>
+<SIGNONMSGSRSV1>
+<SONRS>
+<STATUS><CODE>0<SEVERITY>INFO</STATUS>
+<DTSERVER>20201101120000
+<LANGUAGE>ENG
+</SONRS>
+</SIGNONMSGSRSV1>
+<BANKMSGSRSV1>
+<STMTTRNRS>
+<TRNUID>1
+<STMTRS>
+<CURDEF>GBP
+<BANKACCTFROM>
+<BANKID>112233
+<ACCTID>12345678
+<ACCTTYPE>CHECKING
+</BANKACCTFROM>
+<BANKTRANLIST>
+<DTSTART>20201001
+<DTEND>20201031
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20201012000000.000[0:GMT]
+<TRNAMT>-9.99
+<FITID>202010120001
+<NAME>NETFLIX.COM
+<MEMO>Card payment
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTPOSTED>20201028
+<TRNAMT>1500.00
+<FITID>202010280001
+<MEMO>SALARY
+</STMTTRN>
+</BANKTRANLIST>
+<LEDGERBAL><BALAMT>1490.01<DTASOF>20201031</LEDGERBAL>
+</STMTRS>
+</STMTTRNRS>
+</BANKMSGSRSV1>
+</OFX>
+`
+
+const xmlStatement = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+<OFX>
+  <CREDITCARDMSGSRSV1>
+    <CCSTMTTRNRS>
+      <TRNUID>1</TRNUID>
+      <CCSTMTRS>
+        <CURDEF>USD</CURDEF>
+        <CCACCTFROM>
+          <ACCTID>4111</ACCTID>
+        </CCACCTFROM>
+        <BANKTRANLIST>
+          <!-- The card's transactions -->
+          <STMTTRN>
+            <TRNTYPE>DEBIT</TRNTYPE>
+            <DTPOSTED>20201014</DTPOSTED>
+            <TRNAMT>-34,99</TRNAMT>
+            <FITID>T1</FITID>
+            <NAME>Gym &amp; Spa</NAME>
+          </STMTTRN>
+        </BANKTRANLIST>
+      </CCSTMTRS>
+    </CCSTMTTRNRS>
+  </CREDITCARDMSGSRSV1>
+</OFX>
+`
+
+func TestParseOFX(t *testing.T) {
+	t.Run("reads an OFX 1.x SGML statement", func(t *testing.T) {
+		got, err := ParseOFX(strings.NewReader(sgmlStatement))
+		if err != nil {
+			t.Fatalf("unexpected error parsing statement: %v", err)
+		}
+
+		want := []plaid.Transaction{
+			{TransactionID: "12345678/202010120001", AccountID: "12345678", Amount: 9.99, ISOCurrencyCode: "GBP", Date: "2020-10-12", Name: "NETFLIX.COM"},
+			{TransactionID: "12345678/202010280001", AccountID: "12345678", Amount: -1500, ISOCurrencyCode: "GBP", Date: "2020-10-28", Name: "SALARY"},
+		}
+		if !reflect.DeepEqual(got.Transactions, want) {
+			t.Errorf("got %v want %v", got.Transactions, want)
+		}
+	})
+
+	t.Run("reads an OFX 2.x XML statement", func(t *testing.T) {
+		got, err := ParseOFX(strings.NewReader(xmlStatement))
+		if err != nil {
+			t.Fatalf("unexpected error parsing statement: %v", err)
+		}
+
+		want := []plaid.Transaction{
+			{TransactionID: "4111/T1", AccountID: "4111", Amount: 34.99, ISOCurrencyCode: "USD", Date: "2020-10-14", Name: "Gym & Spa"},
+		}
+		if !reflect.DeepEqual(got.Transactions, want) {
+			t.Errorf("got %v want %v", got.Transactions, want)
+		}
+	})
+
+	t.Run("returns an error for a file that isn't OFX", func(t *testing.T) {
+		_, err := ParseOFX(strings.NewReader("Date,Description,Amount\n"))
+		if !errors.Is(err, ErrNotOFX) {
+			t.Errorf("got %v want %v", err, ErrNotOFX)
+		}
+	})
+
+	t.Run("returns an error for a transaction that can't be read", func(t *testing.T) {
+		cases := map[string]string{
+			"date":   "<OFX><STMTTRN><DTPOSTED>12/10/2020<TRNAMT>-9.99<NAME>NETFLIX.COM</STMTTRN></OFX>",
+			"amount": "<OFX><STMTTRN><DTPOSTED>20201012<TRNAMT>nine<NAME>NETFLIX.COM</STMTTRN></OFX>",
+		}
+
+		for name, statement := range cases {
+			_, err := ParseOFX(strings.NewReader(statement))
+			if err == nil || !strings.Contains(err.Error(), "invalid "+name) {
+				t.Errorf("got %v want an error for the invalid %s", err, name)
+			}
+		}
+	})
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "statement.ofx")
+	err := ioutil.WriteFile(path, []byte(sgmlStatement), 0600)
+	if err != nil {
+		t.Fatalf("unable to write statement: %v", err)
+	}
+
+	t.Run("reads the transactions from the statement", func(t *testing.T) {
+		got, err := File{Path: path, Parse: ParseOFX}.GetTransactions(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error getting transactions: %v", err)
+		}
+		if len(got.Transactions) != 2 {
+			t.Errorf("got %d transactions want 2", len(got.Transactions))
+		}
+	})
+
+	t.Run("returns an error for a missing statement", func(t *testing.T) {
+		_, err := File{Path: path + ".missing", Parse: ParseOFX}.GetTransactions(context.Background())
+		if err == nil {
+			t.Errorf("expected an error reading a missing statement")
+		}
+	})
+}
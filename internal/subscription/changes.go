@@ -0,0 +1,73 @@
+package subscription
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// The reasons Validate gives for a subscription that can't be stored
+var (
+	ErrNameMissing    = errors.New("a subscription needs a name")
+	ErrNameTooLong    = errors.New("a subscription's name can't be longer than 100 characters")
+	ErrNegativeAmount = errors.New("a subscription's amount can't be negative")
+	ErrDateDueMissing = errors.New("a subscription needs a date it is due")
+)
+
+// maxNameLength is the longest name a subscription can be stored with, the size of its database column
+const maxNameLength = 100
+
+// Changes are the fields of a subscription a partial update sets. Fields that are nil are left as they are.
+type Changes struct {
+	Name      *string          `json:"name"`
+	Merchant  *string          `json:"merchant"`
+	Category  *string          `json:"category"`
+	Amount    *decimal.Decimal `json:"amount"`
+	DateDue   *time.Time       `json:"dateDue"`
+	Frequency *Frequency       `json:"frequency"`
+	Interval  *int             `json:"interval"`
+}
+
+// Apply returns the subscription with the changes made to it
+func (c Changes) Apply(sub Subscription) Subscription {
+	if c.Name != nil {
+		sub.Name = *c.Name
+	}
+	if c.Merchant != nil {
+		sub.Merchant = *c.Merchant
+	}
+	if c.Category != nil {
+		sub.Category = *c.Category
+	}
+	if c.Amount != nil {
+		sub.Amount = *c.Amount
+	}
+	if c.DateDue != nil {
+		sub.DateDue = *c.DateDue
+	}
+	if c.Frequency != nil {
+		sub.Frequency = *c.Frequency
+	}
+	if c.Interval != nil {
+		sub.Interval = *c.Interval
+	}
+	return sub
+}
+
+// Validate checks that the subscription has a name, an amount that isn't negative, a date it is due and a known cadence
+func (s Subscription) Validate() error {
+	switch {
+	case strings.TrimSpace(s.Name) == "":
+		return ErrNameMissing
+	case len([]rune(s.Name)) > maxNameLength:
+		return ErrNameTooLong
+	case s.Amount.IsNegative():
+		return ErrNegativeAmount
+	case s.DateDue.IsZero():
+		return ErrDateDueMissing
+	default:
+		return ValidateCadence(s.Frequency, s.Interval)
+	}
+}
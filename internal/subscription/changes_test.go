@@ -0,0 +1,80 @@
+package subscription
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestChangesApply(t *testing.T) {
+	original := Subscription{
+		ID:        3,
+		Name:      "Netflix",
+		Merchant:  "netflix",
+		Category:  "Entertainment",
+		Amount:    decimal.RequireFromString("9.99"),
+		DateDue:   date(2020, time.December, 12),
+		Frequency: Monthly,
+		Interval:  1,
+	}
+
+	name := "Netflix Premium"
+	amount := decimal.RequireFromString("15.99")
+	frequency := EveryNMonths
+	interval := 2
+	got := Changes{Name: &name, Amount: &amount, Frequency: &frequency, Interval: &interval}.Apply(original)
+
+	want := original
+	want.Name = name
+	want.Amount = amount
+	want.Frequency = frequency
+	want.Interval = interval
+	if got.Name != want.Name || !got.Amount.Equal(want.Amount) || got.Frequency != want.Frequency || got.Interval != want.Interval {
+		t.Errorf("got %+v want %+v", got, want)
+	}
+	if got.ID != original.ID || got.Merchant != original.Merchant || got.Category != original.Category || !got.DateDue.Equal(original.DateDue) {
+		t.Errorf("changed fields that weren't set, got %+v want %+v", got, want)
+	}
+
+	if unchanged := (Changes{}).Apply(original); unchanged.Name != original.Name || !unchanged.Amount.Equal(original.Amount) {
+		t.Errorf("got %+v want no changes to %+v", unchanged, original)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := Subscription{Name: "Netflix", Amount: decimal.RequireFromString("9.99"), DateDue: date(2020, time.December, 12), Frequency: Monthly, Interval: 1}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	free := valid
+	free.Amount = decimal.Zero
+	if err := free.Validate(); err != nil {
+		t.Errorf("unexpected error for a free subscription: %v", err)
+	}
+
+	cases := map[string]struct {
+		change func(*Subscription)
+		want   error
+	}{
+		"without a name":          {func(s *Subscription) { s.Name = "  " }, ErrNameMissing},
+		"with a long name":        {func(s *Subscription) { s.Name = strings.Repeat("n", 101) }, ErrNameTooLong},
+		"with a negative amount":  {func(s *Subscription) { s.Amount = decimal.RequireFromString("-1") }, ErrNegativeAmount},
+		"without a due date":      {func(s *Subscription) { s.DateDue = time.Time{} }, ErrDateDueMissing},
+		"with an unknown cadence": {func(s *Subscription) { s.Frequency = "hourly" }, nil},
+		"without an interval":     {func(s *Subscription) { s.Frequency, s.Interval = EveryNDays, 0 }, nil},
+	}
+	for name, c := range cases {
+		t.Run("rejects a subscription "+name, func(t *testing.T) {
+			sub := valid
+			c.change(&sub)
+			err := sub.Validate()
+			if err == nil || (c.want != nil && !errors.Is(err, c.want)) {
+				t.Errorf("got %v want %v", err, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package subscription
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/Catzkorn/subscrypt/internal/catalogue"
+	"github.com/Catzkorn/subscrypt/internal/merchant"
+	"github.com/Catzkorn/subscrypt/internal/plaid"
+
+	"github.com/shopspring/decimal"
+)
+
+// MinConfidence is the lowest confidence score a detected candidate can have
+const MinConfidence = 0.5
+
+// knownMerchantConfidence is the confidence given to a single payment to a merchant in the catalogue
+const knownMerchantConfidence = 0.5
+
+// amountTolerance is how far, as a fraction of the typical amount, a payment can be from it and still count as the same charge
+const amountTolerance = 0.15
+
+// Candidate is a subscription detected from a series of payments to the same merchant.
+// ID is set once the candidate is stored for review.
+// Confidence is a score between 0 and 1 of how likely the payments are to be a subscription.
+// Transactions are the payments the subscription was detected from.
+type Candidate struct {
+	ID           int                 `json:"id"`
+	Subscription Subscription        `json:"subscription"`
+	Merchant     string              `json:"merchant"`
+	Confidence   float64             `json:"confidence"`
+	Transactions []plaid.Transaction `json:"transactions"`
+}
+
+// cadence is a billing frequency that can be recognised from the number of days between payments
+type cadence struct {
+	frequency Frequency
+	days      float64
+	tolerance float64
+}
+
+var cadences = []cadence{
+	{Weekly, 7, 2},
+	{Fortnightly, 14, 3},
+	{Monthly, 30.44, 4},
+	{Quarterly, 91.31, 10},
+	{SemiAnnually, 182.62, 15},
+	{Annually, 365.25, 20},
+}
+
+// payment is a transaction with its date parsed
+type payment struct {
+	transaction plaid.Transaction
+	date        time.Time
+	amount      float64
+}
+
+// DetectSubscriptions groups the transactions by merchant, using the resolver to find the canonical merchant
+// of each one, and looks for payments that repeat at a regular interval for a similar amount.
+// Merchants in the catalogue are grouped under their catalogue name, are given its category, and are
+// detected from a single payment at the catalogue's typical cadence. The resolver and catalogue can be nil.
+// It returns a candidate for every merchant whose payments look like a subscription,
+// ordered by when the merchant first appears in the transactions.
+func DetectSubscriptions(transactions plaid.TransactionList, resolver *merchant.Resolver, merchants *catalogue.Catalogue) []Candidate {
+	var names []string
+	payments := map[string][]payment{}
+	known := map[string]catalogue.Entry{}
+
+	for _, transaction := range transactions.Transactions {
+		date, err := time.Parse(dateLayout, transaction.Date)
+		if err != nil || transaction.Amount <= 0 {
+			continue
+		}
+
+		name := resolver.Resolve(transaction.Name)
+		if name == "" {
+			continue
+		}
+		if entry, ok := merchants.Match(name); ok {
+			name = entry.Merchant
+			known[name] = entry
+		}
+		if _, ok := payments[name]; !ok {
+			names = append(names, name)
+		}
+		payments[name] = append(payments[name], payment{transaction: transaction, date: date, amount: float64(transaction.Amount)})
+	}
+
+	var candidates []Candidate
+	for _, name := range names {
+		entry, isKnown := known[name]
+		candidate, ok := detectRecurringPayments(name, payments[name])
+		if !ok && isKnown {
+			candidate, ok = knownMerchantCandidate(entry, payments[name]), true
+		}
+		if ok {
+			candidate.Subscription.Category = entry.Category
+			candidates = append(candidates, candidate)
+		}
+	}
+	return candidates
+}
+
+// detectRecurringPayments infers a cadence from the payments to a single merchant and scores how regular they are
+func detectRecurringPayments(merchant string, payments []payment) (Candidate, bool) {
+	if len(payments) < 2 {
+		return Candidate{}, false
+	}
+
+	sort.SliceStable(payments, func(i, j int) bool {
+		return payments[i].date.Before(payments[j].date)
+	})
+
+	var gaps []float64
+	var amounts []float64
+	for i, p := range payments {
+		amounts = append(amounts, p.amount)
+		if i > 0 {
+			gaps = append(gaps, p.date.Sub(payments[i-1].date).Hours()/24)
+		}
+	}
+
+	typicalGap := median(gaps)
+	if typicalGap < 1 {
+		return Candidate{}, false
+	}
+	frequency, interval, period, tolerance := inferCadence(typicalGap)
+
+	regular := 0
+	for _, gap := range gaps {
+		if math.Abs(gap-period) <= tolerance {
+			regular++
+		}
+	}
+	regularity := float64(regular) / float64(len(gaps))
+
+	typicalAmount := median(amounts)
+	similar := 0
+	for _, amount := range amounts {
+		if math.Abs(amount-typicalAmount) <= typicalAmount*amountTolerance {
+			similar++
+		}
+	}
+	consistency := float64(similar) / float64(len(amounts))
+
+	evidence := 1 - math.Pow(0.5, float64(len(gaps)))
+
+	confidence := regularity * consistency * evidence
+
+	last := payments[len(payments)-1]
+	if now().Sub(last.date).Hours()/24 > 2*period+tolerance {
+		// The payments have stopped, so the subscription has probably been cancelled
+		confidence /= 2
+	}
+
+	if confidence < MinConfidence {
+		return Candidate{}, false
+	}
+
+	var transactions []plaid.Transaction
+	for _, p := range payments {
+		transactions = append(transactions, p.transaction)
+	}
+
+	return Candidate{
+		Subscription: Subscription{
+			Name:      last.transaction.Name,
+			Merchant:  merchant,
+			Amount:    decimal.NewFromFloat32(last.transaction.Amount),
+			DateDue:   NextDueDate(last.date, frequency, interval, now()),
+			Frequency: frequency,
+			Interval:  interval,
+		},
+		Merchant:     merchant,
+		Confidence:   math.Round(confidence*100) / 100,
+		Transactions: transactions,
+	}, true
+}
+
+// knownMerchantCandidate creates a candidate from the most recent payment to a merchant in the catalogue,
+// billed at the catalogue's typical cadence for the merchant or monthly if it doesn't have a valid one
+func knownMerchantCandidate(entry catalogue.Entry, payments []payment) Candidate {
+	latest := payments[0]
+	for _, p := range payments {
+		if p.date.After(latest.date) {
+			latest = p
+		}
+	}
+
+	frequency, interval := Frequency(entry.Frequency), entry.Interval
+	if interval == 0 {
+		interval = 1
+	}
+	if ValidateCadence(frequency, interval) != nil {
+		frequency, interval = DefaultFrequency, 1
+	}
+
+	var transactions []plaid.Transaction
+	for _, p := range payments {
+		transactions = append(transactions, p.transaction)
+	}
+
+	return Candidate{
+		Subscription: Subscription{
+			Name:      latest.transaction.Name,
+			Merchant:  entry.Merchant,
+			Amount:    decimal.NewFromFloat32(latest.transaction.Amount),
+			DateDue:   NextDueDate(latest.date, frequency, interval, now()),
+			Frequency: frequency,
+			Interval:  interval,
+		},
+		Merchant:     entry.Merchant,
+		Confidence:   knownMerchantConfidence,
+		Transactions: transactions,
+	}
+}
+
+// inferCadence finds the billing frequency closest to the typical number of days between payments.
+// Gaps that don't match a standard frequency become a custom frequency of every N days or months.
+func inferCadence(typicalGap float64) (frequency Frequency, interval int, period float64, tolerance float64) {
+	for _, c := range cadences {
+		if math.Abs(typicalGap-c.days) <= c.tolerance {
+			return c.frequency, 1, c.days, c.tolerance
+		}
+	}
+
+	if typicalGap < 28 {
+		days := int(math.Round(typicalGap))
+		return EveryNDays, days, float64(days), math.Max(1, float64(days)*0.15)
+	}
+
+	months := int(math.Round(typicalGap / 30.44))
+	return EveryNMonths, months, float64(months) * 30.44, float64(months) * 4
+}
+
+// median returns the middle value of the numbers
+func median(numbers []float64) float64 {
+	if len(numbers) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), numbers...)
+	sort.Float64s(sorted)
+
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
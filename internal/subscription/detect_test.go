@@ -0,0 +1,259 @@
+package subscription
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Catzkorn/subscrypt/internal/merchant"
+	"github.com/Catzkorn/subscrypt/internal/plaid"
+)
+
+func TestDetectSubscriptions(t *testing.T) {
+	fixClock(t, time.Date(2020, time.November, 20, 9, 0, 0, 0, time.UTC))
+
+	cases := []struct {
+		name         string
+		transactions []plaid.Transaction
+		detected     bool
+		frequency    Frequency
+		interval     int
+		dateDue      time.Time
+		payments     int
+	}{
+		{
+			name:         "steady monthly payments",
+			transactions: history("Spotify", 9.99, monthlyDates("2020-06-03", 6)...),
+			detected:     true, frequency: Monthly, interval: 1, dateDue: date(2020, time.December, 3), payments: 6,
+		},
+		{
+			name:         "monthly payments taken a few days early or late",
+			transactions: history("PureGym", 19.99, "2020-06-01", "2020-07-03", "2020-07-31", "2020-09-02", "2020-10-01", "2020-11-02"),
+			detected:     true, frequency: Monthly, interval: 1, dateDue: date(2020, time.December, 2), payments: 6,
+		},
+		{
+			name: "monthly payments with a price rise",
+			transactions: append(
+				history("Disney Plus", 5.99, monthlyDates("2020-05-24", 4)...),
+				history("Disney Plus", 6.49, monthlyDates("2020-09-24", 2)...)...,
+			),
+			detected: true, frequency: Monthly, interval: 1, dateDue: date(2020, time.November, 24), payments: 6,
+		},
+		{
+			name:         "weekly payments",
+			transactions: history("The Guardian", 2.50, everyDays("2020-09-04", 7, 11)...),
+			detected:     true, frequency: Weekly, interval: 1, dateDue: date(2020, time.November, 27), payments: 11,
+		},
+		{
+			name:         "fortnightly payments",
+			transactions: history("Sparkle Cleaners", 40, everyDays("2020-08-07", 14, 8)...),
+			detected:     true, frequency: Fortnightly, interval: 1, dateDue: date(2020, time.November, 27), payments: 8,
+		},
+		{
+			name:         "quarterly payments",
+			transactions: history("Octopus Energy", 120, "2020-02-10", "2020-05-11", "2020-08-10", "2020-11-10"),
+			detected:     true, frequency: Quarterly, interval: 1, dateDue: date(2021, time.February, 10), payments: 4,
+		},
+		{
+			name:         "annual payments",
+			transactions: history("Amazon Prime", 79, "2018-12-01", "2019-12-01"),
+			detected:     true, frequency: Annually, interval: 1, dateDue: date(2020, time.December, 1), payments: 2,
+		},
+		{
+			name:         "payments every 10 days",
+			transactions: history("Milk Round", 6.20, everyDays("2020-10-01", 10, 5)...),
+			detected:     true, frequency: EveryNDays, interval: 10, dateDue: date(2020, time.November, 30), payments: 5,
+		},
+		{
+			name: "refunds are ignored",
+			transactions: append(
+				history("Netflix", 9.99, monthlyDates("2020-08-12", 4)...),
+				plaid.Transaction{Amount: -9.99, Date: "2020-10-14", Name: "Netflix"},
+			),
+			detected: true, frequency: Monthly, interval: 1, dateDue: date(2020, time.December, 12), payments: 4,
+		},
+		{
+			name: "descriptors with different reference numbers are the same merchant",
+			transactions: append(
+				history("NETFLIX.COM 866-579", 9.99, "2020-09-12"),
+				history("Netflix.com 123 456", 9.99, "2020-10-12", "2020-11-12")...,
+			),
+			detected: true, frequency: Monthly, interval: 1, dateDue: date(2020, time.December, 12), payments: 3,
+		},
+		{
+			name: "irregular shopping is not a subscription",
+			transactions: []plaid.Transaction{
+				{Amount: 23.10, Date: "2020-09-02", Name: "Tesco"},
+				{Amount: 54.80, Date: "2020-09-05", Name: "Tesco"},
+				{Amount: 12.00, Date: "2020-09-19", Name: "Tesco"},
+				{Amount: 80.45, Date: "2020-10-01", Name: "Tesco"},
+				{Amount: 5.20, Date: "2020-10-03", Name: "Tesco"},
+				{Amount: 33.33, Date: "2020-10-24", Name: "Tesco"},
+				{Amount: 61.00, Date: "2020-11-08", Name: "Tesco"},
+			},
+			detected: false,
+		},
+		{
+			name:         "a one-off purchase is not a subscription",
+			transactions: history("Apple Store", 999, "2020-10-30"),
+			detected:     false,
+		},
+		{
+			name:         "payments that stopped months ago are not a subscription",
+			transactions: history("Hello Fresh", 35, monthlyDates("2020-01-15", 4)...),
+			detected:     false,
+		},
+		{
+			name:         "a single payment to a known subscription",
+			transactions: history("KFC", 4.99, "2020-11-01"),
+			detected:     true, frequency: Monthly, interval: 1, dateDue: date(2020, time.December, 1), payments: 1,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			candidates := DetectSubscriptions(plaid.TransactionList{Transactions: c.transactions}, nil, knownMerchants)
+
+			if !c.detected {
+				if len(candidates) != 0 {
+					t.Errorf("got %d candidates want none: %v", len(candidates), candidates)
+				}
+				return
+			}
+
+			if len(candidates) != 1 {
+				t.Fatalf("got %d candidates want 1: %v", len(candidates), candidates)
+			}
+			got := candidates[0]
+
+			if got.Subscription.Frequency != c.frequency || got.Subscription.Interval != c.interval {
+				t.Errorf("got frequency %v every %v want %v every %v", got.Subscription.Frequency, got.Subscription.Interval, c.frequency, c.interval)
+			}
+
+			if !got.Subscription.DateDue.Equal(c.dateDue) {
+				t.Errorf("got due date %v want %v", got.Subscription.DateDue, c.dateDue)
+			}
+
+			if len(got.Transactions) != c.payments {
+				t.Errorf("got %d supporting transactions want %d", len(got.Transactions), c.payments)
+			}
+
+			if got.Confidence < MinConfidence || got.Confidence > 1 {
+				t.Errorf("got confidence %v want between %v and 1", got.Confidence, MinConfidence)
+			}
+		})
+	}
+}
+
+func TestDetectSubscriptionsConfidence(t *testing.T) {
+	fixClock(t, time.Date(2020, time.November, 20, 9, 0, 0, 0, time.UTC))
+
+	t.Run("a longer history is more certain than a short one", func(t *testing.T) {
+		long := DetectSubscriptions(plaid.TransactionList{Transactions: history("Spotify", 9.99, monthlyDates("2020-03-03", 9)...)}, nil, knownMerchants)
+		short := DetectSubscriptions(plaid.TransactionList{Transactions: history("Spotify", 9.99, monthlyDates("2020-09-03", 3)...)}, nil, knownMerchants)
+
+		if long[0].Confidence <= short[0].Confidence {
+			t.Errorf("got confidence %v for a long history and %v for a short one", long[0].Confidence, short[0].Confidence)
+		}
+	})
+
+	t.Run("separates the subscriptions of different merchants", func(t *testing.T) {
+		transactions := append(history("Spotify", 9.99, monthlyDates("2020-06-03", 6)...), history("The Guardian", 2.50, everyDays("2020-09-04", 7, 11)...)...)
+
+		candidates := DetectSubscriptions(plaid.TransactionList{Transactions: transactions}, nil, knownMerchants)
+
+		if len(candidates) != 2 {
+			t.Fatalf("got %d candidates want 2", len(candidates))
+		}
+		if candidates[0].Merchant != "spotify" || candidates[1].Merchant != "the guardian" {
+			t.Errorf("got merchants %q and %q want %q and %q", candidates[0].Merchant, candidates[1].Merchant, "spotify", "the guardian")
+		}
+	})
+}
+
+func TestDetectSubscriptionsWithAliases(t *testing.T) {
+	fixClock(t, time.Date(2020, time.November, 20, 9, 0, 0, 0, time.UTC))
+
+	t.Run("groups descriptors that an alias maps to the same merchant", func(t *testing.T) {
+		resolver := merchant.NewResolver([]merchant.Alias{{Pattern: "amzn prime", Merchant: "Amazon Prime"}})
+		transactions := append(
+			history("AMZN Prime*2K4DX0", 7.99, "2020-08-14", "2020-09-14"),
+			history("Amazon Prime*MK1234", 7.99, "2020-10-14", "2020-11-14")...,
+		)
+
+		candidates := DetectSubscriptions(plaid.TransactionList{Transactions: transactions}, resolver, nil)
+
+		if len(candidates) != 1 {
+			t.Fatalf("got %d candidates want 1: %v", len(candidates), candidates)
+		}
+		if candidates[0].Merchant != "amazon prime" || candidates[0].Subscription.Merchant != "amazon prime" {
+			t.Errorf("got merchant %q want %q", candidates[0].Merchant, "amazon prime")
+		}
+		if len(candidates[0].Transactions) != 4 {
+			t.Errorf("got %d supporting transactions want %d", len(candidates[0].Transactions), 4)
+		}
+	})
+}
+
+func TestDetectSubscriptionsWithCatalogue(t *testing.T) {
+	fixClock(t, time.Date(2020, time.November, 20, 9, 0, 0, 0, time.UTC))
+
+	t.Run("uses the catalogue's cadence for a single payment", func(t *testing.T) {
+		candidates := DetectSubscriptions(plaid.TransactionList{Transactions: history("Times Newspapers Ltd", 26, "2020-03-05")}, nil, knownMerchants)
+
+		if len(candidates) != 1 {
+			t.Fatalf("got %d candidates want 1: %v", len(candidates), candidates)
+		}
+		got := candidates[0].Subscription
+		if got.Merchant != "the times" || got.Frequency != Annually || !got.DateDue.Equal(date(2021, time.March, 5)) {
+			t.Errorf("got %v for %q due %v want annually for %q due %v", got.Frequency, got.Merchant, got.DateDue, "the times", date(2021, time.March, 5))
+		}
+	})
+
+	t.Run("gives detected subscriptions the catalogue's category", func(t *testing.T) {
+		candidates := DetectSubscriptions(plaid.TransactionList{Transactions: history("NETFLIX.COM", 9.99, monthlyDates("2020-06-12", 6)...)}, nil, knownMerchants)
+
+		if len(candidates) != 1 {
+			t.Fatalf("got %d candidates want 1: %v", len(candidates), candidates)
+		}
+		if candidates[0].Subscription.Category != "Entertainment" {
+			t.Errorf("got category %q want %q", candidates[0].Subscription.Category, "Entertainment")
+		}
+	})
+
+	t.Run("does not detect a single payment to an unknown merchant", func(t *testing.T) {
+		candidates := DetectSubscriptions(plaid.TransactionList{Transactions: history("KFC", 4.99, "2020-11-01")}, nil, nil)
+
+		if len(candidates) != 0 {
+			t.Errorf("got %d candidates want none: %v", len(candidates), candidates)
+		}
+	})
+}
+
+// history creates a payment of the same amount to the merchant on each of the dates
+func history(name string, amount float32, dates ...string) []plaid.Transaction {
+	var transactions []plaid.Transaction
+	for _, d := range dates {
+		transactions = append(transactions, plaid.Transaction{Amount: amount, Date: d, Name: name})
+	}
+	return transactions
+}
+
+// monthlyDates returns count dates a month apart, starting from the given date
+func monthlyDates(start string, count int) []string {
+	first, _ := time.Parse(dateLayout, start)
+	var dates []string
+	for n := 0; n < count; n++ {
+		dates = append(dates, AddPeriods(first, Monthly, 1, n).Format(dateLayout))
+	}
+	return dates
+}
+
+// everyDays returns count dates the given number of days apart, starting from the given date
+func everyDays(start string, days int, count int) []string {
+	first, _ := time.Parse(dateLayout, start)
+	var dates []string
+	for n := 0; n < count; n++ {
+		dates = append(dates, first.AddDate(0, 0, days*n).Format(dateLayout))
+	}
+	return dates
+}
@@ -0,0 +1,158 @@
+package subscription
+
+import (
+	"fmt"
+	"time"
+)
+
+// Frequency defines how often a subscription is billed
+type Frequency string
+
+// The billing frequencies a subscription can have.
+// EveryNDays and EveryNMonths are custom frequencies that use the subscription's Interval.
+const (
+	Weekly       Frequency = "weekly"
+	Fortnightly  Frequency = "fortnightly"
+	Monthly      Frequency = "monthly"
+	Quarterly    Frequency = "quarterly"
+	SemiAnnually Frequency = "semiannually"
+	Annually     Frequency = "annually"
+	EveryNDays   Frequency = "days"
+	EveryNMonths Frequency = "months"
+)
+
+// Frequencies lists every supported billing frequency
+var Frequencies = []Frequency{Weekly, Fortnightly, Monthly, Quarterly, SemiAnnually, Annually, EveryNDays, EveryNMonths}
+
+// DefaultFrequency is used for subscriptions that were stored without a frequency
+const DefaultFrequency = Monthly
+
+// ValidateCadence checks that the frequency is known and that custom frequencies have a positive interval
+func ValidateCadence(frequency Frequency, interval int) error {
+	switch frequency {
+	case Weekly, Fortnightly, Monthly, Quarterly, SemiAnnually, Annually:
+		return nil
+	case EveryNDays, EveryNMonths:
+		if interval < 1 {
+			return fmt.Errorf("frequency %q needs an interval of at least 1, got %d", frequency, interval)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown frequency %q", frequency)
+	}
+}
+
+// period returns the number of days and months between two payments of the given cadence
+func period(frequency Frequency, interval int) (days int, months int) {
+	switch frequency {
+	case Weekly:
+		return 7, 0
+	case Fortnightly:
+		return 14, 0
+	case Quarterly:
+		return 0, 3
+	case SemiAnnually:
+		return 0, 6
+	case Annually:
+		return 0, 12
+	case EveryNDays:
+		if interval > 0 {
+			return interval, 0
+		}
+	case EveryNMonths:
+		if interval > 0 {
+			return 0, interval
+		}
+	}
+	return 0, 1
+}
+
+// AddPeriods moves the date forward by n billing periods of the given cadence.
+// Monthly steps are always counted from the original date and are clamped to the end of shorter months,
+// so a subscription due on the 31st falls on the 28th of February and is back on the 31st in March.
+func AddPeriods(date time.Time, frequency Frequency, interval int, n int) time.Time {
+	days, months := period(frequency, interval)
+	if months == 0 {
+		return date.AddDate(0, 0, days*n)
+	}
+	return addMonths(date, months*n)
+}
+
+// NextDueDate returns the first date on or after the given time that a payment
+// falls on, stepping forward from the start date by the cadence
+func NextDueDate(start time.Time, frequency Frequency, interval int, after time.Time) time.Time {
+	return AddPeriods(start, frequency, interval, periodsUntil(start, frequency, interval, after))
+}
+
+// periodsUntil returns the number of billing periods from the start date to the first date on or after the given time that a payment falls on
+func periodsUntil(start time.Time, frequency Frequency, interval int, after time.Time) int {
+	if !start.Before(after) {
+		return 0
+	}
+
+	days, months := period(frequency, interval)
+	var n int
+	if months == 0 {
+		n = int(after.Sub(start).Hours() / 24 / float64(days))
+	} else {
+		n = ((after.Year()-start.Year())*12 + int(after.Month()) - int(start.Month())) / months
+	}
+
+	for AddPeriods(start, frequency, interval, n).Before(after) {
+		n++
+	}
+	return n
+}
+
+// NextDue returns the first date the subscription is due on or after the given time
+func (s Subscription) NextDue(after time.Time) time.Time {
+	return NextDueDate(s.DateDue, s.Frequency, s.Interval, after)
+}
+
+// Cadence returns a human readable description of how often the subscription is billed
+func (s Subscription) Cadence() string {
+	switch s.Frequency {
+	case Weekly:
+		return "Weekly"
+	case Fortnightly:
+		return "Fortnightly"
+	case Quarterly:
+		return "Quarterly"
+	case SemiAnnually:
+		return "Every 6 months"
+	case Annually:
+		return "Annually"
+	case EveryNDays:
+		return fmt.Sprintf("Every %d days", s.Interval)
+	case EveryNMonths:
+		return fmt.Sprintf("Every %d months", s.Interval)
+	default:
+		return "Monthly"
+	}
+}
+
+// RecurrenceRule returns the iCalendar RRULE value describing the subscription's cadence
+func (s Subscription) RecurrenceRule() string {
+	days, months := period(s.Frequency, s.Interval)
+	switch {
+	case months == 0 && days%7 == 0:
+		return fmt.Sprintf("FREQ=WEEKLY;INTERVAL=%d", days/7)
+	case months == 0:
+		return fmt.Sprintf("FREQ=DAILY;INTERVAL=%d", days)
+	case months%12 == 0:
+		return fmt.Sprintf("FREQ=YEARLY;INTERVAL=%d", months/12)
+	default:
+		return fmt.Sprintf("FREQ=MONTHLY;INTERVAL=%d", months)
+	}
+}
+
+// addMonths adds the given number of months to the date, clamping the day to the last day of the resulting month
+func addMonths(date time.Time, months int) time.Time {
+	year, month, day := date.Date()
+	firstOfMonth := time.Date(year, month+time.Month(months), 1, date.Hour(), date.Minute(), date.Second(), date.Nanosecond(), date.Location())
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return firstOfMonth.AddDate(0, 0, day-1)
+}
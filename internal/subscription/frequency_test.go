@@ -0,0 +1,93 @@
+package subscription
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextDueDate(t *testing.T) {
+	after := time.Date(2020, time.November, 20, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name      string
+		start     time.Time
+		frequency Frequency
+		interval  int
+		want      time.Time
+	}{
+		{"weekly", date(2020, time.October, 1), Weekly, 0, date(2020, time.November, 26)},
+		{"fortnightly", date(2020, time.October, 1), Fortnightly, 0, date(2020, time.November, 26)},
+		{"monthly", date(2020, time.January, 12), Monthly, 0, date(2020, time.December, 12)},
+		{"monthly on the 31st", date(2020, time.January, 31), Monthly, 0, date(2020, time.November, 30)},
+		{"quarterly", date(2020, time.January, 5), Quarterly, 0, date(2021, time.January, 5)},
+		{"semiannually", date(2019, time.December, 1), SemiAnnually, 0, date(2020, time.December, 1)},
+		{"annually", date(2016, time.February, 29), Annually, 0, date(2021, time.February, 28)},
+		{"every 10 days", date(2020, time.November, 1), EveryNDays, 10, date(2020, time.November, 21)},
+		{"every 2 months", date(2020, time.July, 15), EveryNMonths, 2, date(2021, time.January, 15)},
+		{"due on the day", date(2020, time.October, 20), Monthly, 0, date(2020, time.November, 20)},
+		{"start in the future", date(2021, time.March, 3), Weekly, 0, date(2021, time.March, 3)},
+		{"empty frequency is monthly", date(2020, time.September, 12), "", 0, date(2020, time.December, 12)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := NextDueDate(c.start, c.frequency, c.interval, after)
+			if !got.Equal(c.want) {
+				t.Errorf("got %v want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestAddPeriodsKeepsTheDayOfTheMonth(t *testing.T) {
+	start := date(2021, time.January, 31)
+
+	if got := AddPeriods(start, Monthly, 0, 1); !got.Equal(date(2021, time.February, 28)) {
+		t.Errorf("got %v want %v", got, date(2021, time.February, 28))
+	}
+
+	if got := AddPeriods(start, Monthly, 0, 2); !got.Equal(date(2021, time.March, 31)) {
+		t.Errorf("got %v want %v", got, date(2021, time.March, 31))
+	}
+}
+
+func TestValidateCadence(t *testing.T) {
+	cases := []struct {
+		frequency Frequency
+		interval  int
+		valid     bool
+	}{
+		{Weekly, 0, true},
+		{Annually, 0, true},
+		{EveryNDays, 3, true},
+		{EveryNMonths, 0, false},
+		{"hourly", 1, false},
+	}
+
+	for _, c := range cases {
+		err := ValidateCadence(c.frequency, c.interval)
+		if (err == nil) != c.valid {
+			t.Errorf("ValidateCadence(%q, %d) got error %v, want valid %v", c.frequency, c.interval, err, c.valid)
+		}
+	}
+}
+
+func TestRecurrenceRule(t *testing.T) {
+	cases := map[string]Subscription{
+		"FREQ=WEEKLY;INTERVAL=2":  {Frequency: Fortnightly},
+		"FREQ=MONTHLY;INTERVAL=1": {Frequency: Monthly},
+		"FREQ=MONTHLY;INTERVAL=3": {Frequency: Quarterly},
+		"FREQ=YEARLY;INTERVAL=1":  {Frequency: Annually},
+		"FREQ=DAILY;INTERVAL=10":  {Frequency: EveryNDays, Interval: 10},
+	}
+
+	for want, subscription := range cases {
+		if got := subscription.RecurrenceRule(); got != want {
+			t.Errorf("got %v want %v", got, want)
+		}
+	}
+}
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,34 @@
+package subscription
+
+import (
+	"github.com/Catzkorn/subscrypt/internal/transaction"
+)
+
+// MatchPayments finds the subscription each unmatched payment was for.
+// A payment is matched to a subscription with the same merchant, and to the one with the closest amount
+// if the merchant has more than one. Refunds and payments that are already matched are skipped.
+// It returns the external IDs of the matched payments by subscription ID.
+func MatchPayments(subscriptions []Subscription, transactions []transaction.Transaction) map[int][]string {
+	matches := map[int][]string{}
+
+	for _, t := range transactions {
+		if t.SubscriptionID != 0 || !t.Amount.IsPositive() || t.Merchant == "" {
+			continue
+		}
+
+		var best *Subscription
+		for i, sub := range subscriptions {
+			if sub.Merchant != t.Merchant {
+				continue
+			}
+			if best == nil || t.Amount.Sub(sub.Amount).Abs().LessThan(t.Amount.Sub(best.Amount).Abs()) {
+				best = &subscriptions[i]
+			}
+		}
+
+		if best != nil {
+			matches[best.ID] = append(matches[best.ID], t.ExternalID)
+		}
+	}
+	return matches
+}
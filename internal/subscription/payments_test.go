@@ -0,0 +1,50 @@
+package subscription
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Catzkorn/subscrypt/internal/transaction"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestMatchPayments(t *testing.T) {
+	payment := func(externalID string, merchant string, amount string) transaction.Transaction {
+		value, _ := decimal.NewFromString(amount)
+		return transaction.Transaction{ExternalID: externalID, Merchant: merchant, Amount: value, Date: time.Date(2020, time.October, 12, 0, 0, 0, 0, time.UTC)}
+	}
+	netflix := Subscription{ID: 1, Merchant: "netflix", Amount: decimal.RequireFromString("9.99")}
+	appleMusic := Subscription{ID: 2, Merchant: "apple", Amount: decimal.RequireFromString("9.99")}
+	iCloud := Subscription{ID: 3, Merchant: "apple", Amount: decimal.RequireFromString("0.79")}
+
+	t.Run("matches payments to the subscription with the same merchant", func(t *testing.T) {
+		got := MatchPayments([]Subscription{netflix}, []transaction.Transaction{payment("tx-1", "netflix", "9.99"), payment("tx-2", "netflix", "10.99"), payment("tx-3", "spotify", "9.99")})
+
+		want := map[int][]string{1: {"tx-1", "tx-2"}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v want %v", got, want)
+		}
+	})
+
+	t.Run("matches the subscription with the closest amount", func(t *testing.T) {
+		got := MatchPayments([]Subscription{appleMusic, iCloud}, []transaction.Transaction{payment("tx-1", "apple", "0.79"), payment("tx-2", "apple", "10.99")})
+
+		want := map[int][]string{2: {"tx-2"}, 3: {"tx-1"}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v want %v", got, want)
+		}
+	})
+
+	t.Run("skips refunds and payments that are already matched", func(t *testing.T) {
+		matched := payment("tx-2", "netflix", "9.99")
+		matched.SubscriptionID = 4
+
+		got := MatchPayments([]Subscription{netflix}, []transaction.Transaction{payment("tx-1", "netflix", "-9.99"), matched})
+
+		if len(got) != 0 {
+			t.Errorf("got %v want no matches", got)
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package subscription
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Renewal records a payment date that a subscription has rolled past
+type Renewal struct {
+	SubscriptionID int             `json:"subscriptionId"`
+	DateDue        time.Time       `json:"dateDue"`
+	Amount         decimal.Decimal `json:"amount"`
+}
+
+// renewalHistoryYears is how many years back Rollover records renewals, so a subscription due long ago
+// doesn't fill the renewals table with a payment for every period since
+const renewalHistoryYears = 1
+
+// Rollover returns the next date the subscription is due on or after today,
+// along with a renewal for every due date in the last year that has already passed.
+// Due dates are counted from the subscription's anchor, so a date clamped to the end of a short month doesn't stay clamped.
+func (s Subscription) Rollover(today time.Time) (time.Time, []Renewal) {
+	if s.DateDue.IsZero() || !s.DateDue.Before(today) {
+		return s.DateDue, nil
+	}
+
+	anchor := s.Anchor
+	if anchor.IsZero() || anchor.After(s.DateDue) {
+		anchor = s.DateDue
+	}
+
+	from := s.DateDue
+	if earliest := today.AddDate(-renewalHistoryYears, 0, 0); from.Before(earliest) {
+		from = earliest
+	}
+
+	var renewals []Renewal
+	n := periodsUntil(anchor, s.Frequency, s.Interval, from)
+	dateDue := AddPeriods(anchor, s.Frequency, s.Interval, n)
+	for dateDue.Before(today) {
+		renewals = append(renewals, Renewal{SubscriptionID: s.ID, DateDue: dateDue, Amount: s.Amount})
+		n++
+		dateDue = AddPeriods(anchor, s.Frequency, s.Interval, n)
+	}
+
+	return dateDue, renewals
+}
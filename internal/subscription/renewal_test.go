@@ -0,0 +1,81 @@
+package subscription
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRollover(t *testing.T) {
+	today := date(2020, time.November, 20)
+
+	t.Run("records every missed due date and moves to the next one", func(t *testing.T) {
+		subscription := Subscription{ID: 3, Name: "Spotify", DateDue: date(2020, time.September, 30), Frequency: Monthly}
+
+		dateDue, renewals := subscription.Rollover(today)
+
+		if !dateDue.Equal(date(2020, time.November, 30)) {
+			t.Errorf("got next due date %v want %v", dateDue, date(2020, time.November, 30))
+		}
+
+		want := []time.Time{date(2020, time.September, 30), date(2020, time.October, 30)}
+		if len(renewals) != len(want) {
+			t.Fatalf("got %d renewals want %d", len(renewals), len(want))
+		}
+		for i, renewal := range renewals {
+			if !renewal.DateDue.Equal(want[i]) || renewal.SubscriptionID != 3 {
+				t.Errorf("got renewal %v want subscription 3 due %v", renewal, want[i])
+			}
+		}
+	})
+
+	t.Run("leaves a subscription that is due today alone", func(t *testing.T) {
+		subscription := Subscription{DateDue: today, Frequency: Weekly}
+
+		dateDue, renewals := subscription.Rollover(today)
+
+		if !dateDue.Equal(today) || len(renewals) != 0 {
+			t.Errorf("got %v with %d renewals want %v with none", dateDue, len(renewals), today)
+		}
+	})
+
+	t.Run("goes back to the end of the month after a rollover into February", func(t *testing.T) {
+		subscription := Subscription{DateDue: date(2021, time.January, 31), Frequency: Monthly}
+
+		dateDue, _ := subscription.Rollover(date(2021, time.February, 1))
+		if !dateDue.Equal(date(2021, time.February, 28)) {
+			t.Fatalf("got next due date %v want %v", dateDue, date(2021, time.February, 28))
+		}
+
+		subscription.Anchor = subscription.DateDue
+		subscription.DateDue = dateDue
+		dateDue, renewals := subscription.Rollover(date(2021, time.March, 1))
+
+		if !dateDue.Equal(date(2021, time.March, 31)) {
+			t.Errorf("got next due date %v want %v", dateDue, date(2021, time.March, 31))
+		}
+		if len(renewals) != 1 || !renewals[0].DateDue.Equal(date(2021, time.February, 28)) {
+			t.Errorf("got renewals %v want one due %v", renewals, date(2021, time.February, 28))
+		}
+	})
+
+	t.Run("only records renewals from the last year", func(t *testing.T) {
+		subscription := Subscription{DateDue: date(1, time.January, 11), Frequency: Monthly}
+
+		dateDue, renewals := subscription.Rollover(today)
+
+		if !dateDue.Equal(date(2020, time.December, 11)) {
+			t.Errorf("got next due date %v want %v", dateDue, date(2020, time.December, 11))
+		}
+		if len(renewals) != 12 || !renewals[0].DateDue.Equal(date(2019, time.December, 11)) {
+			t.Errorf("got renewals %v want 12 from %v", renewals, date(2019, time.December, 11))
+		}
+	})
+
+	t.Run("leaves a subscription with no due date alone", func(t *testing.T) {
+		dateDue, renewals := Subscription{Frequency: Monthly}.Rollover(today)
+
+		if !dateDue.IsZero() || len(renewals) != 0 {
+			t.Errorf("got %v with %d renewals want no due date and none", dateDue, len(renewals))
+		}
+	})
+}
@@ -3,7 +3,10 @@ package subscription
 import (
 	"time"
 
+	"github.com/Catzkorn/subscrypt/internal/catalogue"
+	"github.com/Catzkorn/subscrypt/internal/merchant"
 	"github.com/Catzkorn/subscrypt/internal/plaid"
+	"github.com/Catzkorn/subscrypt/internal/transaction"
 
 	"github.com/shopspring/decimal"
 )
@@ -12,66 +15,41 @@ import (
 // Name is the name of the subscription stored as a string.
 // Amount is the cost of the subscription, stored as a decimal.
 // DateDue is the date that the subscription is due on, stored as a date.
+// Anchor is the due date the subscription was given, which later due dates are counted from
+// so a monthly date clamped to a short month goes back to its own day afterwards.
+// Merchant is the canonical name of the merchant, used to tell when two subscriptions are the same.
+// Category is a free text grouping such as Entertainment, defaulted from the merchant catalogue.
+// Frequency is how often the subscription is billed, and Interval is the number
+// of days or months between payments for the custom EveryNDays and EveryNMonths frequencies.
+// Payments are the bank transactions matched to the subscription, most recent first.
+// UserID is the user the subscription belongs to, it is never sent to the browser.
 type Subscription struct {
-	ID      int             `json:"id"`
-	Name    string          `json:"name"`
-	Amount  decimal.Decimal `json:"amount"`
-	DateDue time.Time       `json:"dateDue"`
+	ID        int                       `json:"id"`
+	UserID    int                       `json:"-"`
+	Name      string                    `json:"name"`
+	Merchant  string                    `json:"merchant"`
+	Category  string                    `json:"category"`
+	Amount    decimal.Decimal           `json:"amount"`
+	DateDue   time.Time                 `json:"dateDue"`
+	Anchor    time.Time                 `json:"-"`
+	Frequency Frequency                 `json:"frequency"`
+	Interval  int                       `json:"interval"`
+	Payments  []transaction.Transaction `json:"payments"`
 }
 
-func ProcessTransactions(transactions plaid.TransactionList) []Subscription {
+// now returns the current time, it is a variable so tests can fix the date
+var now = time.Now
 
-	knownSubscriptions := []string{"Netflix", "Touchstone Climbing", "SparkFun", "Tectra Inc", "KFC"}
+// dateLayout is the format of transaction dates
+const dateLayout = "2006-01-02"
 
+// ProcessTransactions returns the subscriptions detected from the transactions
+func ProcessTransactions(transactions plaid.TransactionList, resolver *merchant.Resolver, merchants *catalogue.Catalogue) []Subscription {
 	var subscriptions []Subscription
 
-	for _, transaction := range transactions.Transactions {
-		if subscriptionInSlice(transaction.Name, subscriptions) {
-			continue
-		} else {
-			if stringInSlice(transaction.Name, knownSubscriptions) {
-				amount := decimal.NewFromFloat32(transaction.Amount)
-				subscriptionDate := processDate(transaction.Date)
-				subscription := Subscription{Name: transaction.Name, Amount: amount, DateDue: subscriptionDate}
-				subscriptions = append(subscriptions, subscription)
-			}
-		}
+	for _, candidate := range DetectSubscriptions(transactions, resolver, merchants) {
+		subscriptions = append(subscriptions, candidate.Subscription)
 	}
 
 	return subscriptions
 }
-
-func processDate(date string) time.Time {
-	layout := "2006-01-02"
-	str := date
-	t, _ := time.Parse(layout, str)
-
-	var subscriptionDate time.Time
-
-	if t.Day() <= time.Now().Day() {
-		subscriptionDate = time.Date(time.Now().Year(), time.Now().Month()+1, t.Day(), 0, 0, 0, 0, time.UTC)
-	} else {
-		// next month date
-		subscriptionDate = time.Date(time.Now().Year(), time.Now().Month(), t.Day(), 0, 0, 0, 0, time.UTC)
-	}
-
-	return subscriptionDate
-}
-
-func stringInSlice(a string, list []string) bool {
-	for _, b := range list {
-		if b == a {
-			return true
-		}
-	}
-	return false
-}
-
-func subscriptionInSlice(a string, list []Subscription) bool {
-	for _, b := range list {
-		if b.Name == a {
-			return true
-		}
-	}
-	return false
-}
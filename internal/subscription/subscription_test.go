@@ -1,19 +1,30 @@
 package subscription
 
 import (
-	"github.com/Catzkorn/subscrypt/internal/plaid"
-	"github.com/shopspring/decimal"
 	"reflect"
 	"testing"
 	"time"
+
+	"github.com/Catzkorn/subscrypt/internal/catalogue"
+	"github.com/Catzkorn/subscrypt/internal/plaid"
+	"github.com/shopspring/decimal"
 )
 
+// knownMerchants is the merchant catalogue used by the tests
+var knownMerchants = catalogue.New([]catalogue.Entry{
+	{Merchant: "Netflix", Patterns: []string{"netflix com"}, Category: "Entertainment", Frequency: "monthly"},
+	{Merchant: "KFC", Category: "Food", Frequency: "monthly"},
+	{Merchant: "The Times", Patterns: []string{"times newspapers"}, Category: "News", Frequency: "annually"},
+})
+
 func TestProcessTransactions(t *testing.T) {
+	fixClock(t, time.Date(2020, time.November, 20, 9, 0, 0, 0, time.UTC))
+
 	t.Run("Returns a list of subscriptions after processing a known subscription from the statement of transactions", func(t *testing.T) {
 		transactions := plaid.TransactionList{Transactions: []plaid.Transaction{{Amount: 9.99, Date: "2020-09-12", Name: "Netflix"}}}
 		amount, _ := decimal.NewFromString("9.99")
-		want := []Subscription{{ID: 0, Name: "Netflix", Amount: amount, DateDue: time.Date(2020, time.Now().Month() + 1, 12, 0, 0, 0, 0, time.UTC)}}
-		got := ProcessTransactions(transactions)
+		want := []Subscription{{ID: 0, Name: "Netflix", Merchant: "netflix", Category: "Entertainment", Amount: amount, DateDue: time.Date(2020, time.December, 12, 0, 0, 0, 0, time.UTC), Frequency: Monthly, Interval: 1}}
+		got := ProcessTransactions(transactions, nil, knownMerchants)
 
 		if !reflect.DeepEqual(got, want) {
 			t.Errorf("got %v want %v", got, want)
@@ -24,8 +35,8 @@ func TestProcessTransactions(t *testing.T) {
 	t.Run("Returns only a known subscription from the statement of transactions", func(t *testing.T) {
 		transactions := plaid.TransactionList{Transactions: []plaid.Transaction{{Amount: 9.99, Date: "2020-09-12", Name: "Netflix"}, {Amount: 9.99, Date: "2020-09-12", Name: "Spotify"}}}
 		amount, _ := decimal.NewFromString("9.99")
-		want := []Subscription{{ID: 0, Name: "Netflix", Amount: amount, DateDue: time.Date(2020, time.Now().Month() + 1, 12, 0, 0, 0, 0, time.UTC)}}
-		got := ProcessTransactions(transactions)
+		want := []Subscription{{ID: 0, Name: "Netflix", Merchant: "netflix", Category: "Entertainment", Amount: amount, DateDue: time.Date(2020, time.December, 12, 0, 0, 0, 0, time.UTC), Frequency: Monthly, Interval: 1}}
+		got := ProcessTransactions(transactions, nil, knownMerchants)
 
 		if !reflect.DeepEqual(got, want) {
 			t.Errorf("got %v want %v", got, want)
@@ -36,12 +47,29 @@ func TestProcessTransactions(t *testing.T) {
 	t.Run("Does not allow duplicate transactions", func(t *testing.T) {
 		transactions := plaid.TransactionList{Transactions: []plaid.Transaction{{Amount: 9.99, Date: "2020-09-12", Name: "Netflix"}, {Amount: 9.99, Date: "2020-09-12", Name: "Spotify"}, {Amount: 9.99, Date: "2020-08-12", Name: "Netflix"}}}
 		amount, _ := decimal.NewFromString("9.99")
-		want := []Subscription{{ID: 0, Name: "Netflix", Amount: amount, DateDue: time.Date(2020, time.Now().Month() + 1, 12, 0, 0, 0, 0, time.UTC)}}
-		got := ProcessTransactions(transactions)
+		want := []Subscription{{ID: 0, Name: "Netflix", Merchant: "netflix", Category: "Entertainment", Amount: amount, DateDue: time.Date(2020, time.December, 12, 0, 0, 0, 0, time.UTC), Frequency: Monthly, Interval: 1}}
+		got := ProcessTransactions(transactions, nil, knownMerchants)
 
 		if !reflect.DeepEqual(got, want) {
 			t.Errorf("got %v want %v", got, want)
 		}
 
 	})
-}
\ No newline at end of file
+
+	t.Run("Moves a payment made later in the month to this month", func(t *testing.T) {
+		transactions := plaid.TransactionList{Transactions: []plaid.Transaction{{Amount: 9.99, Date: "2020-10-25", Name: "Netflix"}}}
+		want := time.Date(2020, time.November, 25, 0, 0, 0, 0, time.UTC)
+		got := ProcessTransactions(transactions, nil, knownMerchants)
+
+		if !got[0].DateDue.Equal(want) {
+			t.Errorf("got %v want %v", got[0].DateDue, want)
+		}
+	})
+}
+
+// fixClock sets the time used by the package for the duration of the test
+func fixClock(t *testing.T, fixed time.Time) {
+	t.Helper()
+	now = func() time.Time { return fixed }
+	t.Cleanup(func() { now = time.Now })
+}
@@ -0,0 +1,84 @@
+package transaction
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Catzkorn/subscrypt/internal/plaid"
+
+	"github.com/shopspring/decimal"
+)
+
+// dateLayout is the format of transaction dates
+const dateLayout = "2006-01-02"
+
+// Transaction is a payment imported from a bank. ID is unique per stored transaction.
+// ExternalID is the bank's identifier for the transaction, used to update it rather than store it twice when it is imported again.
+// AccountID is the bank account the payment was made from.
+// Name is the description the bank gave the payment and Merchant is the canonical name of who was paid.
+// Amount follows the bank's sign convention, positive amounts are money paid out of the account.
+// Currency is the ISO 4217 code of the amount, and Pending is true until the payment has settled.
+// SubscriptionID is the subscription the payment was matched to, or 0 if it hasn't been matched.
+type Transaction struct {
+	ID             int             `json:"id"`
+	ExternalID     string          `json:"externalId"`
+	AccountID      string          `json:"accountId"`
+	Name           string          `json:"name"`
+	Merchant       string          `json:"merchant"`
+	Amount         decimal.Decimal `json:"amount"`
+	Currency       string          `json:"currency"`
+	Date           time.Time       `json:"date"`
+	Pending        bool            `json:"pending"`
+	SubscriptionID int             `json:"subscriptionId"`
+}
+
+// FromPlaid converts a transaction returned by Plaid to one that can be stored, paid to the given merchant
+func FromPlaid(t plaid.Transaction, merchant string) (Transaction, error) {
+	date, err := time.Parse(dateLayout, t.Date)
+	if err != nil {
+		return Transaction{}, fmt.Errorf("transaction %q has an invalid date: %w", t.Name, err)
+	}
+
+	return Transaction{
+		ExternalID: ExternalID(t),
+		AccountID:  t.AccountID,
+		Name:       t.Name,
+		Merchant:   merchant,
+		Amount:     decimal.NewFromFloat32(t.Amount),
+		Currency:   t.ISOCurrencyCode,
+		Date:       date,
+		Pending:    t.Pending,
+	}, nil
+}
+
+// ExternalID returns the ID a Plaid transaction is stored with.
+// Transactions without a transaction ID are given one made from their account, date, name and amount.
+func ExternalID(t plaid.Transaction) string {
+	if t.TransactionID != "" {
+		return t.TransactionID
+	}
+	return fmt.Sprintf("%s/%s/%s/%s", t.AccountID, t.Date, t.Name, decimal.NewFromFloat32(t.Amount).StringFixed(2))
+}
+
+// Plaid converts the stored transaction back to the form subscriptions are detected from
+func (t Transaction) Plaid() plaid.Transaction {
+	amount, _ := t.Amount.Float64()
+	return plaid.Transaction{
+		TransactionID:   t.ExternalID,
+		AccountID:       t.AccountID,
+		Amount:          float32(amount),
+		ISOCurrencyCode: t.Currency,
+		Date:            t.Date.Format(dateLayout),
+		Name:            t.Name,
+		Pending:         t.Pending,
+	}
+}
+
+// List converts stored transactions to a list subscriptions can be detected from
+func List(transactions []Transaction) plaid.TransactionList {
+	list := plaid.TransactionList{Transactions: []plaid.Transaction{}}
+	for _, t := range transactions {
+		list.Transactions = append(list.Transactions, t.Plaid())
+	}
+	return list
+}
@@ -0,0 +1,61 @@
+package transaction
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Catzkorn/subscrypt/internal/plaid"
+)
+
+func TestFromPlaid(t *testing.T) {
+	t.Run("converts a plaid transaction", func(t *testing.T) {
+		got, err := FromPlaid(plaid.Transaction{TransactionID: "tx-1", AccountID: "acc-1", Amount: 9.99, ISOCurrencyCode: "GBP", Date: "2020-10-12", Name: "NETFLIX.COM", Pending: true}, "netflix")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if got.ExternalID != "tx-1" || got.AccountID != "acc-1" || got.Merchant != "netflix" || got.Currency != "GBP" || !got.Pending {
+			t.Errorf("got %v want the Netflix transaction", got)
+		}
+		if got.Amount.String() != "9.99" {
+			t.Errorf("got amount %s want 9.99", got.Amount)
+		}
+		if !got.Date.Equal(time.Date(2020, time.October, 12, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("got date %v want 2020-10-12", got.Date)
+		}
+	})
+
+	t.Run("gives the same ID to a transaction without one every time", func(t *testing.T) {
+		transaction := plaid.Transaction{Amount: 9.99, Date: "2020-10-12", Name: "NETFLIX.COM"}
+
+		first, _ := FromPlaid(transaction, "netflix")
+		second, _ := FromPlaid(transaction, "netflix")
+		transaction.Date = "2020-11-12"
+		third, _ := FromPlaid(transaction, "netflix")
+
+		if first.ExternalID == "" || first.ExternalID != second.ExternalID || first.ExternalID == third.ExternalID {
+			t.Errorf("got IDs %q, %q and %q want the first two the same and the third different", first.ExternalID, second.ExternalID, third.ExternalID)
+		}
+	})
+
+	t.Run("rejects an invalid date", func(t *testing.T) {
+		_, err := FromPlaid(plaid.Transaction{Amount: 9.99, Date: "12/10/2020", Name: "NETFLIX.COM"}, "netflix")
+		if err == nil {
+			t.Errorf("expected an error for an invalid date")
+		}
+	})
+}
+
+func TestPlaid(t *testing.T) {
+	want := plaid.Transaction{TransactionID: "tx-1", AccountID: "acc-1", Amount: 9.99, ISOCurrencyCode: "GBP", Date: "2020-10-12", Name: "NETFLIX.COM"}
+
+	stored, err := FromPlaid(want, "netflix")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := stored.Plaid(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+}
@@ -1,7 +1,10 @@
 package userprofile
 
 // Userprofile defines a users details
+// PasswordHash is the bcrypt hash of the user's password, it is never sent to the browser.
 type Userprofile struct {
-	Name  string
-	Email string
+	ID           int
+	Name         string
+	Email        string
+	PasswordHash string `json:"-"`
 }
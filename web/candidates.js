@@ -0,0 +1,99 @@
+function loadCandidates() {
+    _getCandidates(_showCandidates);
+}
+
+function acceptCandidate(id) {
+    let name = document.getElementById(`candidate-name-${id}`).value;
+    let amount = document.getElementById(`candidate-amount-${id}`).value;
+    let dateDue = _formatDateForJSON(document.getElementById(`candidate-date-${id}`).value);
+
+    if (_validateSubscriptionValues(name, amount, dateDue) !== false) {
+        _postCandidateAction(id, "accept", {"name": name, "amount": amount, "dateDue": dateDue});
+    }
+}
+
+function rejectCandidate(id) {
+    _postCandidateAction(id, "reject", null);
+}
+
+function _getCandidates(callback) {
+    let xhttp = new XMLHttpRequest();
+    let path = '/api/candidates';
+    xhttp.onreadystatechange = function () {
+        if (xhttp.readyState === 4 && xhttp.status === 200) {
+            callback(JSON.parse(xhttp.responseText) || []);
+        }
+    };
+    xhttp.open("GET", path, true);
+    xhttp.send();
+}
+
+function _showCandidates(candidates) {
+    let candidatesDiv = document.getElementById("candidates");
+    if (candidates.length === 0) {
+        candidatesDiv.style.display = "none";
+        return;
+    }
+
+    let candidatesHTML = `<h4>Review detected subscriptions</h4>
+                          <p>We found these payments that look like subscriptions. Check the details and add them, or dismiss them if they aren't subscriptions.</p>`;
+    candidatesHTML += _formatCandidatesTable(candidates);
+    document.getElementById("candidates-table").innerHTML = candidatesHTML;
+    candidatesDiv.style.display = "block";
+}
+
+function _formatCandidatesTable(candidates) {
+    let tableHTML = `<table class="table" id="table-candidates">
+                        <thead>
+                            <tr>
+                                <th scope="col">Subscription Name</th>
+                                <th scope="col">Amount</th>
+                                <th scope="col">Next Payment</th>
+                                <th scope="col">Frequency</th>
+                                <th scope="col">Payments Found</th>
+                                <th scope="col">Actions</th>
+                            </tr>
+                        </thead>
+                        <tbody>`;
+
+    candidates.forEach(function (candidate) {
+        tableHTML += _formatCandidate(candidate);
+    });
+
+    tableHTML += "</tbody></table>";
+    return tableHTML;
+}
+
+function _formatCandidate(candidate) {
+    let subscription = candidate.subscription;
+    return `<tr>
+            <td><input type="text" class="form-control" id="candidate-name-${candidate.id}" value="${subscription.name}"></td>
+            <td><input type="text" class="form-control" id="candidate-amount-${candidate.id}" value="${_formatAmountTwoDecimals(subscription.amount)}"></td>
+            <td><input type="date" class="form-control" id="candidate-date-${candidate.id}" value="${subscription.dateDue.substring(0, 10)}"></td>
+            <td>${_formatFrequency(subscription)}</td>
+            <td>${_formatPayments(candidate.transactions)}</td>
+            <td><button type="button" class="btn btn-primary" id="accept-${candidate.id}" onclick="acceptCandidate(${candidate.id})">Add</button>
+            <button type="button" class="btn btn-secondary" id="reject-${candidate.id}" onclick="rejectCandidate(${candidate.id})">Not a subscription</button></td>
+            </tr>`;
+}
+
+function _formatPayments(transactions) {
+    return transactions.map(function (transaction) {
+        return `${transaction.date}: ${_formatAmountTwoDecimals(transaction.amount)}`;
+    }).join("<br>");
+}
+
+function _postCandidateAction(id, action, edits) {
+    let xhttp = new XMLHttpRequest();
+    let url = `/api/candidates/${id}/${action}`;
+    xhttp.open("POST", url, true);
+    setCSRFHeader(xhttp);
+    xhttp.setRequestHeader("Content-type", "application/json");
+    xhttp.onreadystatechange = function () {
+        if (xhttp.readyState === 4 && xhttp.status === 200) {
+            loadCandidates();
+            loadSubscriptions();
+        }
+    };
+    xhttp.send(edits === null ? "" : JSON.stringify(edits));
+}
@@ -17,6 +17,7 @@ function sendReminder(id) {
     }
   };
   xhttp.open("POST", url, true);
+  setCSRFHeader(xhttp);
   xhttp.send(data);
 }
 
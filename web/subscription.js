@@ -1,8 +1,13 @@
 class Subscription {
-    constructor(id, name, amount, dateDue) {
+    constructor(id, name, amount, dateDue, frequency, interval, merchant, category, payments) {
         this.id = id
         this.name = name
         this.amount = amount
         this.dateDue = new Date(dateDue)
+        this.frequency = frequency
+        this.interval = interval
+        this.merchant = merchant
+        this.category = category
+        this.payments = payments || []
     }
 }
\ No newline at end of file
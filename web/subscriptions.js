@@ -2,20 +2,32 @@
 const calendarSvg = `<svg class="w-6 h-6" fill="currentColor" viewBox="0 0 20 20" xmlns="http://www.w3.org/2000/svg"><path fill-rule="evenodd" d="M6 2a1 1 0 00-1 1v1H4a2 2 0 00-2 2v10a2 2 0 002 2h12a2 2 0 002-2V6a2 2 0 00-2-2h-1V3a1 1 0 10-2 0v1H7V3a1 1 0 00-1-1zm0 5a1 1 0 000 2h8a1 1 0 100-2H6z" clip-rule="evenodd"></path></svg>`
 const binSvg = `<svg class="w-6 h-6" fill="currentColor" viewBox="0 0 20 20" xmlns="http://www.w3.org/2000/svg"><path fill-rule="evenodd" d="M9 2a1 1 0 00-.894.553L7.382 4H4a1 1 0 000 2v10a2 2 0 002 2h8a2 2 0 002-2V6a1 1 0 100-2h-3.382l-.724-1.447A1 1 0 0011 2H9zM7 8a1 1 0 012 0v6a1 1 0 11-2 0V8zm5-1a1 1 0 00-1 1v6a1 1 0 102 0V8a1 1 0 00-1-1z" clip-rule="evenodd"></path></svg>`
 
+let merchantCatalogue = [];
+
 function loadSubscriptions() {
-    _getSubscriptions(_showSubscriptions);
+    _getMerchantCatalogue(function () {
+        _getSubscriptions(_showSubscriptions);
+    });
 }
 
 function createSubscription() {
     let name = document.getElementById('subscription-name').value;
     let amount = document.getElementById('subscription-amount').value;
     let dateDue = _formatDateForJSON(document.getElementById('subscription-date').value);
+    let frequency = document.getElementById('subscription-frequency').value;
+    let interval = parseInt(document.getElementById('subscription-interval').value, 10);
 
     if (_validateSubscriptionValues(name, amount, dateDue) !== false) {
-        _postSubscription(name, amount, dateDue);
+        _postSubscription(name, amount, dateDue, frequency, interval);
     }
 }
 
+function toggleIntervalInput() {
+    let frequency = document.getElementById('subscription-frequency').value;
+    let intervalGroup = document.getElementById('subscription-interval-group');
+    intervalGroup.style.display = _isCustomFrequency(frequency) ? "block" : "none";
+}
+
 function deleteSubscription(id) {
     let xhttp = new XMLHttpRequest();
     let url = "/api/subscriptions/" + id;
@@ -25,6 +37,7 @@ function deleteSubscription(id) {
         }
     };
     xhttp.open("DELETE", url, true);
+    setCSRFHeader(xhttp);
     xhttp.send();
 }
 
@@ -41,6 +54,27 @@ function _getSubscriptions(callback) {
     xhttp.send();
 }
 
+function _getMerchantCatalogue(callback) {
+    let xhttp = new XMLHttpRequest();
+    let path = '/api/merchant-catalogue';
+    xhttp.onreadystatechange = function () {
+        if (xhttp.readyState === 4) {
+            if (xhttp.status === 200) {
+                merchantCatalogue = JSON.parse(xhttp.responseText) || [];
+            }
+            callback();
+        }
+    };
+    xhttp.open("GET", path, true);
+    xhttp.send();
+}
+
+function _findCatalogueEntry(merchant) {
+    return merchantCatalogue.find(function (entry) {
+        return entry.merchant === merchant;
+    });
+}
+
 function _showSubscriptions(subscriptions) {
     let subscriptionsHTML = `<h4>Subscriptions</h4>`;
     if (subscriptions.length > 0) {
@@ -61,6 +95,8 @@ function _formatSubscriptionsTable(subscriptions) {
                                 <th scope="col">Amount</th>
                                 <th scope="col">Payment Date</th>
                                 <th scope="col">Frequency</th>
+                                <th scope="col">Category</th>
+                                <th scope="col">Last Charged</th>
                                 <th scope="col">Actions</th>
                             </tr>
                         </thead>
@@ -79,12 +115,66 @@ function _formatSubscription(subscription) {
             <th scope="row">${subscription.name}</th>
             <td>${_formatAmountTwoDecimals(subscription.amount)}</td>
             <td>${_formatDateAsDay(subscription.dateDue)}</td>
-            <td>Monthly</td>
+            <td>${_formatFrequency(subscription)}</td>
+            <td>${_formatCategory(subscription)}</td>
+            <td>${_formatLastCharged(subscription)}</td>
             <td><button type="button" class="icon-button" id="reminder-button" onclick="sendReminder(${subscription.id})">${calendarSvg}</button>
-           <button type="button" class="icon-button" id="delete-${subscription.id}" onclick="deleteSubscription(${subscription.id})">${binSvg}</button></td>
+           <button type="button" class="icon-button" id="delete-${subscription.id}" onclick="deleteSubscription(${subscription.id})">${binSvg}</button>
+           ${_formatCancellationLink(subscription)}</td>
             </tr>`;
 }
 
+function _formatFrequency(subscription) {
+    switch (subscription.frequency) {
+        case "weekly":
+            return "Weekly";
+        case "fortnightly":
+            return "Fortnightly";
+        case "quarterly":
+            return "Quarterly";
+        case "semiannually":
+            return "Every 6 months";
+        case "annually":
+            return "Annually";
+        case "days":
+            return `Every ${subscription.interval} days`;
+        case "months":
+            return `Every ${subscription.interval} months`;
+        default:
+            return "Monthly";
+    }
+}
+
+function _formatCategory(subscription) {
+    if (subscription.category) {
+        return subscription.category;
+    }
+    let entry = _findCatalogueEntry(subscription.merchant);
+    return entry && entry.category ? entry.category : "";
+}
+
+function _formatLastCharged(subscription) {
+    if (subscription.payments.length === 0) {
+        return "";
+    }
+    let payment = subscription.payments[0];
+    let date = new Date(payment.date);
+    let day = date.toLocaleDateString("en-GB", {day: "numeric", month: "short", timeZone: "UTC"});
+    return `£${_formatAmountTwoDecimals(payment.amount)} on ${day}`;
+}
+
+function _formatCancellationLink(subscription) {
+    let entry = _findCatalogueEntry(subscription.merchant);
+    if (!entry || !entry.cancellationUrl) {
+        return "";
+    }
+    return `<a href="${entry.cancellationUrl}" target="_blank" rel="noopener noreferrer" id="cancel-${subscription.id}">Cancel</a>`;
+}
+
+function _isCustomFrequency(frequency) {
+    return frequency === "days" || frequency === "months";
+}
+
 function _formatAmountTwoDecimals(amount) {
     return parseFloat(amount).toFixed(2);
 }
@@ -108,10 +198,11 @@ function _getOrdinal(number) {
     }
 }
 
-function _postSubscription(name, amount, dateDue) {
+function _postSubscription(name, amount, dateDue, frequency, interval) {
     let xhttp = new XMLHttpRequest();
     let url = "/api/subscriptions";
     xhttp.open("POST", url, true);
+    setCSRFHeader(xhttp);
     xhttp.setRequestHeader("Content-type", "application/json");
     xhttp.onreadystatechange = function () {
         if (xhttp.readyState == 4 && xhttp.status == 200) {
@@ -119,7 +210,7 @@ function _postSubscription(name, amount, dateDue) {
             document.getElementById("create-subscription-form").reset();
         }
     };
-    let data = JSON.stringify({"name": name, "amount": amount, "dateDue": dateDue});
+    let data = JSON.stringify({"name": name, "amount": amount, "dateDue": dateDue, "frequency": frequency, "interval": interval});
     xhttp.send(data);
 }
 
@@ -139,7 +230,7 @@ function _convertToSubscriptions(res) {
         return subscriptions;
     } else {
         resSubscriptions.forEach(function (subscription) {
-            let subscriptionObj = new Subscription(subscription.id, subscription.name, subscription.amount, subscription.dateDue);
+            let subscriptionObj = new Subscription(subscription.id, subscription.name, subscription.amount, subscription.dateDue, subscription.frequency, subscription.interval, subscription.merchant, subscription.category, subscription.payments);
             subscriptions.push(subscriptionObj);
         });
         return subscriptions;
@@ -1,7 +1,8 @@
 class Transaction {
-    constructor(name, date, amount) {
+    constructor(name, date, amount, pending) {
         this.name = name
         this.date = date
         this.amount = amount
+        this.pending = pending
     }
 }
\ No newline at end of file
@@ -1,13 +1,81 @@
-function importTransactionsToSubscriptions() {
+function loadSources() {
+    let xhttp = new XMLHttpRequest();
+    xhttp.onreadystatechange = function () {
+        if (xhttp.readyState === 4 && xhttp.status === 200) {
+            _showSources(JSON.parse(xhttp.responseText) || []);
+        }
+    }
+    xhttp.open("GET", "/api/sources", true);
+    xhttp.send();
+}
+
+function _showSources(sources) {
+    let sourcesHTML = "";
+    sources.forEach(function (source) {
+        sourcesHTML += `<div class="row my-1"><div class="col d-flex justify-content-center">
+            <button type="button" class="btn btn-primary" data-dismiss="modal"
+                    onclick="importTransactionsToSubscriptions('${source.name}')">${source.name}</button>
+        </div></div>`;
+    });
+    document.getElementById("transaction-sources").innerHTML = sourcesHTML;
+}
+
+function importTransactionsToSubscriptions(source) {
     showSpinner();
     let xhttp = new XMLHttpRequest();
     let url = "/api/transactions/load-subscriptions"
+    if (source) {
+        url = `/api/sources/${source}/import`
+    }
     xhttp.onreadystatechange = function () {
         if (xhttp.readyState === 4 && xhttp.status === 200) {
-            loadSubscriptions();
+            _showCandidates(JSON.parse(xhttp.responseText) || []);
+            hideSpinner()
+        } else if (xhttp.readyState === 4) {
+            document.getElementById("subscription-error").innerHTML = xhttp.responseText;
             hideSpinner()
         }
     }
     xhttp.open("POST", url, true);
+    setCSRFHeader(xhttp);
     xhttp.send();
-}
\ No newline at end of file
+}
+
+function importStatement() {
+    let file = document.getElementById("statement-file").files[0];
+    if (!file) {
+        document.getElementById("subscription-error").innerHTML = "Choose a statement to import";
+        return;
+    }
+
+    let form = new FormData();
+    form.append("bank", document.getElementById("statement-bank").value);
+    form.append("statement", file);
+
+    showSpinner();
+    let xhttp = new XMLHttpRequest();
+    let url = _statementURL(file.name)
+    xhttp.onreadystatechange = function () {
+        if (xhttp.readyState === 4 && xhttp.status === 200) {
+            _showCandidates(JSON.parse(xhttp.responseText) || []);
+            hideSpinner()
+        } else if (xhttp.readyState === 4) {
+            document.getElementById("subscription-error").innerHTML = xhttp.responseText;
+            hideSpinner()
+        }
+    }
+    xhttp.open("POST", url, true);
+    setCSRFHeader(xhttp);
+    xhttp.send(form);
+}
+
+function _statementURL(fileName) {
+    if (/\.(ofx|qfx)$/i.test(fileName)) {
+        return "/api/statements/ofx";
+    } else if (/\.xml$/i.test(fileName)) {
+        return "/api/statements/camt053";
+    } else if (/\.(sta|940|mt940)$/i.test(fileName)) {
+        return "/api/statements/mt940";
+    }
+    return "/api/statements/csv";
+}
@@ -14,6 +14,9 @@ function _getTransactions(callback) {
             let transactions = _convertToTransactions(xhttp.responseText);
             callback(transactions);
             hideSpinner();
+        } else if (xhttp.readyState === 4) {
+            document.getElementById("transactions").innerHTML = `<h4>Transactions</h4><p>${xhttp.responseText}</p>`;
+            hideSpinner();
         }
     };
     xhttp.open("GET", path, true);
@@ -26,8 +29,8 @@ function _convertToTransactions(res) {
     if (resTransactions === null) {
         return transactions;
     } else {
-        resTransactions.transactions.forEach(function(transaction) {
-            let transactionObj = new Transaction(transaction.name, transaction.date, transaction.amount);
+        resTransactions.forEach(function(transaction) {
+            let transactionObj = new Transaction(transaction.name, transaction.date.substring(0, 10), transaction.amount, transaction.pending);
             transactions.push(transactionObj);
         });
         return transactions;
@@ -39,7 +42,7 @@ function _showTransactions(transactions) {
     if (transactions.length > 0) {
         transactionsHTML += _formatTransactionsTable(transactions);
     } else {
-        transactionsHTML += "<p>You don't have any Transactions</p>";
+        transactionsHTML += "<p>You don't have any Transactions. Load them from your bank account on the home page.</p>";
     }
     document.getElementById("transactions").innerHTML = transactionsHTML;
 }
@@ -65,7 +68,7 @@ function _formatTransactionsTable(transactions) {
 
 function _formatTransaction(transaction) {
     return `<tr>
-            <td>${transaction.name}</td>
+            <td>${transaction.name}${transaction.pending ? ' <span class="text-secondary">(pending)</span>' : ''}</td>
             <td>${transaction.date}</td>
             <td>${_formatAmountTwoDecimals(transaction.amount)}</td>
             </tr>`;
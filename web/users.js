@@ -21,6 +21,8 @@ function _getUser(callback) {
     if (xhttp.readyState === 4 && xhttp.status === 200) {
       let user = JSON.parse(xhttp.responseText);
       callback(user);
+    } else if (xhttp.readyState === 4 && xhttp.status === 401) {
+      callback(null);
     }
   };
   xhttp.open("GET", path, true);
@@ -33,12 +35,37 @@ function _showUser(user) {
   if (user != null) {
     existingUserHTML = _formatUser(user);
     loadSubscriptions();
+    loadCandidates();
+    loadSources();
   } else {
-    newUserHTML = _newUserForm();
+    newUserHTML = _loginForm();
+    document.getElementById("subscriptions-table").innerHTML = "";
+    document.getElementById("candidates-table").innerHTML = "";
   }
   document.getElementById("new-user").innerHTML = newUserHTML;
 
   document.getElementById("existing-user").innerHTML = existingUserHTML;
+  if (user == null) {
+    _loadLoginMethods();
+  }
+}
+
+function _loadLoginMethods() {
+  let xhttp = new XMLHttpRequest();
+  xhttp.onreadystatechange = function() {
+    if (xhttp.readyState === 4 && xhttp.status === 200) {
+      let methods = JSON.parse(xhttp.responseText);
+      if (methods.singleSignOn) {
+        document.getElementById("sso-login").innerHTML =
+          `<a class="btn btn-primary" id="sso-login-button" href="/api/sso/login">Sign in with single sign on</a>`;
+      }
+      if (!methods.password) {
+        document.getElementById("account-form").style.display = "none";
+      }
+    }
+  };
+  xhttp.open("GET", "/api/login", true);
+  xhttp.send();
 }
 
 function _formatUser(user) {
@@ -51,6 +78,7 @@ function _formatUser(user) {
         <label for="email" class="col-form-label col-form-label-md"><span class="icon icon-light">${atSvg}</span></label>
         <input type="email" readonly class="form-control-plaintext form-control-md input-light" id="email" value="${user.Email}">
         ${_formatEditUserButton(user)}
+        <button type="button" class="btn btn-secondary ml-3" id="logout-button" onclick="logout()">Log out</button>
       </div>
     </form>
   `;
@@ -62,28 +90,34 @@ function _formatEditUserButton(user) {
           `</button>`;
 }
 
-function _newUserForm() {
-  let newUserForm = `<div class="card mx-auto justify-content-center" id='new-user-form'>` +
-                      `<div class="card-body">` +
-                        `<h5 class="card-title text-center new-user pb-3">Welcome! Enter your details</h5>` +
-                        `<form class="row" id="user-form">
-                            <div class="form-group row justify-content-center new-user">
-                                <label for="user-name" class="col- col-form-label col-form-label-md ml-4"><span class="icon icon-light">${userSvg}</span></label>
-                                  <div class="col">
-                                      <input type="text" class="form-control form-control-md input-dark" id="user-name" placeholder="Name">
-                                  </div>
-                                 <label for="email" class="col- col-form-label col-form-label-md ml-4"><span class="icon icon-light">${atSvg}</span></label>
+function _loginForm() {
+  let loginForm = `<div class="card mx-auto justify-content-center" id='login-form'>` +
+                    `<div class="card-body">` +
+                      `<h5 class="card-title text-center new-user pb-3">Welcome! Log in or sign up</h5>` +
+                      `<form class="row" id="account-form">
+                          <div class="form-group row justify-content-center new-user">
+                              <label for="user-name" class="col- col-form-label col-form-label-md ml-4"><span class="icon icon-light">${userSvg}</span></label>
                                 <div class="col">
-                                    <input type="email" class="form-control form-control-md input-dark" id="email" placeholder="Email">
+                                    <input type="text" class="form-control form-control-md input-dark" id="user-name" placeholder="Name (to sign up)">
                                 </div>
-                                <div class="col-2">
-                                    <button type="button" class="btn btn-primary mr-5" id="create-user-button" onclick="createUser()">Submit</button>
-                                </div>
-                            </div>
-                        </form>` +
-                      "</div>" +
-                    "</div>"
-  return newUserForm
+                               <label for="email" class="col- col-form-label col-form-label-md ml-4"><span class="icon icon-light">${atSvg}</span></label>
+                              <div class="col">
+                                  <input type="email" class="form-control form-control-md input-dark" id="email" placeholder="Email">
+                              </div>
+                              <div class="col">
+                                  <input type="password" class="form-control form-control-md input-dark" id="password" placeholder="Password">
+                              </div>
+                              <div class="col-3">
+                                  <button type="button" class="btn btn-primary" id="login-button" onclick="login()">Log in</button>
+                                  <button type="button" class="btn btn-secondary" id="signup-button" onclick="signup()">Sign up</button>
+                              </div>
+                          </div>
+                      </form>
+                      <div class="text-center" id="sso-login"></div>
+                      <p class="text-center text-danger" id="user-error"></p>` +
+                    "</div>" +
+                  "</div>"
+  return loginForm
 }
 
 function _formatUserForm() {
@@ -122,6 +156,7 @@ function createUser() {
   let xhttp = new XMLHttpRequest();
   let url = "/api/users";
   xhttp.open("POST", url, true);
+  setCSRFHeader(xhttp);
   xhttp.setRequestHeader("Content-type", "application/json");
   xhttp.onreadystatechange = function() {
     if (xhttp.readyState == 4 && xhttp.status == 200) {
@@ -139,4 +174,53 @@ function validateUserValues(name, email) {
   } else {
     return true;
   }
-}
\ No newline at end of file
+}
+
+function login() {
+  let email = document.getElementById('email').value;
+  let password = document.getElementById('password').value;
+
+  _postAccount("/api/login", { "email": email, "password": password });
+}
+
+function signup() {
+  let name = document.getElementById('user-name').value;
+  let email = document.getElementById('email').value;
+  let password = document.getElementById('password').value;
+
+  if (validateUserValues(name, email) == false) {
+    return;
+  }
+
+  _postAccount("/api/signup", { "name": name, "email": email, "password": password });
+}
+
+function _postAccount(url, details) {
+  let xhttp = new XMLHttpRequest();
+  xhttp.open("POST", url, true);
+  setCSRFHeader(xhttp);
+  xhttp.setRequestHeader("Content-type", "application/json");
+  xhttp.onreadystatechange = function() {
+    if (xhttp.readyState != 4) {
+      return;
+    }
+    if (xhttp.status == 200 || xhttp.status == 201) {
+      loadUser();
+    } else {
+      document.getElementById("user-error").innerHTML = xhttp.responseText;
+    }
+  };
+  xhttp.send(JSON.stringify(details));
+}
+
+function logout() {
+  let xhttp = new XMLHttpRequest();
+  xhttp.open("POST", "/api/logout", true);
+  setCSRFHeader(xhttp);
+  xhttp.onreadystatechange = function() {
+    if (xhttp.readyState == 4 && xhttp.status == 200) {
+      loadUser();
+    }
+  };
+  xhttp.send();
+}
@@ -14,4 +14,11 @@ function showSpinner() {
 function hideSpinner() {
     let spinner = document.getElementById("loading-spinner");
     spinner.style.display = "none";
-}
\ No newline at end of file
+}
+
+function setCSRFHeader(xhttp) {
+    let match = document.cookie.match(/(?:^|;\s*)subscrypt_csrf=([^;]*)/);
+    if (match) {
+        xhttp.setRequestHeader("X-CSRF-Token", match[1]);
+    }
+}